@@ -0,0 +1,53 @@
+// Сервис shorturl с HTTP API и gRPC в одном процессе. Какие серверы запускать, задаёт SERVER_MODE:
+// http, grpc или both. В режиме both без GRPC_ADDRESS оба сервера слушают один порт
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"net/http"
+	_ "net/http/pprof"
+
+	"github.com/wellywell/shorturl/internal/app"
+	"github.com/wellywell/shorturl/internal/config"
+)
+
+var (
+	buildVersion string = "N/A"
+	buildDate    string = "N/A"
+	buildCommit  string = "N/A"
+)
+
+func main() {
+
+	fmt.Printf("Build version: %s\nBuild date: %s\nBuild commit: %s", buildVersion, buildDate, buildCommit)
+
+	conf, err := config.NewConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	a, err := app.New(*conf)
+	if err != nil {
+		panic(err)
+	}
+
+	// pprof c chi роутером ведёт себя странно, запустим отдельно
+	go func() {
+		err := http.ListenAndServe(":8081", nil)
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	if err := a.Run(ctx, conf.ServerMode); err != nil {
+		log.Fatal(err)
+	}
+}
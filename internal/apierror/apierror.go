@@ -0,0 +1,161 @@
+// Package apierror единая модель ошибок API: типизированные коды ошибок, их соответствие HTTP-статусам
+// и кодам gRPC, ответы в формате application/problem+json (RFC 7807) и идентификаторы запросов для корреляции
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+// Code код ошибки, одинаковый для HTTP и gRPC
+type Code string
+
+// Коды ошибок
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeValidation       Code = "validation_failed"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeGone             Code = "gone"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeUnprocessable    Code = "unprocessable"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	CodeRateLimited      Code = "rate_limited"
+	CodeUnavailable      Code = "unavailable"
+	CodeNotImplemented   Code = "not_implemented"
+	CodeInternal         Code = "internal"
+)
+
+var httpStatuses = map[Code]int{
+	CodeBadRequest:       http.StatusBadRequest,
+	CodeValidation:       http.StatusBadRequest,
+	CodeUnauthorized:     http.StatusUnauthorized,
+	CodeForbidden:        http.StatusForbidden,
+	CodeNotFound:         http.StatusNotFound,
+	CodeGone:             http.StatusGone,
+	CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	CodeConflict:         http.StatusConflict,
+	CodeUnprocessable:    http.StatusUnprocessableEntity,
+	CodePayloadTooLarge:  http.StatusRequestEntityTooLarge,
+	CodeRateLimited:      http.StatusTooManyRequests,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+	CodeNotImplemented:   http.StatusNotImplemented,
+	CodeInternal:         http.StatusInternalServerError,
+}
+
+var grpcCodes = map[Code]codes.Code{
+	CodeBadRequest:       codes.InvalidArgument,
+	CodeValidation:       codes.InvalidArgument,
+	CodeUnauthorized:     codes.Unauthenticated,
+	CodeForbidden:        codes.PermissionDenied,
+	CodeNotFound:         codes.NotFound,
+	CodeGone:             codes.NotFound,
+	CodeMethodNotAllowed: codes.Unimplemented,
+	CodeConflict:         codes.AlreadyExists,
+	CodeUnprocessable:    codes.FailedPrecondition,
+	CodePayloadTooLarge:  codes.InvalidArgument,
+	CodeRateLimited:      codes.ResourceExhausted,
+	CodeUnavailable:      codes.Unavailable,
+	CodeNotImplemented:   codes.Unimplemented,
+	CodeInternal:         codes.Internal,
+}
+
+// HTTPStatus HTTP-статус для кода ошибки
+func (c Code) HTTPStatus() int {
+	if status, ok := httpStatuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode код gRPC для кода ошибки
+func (c Code) GRPCCode() codes.Code {
+	if code, ok := grpcCodes[c]; ok {
+		return code
+	}
+	return codes.Internal
+}
+
+// Error ошибка API: код, сообщение для клиента и исходная ошибка, которая клиенту не показывается
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+	// Extensions дополнительные поля ответа problem+json
+	Extensions map[string]any
+}
+
+// New создаёт ошибку API
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Newf создаёт ошибку API с форматированным сообщением
+func Newf(code Code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap создаёт ошибку API, сохраняя исходную ошибку
+func Wrap(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// With добавляет в ответ дополнительное поле
+func (e *Error) With(key string, value any) *Error {
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]any)
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// Error стандартный метод интерфейса error
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Unwrap возвращает исходную ошибку
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// From приводит любую ошибку к ошибке API. Ошибки хранилища получают соответствующие коды,
+// остальные считаются внутренними
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var notFound *storage.KeyNotFoundError
+	var deleted *storage.RecordIsDeleted
+	var disabled *storage.RecordIsDisabled
+	var expired *storage.RecordIsExpired
+	var valueExists *storage.ValueExistsError
+	var keyExists *storage.KeyExistsError
+	switch {
+	case errors.As(err, &notFound):
+		return Wrap(CodeNotFound, "Not found", err)
+	case errors.As(err, &deleted):
+		return Wrap(CodeGone, "Link is deleted", err)
+	case errors.As(err, &disabled):
+		return Wrap(CodeGone, "Link is disabled", err)
+	case errors.As(err, &expired):
+		return Wrap(CodeGone, "Link is expired", err)
+	case errors.As(err, &valueExists):
+		return Wrap(CodeConflict, "Already exists", err)
+	case errors.As(err, &keyExists):
+		return Wrap(CodeConflict, "Already exists", err)
+	}
+	return Wrap(CodeInternal, "Something went wrong", err)
+}
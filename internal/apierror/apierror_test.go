@@ -0,0 +1,122 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		code       Code
+		httpStatus int
+		grpcCode   codes.Code
+	}{
+		{"not found", fmt.Errorf("%w", &storage.KeyNotFoundError{Key: "abc"}), CodeNotFound, http.StatusNotFound, codes.NotFound},
+		{"deleted", fmt.Errorf("%w", &storage.RecordIsDeleted{Key: "abc"}), CodeGone, http.StatusGone, codes.NotFound},
+		{"disabled", fmt.Errorf("%w", &storage.RecordIsDisabled{Key: "abc"}), CodeGone, http.StatusGone, codes.NotFound},
+		{"value exists", fmt.Errorf("%w", &storage.ValueExistsError{Value: "http://a.ru"}), CodeConflict, http.StatusConflict, codes.AlreadyExists},
+		{"api error", fmt.Errorf("wrapped: %w", New(CodeValidation, "bad url")), CodeValidation, http.StatusBadRequest, codes.InvalidArgument},
+		{"unknown", errors.New("connection refused"), CodeInternal, http.StatusInternalServerError, codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := From(tt.err)
+			assert.Equal(t, tt.code, apiErr.Code)
+			assert.Equal(t, tt.httpStatus, apiErr.Code.HTTPStatus())
+			assert.Equal(t, tt.grpcCode, apiErr.Code.GRPCCode())
+		})
+	}
+	// внутренние подробности клиенту не показываются
+	assert.Equal(t, "Something went wrong", From(errors.New("connection refused")).Message)
+}
+
+func TestWrite(t *testing.T) {
+	handler := Correlation{}.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, New(CodeConflict, "URL already shortened").With("result", "http://localhost/abc"))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	r.Header.Set(CorrelationHeader, "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "req-1", w.Header().Get(CorrelationHeader))
+
+	var problem map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, map[string]any{
+		"type":           "urn:shorturl:problem:conflict",
+		"title":          "Conflict",
+		"status":         float64(http.StatusConflict),
+		"detail":         "URL already shortened",
+		"instance":       "/api/shorten",
+		"code":           "conflict",
+		"correlation_id": "req-1",
+		"result":         "http://localhost/abc",
+	}, problem)
+}
+
+func TestCorrelation(t *testing.T) {
+	var got string
+	handler := Correlation{}.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = CorrelationID(r.Context())
+	}))
+
+	for _, fromClient := range []string{"", "bad id", strings.Repeat("a", maxCorrelationIDLength+1)} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(CorrelationHeader, fromClient)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		assert.Len(t, got, 32)
+		assert.NotEqual(t, fromClient, got)
+		assert.Equal(t, got, w.Header().Get(CorrelationHeader))
+	}
+}
+
+func TestStatus(t *testing.T) {
+	ctx := WithCorrelationID(context.Background(), "req-1")
+	err := Status(ctx, fmt.Errorf("%w", &storage.RecordIsDeleted{Key: "abc"}))
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "Link is deleted", st.Message())
+	assert.Equal(t, CodeGone, CodeFromStatus(err))
+	require.Len(t, st.Details(), 1)
+
+	assert.Equal(t, Code(""), CodeFromStatus(status.Error(codes.Internal, "plain")))
+}
+
+func TestFromStatus(t *testing.T) {
+	ctx := WithCorrelationID(context.Background(), "req-1")
+	apiErr, correlationID := FromStatus(Status(ctx, New(CodePayloadTooLarge, "Too many items").With("limit", 10)))
+	assert.Equal(t, CodePayloadTooLarge, apiErr.Code)
+	assert.Equal(t, "Too many items", apiErr.Message)
+	assert.Equal(t, map[string]any{"limit": "10"}, apiErr.Extensions)
+	assert.Equal(t, "req-1", correlationID)
+
+	// без деталей код выводится из статуса gRPC
+	apiErr, correlationID = FromStatus(status.Error(codes.Unauthenticated, "no token"))
+	assert.Equal(t, CodeUnauthorized, apiErr.Code)
+	assert.Empty(t, correlationID)
+
+	apiErr, _ = FromStatus(status.Error(codes.DataLoss, "broken"))
+	assert.Equal(t, CodeInternal, apiErr.Code)
+}
@@ -0,0 +1,63 @@
+package apierror
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// CorrelationHeader заголовок и ключ метаданных gRPC с идентификатором запроса
+const CorrelationHeader = "X-Request-ID"
+
+// maxCorrelationIDLength длиннее идентификатор от клиента не принимается, вместо него выдаётся новый
+const maxCorrelationIDLength = 128
+
+type correlationKey struct{}
+
+// WithCorrelationID сохраняет идентификатор запроса в контексте
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID идентификатор запроса из контекста, пустая строка, если его нет
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// NewCorrelationID принимает идентификатор запроса от клиента, если он допустим, иначе генерирует новый
+func NewCorrelationID(fromClient string) string {
+	if isValidCorrelationID(fromClient) {
+		return fromClient
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isValidCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+	for _, c := range id {
+		// печатные ASCII-символы, чтобы идентификатор можно было безопасно писать в логи и заголовки
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Correlation middleware присваивает запросу идентификатор из заголовка X-Request-ID либо новый
+// и возвращает его в ответе
+type Correlation struct{}
+
+// Handle для использования Correlation в качестве Middleware
+func (Correlation) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := NewCorrelationID(r.Header.Get(CorrelationHeader))
+		w.Header().Set(CorrelationHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithCorrelationID(r.Context(), id)))
+	})
+}
@@ -0,0 +1,95 @@
+package apierror
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain домен ошибок сервиса в деталях ErrorInfo
+const ErrorDomain = "shorturl"
+
+// Status ошибка gRPC для err с тем же кодом, что и в HTTP API. В деталях передаётся ErrorInfo:
+// код ошибки в Reason, идентификатор запроса и дополнительные поля в Metadata
+func Status(ctx context.Context, err error) error {
+	apiErr := From(err)
+	st := status.New(apiErr.Code.GRPCCode(), apiErr.Message)
+
+	metadata := make(map[string]string, len(apiErr.Extensions)+1)
+	for key, value := range apiErr.Extensions {
+		metadata[key] = fmt.Sprint(value)
+	}
+	if id := CorrelationID(ctx); id != "" {
+		metadata["correlation_id"] = id
+	}
+	withDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   string(apiErr.Code),
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// StatusCode ошибка gRPC с кодом code и сообщением message
+func StatusCode(ctx context.Context, code Code, message string) error {
+	return Status(ctx, New(code, message))
+}
+
+// CodeFromStatus код ошибки из деталей ошибки gRPC, пустая строка, если деталей нет
+func CodeFromStatus(err error) Code {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == ErrorDomain {
+			return Code(info.GetReason())
+		}
+	}
+	return ""
+}
+
+// statusCodes коды ошибок для статусов gRPC без деталей ErrorInfo
+var statusCodes = map[codes.Code]Code{
+	codes.InvalidArgument:    CodeBadRequest,
+	codes.Unauthenticated:    CodeUnauthorized,
+	codes.PermissionDenied:   CodeForbidden,
+	codes.NotFound:           CodeNotFound,
+	codes.AlreadyExists:      CodeConflict,
+	codes.FailedPrecondition: CodeUnprocessable,
+	codes.ResourceExhausted:  CodeRateLimited,
+	codes.Unavailable:        CodeUnavailable,
+	codes.DeadlineExceeded:   CodeUnavailable,
+	codes.Unimplemented:      CodeNotImplemented,
+}
+
+// FromStatus ошибка API из ошибки gRPC, обратное преобразование к Status. Код и дополнительные поля
+// берутся из ErrorInfo, а если деталей нет, код выводится из статуса. Вторым значением возвращается
+// идентификатор запроса из деталей. Значения дополнительных полей в ErrorInfo - строки
+func FromStatus(err error) (*Error, string) {
+	st := status.Convert(err)
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.GetDomain() != ErrorDomain {
+			continue
+		}
+		var correlationID string
+		apiErr := New(Code(info.GetReason()), st.Message())
+		for key, value := range info.GetMetadata() {
+			if key == "correlation_id" {
+				correlationID = value
+				continue
+			}
+			apiErr.With(key, value)
+		}
+		return apiErr, correlationID
+	}
+
+	code, ok := statusCodes[st.Code()]
+	if !ok {
+		code = CodeInternal
+	}
+	return New(code, st.Message()), ""
+}
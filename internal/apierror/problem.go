@@ -0,0 +1,49 @@
+package apierror
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+)
+
+// ProblemContentType тип содержимого ответа с ошибкой
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix префикс URI типа ошибки, к нему добавляется код
+const problemTypePrefix = "urn:shorturl:problem:"
+
+// Write отвечает на ошибку в формате application/problem+json (RFC 7807).
+// Кроме стандартных полей, в ответе есть код ошибки и идентификатор запроса
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := From(err)
+	status := apiErr.Code.HTTPStatus()
+
+	problem := make(map[string]any, len(apiErr.Extensions)+7)
+	maps.Copy(problem, apiErr.Extensions)
+	problem["type"] = problemTypePrefix + string(apiErr.Code)
+	problem["title"] = http.StatusText(status)
+	problem["status"] = status
+	problem["detail"] = apiErr.Message
+	problem["code"] = apiErr.Code
+	if r != nil {
+		problem["instance"] = r.URL.Path
+		if id := CorrelationID(r.Context()); id != "" {
+			problem["correlation_id"] = id
+		}
+	}
+
+	body, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		http.Error(w, apiErr.Message, status)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// WriteCode отвечает на ошибку с кодом code и сообщением message
+func WriteCode(w http.ResponseWriter, r *http.Request, code Code, message string) {
+	Write(w, r, New(code, message))
+}
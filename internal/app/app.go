@@ -0,0 +1,215 @@
+// Package app сервис shorturl целиком: общее хранилище, очередь удаления и серверы HTTP и gRPC,
+// которые запускаются по отдельности, на разных портах или на одном порту
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/config"
+	commonhandlers "github.com/wellywell/shorturl/internal/handlers"
+	"github.com/wellywell/shorturl/internal/handlers/grpc/handlers"
+	"github.com/wellywell/shorturl/internal/lifecycle"
+	"github.com/wellywell/shorturl/internal/logging"
+	"github.com/wellywell/shorturl/internal/ratelimit"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+// Storage - интерфейс хранилища для ссылок
+// В роли хранилища может выступать база данных, структура в памяти, и структура памяти с записью в файл
+type Storage interface {
+	// Put метод для записи длинной ссылки в хранилище по ключу
+	Put(ctx context.Context, key string, val string, user int) error
+	PutLink(ctx context.Context, key string, val string, user int, expiresAt *time.Time) error
+	// Get достаёт запись по ключу
+	Get(ctx context.Context, key string) (string, error)
+	// PutBatch позволяет сохранять несколько записей за раз
+	PutBatch(ctx context.Context, records ...storage.URLRecord) error
+	// CreateNewUser создаёт нового пользователя и возвращает его id
+	CreateNewUser(ctx context.Context) (int, error)
+	// GetUserURLS возвращает список ссылок для данного пользователя
+	GetUserURLS(ctx context.Context, userID int) ([]storage.URLRecord, error)
+	// GetUserURLSPage возвращает страницу ссылок пользователя с ключами больше after
+	GetUserURLSPage(ctx context.Context, userID int, after string, limit int) ([]storage.URLRecord, error)
+	// DeleteBatch удаляет набор переданных ему ссылок
+	DeleteBatch(ctx context.Context, records ...storage.ToDelete) ([]storage.DeleteResult, error)
+	// Close корректно завершает работу хранилища
+	Close() error
+	// CountURLs количество сохраненных записей
+	CountURLs(ctx context.Context) (int, error)
+	// CountUsers количество сохраненных пользователей
+	CountUsers(ctx context.Context) (int, error)
+	// CreateAPIKey сохраняет новый API-ключ пользователя
+	CreateAPIKey(ctx context.Context, key storage.APIKey) (storage.APIKey, error)
+	// GetAPIKey ищет API-ключ по его хэшу
+	GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error)
+	// GetUserAPIKeys возвращает ключи пользователя
+	GetUserAPIKeys(ctx context.Context, userID int) ([]storage.APIKey, error)
+	// RevokeAPIKey отзывает ключ пользователя
+	RevokeAPIKey(ctx context.Context, userID int, keyID int) error
+	// TouchAPIKey обновляет время последнего использования ключа
+	TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error
+	// GetOrCreateUserByIdentity возвращает пользователя, привязанного к учётной записи OIDC провайдера
+	GetOrCreateUserByIdentity(ctx context.Context, issuer string, subject string) (int, error)
+	// GetUserLinks возвращает ссылки пользователя со всеми атрибутами
+	GetUserLinks(ctx context.Context, userID int) ([]storage.LinkInfo, error)
+	// UpdateLink изменяет ссылку пользователя
+	UpdateLink(ctx context.Context, key string, userID int, update storage.LinkUpdate) (storage.LinkInfo, error)
+	// методы для API администратора: пользователи, ссылки и журнал аудита
+	commonhandlers.AdminStorage
+	// ключи идемпотентности запросов на сокращение
+	commonhandlers.IdempotencyStorage
+	// задания на удаление ссылок
+	tasks.Storage
+	// журнал запусков фоновых задач
+	tasks.RunStorage
+	// Ping проверяет, что хранилище доступно
+	Ping(ctx context.Context) error
+	// PurgeDeleteJobs удаляет задания на удаление, завершённые раньше finishedBefore
+	PurgeDeleteJobs(ctx context.Context, finishedBefore time.Time) (int, error)
+	// PurgeIdempotencyKeys удаляет ключи идемпотентности, созданные раньше expiredBefore
+	PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error)
+	// PurgeDeletedLinks окончательно стирает ссылки, удалённые раньше deletedBefore
+	PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time, tombstones bool) (int, error)
+	// PurgeExpiredLinks окончательно стирает ссылки, срок действия которых истёк раньше expiredBefore
+	PurgeExpiredLinks(ctx context.Context, expiredBefore time.Time, tombstones bool) (int, error)
+}
+
+// App общие для всех серверов хранилище, очередь удаления и ограничитель частоты запросов, и запущенные серверы
+type App struct {
+	config      config.ServerConfig
+	logger      *zap.SugaredLogger
+	store       Storage
+	deleteQueue *tasks.DeleteQueue
+	limiter     *ratelimit.Limiter
+
+	workerDone chan struct{}
+	stopWorker context.CancelFunc
+
+	scheduler       *tasks.Scheduler
+	schedulerDone   chan struct{}
+	cancelScheduler context.CancelFunc
+	lifecycle       *lifecycle.Manager
+
+	httpServers []*http.Server
+	grpcServers []grpcServer
+	// health состояние сервиса для grpc.health.v1, nil - если сервис выключен
+	health *handlers.HealthChecker
+}
+
+// grpcServer gRPC-сервер, который останавливается на шаге grpc
+type grpcServer interface {
+	GracefulStop()
+	Stop()
+}
+
+// NewStorage выбирает хранилище по конфигурации: база данных, файл или память
+func NewStorage(conf config.ServerConfig) (Storage, error) {
+	if conf.DatabaseDSN != "" {
+		return storage.NewDatabase(conf.DatabaseDSN)
+	}
+	if conf.FileStoragePath != "" {
+		return storage.NewFileMemory(conf.FileStoragePath, storage.NewMemory())
+	}
+	return storage.NewMemory(), nil
+}
+
+// New настраивает авторизацию, открывает хранилище и запускает обработчик очереди удаления и планировщик
+func New(conf config.ServerConfig) (*App, error) {
+	logger, err := logging.New()
+	if err != nil {
+		return nil, err
+	}
+	auth.SetLogger(logger)
+	if err := auth.Setup(conf); err != nil {
+		return nil, err
+	}
+
+	store, err := NewStorage(conf)
+	if err != nil {
+		return nil, err
+	}
+	auth.SetKeyStore(store)
+	auth.SetUserStore(store)
+
+	adminIDs, err := commonhandlers.ParseUserIDs(conf.AdminUsers)
+	if err != nil {
+		return nil, closeWith(store, err)
+	}
+	err = commonhandlers.NewAdmin(store).GrantAdmins(context.Background(), adminIDs)
+	if err != nil {
+		return nil, closeWith(store, err)
+	}
+
+	var sharedLimits ratelimit.Store
+	if db, ok := store.(*storage.Database); ok {
+		sharedLimits = db
+	}
+	limiter, err := ratelimit.NewFromConfig(conf, sharedLimits)
+	if err != nil {
+		return nil, closeWith(store, err)
+	}
+	limiter.SetLogger(logger)
+
+	a := &App{
+		config:        conf,
+		logger:        logger,
+		store:         store,
+		workerDone:    make(chan struct{}),
+		schedulerDone: make(chan struct{}),
+		limiter:       limiter,
+	}
+	a.scheduler, err = a.newScheduler()
+	if err != nil {
+		return nil, closeWith(store, err)
+	}
+	a.scheduler.SetLogger(logger)
+	a.lifecycle, err = a.newLifecycle()
+	if err != nil {
+		return nil, closeWith(store, err)
+	}
+	a.lifecycle.SetLogger(logger)
+
+	a.deleteQueue = tasks.NewDeleteQueue(store, tasks.DeleteQueueConfig{
+		BatchConfig: tasks.BatchConfig{
+			BatchSize:    conf.DeleteBatchSize,
+			MaxLatency:   time.Duration(conf.DeleteMaxLatency),
+			Workers:      conf.DeleteWorkers,
+			Retries:      conf.DeleteRetries,
+			RetryBackoff: time.Duration(conf.DeleteRetryBackoff),
+		},
+		PollInterval: time.Duration(conf.DeletePollInterval),
+		Lease:        time.Duration(conf.DeleteJobLease),
+		MaxAttempts:  conf.DeleteMaxAttempts,
+	})
+	a.deleteQueue.SetLogger(logger)
+	a.deleteQueue.Worker().Publish("delete_queue")
+	var workerCtx context.Context
+	workerCtx, a.stopWorker = context.WithCancel(context.Background())
+	go func() {
+		a.deleteQueue.Run(workerCtx)
+		close(a.workerDone)
+	}()
+
+	var schedulerCtx context.Context
+	schedulerCtx, a.cancelScheduler = context.WithCancel(context.Background())
+	go func() {
+		a.scheduler.Run(schedulerCtx)
+		close(a.schedulerDone)
+	}()
+	return a, nil
+}
+
+// closeWith закрывает хранилище после ошибки запуска и возвращает эту ошибку
+func closeWith(store Storage, err error) error {
+	if closeErr := store.Close(); closeErr != nil {
+		fmt.Println(closeErr)
+	}
+	return err
+}
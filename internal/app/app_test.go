@@ -0,0 +1,373 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/wellywell/shorturl/internal/config"
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+// freeAddress свободный адрес на localhost
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestRunBothOnOnePort(t *testing.T) {
+	address := freeAddress(t)
+	a, err := New(config.ServerConfig{
+		BaseAddress:      address,
+		ShortURLsAddress: "http://" + address,
+		JWTAlgorithm:     "HS256",
+		JWTSecret:        "secret",
+		RateLimitStore:   "memory",
+		CSRFMode:         "off",
+		MaxBodySize:      1 << 20,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx, ModeBoth)
+	}()
+
+	// HTTP API и gRPC отвечают на одном порту
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + address + "/api/openapi.json")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 50*time.Millisecond)
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewShortURLServiceClient(conn)
+	resp, err := client.ShortenURL(context.Background(), &pb.ShortenURLRequest{Url: "https://example.com/app"})
+	require.NoError(t, err)
+	assert.True(t, resp.GetIsCreated())
+
+	// ссылка, созданная через gRPC, доступна через HTTP: хранилище общее
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	redirect, err := noRedirect.Get(resp.GetResult())
+	require.NoError(t, err)
+	redirect.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, redirect.StatusCode)
+	assert.Equal(t, "https://example.com/app", redirect.Header.Get("Location"))
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
+
+func TestMultiplexedGRPCGracefulStop(t *testing.T) {
+	m := &multiplexedGRPC{server: grpc.NewServer()}
+	// начатый вызов, например поток ListUserURLs
+	m.calls.Add(1)
+
+	stopped := make(chan struct{})
+	go func() {
+		m.GracefulStop()
+		close(stopped)
+	}()
+
+	// новые вызовы отклоняются сразу, не дожидаясь начатых
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		return w.Code == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+
+	select {
+	case <-stopped:
+		t.Fatal("GracefulStop did not wait for the open call")
+	default:
+	}
+	m.calls.Done()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("GracefulStop did not return")
+	}
+}
+
+func TestRunUnknownMode(t *testing.T) {
+	a, err := New(config.ServerConfig{JWTAlgorithm: "HS256", JWTSecret: "secret", RateLimitStore: "memory"})
+	require.NoError(t, err)
+	assert.Error(t, a.Run(context.Background(), "ftp"))
+}
+
+func TestRunGRPCServices(t *testing.T) {
+	address := freeAddress(t)
+	a, err := New(config.ServerConfig{
+		BaseAddress:        address,
+		JWTAlgorithm:       "HS256",
+		JWTSecret:          "secret",
+		RateLimitStore:     "memory",
+		MaxBodySize:        1 << 20,
+		GRPCServices:       GRPCServiceHealth + "," + GRPCServiceReflection,
+		GRPCHealthInterval: config.Duration(time.Second),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx, ModeGRPC)
+	}()
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// health отвечает по состоянию хранилища
+	health := healthpb.NewHealthClient(conn)
+	require.Eventually(t, func() bool {
+		resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: pb.ShortURLService_ServiceDesc.ServiceName})
+		return err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// reflection перечисляет сервисы для grpcurl
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	var services []string
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		services = append(services, service.Name)
+	}
+	assert.Contains(t, services, pb.ShortURLService_ServiceDesc.ServiceName)
+	assert.Contains(t, services, healthpb.Health_ServiceDesc.ServiceName)
+	require.NoError(t, stream.CloseSend())
+
+	// channelz не включён
+	_, err = channelzpb.NewChannelzClient(conn).GetTopChannels(context.Background(), &channelzpb.GetTopChannelsRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
+
+func TestGRPCServicesValidated(t *testing.T) {
+	a, err := New(config.ServerConfig{JWTAlgorithm: "HS256", JWTSecret: "secret", RateLimitStore: "memory",
+		BaseAddress: freeAddress(t), GRPCServices: "health,metrics"})
+	require.NoError(t, err)
+	assert.ErrorContains(t, a.Run(context.Background(), ModeGRPC), "metrics")
+}
+
+func TestParseTrustedGRPCMethods(t *testing.T) {
+	methods, err := parseTrustedGRPCMethods(pb.ShortURLService_GetStats_FullMethodName + ", /" + channelzpb.Channelz_ServiceDesc.ServiceName + "/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{pb.ShortURLService_GetStats_FullMethodName, "/grpc.channelz.v1.Channelz/"}, methods)
+
+	methods, err = parseTrustedGRPCMethods(GRPCServiceNone)
+	require.NoError(t, err)
+	assert.Empty(t, methods)
+
+	for _, bad := range []string{"GetStats", "/", "//GetStats", "/handlers.grcp.ShortURLService", "/a/b/c"} {
+		_, err = parseTrustedGRPCMethods(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestShutdownDrainsDeleteQueue(t *testing.T) {
+	a, err := New(config.ServerConfig{JWTAlgorithm: "HS256", JWTSecret: "secret", RateLimitStore: "memory"})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	userID, err := a.store.CreateNewUser(ctx)
+	require.NoError(t, err)
+	require.NoError(t, a.store.Put(ctx, "abc", "https://example.com", userID))
+
+	job, err := a.deleteQueue.Enqueue(ctx, userID, "abc")
+	require.NoError(t, err)
+	// задание забрано обработчиком: остановка должна дождаться его выполнения
+	require.Eventually(t, func() bool {
+		job, err = a.store.GetDeleteJob(ctx, userID, job.ID)
+		return err == nil && job.Status != storage.DeleteJobPending
+	}, time.Second, time.Millisecond)
+	require.NoError(t, a.lifecycle.Shutdown())
+
+	link, err := a.store.GetLink(ctx, "abc")
+	require.NoError(t, err)
+	assert.True(t, link.IsDeleted)
+	job, err = a.store.GetDeleteJob(ctx, userID, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.DeleteJobDone, job.Status)
+}
+
+func TestDeleteJobsSurviveRestart(t *testing.T) {
+	conf := config.ServerConfig{JWTAlgorithm: "HS256", JWTSecret: "secret", RateLimitStore: "memory",
+		FileStoragePath: filepath.Join(t.TempDir(), "db.json")}
+	ctx := context.Background()
+
+	// задание сохранено, но процесс остановлен раньше, чем обработчик его забрал
+	a, err := New(conf)
+	require.NoError(t, err)
+	a.stopWorker()
+	<-a.workerDone
+	userID, err := a.store.CreateNewUser(ctx)
+	require.NoError(t, err)
+	require.NoError(t, a.store.Put(ctx, "abc", "https://example.com", userID))
+	job, err := a.store.AddDeleteJob(ctx, storage.DeleteJob{UserID: userID, ShortURLs: []string{"abc"}})
+	require.NoError(t, err)
+	require.NoError(t, a.store.Close())
+
+	a, err = New(conf)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, a.lifecycle.Shutdown()) }()
+	assert.Eventually(t, func() bool {
+		job, err = a.store.GetDeleteJob(ctx, userID, job.ID)
+		return err == nil && job.Status == storage.DeleteJobDone
+	}, 5*time.Second, 10*time.Millisecond)
+
+	link, err := a.store.GetLink(ctx, "abc")
+	require.NoError(t, err)
+	assert.True(t, link.IsDeleted)
+}
+
+func TestAdminUsersGranted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	ctx := context.Background()
+	st, err := storage.NewFileMemory(path, storage.NewMemory())
+	require.NoError(t, err)
+	userID, err := st.CreateNewUser(ctx)
+	require.NoError(t, err)
+	require.NoError(t, st.Put(ctx, "abc", "https://example.com", userID))
+	require.NoError(t, st.Close())
+
+	conf := config.ServerConfig{JWTAlgorithm: "HS256", JWTSecret: "secret", RateLimitStore: "memory", FileStoragePath: path}
+
+	// неверный список и неизвестный пользователь не дают запустить сервис без администраторов
+	conf.AdminUsers = "admin"
+	_, err = New(conf)
+	assert.Error(t, err)
+	conf.AdminUsers = strconv.Itoa(userID + 1)
+	_, err = New(conf)
+	assert.Error(t, err)
+
+	conf.AdminUsers = strconv.Itoa(userID)
+	a, err := New(conf)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, a.lifecycle.Shutdown()) }()
+	user, err := a.store.GetUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.RoleAdmin, user.Role)
+}
+
+func TestShutdownOrderValidated(t *testing.T) {
+	_, err := New(config.ServerConfig{JWTAlgorithm: "HS256", JWTSecret: "secret", RateLimitStore: "memory",
+		ShutdownOrder: StageStorage + "," + StageHTTP})
+	assert.Error(t, err)
+}
+
+func TestJobIntervalsValidated(t *testing.T) {
+	conf := config.ServerConfig{JWTAlgorithm: "HS256", JWTSecret: "secret", RateLimitStore: "memory",
+		FileStoragePath: filepath.Join(t.TempDir(), "db.json")}
+
+	conf.JobIntervals = "unknown=1h"
+	_, err := New(conf)
+	assert.Error(t, err)
+
+	conf.JobIntervals = JobCompact + "=10m"
+	a, err := New(conf)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, a.lifecycle.Shutdown()) }()
+	require.Len(t, a.scheduler.Jobs(), 1)
+	assert.Equal(t, 10*time.Minute, a.scheduler.Jobs()[0].Interval)
+}
+
+func TestPurgeJob(t *testing.T) {
+	conf := config.ServerConfig{JWTAlgorithm: "HS256", JWTSecret: "secret", RateLimitStore: "memory",
+		LinkRetention: config.Duration(time.Millisecond), LinkTombstones: true}
+	ctx := context.Background()
+
+	a, err := New(conf)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, a.lifecycle.Shutdown()) }()
+
+	var purge, expired tasks.ScheduledJob
+	for _, job := range a.scheduler.Jobs() {
+		switch job.Name {
+		case JobPurge:
+			purge = job
+		case JobExpired:
+			expired = job
+		}
+	}
+	require.Equal(t, JobPurge, purge.Name)
+	require.Equal(t, JobExpired, expired.Name)
+
+	userID, err := a.store.CreateNewUser(ctx)
+	require.NoError(t, err)
+	require.NoError(t, a.store.Put(ctx, "abc", "https://example.com", userID))
+	_, err = a.store.DeleteBatch(ctx, storage.ToDelete{ShortURL: "abc", UserID: userID})
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	core, logs := observer.New(zap.InfoLevel)
+	a.logger = zap.New(core).Sugar()
+	require.True(t, a.scheduler.RunJob(ctx, purge))
+	entries := logs.FilterMessage("purged deleted links").All()
+	require.Len(t, entries, 1)
+	assert.EqualValues(t, 1, entries[0].ContextMap()["count"])
+	_, err = a.store.GetLink(ctx, "abc")
+	var notFound *storage.KeyNotFoundError
+	assert.ErrorAs(t, err, &notFound)
+	var exists *storage.KeyExistsError
+	assert.ErrorAs(t, a.store.Put(ctx, "abc", "https://example.org", userID), &exists)
+
+	// истёкшая ссылка стирается отдельной задачей, действующая остаётся
+	past, future := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	require.NoError(t, a.store.Put(ctx, "old", "https://old.example.com", userID))
+	_, err = a.store.UpdateLink(ctx, "old", userID, storage.LinkUpdate{ExpiresAt: &past})
+	require.NoError(t, err)
+	require.NoError(t, a.store.Put(ctx, "new", "https://new.example.com", userID))
+	_, err = a.store.UpdateLink(ctx, "new", userID, storage.LinkUpdate{ExpiresAt: &future})
+	require.NoError(t, err)
+
+	require.True(t, a.scheduler.RunJob(ctx, expired))
+	assert.Len(t, logs.FilterMessage("purged expired links").All(), 1)
+	_, err = a.store.GetLink(ctx, "old")
+	assert.ErrorAs(t, err, &notFound)
+	_, err = a.store.GetLink(ctx, "new")
+	assert.NoError(t, err)
+}
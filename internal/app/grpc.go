@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/clientip"
+	"github.com/wellywell/shorturl/internal/gateway"
+	commonhandlers "github.com/wellywell/shorturl/internal/handlers"
+	"github.com/wellywell/shorturl/internal/handlers/grpc/handlers"
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/ratelimit"
+)
+
+// Служебные сервисы gRPC-сервера, которые включаются в конфигурации
+const (
+	GRPCServiceHealth     = "health"
+	GRPCServiceReflection = "reflection"
+	GRPCServiceChannelz   = "channelz"
+	// GRPCServiceNone выключает все служебные сервисы
+	GRPCServiceNone = "none"
+)
+
+// parseGRPCServices разбирает список служебных сервисов через запятую
+func parseGRPCServices(value string) (map[string]bool, error) {
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "", GRPCServiceNone:
+		case GRPCServiceHealth, GRPCServiceReflection, GRPCServiceChannelz:
+			enabled[name] = true
+		default:
+			return nil, fmt.Errorf("unknown grpc service %q", name)
+		}
+	}
+	return enabled, nil
+}
+
+// parseTrustedGRPCMethods разбирает список методов, доступных только из доверенных подсетей
+func parseTrustedGRPCMethods(value string) ([]string, error) {
+	var methods []string
+	for _, method := range strings.Split(value, ",") {
+		method = strings.TrimSpace(method)
+		if method == "" || method == GRPCServiceNone {
+			continue
+		}
+		service, _, found := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+		if !strings.HasPrefix(method, "/") || !found || service == "" || strings.Count(method, "/") != 2 {
+			return nil, fmt.Errorf("bad trusted grpc method %q", method)
+		}
+		methods = append(methods, method)
+	}
+	return methods, nil
+}
+
+// grpcServices перехватчики и сервисы gRPC, из которых собираются основной сервер и сервер для шлюза
+type grpcServices struct {
+	interceptors []grpc.UnaryServerInterceptor
+	streams      []grpc.StreamServerInterceptor
+	urls         *handlers.ShorturlServer
+	admin        *handlers.AdminServer
+	maxMsgSize   int
+
+	// служебные сервисы: health равен nil, если выключен
+	health     *handlers.HealthChecker
+	reflection bool
+	channelz   bool
+}
+
+func (a *App) newGRPCServices() (*grpcServices, error) {
+	enabled, err := parseGRPCServices(a.config.GRPCServices)
+	if err != nil {
+		return nil, err
+	}
+	if enabled[GRPCServiceHealth] && a.config.GRPCHealthInterval <= 0 {
+		return nil, errors.New("grpc health interval must be positive")
+	}
+
+	urls := handlers.NewShorturlServer(a.store, a.deleteQueue, a.config)
+	urls.SetRateLimiter(a.limiter)
+
+	// по умолчанию статистика, API администратора и channelz доступны только из доверенных подсетей
+	trustedMethods, err := parseTrustedGRPCMethods(a.config.TrustedGRPCMethods)
+	if err != nil {
+		return nil, err
+	}
+	subnet, err := handlers.NewSubnetInterceptor(a.config.Trusted, a.config.TrustedProxies, trustedMethods...)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := auth.ParseCertIdentities(a.config.TLSClientIdentities)
+	if err != nil {
+		return nil, err
+	}
+	clientCert := handlers.ClientCertInterceptor{Identities: identities}
+	rateLimit, err := handlers.NewRateLimitInterceptor(a.limiter, a.config.TrustedProxies, map[string]string{
+		pb.ShortURLService_ShortenURL_FullMethodName:    ratelimit.BucketShorten,
+		pb.ShortURLService_ShortenBatch_FullMethodName:  ratelimit.BucketShorten,
+		pb.ShortURLService_ShortenStream_FullMethodName: ratelimit.BucketShorten,
+		pb.ShortURLService_GetFullURL_FullMethodName:    ratelimit.BucketRedirect,
+	})
+	if err != nil {
+		return nil, err
+	}
+	idempotency := handlers.NewIdempotencyInterceptor(commonhandlers.NewIdempotency(a.store, time.Duration(a.config.IdempotencyTTL)),
+		map[string]func() proto.Message{
+			pb.ShortURLService_ShortenURL_FullMethodName:   func() proto.Message { return &pb.ShortenURLResponse{} },
+			pb.ShortURLService_ShortenBatch_FullMethodName: func() proto.Message { return &pb.ShortenBatchResponse{} },
+		})
+	idempotency.SetLogger(a.logger)
+
+	if enabled[GRPCServiceHealth] && a.health == nil {
+		a.health = handlers.NewHealthChecker(a.store, time.Duration(a.config.GRPCHealthInterval))
+		a.health.SetLogger(a.logger)
+	}
+
+	return &grpcServices{
+		interceptors: []grpc.UnaryServerInterceptor{
+			handlers.CorrelationInterceptor{}.Unary, clientCert.Unary, subnet.Unary, rateLimit.Unary, idempotency.Unary,
+		},
+		// потоковые вызовы не повторяются по ключу идемпотентности
+		streams: []grpc.StreamServerInterceptor{
+			handlers.CorrelationInterceptor{}.Stream, clientCert.Stream, subnet.Stream, rateLimit.Stream,
+		},
+		urls:       urls,
+		admin:      handlers.NewAdminServer(a.store, a.config),
+		maxMsgSize: int(a.config.MaxBodySize),
+		health:     a.health,
+		reflection: enabled[GRPCServiceReflection],
+		channelz:   enabled[GRPCServiceChannelz],
+	}, nil
+}
+
+// newServer создаёт gRPC-сервер с сервисами. Если tlsConfig не nil, сервер сам принимает TLS-соединения,
+// extra - перехватчики, которые выполняются перед общими
+func (s *grpcServices) newServer(tlsConfig *tls.Config, extra ...grpc.UnaryServerInterceptor) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(append(extra, s.interceptors...)...),
+		grpc.ChainStreamInterceptor(s.streams...),
+		grpc.MaxRecvMsgSize(s.maxMsgSize),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterShortURLServiceServer(srv, s.urls)
+	pb.RegisterAdminServiceServer(srv, s.admin)
+	if s.health != nil {
+		s.health.Register(srv)
+	}
+	if s.reflection {
+		reflection.Register(srv)
+	}
+	if s.channelz {
+		channelz.RegisterChannelzServiceToServer(srv)
+	}
+	return srv
+}
+
+// newGateway создаёт JSON/HTTP фасад ShortURLService. Шлюз вызывает копию сервера без TLS
+// на соединении в памяти, с теми же перехватчиками
+func (a *App) newGateway(ctx context.Context, services *grpcServices) (http.Handler, error) {
+	server := services.newServer(nil, gateway.PeerInterceptor{}.Unary)
+	a.grpcServers = append(a.grpcServers, server)
+	conn, err := gateway.Dial(server)
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := clientip.NewResolver(a.config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return gateway.NewHandler(ctx, conn, resolver)
+}
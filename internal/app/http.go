@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/clientip"
+	"github.com/wellywell/shorturl/internal/compress"
+	commonhandlers "github.com/wellywell/shorturl/internal/handlers"
+	"github.com/wellywell/shorturl/internal/handlers/http/handlers"
+	"github.com/wellywell/shorturl/internal/logging"
+	"github.com/wellywell/shorturl/internal/oidc"
+	"github.com/wellywell/shorturl/internal/router"
+)
+
+// newHTTPHandler собирает HTTP API со всеми middleware
+func (a *App) newHTTPHandler(ctx context.Context) (http.Handler, error) {
+	logger := logging.NewMiddleware(a.logger)
+	if _, err := clientip.ParsePrefixes(a.config.Trusted); err != nil {
+		return nil, err
+	}
+	resolver, err := clientip.NewResolver(a.config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := auth.ParseCertIdentities(a.config.TLSClientIdentities)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := handlers.NewURLsHandler(a.store, a.deleteQueue, a.config)
+	urls.SetRateLimiter(a.limiter)
+	urls.SetLogger(a.logger)
+	urls.SetIdempotency(commonhandlers.NewIdempotency(a.store, time.Duration(a.config.IdempotencyTTL)))
+
+	if a.config.OIDCIssuer != "" {
+		provider, err := oidc.NewProvider(ctx, oidc.Config{
+			Issuer:       a.config.OIDCIssuer,
+			ClientID:     a.config.OIDCClientID,
+			ClientSecret: a.config.OIDCClientSecret,
+			RedirectURL:  a.config.OIDCRedirectURL,
+			Scopes:       strings.Fields(a.config.OIDCScopes),
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		urls.SetOIDCProvider(provider)
+	}
+
+	admin := handlers.NewAdminHandler(a.store, a.config)
+
+	s := router.NewServer(a.config, urls, admin, a.limiter, apierror.Correlation{}, resolver,
+		auth.ClientCertAuth{Identities: identities}, logger, compress.RequestUngzipper{}, compress.ResponseGzipper{})
+	return s.Handler(), nil
+}
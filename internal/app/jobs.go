@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+// Фоновые задачи планировщика
+const (
+	JobCompact     = "compact"
+	JobPurge       = "purge"
+	JobExpired     = "expired"
+	JobIdempotency = "idempotency"
+	JobDeleteJobs  = "delete-jobs"
+	JobRateLimits  = "rate-limits"
+)
+
+// compacter хранилище, которое умеет переписывать свой файл без устаревших записей
+type compacter interface {
+	Compact(ctx context.Context) error
+}
+
+// bucketPurger общее хранилище лимитов, из которого нужно удалять давно не обновлявшиеся вёдра
+type bucketPurger interface {
+	PurgeBuckets(ctx context.Context, updatedBefore time.Time) (int, error)
+}
+
+// purgeJob стирает ссылки, удалённые раньше срока хранения
+func (a *App) purgeJob(ctx context.Context) error {
+	deletedBefore := time.Now().Add(-time.Duration(a.config.LinkRetention))
+	purged, err := a.store.PurgeDeletedLinks(ctx, deletedBefore, a.config.LinkTombstones)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		a.logger.Infow("purged deleted links", "count", purged)
+	}
+	return nil
+}
+
+// expiredJob стирает ссылки, срок действия которых истёк раньше срока хранения
+func (a *App) expiredJob(ctx context.Context) error {
+	expiredBefore := time.Now().Add(-time.Duration(a.config.LinkRetention))
+	purged, err := a.store.PurgeExpiredLinks(ctx, expiredBefore, a.config.LinkTombstones)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		a.logger.Infow("purged expired links", "count", purged)
+	}
+	return nil
+}
+
+// idempotencyJob удаляет ключи идемпотентности, срок хранения ответа по которым истёк
+func (a *App) idempotencyJob(ctx context.Context) error {
+	_, err := a.store.PurgeIdempotencyKeys(ctx, time.Now().Add(-time.Duration(a.config.IdempotencyTTL)))
+	return err
+}
+
+// deleteJobsJob удаляет выполненные и неудавшиеся задания на удаление после срока хранения
+func (a *App) deleteJobsJob(ctx context.Context) error {
+	_, err := a.store.PurgeDeleteJobs(ctx, time.Now().Add(-time.Duration(a.config.DeleteJobRetention)))
+	return err
+}
+
+// rateLimitsJob удаляет вёдра лимитов, которые успели наполниться полностью
+func (a *App) rateLimitsJob(p bucketPurger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := p.PurgeBuckets(ctx, time.Now().Add(-a.limiter.RefillWindow()))
+		return err
+	}
+}
+
+// newScheduler фоновые задачи для выбранного хранилища. С базой данных каждую задачу выполняет
+// одна реплика, получившая advisory lock, иначе хранилище принадлежит одному процессу
+func (a *App) newScheduler() (*tasks.Scheduler, error) {
+	var locker tasks.Locker = tasks.NewLocalLocker()
+	if db, ok := a.store.(*storage.Database); ok {
+		locker = db
+	}
+	s := tasks.NewScheduler(locker, a.store)
+
+	if c, ok := a.store.(compacter); ok {
+		s.Add(tasks.ScheduledJob{Name: JobCompact, Interval: time.Hour, Run: c.Compact})
+	}
+	if a.config.LinkRetention > 0 {
+		s.Add(tasks.ScheduledJob{Name: JobPurge, Interval: time.Hour, Run: a.purgeJob})
+		s.Add(tasks.ScheduledJob{Name: JobExpired, Interval: time.Hour, Run: a.expiredJob})
+	}
+	if a.config.DeleteJobRetention > 0 {
+		s.Add(tasks.ScheduledJob{Name: JobDeleteJobs, Interval: time.Hour, Run: a.deleteJobsJob})
+	}
+	if p, ok := a.store.(bucketPurger); ok && a.config.RateLimitStore == "postgres" && a.limiter.RefillWindow() > 0 {
+		s.Add(tasks.ScheduledJob{Name: JobRateLimits, Interval: time.Hour, Run: a.rateLimitsJob(p)})
+	}
+	if a.config.IdempotencyTTL > 0 {
+		s.Add(tasks.ScheduledJob{Name: JobIdempotency, Interval: time.Hour, Run: a.idempotencyJob})
+	}
+
+	if err := s.SetIntervals(a.config.JobIntervals); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// stopScheduler отменяет запуски задач и ждёт их завершения
+func (a *App) stopScheduler(ctx context.Context) error {
+	a.cancelScheduler()
+	select {
+	case <-a.schedulerDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/lifecycle"
+)
+
+// Шаги остановки сервиса
+const (
+	StageHTTP        = "http"
+	StageGRPC        = "grpc"
+	StageDeleteQueue = "delete-queue"
+	StageScheduler   = "scheduler"
+	StageStorage     = "storage"
+)
+
+// newLifecycle шаги остановки: серверы перестают принимать запросы и дожидаются начатых, обработчик
+// выполняет забранные задания на удаление, планировщик дожидается начатых задач, затем закрывается хранилище.
+// Порядок и таймауты можно поменять в конфигурации, но очередь удаления закрывается только после серверов,
+// а хранилище - после очереди и планировщика
+func (a *App) newLifecycle() (*lifecycle.Manager, error) {
+	m := &lifecycle.Manager{}
+	m.Add(lifecycle.Stage{Name: StageHTTP, Timeout: 10 * time.Second, Stop: a.stopHTTP})
+	m.Add(lifecycle.Stage{Name: StageGRPC, Timeout: 10 * time.Second, Stop: a.stopGRPC})
+	m.Add(lifecycle.Stage{
+		Name:    StageDeleteQueue,
+		Timeout: 30 * time.Second,
+		// обработчики пишут в очередь, закрывать её раньше серверов нельзя
+		After: []string{StageHTTP, StageGRPC},
+		Stop:  a.drainDeleteQueue,
+	})
+	m.Add(lifecycle.Stage{Name: StageScheduler, Timeout: 30 * time.Second, Stop: a.stopScheduler})
+	m.Add(lifecycle.Stage{
+		Name:    StageStorage,
+		Timeout: 5 * time.Second,
+		After:   []string{StageDeleteQueue, StageScheduler},
+		Stop: func(ctx context.Context) error {
+			return a.store.Close()
+		},
+	})
+
+	m.SetOrder(a.config.ShutdownOrder)
+	if err := m.SetTimeouts(a.config.ShutdownTimeouts); err != nil {
+		return nil, err
+	}
+	if _, err := m.Plan(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (a *App) stopHTTP(ctx context.Context) error {
+	var errs []error
+	for _, server := range a.httpServers {
+		errs = append(errs, server.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// stopGRPC сообщает клиентам health, что сервис недоступен, дожидается завершения начатых вызовов,
+// а по таймауту обрывает их
+func (a *App) stopGRPC(ctx context.Context) error {
+	if a.health != nil {
+		a.health.Shutdown()
+	}
+	var wg sync.WaitGroup
+	for _, server := range a.grpcServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.GracefulStop()
+		}()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		for _, server := range a.grpcServers {
+			server.Stop()
+		}
+		return ctx.Err()
+	}
+}
+
+// drainDeleteQueue перестаёт забирать задания на удаление и ждёт, пока обработчик выполнит уже забранные.
+// Остальные задания остаются в хранилище до следующего запуска. По таймауту обработчик останавливается,
+// не дожидаясь хранилища
+func (a *App) drainDeleteQueue(ctx context.Context) error {
+	a.deleteQueue.Close()
+	select {
+	case <-a.workerDone:
+		return nil
+	case <-ctx.Done():
+		a.stopWorker()
+		<-a.workerDone
+		return ctx.Err()
+	}
+}
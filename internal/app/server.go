@@ -0,0 +1,196 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+
+	"github.com/wellywell/shorturl/internal/certs"
+)
+
+// Режимы запуска: только HTTP API, только gRPC или оба
+const (
+	ModeHTTP = "http"
+	ModeGRPC = "grpc"
+	ModeBoth = "both"
+)
+
+// Run запускает серверы режима mode и работает, пока не отменён ctx или один из серверов не завершился с ошибкой.
+// В режиме both без GRPCAddress HTTP и gRPC слушают один порт, запросы gRPC отличаются по HTTP/2 и
+// content-type application/grpc. Затем сервис останавливается по шагам из lifecycle.go
+func (a *App) Run(ctx context.Context, mode string) error {
+	if mode != ModeHTTP && mode != ModeGRPC && mode != ModeBoth {
+		return errors.Join(fmt.Errorf("unknown server mode %q", mode), a.lifecycle.Shutdown())
+	}
+
+	var tlsConfig *tls.Config
+	if a.config.EnableHTTPS {
+		certManager, err := certs.NewManager(a.config, a.logger)
+		if err != nil {
+			return errors.Join(err, a.lifecycle.Shutdown())
+		}
+		defer certManager.Close()
+		tlsConfig = certManager.TLSConfig()
+	}
+
+	errs := make(chan error, 3)
+	if err := a.start(ctx, mode, tlsConfig, errs); err != nil {
+		return errors.Join(err, a.lifecycle.Shutdown())
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	return errors.Join(err, a.lifecycle.Shutdown())
+}
+
+func (a *App) start(ctx context.Context, mode string, tlsConfig *tls.Config, errs chan<- error) error {
+	multiplexed := mode == ModeBoth && a.config.GRPCAddress == ""
+
+	var multiplexedServer *multiplexedGRPC
+	if mode != ModeHTTP {
+		services, err := a.newGRPCServices()
+		if err != nil {
+			return err
+		}
+		if services.health != nil {
+			go services.health.Run(ctx)
+		}
+		if multiplexed {
+			// TLS принимает http.Server, gRPC получает уже расшифрованные запросы
+			multiplexedServer = &multiplexedGRPC{server: services.newServer(nil)}
+			a.grpcServers = append(a.grpcServers, multiplexedServer)
+		} else {
+			grpcServer := services.newServer(tlsConfig)
+			address := a.config.GRPCAddress
+			if address == "" {
+				address = a.config.BaseAddress
+			}
+			if err := a.serveGRPC(grpcServer, address, errs); err != nil {
+				return err
+			}
+			a.grpcServers = append(a.grpcServers, grpcServer)
+		}
+
+		if a.config.GatewayAddress != "" {
+			handler, err := a.newGateway(ctx, services)
+			if err != nil {
+				return err
+			}
+			a.serveHTTP(&http.Server{Addr: a.config.GatewayAddress, Handler: handler, TLSConfig: tlsConfig}, errs)
+		}
+	}
+
+	if mode != ModeGRPC {
+		handler, err := a.newHTTPHandler(ctx)
+		if err != nil {
+			return err
+		}
+		if multiplexed {
+			handler = multiplex(multiplexedServer, handler)
+			if tlsConfig == nil {
+				// gRPC без TLS работает по HTTP/2 без согласования (h2c)
+				handler = h2c.NewHandler(handler, &http2.Server{})
+			}
+		}
+		a.serveHTTP(&http.Server{Addr: a.config.BaseAddress, Handler: handler, TLSConfig: tlsConfig}, errs)
+	}
+	return nil
+}
+
+// multiplex направляет запросы gRPC в grpcServer, остальные - в next
+func multiplex(grpcServer http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// multiplexedGRPC gRPC-сервер, который принимает вызовы через http.Server. grpc.Server.GracefulStop
+// не умеет мягко закрывать такие вызовы, поэтому начатые вызовы отслеживаются здесь
+type multiplexedGRPC struct {
+	server *grpc.Server
+
+	mu      sync.Mutex
+	closing bool
+	calls   sync.WaitGroup
+}
+
+// ServeHTTP обрабатывает вызов gRPC. После начала остановки новые вызовы сразу получают Unavailable
+func (m *multiplexedGRPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	if m.closing {
+		m.mu.Unlock()
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	m.calls.Add(1)
+	m.mu.Unlock()
+	defer m.calls.Done()
+
+	m.server.ServeHTTP(w, r)
+}
+
+// GracefulStop перестаёт принимать вызовы, дожидается начатых и останавливает сервер.
+// Долгие потоки держат остановку до таймаута шага, после которого их обрывает Stop
+func (m *multiplexedGRPC) GracefulStop() {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	m.calls.Wait()
+	m.server.Stop()
+}
+
+// Stop обрывает начатые вызовы
+func (m *multiplexedGRPC) Stop() {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	m.server.Stop()
+}
+
+func (a *App) serveHTTP(server *http.Server, errs chan<- error) {
+	a.httpServers = append(a.httpServers, server)
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+	fmt.Println("Сервер HTTP начал работу на", server.Addr)
+}
+
+func (a *App) serveGRPC(server *grpc.Server, address string, errs chan<- error) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			errs <- err
+		}
+	}()
+	fmt.Println("Сервер gRPC начал работу на", address)
+	return nil
+}
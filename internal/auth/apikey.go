@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+// Области доступа API-ключей
+const (
+	ScopeLinksRead  = "links:read"
+	ScopeLinksWrite = "links:write"
+)
+
+// Scopes все поддерживаемые области доступа
+var Scopes = []string{ScopeLinksRead, ScopeLinksWrite}
+
+// apiKeyPrefix позволяет отличить API-ключ от JWT в заголовке Authorization
+const apiKeyPrefix = "sk_"
+
+// apiKeyTouchInterval время использования ключа обновляется не чаще этого интервала,
+// чтобы каждый запрос с ключом не приводил к записи в хранилище
+const apiKeyTouchInterval = time.Minute
+
+// Ошибки проверки API-ключа
+var (
+	ErrAPIKeyInvalid     = errors.New("api key invalid")
+	ErrAPIKeyRevoked     = errors.New("api key revoked")
+	ErrInsufficientScope = errors.New("api key has insufficient scope")
+	ErrNoKeyStore        = errors.New("api key store is not configured")
+)
+
+// KeyStore - интерфейс хранилища API-ключей
+type KeyStore interface {
+	GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error
+}
+
+var (
+	keyStore     KeyStore
+	keyStoreLock sync.RWMutex
+)
+
+// SetKeyStore задаёт хранилище, в котором проверяются API-ключи
+func SetKeyStore(store KeyStore) {
+	keyStoreLock.Lock()
+	defer keyStoreLock.Unlock()
+	keyStore = store
+}
+
+func getKeyStore() KeyStore {
+	keyStoreLock.RLock()
+	defer keyStoreLock.RUnlock()
+	return keyStore
+}
+
+// GenerateAPIKey создаёт новый случайный ключ. Возвращает сам ключ, который нужно отдать пользователю,
+// префикс для отображения в списке ключей и хэш для хранения
+func GenerateAPIKey() (key string, prefix string, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, key[:len(apiKeyPrefix)+6], HashAPIKey(key), nil
+}
+
+// HashAPIKey вычисляет хэш ключа, под которым он хранится
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey проверяет, похожа ли строка на API-ключ
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// ValidateScopes проверяет, что все переданные области доступа известны. Пустой список означает все области
+func ValidateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return slices.Clone(Scopes), nil
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return scopes, nil
+}
+
+// VerifyAPIKey проверяет ключ, его области доступа, и возвращает id владельца.
+// Пустой scope означает, что подойдёт любой действующий ключ
+func VerifyAPIKey(ctx context.Context, key string, scope string) (int, error) {
+	store := getKeyStore()
+	if store == nil {
+		return 0, ErrNoKeyStore
+	}
+	record, err := store.GetAPIKey(ctx, HashAPIKey(key))
+	if err != nil {
+		var notFound *storage.KeyNotFoundError
+		if errors.As(err, &notFound) {
+			return 0, ErrAPIKeyInvalid
+		}
+		return 0, err
+	}
+	if record.IsRevoked() {
+		return 0, ErrAPIKeyRevoked
+	}
+	if scope != "" && !slices.Contains(record.Scopes, scope) {
+		return 0, ErrInsufficientScope
+	}
+	if err := CheckUser(ctx, record.UserID); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= apiKeyTouchInterval {
+		if err := store.TouchAPIKey(ctx, record.ID, now); err != nil {
+			return 0, err
+		}
+	}
+	return record.UserID, nil
+}
+
+// VerifyBearer проверяет значение из заголовка Authorization: API-ключ либо JWT-токен
+func VerifyBearer(ctx context.Context, token string, scope string) (int, error) {
+	if IsAPIKey(token) {
+		return VerifyAPIKey(ctx, token, scope)
+	}
+	return VerifyToken(ctx, token)
+}
+
+// VerifyToken проверяет JWT-токен сессии и то, что его владелец не заблокирован
+func VerifyToken(ctx context.Context, token string) (int, error) {
+	userID, err := GetUserID(token)
+	if err != nil {
+		return 0, err
+	}
+	if err := CheckUser(ctx, userID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// ParseBearer достаёт токен из значения заголовка вида "Bearer <token>"
+func ParseBearer(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
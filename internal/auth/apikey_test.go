@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestVerifyAPIKey(t *testing.T) {
+	st := storage.NewMemory()
+	SetKeyStore(st)
+	defer SetKeyStore(nil)
+
+	ctx := context.Background()
+
+	newKey := func(scopes ...string) string {
+		raw, prefix, hash, err := GenerateAPIKey()
+		require.NoError(t, err)
+		_, err = st.CreateAPIKey(ctx, storage.APIKey{UserID: 7, Prefix: prefix, Hash: hash, Scopes: scopes})
+		require.NoError(t, err)
+		return raw
+	}
+
+	readOnly := newKey(ScopeLinksRead)
+	full := newKey(ScopeLinksRead, ScopeLinksWrite)
+	revoked := newKey(ScopeLinksRead)
+	keys, _ := st.GetUserAPIKeys(ctx, 7)
+	require.NoError(t, st.RevokeAPIKey(ctx, 7, keys[2].ID))
+
+	tests := []struct {
+		name    string
+		key     string
+		scope   string
+		wantErr error
+	}{
+		{"read ok", readOnly, ScopeLinksRead, nil},
+		{"any scope", readOnly, "", nil},
+		{"no write scope", readOnly, ScopeLinksWrite, ErrInsufficientScope},
+		{"write ok", full, ScopeLinksWrite, nil},
+		{"revoked", revoked, ScopeLinksRead, ErrAPIKeyRevoked},
+		{"unknown", "sk_unknown", ScopeLinksRead, ErrAPIKeyInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, err := VerifyAPIKey(ctx, tt.key, tt.scope)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 7, userID)
+		})
+	}
+
+	keys, _ = st.GetUserAPIKeys(ctx, 7)
+	require.NotNil(t, keys[0].LastUsedAt, "время использования ключа не обновилось")
+
+	// повторное использование в пределах интервала не записывается
+	lastUsed := *keys[0].LastUsedAt
+	_, err := VerifyAPIKey(ctx, readOnly, ScopeLinksRead)
+	require.NoError(t, err)
+	keys, _ = st.GetUserAPIKeys(ctx, 7)
+	assert.Equal(t, lastUsed, *keys[0].LastUsedAt)
+
+	// после интервала время обновляется
+	require.NoError(t, st.TouchAPIKey(ctx, keys[0].ID, lastUsed.Add(-apiKeyTouchInterval)))
+	_, err = VerifyAPIKey(ctx, readOnly, ScopeLinksRead)
+	require.NoError(t, err)
+	keys, _ = st.GetUserAPIKeys(ctx, 7)
+	assert.True(t, keys[0].LastUsedAt.After(lastUsed.Add(-apiKeyTouchInterval)))
+}
+
+func TestVerifyUserBearer(t *testing.T) {
+	st := storage.NewMemory()
+	SetKeyStore(st)
+	defer SetKeyStore(nil)
+
+	raw, prefix, hash, err := GenerateAPIKey()
+	require.NoError(t, err)
+	_, err = st.CreateAPIKey(context.Background(), storage.APIKey{UserID: 3, Prefix: prefix, Hash: hash, Scopes: Scopes})
+	require.NoError(t, err)
+
+	token, err := BuildJWTString(5)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		header  string
+		user    int
+		wantErr bool
+	}{
+		{"api key", "Bearer " + raw, 3, false},
+		{"jwt", "Bearer " + token, 5, false},
+		{"bad key", "Bearer sk_bad", 0, true},
+		{"no scheme", raw, 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", tc.header)
+
+			userID, err := VerifyUser(r)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.user, userID)
+		})
+	}
+
+	t.Run("session rejects api key", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+raw)
+		_, err := VerifySession(r)
+		assert.ErrorIs(t, err, ErrInsufficientScope)
+	})
+}
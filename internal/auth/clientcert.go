@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CertIdentity пользователь или сервис, которому сопоставлен клиентский сертификат.
+// У пользователя заполнен UserID, у сервиса - Service
+type CertIdentity struct {
+	Name    string
+	UserID  int
+	Service string
+}
+
+// CertIdentities соответствие имён из сертификатов (CN, DNS, URI и email SAN) пользователям и сервисам
+type CertIdentities map[string]CertIdentity
+
+// ParseCertIdentities разбирает список через запятую вида name=user:ID или name=service:NAME
+func ParseCertIdentities(value string) (CertIdentities, error) {
+	result := make(CertIdentities)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		sep := strings.LastIndex(item, "=")
+		if sep <= 0 {
+			return nil, fmt.Errorf("bad client identity %q", item)
+		}
+		name, target := item[:sep], item[sep+1:]
+		kind, id, _ := strings.Cut(target, ":")
+		identity := CertIdentity{Name: name}
+		switch kind {
+		case "user":
+			userID, err := strconv.Atoi(id)
+			if err != nil || userID < 1 {
+				return nil, fmt.Errorf("bad user id in client identity %q", item)
+			}
+			identity.UserID = userID
+		case "service":
+			if id == "" {
+				return nil, fmt.Errorf("empty service name in client identity %q", item)
+			}
+			identity.Service = id
+		default:
+			return nil, fmt.Errorf("bad client identity %q", item)
+		}
+		result[name] = identity
+	}
+	return result, nil
+}
+
+// Lookup ищет сопоставление для сертификата. Сначала проверяются SAN, затем CN
+func (ci CertIdentities) Lookup(cert *x509.Certificate) (CertIdentity, bool) {
+	var names []string
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	names = append(names, cert.Subject.CommonName)
+
+	for _, name := range names {
+		if identity, ok := ci[name]; ok && name != "" {
+			return identity, true
+		}
+	}
+	return CertIdentity{}, false
+}
+
+// LookupChains ищет сопоставление для проверенного клиентского сертификата.
+// Непроверенные сертификаты, для которых нет цепочки до корневого, не учитываются
+func (ci CertIdentities) LookupChains(chains [][]*x509.Certificate) (CertIdentity, bool) {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return CertIdentity{}, false
+	}
+	return ci.Lookup(chains[0][0])
+}
+
+type certIdentityKey struct{}
+
+// WithCertIdentity сохраняет в контексте личность, подтверждённую клиентским сертификатом
+func WithCertIdentity(ctx context.Context, identity CertIdentity) context.Context {
+	return context.WithValue(ctx, certIdentityKey{}, identity)
+}
+
+// CertIdentityFromContext достаёт личность, подтверждённую клиентским сертификатом
+func CertIdentityFromContext(ctx context.Context) (CertIdentity, bool) {
+	identity, ok := ctx.Value(certIdentityKey{}).(CertIdentity)
+	return identity, ok
+}
+
+// ClientCertAuth middleware, сохраняющая в контексте пользователя или сервис по клиентскому сертификату
+type ClientCertAuth struct {
+	Identities CertIdentities
+}
+
+// Handle для использования ClientCertAuth в качестве Middleware
+func (c ClientCertAuth) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			if identity, ok := c.Identities.LookupChains(r.TLS.VerifiedChains); ok {
+				r = r.WithContext(WithCertIdentity(r.Context(), identity))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
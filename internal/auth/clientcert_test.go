@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestParseCertIdentities(t *testing.T) {
+	identities, err := ParseCertIdentities("alice=user:7, spiffe://shorturl/monitoring=service:monitoring")
+	require.NoError(t, err)
+
+	identity, ok := identities.Lookup(&x509.Certificate{Subject: pkix.Name{CommonName: "alice"}})
+	require.True(t, ok)
+	assert.Equal(t, 7, identity.UserID)
+
+	_, ok = identities.Lookup(&x509.Certificate{Subject: pkix.Name{CommonName: "bob"}})
+	assert.False(t, ok)
+
+	for _, bad := range []string{"alice", "alice=user:x", "alice=user:0", "alice=service:", "alice=group:1"} {
+		_, err := ParseCertIdentities(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestVerifyUserWithCertIdentity(t *testing.T) {
+	st := storage.NewMemory()
+	SetUserStore(st)
+	defer SetUserStore(nil)
+
+	ctx := context.Background()
+	userID, _ := st.CreateNewUser(ctx)
+	blocked, _ := st.CreateNewUser(ctx)
+	require.NoError(t, st.SetUserBlocked(ctx, blocked, true))
+
+	request := func(identity CertIdentity) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		return r.WithContext(WithCertIdentity(r.Context(), identity))
+	}
+
+	got, err := VerifyUser(request(CertIdentity{Name: "alice", UserID: userID}))
+	require.NoError(t, err)
+	assert.Equal(t, userID, got)
+
+	_, err = VerifyUser(request(CertIdentity{Name: "mallory", UserID: blocked}))
+	assert.ErrorIs(t, err, ErrUserBlocked)
+
+	// сервис не является пользователем
+	_, err = VerifyUser(request(CertIdentity{Name: "monitoring", Service: "monitoring"}))
+	assert.Error(t, err)
+
+	// и не проходит проверку подсети из чужой сети
+	w := httptest.NewRecorder()
+	r := request(CertIdentity{Name: "monitoring", Service: "monitoring"})
+	r.RemoteAddr = "203.0.113.1:1234"
+	SubnetChecker{Trusted: "192.168.0.0/24"}.Handle(MockHandler{}).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
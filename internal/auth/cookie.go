@@ -1,34 +1,215 @@
 package auth
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/config"
 )
 
-const userCookie = "_user"
+const (
+	userCookie       = "_user"
+	loginStateCookie = "_login_state"
+	loginStateMaxAge = 10 * time.Minute
+)
 
-// VerifyUser проверяет куку из запроса, и достаёт из неё id user-a. Вернёт ошибку при неудаче
-func VerifyUser(r *http.Request) (int, error) {
+// CookieOptions атрибуты кук, которые выставляет сервис
+type CookieOptions struct {
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+	Path     string
+	MaxAge   time.Duration
+}
 
-	cookie, err := r.Cookie(userCookie)
-	if err == nil {
-		var userID int
-		userID, err = GetUserID(cookie.Value)
+var (
+	cookieOptions     = CookieOptions{SameSite: http.SameSiteLaxMode, Path: "/"}
+	cookieOptionsLock sync.RWMutex
+)
+
+// NewCookieOptions собирает атрибуты кук из настроек. Secure по умолчанию включён, если включён HTTPS
+func NewCookieOptions(conf config.ServerConfig) (CookieOptions, error) {
+	opts := CookieOptions{
+		Secure: conf.EnableHTTPS,
+		Domain: conf.CookieDomain,
+		Path:   conf.CookiePath,
+		MaxAge: time.Duration(conf.CookieMaxAge),
+	}
+	if conf.CookieSecure != "" {
+		secure, err := strconv.ParseBool(conf.CookieSecure)
 		if err != nil {
+			return CookieOptions{}, fmt.Errorf("bad cookie secure value %q", conf.CookieSecure)
+		}
+		opts.Secure = secure
+	}
+
+	switch strings.ToLower(conf.CookieSameSite) {
+	case "", "lax":
+		opts.SameSite = http.SameSiteLaxMode
+	case "strict":
+		opts.SameSite = http.SameSiteStrictMode
+	case "none":
+		if !opts.Secure {
+			return CookieOptions{}, fmt.Errorf("SameSite=None cookies must be Secure")
+		}
+		opts.SameSite = http.SameSiteNoneMode
+	default:
+		return CookieOptions{}, fmt.Errorf("bad cookie samesite value %q", conf.CookieSameSite)
+	}
+	return opts, nil
+}
+
+// SetCookieOptions задаёт атрибуты для всех кук сервиса
+func SetCookieOptions(opts CookieOptions) {
+	cookieOptionsLock.Lock()
+	defer cookieOptionsLock.Unlock()
+	cookieOptions = opts
+}
+
+func newCookie(name string, value string, httpOnly bool) *http.Cookie {
+	cookieOptionsLock.RLock()
+	opts := cookieOptions
+	cookieOptionsLock.RUnlock()
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		MaxAge:   int(opts.MaxAge.Seconds()),
+		Secure:   opts.Secure,
+		HttpOnly: httpOnly,
+		SameSite: opts.SameSite,
+	}
+}
+
+// VerifyUser проверяет авторизацию запроса, и достаёт из неё id user-a. Вернёт ошибку при неудаче.
+// Принимается заголовок Authorization: Bearer с API-ключом или JWT, либо авторизационная кука
+func VerifyUser(r *http.Request) (int, error) {
+	return VerifyUserWithScope(r, "")
+}
+
+// VerifyUserWithScope аналогичен VerifyUser, но для API-ключей дополнительно проверяет область доступа.
+// Клиентский сертификат, сопоставленный пользователю, принимается наравне с заголовком Authorization
+func VerifyUserWithScope(r *http.Request, scope string) (int, error) {
+
+	if token, ok := BearerToken(r); ok {
+		return VerifyBearer(r.Context(), token, scope)
+	}
+	if identity, ok := CertIdentityFromContext(r.Context()); ok && identity.UserID != 0 {
+		if err := CheckUser(r.Context(), identity.UserID); err != nil {
 			return 0, err
 		}
-		return userID, nil
+		return identity.UserID, nil
+	}
+	return VerifySession(r)
+}
+
+// UnverifiedUserID достаёт id пользователя из JWT в заголовке Authorization или из куки, не обращаясь к хранилищу:
+// проверяются только подпись и срок токена. Блокировку и стирание пользователя проверяет VerifyUser
+func UnverifiedUserID(r *http.Request) (int, bool) {
+	token, ok := BearerToken(r)
+	if !ok {
+		cookie, err := r.Cookie(userCookie)
+		if err != nil {
+			return 0, false
+		}
+		token = cookie.Value
+	}
+	if IsAPIKey(token) {
+		return 0, false
+	}
+	claims, err := getKeySet().ParseToken(token)
+	if err != nil {
+		return 0, false
+	}
+	return claims.UserID, true
+}
+
+// HasSessionCookie сообщает, что запрос несёт авторизационную куку, которую браузер подставляет сам
+func HasSessionCookie(r *http.Request) bool {
+	_, err := r.Cookie(userCookie)
+	return err == nil
+}
+
+// VerifySession проверяет только сессию пользователя - куку или JWT, API-ключи не принимаются.
+// Заблокированному пользователю вернётся ErrUserBlocked
+func VerifySession(r *http.Request) (int, error) {
+
+	if token, ok := BearerToken(r); ok {
+		if IsAPIKey(token) {
+			return 0, ErrInsufficientScope
+		}
+		return VerifyToken(r.Context(), token)
+	}
+
+	cookie, err := r.Cookie(userCookie)
+	if err == nil {
+		return VerifyToken(r.Context(), cookie.Value)
 	}
 	return 0, err
 }
 
-// SetAuthCookie устанавливает авторизационную куку
+// BearerToken достаёт токен из заголовка Authorization
+func BearerToken(r *http.Request) (string, bool) {
+	return ParseBearer(r.Header.Get("Authorization"))
+}
+
+// RenewAuthCookie перевыпускает авторизационную куку, если срок жизни токена в ней подходит к концу.
+// Так сессия активного пользователя продлевается, а брошенная - истекает
+func RenewAuthCookie(w http.ResponseWriter, r *http.Request) error {
+	if _, ok := BearerToken(r); ok {
+		return nil
+	}
+	cookie, err := r.Cookie(userCookie)
+	if err != nil {
+		return nil
+	}
+	ks := getKeySet()
+	claims, err := ks.ParseToken(cookie.Value)
+	if err != nil {
+		return err
+	}
+	if !ks.NeedsRenewal(claims) {
+		return nil
+	}
+	return SetAuthCookie(claims.UserID, w)
+}
+
+// SetAuthCookie устанавливает авторизационную куку со свежим токеном
 func SetAuthCookie(userID int, w http.ResponseWriter) error {
 
 	token, err := BuildJWTString(userID)
 	if err != nil {
 		return err
 	}
-	cookie := &http.Cookie{Name: userCookie, Value: token}
-	http.SetCookie(w, cookie)
+	http.SetCookie(w, newCookie(userCookie, token, true))
 	return nil
 }
+
+// SetLoginStateCookie сохраняет состояние входа через внешнего провайдера на время, пока пользователь у провайдера.
+// SameSite всегда Lax: провайдер возвращает пользователя переходом с другого сайта, и Strict-куку браузер не пришлёт
+func SetLoginStateCookie(w http.ResponseWriter, value string) {
+	cookie := newCookie(loginStateCookie, value, true)
+	cookie.MaxAge = int(loginStateMaxAge.Seconds())
+	if cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(w, cookie)
+}
+
+// PopLoginStateCookie достаёт состояние входа и удаляет куку, чтобы его нельзя было использовать повторно
+func PopLoginStateCookie(w http.ResponseWriter, r *http.Request) (string, error) {
+	cookie, err := r.Cookie(loginStateCookie)
+	if err != nil {
+		return "", err
+	}
+	expired := newCookie(loginStateCookie, "", true)
+	expired.MaxAge = -1
+	http.SetCookie(w, expired)
+	return cookie.Value, nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/config"
+)
+
+func TestNewCookieOptions(t *testing.T) {
+	testCases := []struct {
+		name    string
+		conf    config.ServerConfig
+		want    CookieOptions
+		wantErr bool
+	}{
+		{"defaults", config.ServerConfig{CookiePath: "/"}, CookieOptions{SameSite: http.SameSiteLaxMode, Path: "/"}, false},
+		{"secure with https", config.ServerConfig{EnableHTTPS: true, CookieSameSite: "strict"}, CookieOptions{Secure: true, SameSite: http.SameSiteStrictMode}, false},
+		{"explicit insecure", config.ServerConfig{EnableHTTPS: true, CookieSecure: "false"}, CookieOptions{SameSite: http.SameSiteLaxMode}, false},
+		{"none with secure", config.ServerConfig{CookieSecure: "true", CookieSameSite: "None"}, CookieOptions{Secure: true, SameSite: http.SameSiteNoneMode}, false},
+		{"none without secure", config.ServerConfig{CookieSameSite: "none"}, CookieOptions{}, true},
+		{"bad samesite", config.ServerConfig{CookieSameSite: "sometimes"}, CookieOptions{}, true},
+		{"bad secure", config.ServerConfig{CookieSecure: "maybe"}, CookieOptions{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := NewCookieOptions(tc.conf)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, opts)
+		})
+	}
+}
+
+func TestSetAuthCookieAttributes(t *testing.T) {
+	SetCookieOptions(CookieOptions{Secure: true, SameSite: http.SameSiteStrictMode, Domain: "example.com", Path: "/", MaxAge: time.Hour})
+	defer SetCookieOptions(CookieOptions{SameSite: http.SameSiteLaxMode, Path: "/"})
+
+	w := httptest.NewRecorder()
+	require.NoError(t, SetAuthCookie(1, w))
+	res := w.Result()
+	defer res.Body.Close()
+
+	cookies := res.Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, userCookie, cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.Equal(t, "example.com", cookie.Domain)
+	assert.Equal(t, "/", cookie.Path)
+	assert.Equal(t, 3600, cookie.MaxAge)
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/config"
+)
+
+// Режимы защиты от CSRF
+const (
+	CSRFModeOrigin       = "origin"
+	CSRFModeDoubleSubmit = "double-submit"
+	CSRFModeOff          = "off"
+)
+
+const (
+	csrfCookie = "_csrf"
+	// CSRFHeader заголовок, в котором клиент возвращает значение CSRF-куки
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRFProtector middleware для защиты изменяющих запросов, авторизованных кукой.
+// Запросы с заголовком Authorization браузер сам не подставляет, поэтому они не проверяются
+type CSRFProtector struct {
+	Mode           string
+	TrustedOrigins []string
+}
+
+// NewCSRFProtector создаёт CSRFProtector по настройкам сервиса
+func NewCSRFProtector(conf config.ServerConfig) CSRFProtector {
+	p := CSRFProtector{Mode: conf.CSRFMode}
+	for _, origin := range strings.Split(conf.CSRFTrustedOrigins, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			p.TrustedOrigins = append(p.TrustedOrigins, strings.ToLower(origin))
+		}
+	}
+	return p
+}
+
+// Handle для использования CSRFProtector в качестве Middleware
+func (p CSRFProtector) Handle(next http.Handler) http.Handler {
+
+	protect := func(w http.ResponseWriter, r *http.Request) {
+		if p.Mode == CSRFModeOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if p.Mode == CSRFModeDoubleSubmit {
+			if _, err := r.Cookie(csrfCookie); err != nil {
+				if err := SetCSRFCookie(w); err != nil {
+					apierror.WriteCode(w, r, apierror.CodeInternal, "Something went wrong")
+					return
+				}
+			}
+		}
+
+		if isSafeMethod(r.Method) || !HasSessionCookie(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := BearerToken(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var allowed bool
+		if p.Mode == CSRFModeDoubleSubmit {
+			allowed = checkDoubleSubmit(r)
+		} else {
+			allowed = p.checkOrigin(r)
+		}
+		if !allowed {
+			apierror.WriteCode(w, r, apierror.CodeForbidden, "CSRF check failed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(protect)
+}
+
+// SetCSRFCookie выставляет новую CSRF-куку. Она доступна скриптам, чтобы их можно было вернуть в заголовке
+func SetCSRFCookie(w http.ResponseWriter) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	http.SetCookie(w, newCookie(csrfCookie, base64.RawURLEncoding.EncodeToString(buf), false))
+	return nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func checkDoubleSubmit(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
+// checkOrigin сверяет Origin, либо Referer, с адресом сервиса и списком доверенных источников.
+// Клиенты, не присылающие ни того, ни другого, не являются браузерами и пропускаются
+func (p CSRFProtector) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "null" {
+		return false
+	}
+	if origin == "" {
+		if referer := r.Header.Get("Referer"); referer != "" {
+			u, err := url.Parse(referer)
+			if err != nil {
+				return false
+			}
+			origin = u.Scheme + "://" + u.Host
+		}
+	}
+	if origin == "" {
+		return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return slices.Contains(p.TrustedOrigins, strings.ToLower(u.Scheme+"://"+u.Host))
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/config"
+)
+
+func TestCSRFProtectorOrigin(t *testing.T) {
+	protector := NewCSRFProtector(config.ServerConfig{CSRFMode: CSRFModeOrigin, CSRFTrustedOrigins: "https://app.example.com/, "})
+	assert.Equal(t, []string{"https://app.example.com"}, protector.TrustedOrigins)
+
+	testCases := []struct {
+		name       string
+		method     string
+		cookie     bool
+		bearer     bool
+		headers    map[string]string
+		resultCode int
+	}{
+		{"safe method", http.MethodGet, true, false, map[string]string{"Origin": "https://evil.com"}, http.StatusOK},
+		{"no cookie", http.MethodPost, false, false, map[string]string{"Origin": "https://evil.com"}, http.StatusOK},
+		{"bearer", http.MethodPost, true, true, map[string]string{"Origin": "https://evil.com"}, http.StatusOK},
+		{"same origin", http.MethodPost, true, false, map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+		{"trusted origin", http.MethodPost, true, false, map[string]string{"Origin": "https://app.example.com"}, http.StatusOK},
+		{"cross origin", http.MethodPost, true, false, map[string]string{"Origin": "https://evil.com"}, http.StatusForbidden},
+		{"null origin", http.MethodDelete, true, false, map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"same referer", http.MethodPost, true, false, map[string]string{"Referer": "http://example.com/page"}, http.StatusOK},
+		{"cross referer", http.MethodPost, true, false, map[string]string{"Referer": "https://evil.com/page"}, http.StatusForbidden},
+		{"no origin", http.MethodPost, true, false, nil, http.StatusOK},
+		{"cross site fetch", http.MethodPost, true, false, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/", nil)
+			if tc.cookie {
+				r.AddCookie(&http.Cookie{Name: userCookie, Value: "token"})
+			}
+			if tc.bearer {
+				r.Header.Set("Authorization", "Bearer token")
+			}
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			protector.Handle(MockHandler{}).ServeHTTP(w, r)
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.resultCode, res.StatusCode)
+		})
+	}
+}
+
+func TestCSRFProtectorDoubleSubmit(t *testing.T) {
+	handler := CSRFProtector{Mode: CSRFModeDoubleSubmit}.Handle(MockHandler{})
+
+	// безопасный запрос выдаёт CSRF-куку
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	res := w.Result()
+	defer res.Body.Close()
+
+	var token *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == csrfCookie {
+			token = c
+		}
+	}
+	require.NotNil(t, token)
+	assert.False(t, token.HttpOnly)
+
+	testCases := []struct {
+		name       string
+		header     string
+		resultCode int
+	}{
+		{"matching token", token.Value, http.StatusOK},
+		{"wrong token", "wrong", http.StatusForbidden},
+		{"no token", "", http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.AddCookie(&http.Cookie{Name: userCookie, Value: "token"})
+			r.AddCookie(token)
+			if tc.header != "" {
+				r.Header.Set(CSRFHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.resultCode, res.StatusCode)
+		})
+	}
+}
+
+func TestCSRFProtectorOff(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.AddCookie(&http.Cookie{Name: userCookie, Value: "token"})
+	r.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+
+	CSRFProtector{Mode: CSRFModeOff}.Handle(MockHandler{}).ServeHTTP(w, r)
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
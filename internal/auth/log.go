@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	logger     = zap.NewNop().Sugar()
+	loggerLock sync.RWMutex
+)
+
+// SetLogger задаёт логгер для причин отказа в авторизации. По умолчанию сообщения не пишутся
+func SetLogger(l *zap.SugaredLogger) {
+	loggerLock.Lock()
+	defer loggerLock.Unlock()
+	logger = l
+}
+
+func getLogger() *zap.SugaredLogger {
+	loggerLock.RLock()
+	defer loggerLock.RUnlock()
+	return logger
+}
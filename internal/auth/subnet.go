@@ -3,9 +3,13 @@ package auth
 import (
 	"net/http"
 	"net/netip"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/clientip"
 )
 
-// SubnetChecker middleware для проверки вхождения ip-адреса запроса в подсеть
+// SubnetChecker middleware для проверки вхождения ip-адреса запроса в доверенные подсети.
+// Trusted - подсети через запятую. Адрес клиента берётся из clientip.Resolver, а без него - из RemoteAddr
 type SubnetChecker struct {
 	Trusted string
 }
@@ -13,16 +17,17 @@ type SubnetChecker struct {
 // Handle для использоования SubnetChecker в качестве Middleware
 func (s SubnetChecker) Handle(next http.Handler) http.Handler {
 
+	trusted, err := clientip.ParsePrefixes(s.Trusted)
+	if err != nil {
+		getLogger().Errorln("bad trusted subnet, all requests will be rejected", err)
+	}
+
 	authenticate := func(w http.ResponseWriter, r *http.Request) {
 
-		ipStr := r.Header.Get("X-Real-IP")
+		addr := clientip.FromRequest(r)
 
-		if ipStr == "" {
-			http.Error(w, "Not trusted network", http.StatusForbidden)
-			return
-		}
-		if !checkCIDR(ipStr, s.Trusted) {
-			http.Error(w, "Not trusted network", http.StatusForbidden)
+		if !addr.IsValid() || !trusted.Contains(addr) {
+			apierror.WriteCode(w, r, apierror.CodeForbidden, "Not trusted network")
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -31,16 +36,15 @@ func (s SubnetChecker) Handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(authenticate)
 }
 
-func checkCIDR(ip string, mask string) bool {
-	network, err := netip.ParsePrefix(mask)
+// IsTrustedIP проверяет вхождение ip-адреса в одну из доверенных подсетей
+func IsTrustedIP(ip string, trusted string) bool {
+	addr, err := netip.ParseAddr(ip)
 	if err != nil {
 		return false
 	}
-
-	addr, err := netip.ParseAddr(ip)
+	prefixes, err := clientip.ParsePrefixes(trusted)
 	if err != nil {
 		return false
 	}
-	return network.Contains(addr)
-
+	return prefixes.Contains(addr)
 }
@@ -6,9 +6,11 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/wellywell/shorturl/internal/clientip"
 )
 
-func Test_checkCIDR(t *testing.T) {
+func TestIsTrustedIP(t *testing.T) {
 	type args struct {
 		ip   string
 		mask string
@@ -21,11 +23,14 @@ func Test_checkCIDR(t *testing.T) {
 		{"true", args{"192.168.0.1", "192.168.0.0/24"}, true},
 		{"true", args{"192.168.0.1", "192.168.1.0/24"}, false},
 		{"bad", args{"192", "192.168.1.0/24"}, false},
+		{"second subnet", args{"10.1.2.3", "192.168.1.0/24, 10.0.0.0/8"}, true},
+		{"ipv6", args{"2001:db8::1", "192.168.1.0/24,2001:db8::/32"}, true},
+		{"bad mask", args{"192.168.0.1", "192.168.0.0/24,bad"}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := checkCIDR(tt.args.ip, tt.args.mask); got != tt.want {
-				t.Errorf("checkCIDR() = %v, want %v", got, tt.want)
+			if got := IsTrustedIP(tt.args.ip, tt.args.mask); got != tt.want {
+				t.Errorf("IsTrustedIP() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -39,21 +44,22 @@ func (MockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func TestHandleWithIP(t *testing.T) {
 
 	testCases := []struct {
-		realIP     string
+		remoteAddr string
 		resultCode int
 	}{
-		{"192.168.0.1", http.StatusOK},
-		{"", http.StatusForbidden},
+		{"192.168.0.1:1234", http.StatusOK},
+		{"[2001:db8::1]:1234", http.StatusOK},
+		{"10.0.0.1:1234", http.StatusForbidden},
 		{"123", http.StatusForbidden},
 	}
 
-	handler := &SubnetChecker{Trusted: "192.168.0.0/24"}
+	handler := &SubnetChecker{Trusted: "192.168.0.0/24,2001:db8::/32"}
 	mock := MockHandler{}
 
 	for _, tc := range testCases {
-		t.Run(tc.realIP, func(t *testing.T) {
+		t.Run(tc.remoteAddr, func(t *testing.T) {
 			r := httptest.NewRequest(http.MethodGet, "/", nil)
-			r.Header.Set("X-REAL-IP", tc.realIP)
+			r.RemoteAddr = tc.remoteAddr
 			w := httptest.NewRecorder()
 
 			testHandler := handler.Handle(mock)
@@ -64,18 +70,33 @@ func TestHandleWithIP(t *testing.T) {
 	}
 }
 
-func TestHandleEmptyHeaderP(t *testing.T) {
+func TestHandleSpoofedHeader(t *testing.T) {
 
 	handler := &SubnetChecker{Trusted: "192.168.0.0/24"}
 	mock := MockHandler{}
+	resolver, err := clientip.NewResolver("10.0.0.0/8")
+	assert.NoError(t, err)
 
-	t.Run("noheader", func(t *testing.T) {
+	t.Run("direct client", func(t *testing.T) {
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "203.0.113.5:1234"
+		r.Header.Set("X-Real-IP", "192.168.0.1")
+		r.Header.Set("X-Forwarded-For", "192.168.0.1")
 		w := httptest.NewRecorder()
 
-		testHandler := handler.Handle(mock)
-		testHandler.ServeHTTP(w, r)
+		resolver.Handle(handler.Handle(mock)).ServeHTTP(w, r)
 
 		assert.Equal(t, http.StatusForbidden, w.Code, "Код ответа не совпадает с ожидаемым")
 	})
+
+	t.Run("trusted proxy", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.2:1234"
+		r.Header.Set("X-Forwarded-For", "192.168.0.1")
+		w := httptest.NewRecorder()
+
+		resolver.Handle(handler.Handle(mock)).ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
 }
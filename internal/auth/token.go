@@ -1,9 +1,18 @@
 package auth
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/wellywell/shorturl/internal/config"
 )
 
 // Claims нужен для кастомизации формата JWT token
@@ -12,41 +21,301 @@ type Claims struct {
 	UserID int
 }
 
-const secret = "secret"
+// Причины, по которым токен может быть отклонён
+var (
+	ErrTokenMalformed     = errors.New("token malformed")
+	ErrTokenExpired       = errors.New("token expired")
+	ErrTokenNotValidYet   = errors.New("token not valid yet")
+	ErrTokenNoExpiry      = errors.New("token has no expiry")
+	ErrTokenUnknownKey    = errors.New("token signed with unknown key")
+	ErrTokenBadAlgorithm  = errors.New("token signing method does not match key")
+	ErrTokenBadSignature  = errors.New("token signature invalid")
+	ErrTokenInvalidClaims = errors.New("token claims invalid")
+)
 
-// BuildJWTString формирует jwt-токен, включающий userID
-func BuildJWTString(userID int) (string, error) {
+// Key ключ для подписи либо проверки токенов. Для HS256 SignKey и VerifyKey - один и тот же секрет
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   any
+	VerifyKey any
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		RegisteredClaims: jwt.RegisteredClaims{},
+// KeySet набор ключей: один ключ для подписи новых токенов и несколько для проверки.
+// Позволяет ротировать ключи, не инвалидируя уже выданные токены
+type KeySet struct {
+	signing      Key
+	verification map[string]Key
+	ttl          time.Duration
+	renewBefore  time.Duration
+}
 
-		UserID: userID,
-	})
+// NewKeySet создаёт набор ключей. Ключ подписи автоматически используется и для проверки
+func NewKeySet(signing Key, verification []Key, ttl time.Duration, renewBefore time.Duration) *KeySet {
+	ks := &KeySet{
+		signing:      signing,
+		verification: map[string]Key{signing.ID: signing},
+		ttl:          ttl,
+		renewBefore:  renewBefore,
+	}
+	for _, key := range verification {
+		ks.verification[key.ID] = key
+	}
+	return ks
+}
+
+// LoadKeySet загружает ключи из настроек сервиса
+func LoadKeySet(conf config.ServerConfig) (*KeySet, error) {
+	var signing Key
+	var err error
+
+	switch strings.ToUpper(conf.JWTAlgorithm) {
+	case "", "HS256":
+		secret := []byte(conf.JWTSecret)
+		if len(secret) == 0 && conf.JWTSecretFile != "" {
+			secret, err = readSecretFile(conf.JWTSecretFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("jwt secret is not configured")
+		}
+		signing = Key{Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}
+	case "RS256", "EDDSA":
+		if conf.JWTSigningKeyFile == "" {
+			return nil, fmt.Errorf("jwt signing key file is not configured for %s", conf.JWTAlgorithm)
+		}
+		signing, err = loadPrivateKey(conf.JWTSigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(signing.Method.Alg(), conf.JWTAlgorithm) {
+			return nil, fmt.Errorf("key in %s is not a %s key", conf.JWTSigningKeyFile, conf.JWTAlgorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %s", conf.JWTAlgorithm)
+	}
+	signing.ID = conf.JWTKeyID
+
+	var verification []Key
+	if conf.JWTVerificationKeys != "" {
+		for _, item := range strings.Split(conf.JWTVerificationKeys, ",") {
+			kid, path, found := strings.Cut(strings.TrimSpace(item), "=")
+			if !found {
+				return nil, fmt.Errorf("verification key %q must be in kid=path format", item)
+			}
+			key, err := loadVerificationKey(path)
+			if err != nil {
+				return nil, err
+			}
+			key.ID = kid
+			verification = append(verification, key)
+		}
+	}
+	return NewKeySet(signing, verification, time.Duration(conf.JWTTokenTTL), time.Duration(conf.JWTRenewBefore)), nil
+}
+
+func readSecretFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(data))), nil
+}
 
-	tokenString, err := token.SignedString([]byte(secret))
+// loadPrivateKey читает приватный ключ RSA или Ed25519 в формате PEM
+func loadPrivateKey(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return Key{Method: jwt.SigningMethodRS256, SignKey: rsaKey, VerifyKey: &rsaKey.PublicKey}, nil
+	}
+	if edKey, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		return Key{Method: jwt.SigningMethodEdDSA, SignKey: edKey, VerifyKey: edKey.(ed25519.PrivateKey).Public()}, nil
+	}
+	return Key{}, fmt.Errorf("%s does not contain an RSA or Ed25519 private key", path)
+}
+
+// loadVerificationKey читает ключ для проверки: публичный или приватный ключ в PEM, иначе - секрет HS256
+func loadVerificationKey(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	if !strings.Contains(string(data), "-----BEGIN") {
+		secret := []byte(strings.TrimSpace(string(data)))
+		return Key{Method: jwt.SigningMethodHS256, VerifyKey: secret}, nil
+	}
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return Key{Method: jwt.SigningMethodRS256, VerifyKey: rsaKey}, nil
+	}
+	if edKey, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return Key{Method: jwt.SigningMethodEdDSA, VerifyKey: edKey}, nil
+	}
+	key, err := loadPrivateKey(path)
 	if err != nil {
-		return "", err
+		return Key{}, err
 	}
+	key.SignKey = nil
+	return key, nil
+}
 
-	return tokenString, nil
+// BuildToken формирует jwt-токен, включающий userID
+func (ks *KeySet) BuildToken(userID int) (string, error) {
+	now := time.Now()
+
+	token := jwt.NewWithClaims(ks.signing.Method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ks.ttl)),
+		},
+
+		UserID: userID,
+	})
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+
+	return token.SignedString(ks.signing.SignKey)
 }
 
-// GetUserID получает id пользователя из JWT-токена
-func GetUserID(tokenString string) (int, error) {
+// ParseToken проверяет токен и возвращает его claims. Ошибка содержит причину отказа
+func (ks *KeySet) ParseToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims,
 		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			kid, _ := t.Header["kid"].(string)
+			key, ok := ks.verification[kid]
+			if !ok {
+				return nil, fmt.Errorf("%w: kid %q", ErrTokenUnknownKey, kid)
 			}
-			return []byte(secret), nil
+			if t.Method.Alg() != key.Method.Alg() {
+				return nil, fmt.Errorf("%w: %v", ErrTokenBadAlgorithm, t.Header["alg"])
+			}
+			return key.VerifyKey, nil
 		})
 	if err != nil {
-		return 0, err
+		return nil, rejectionReason(err)
 	}
 
 	if !token.Valid {
-		return 0, fmt.Errorf("token invalid")
+		return nil, ErrTokenInvalidClaims
+	}
+	if claims.ExpiresAt == nil {
+		return nil, ErrTokenNoExpiry
+	}
+
+	return claims, nil
+}
+
+// NeedsRenewal сообщает, что срок жизни токена подходит к концу и его стоит перевыпустить
+func (ks *KeySet) NeedsRenewal(claims *Claims) bool {
+	return claims.ExpiresAt != nil && time.Until(claims.ExpiresAt.Time) < ks.renewBefore
+}
+
+// TTL время жизни выпускаемых токенов
+func (ks *KeySet) TTL() time.Duration {
+	return ks.ttl
+}
+
+func rejectionReason(err error) error {
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) {
+		return fmt.Errorf("%w: %w", ErrTokenMalformed, err)
+	}
+	switch {
+	case validationErr.Inner != nil && (errors.Is(validationErr.Inner, ErrTokenUnknownKey) || errors.Is(validationErr.Inner, ErrTokenBadAlgorithm)):
+		return validationErr.Inner
+	case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+		return fmt.Errorf("%w: %w", ErrTokenMalformed, err)
+	case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return ErrTokenBadSignature
+	case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+		return ErrTokenExpired
+	case validationErr.Errors&jwt.ValidationErrorNotValidYet != 0:
+		return ErrTokenNotValidYet
+	case validationErr.Errors&jwt.ValidationErrorIssuedAt != 0:
+		return ErrTokenNotValidYet
+	}
+	return fmt.Errorf("%w: %w", ErrTokenInvalidClaims, err)
+}
+
+var (
+	defaultKeys     *KeySet
+	defaultKeysLock sync.RWMutex
+)
+
+// Setup загружает ключи из настроек и делает их ключами по умолчанию для пакета,
+// и настраивает атрибуты кук
+func Setup(conf config.ServerConfig) error {
+	opts, err := NewCookieOptions(conf)
+	if err != nil {
+		return err
+	}
+	SetCookieOptions(opts)
+
+	if conf.JWTAlgorithm == "" || strings.EqualFold(conf.JWTAlgorithm, "HS256") {
+		if conf.JWTSecret == "" && conf.JWTSecretFile == "" {
+			getLogger().Warnln("JWT secret is not configured, using a random one: sessions will not survive a restart")
+			SetKeySet(newRandomKeySet(time.Duration(conf.JWTTokenTTL), time.Duration(conf.JWTRenewBefore)))
+			return nil
+		}
+	}
+	ks, err := LoadKeySet(conf)
+	if err != nil {
+		return err
+	}
+	SetKeySet(ks)
+	return nil
+}
+
+// SetKeySet задаёт набор ключей по умолчанию
+func SetKeySet(ks *KeySet) {
+	defaultKeysLock.Lock()
+	defer defaultKeysLock.Unlock()
+	defaultKeys = ks
+}
+
+func getKeySet() *KeySet {
+	defaultKeysLock.RLock()
+	ks := defaultKeys
+	defaultKeysLock.RUnlock()
+	if ks != nil {
+		return ks
+	}
+
+	defaultKeysLock.Lock()
+	defer defaultKeysLock.Unlock()
+	if defaultKeys == nil {
+		defaultKeys = newRandomKeySet(30*24*time.Hour, 7*24*time.Hour)
+	}
+	return defaultKeys
+}
+
+// newRandomKeySet используется, если ключи не настроены: токены живут только до перезапуска
+func newRandomKeySet(ttl time.Duration, renewBefore time.Duration) *KeySet {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return NewKeySet(Key{Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}, nil, ttl, renewBefore)
+}
+
+// BuildJWTString формирует jwt-токен, включающий userID
+func BuildJWTString(userID int) (string, error) {
+	return getKeySet().BuildToken(userID)
+}
+
+// GetUserID получает id пользователя из JWT-токена
+func GetUserID(tokenString string) (int, error) {
+	claims, err := getKeySet().ParseToken(tokenString)
+	if err != nil {
+		getLogger().Infoln("JWT rejected", "reason", err)
+		return 0, err
 	}
 
 	return claims.UserID, nil
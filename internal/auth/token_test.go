@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/config"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func writePrivateKey(t *testing.T, key any) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return writeFile(t, "key.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestLoadKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		conf    config.ServerConfig
+		alg     string
+		wantErr bool
+	}{
+		{"hs256 secret", config.ServerConfig{JWTSecret: "s3cret"}, "HS256", false},
+		{"hs256 file", config.ServerConfig{JWTSecretFile: writeFile(t, "secret", []byte("s3cret\n"))}, "HS256", false},
+		{"hs256 missing", config.ServerConfig{JWTAlgorithm: "HS256"}, "", true},
+		{"rs256", config.ServerConfig{JWTAlgorithm: "RS256", JWTSigningKeyFile: writePrivateKey(t, rsaKey)}, "RS256", false},
+		{"eddsa", config.ServerConfig{JWTAlgorithm: "EdDSA", JWTSigningKeyFile: writePrivateKey(t, edKey)}, "EdDSA", false},
+		{"wrong key type", config.ServerConfig{JWTAlgorithm: "RS256", JWTSigningKeyFile: writePrivateKey(t, edKey)}, "", true},
+		{"unknown alg", config.ServerConfig{JWTAlgorithm: "none"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.JWTTokenTTL = config.Duration(time.Hour)
+			ks, err := LoadKeySet(tt.conf)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			token, err := ks.BuildToken(42)
+			require.NoError(t, err)
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, parsed.Method.Alg())
+
+			claims, err := ks.ParseToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, 42, claims.UserID)
+			assert.NotNil(t, claims.IssuedAt)
+			assert.NotNil(t, claims.NotBefore)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldSecret := writeFile(t, "old", []byte("old-secret"))
+
+	oldKeys, err := LoadKeySet(config.ServerConfig{JWTSecret: "old-secret", JWTKeyID: "old", JWTTokenTTL: config.Duration(time.Hour)})
+	require.NoError(t, err)
+	oldToken, err := oldKeys.BuildToken(1)
+	require.NoError(t, err)
+
+	newKeys, err := LoadKeySet(config.ServerConfig{
+		JWTSecret:           "new-secret",
+		JWTKeyID:            "new",
+		JWTVerificationKeys: "old=" + oldSecret,
+		JWTTokenTTL:         config.Duration(time.Hour),
+	})
+	require.NoError(t, err)
+
+	claims, err := newKeys.ParseToken(oldToken)
+	require.NoError(t, err, "токен, подписанный старым ключом, должен приниматься")
+	assert.Equal(t, 1, claims.UserID)
+
+	newToken, err := newKeys.BuildToken(2)
+	require.NoError(t, err)
+	_, err = oldKeys.ParseToken(newToken)
+	assert.ErrorIs(t, err, ErrTokenUnknownKey)
+}
+
+func TestParseTokenRejections(t *testing.T) {
+	secret := []byte("secret")
+	ks := NewKeySet(Key{Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}, nil, time.Hour, time.Minute)
+
+	sign := func(method jwt.SigningMethod, key any, claims Claims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		require.NoError(t, err)
+		return token
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", sign(jwt.SigningMethodHS256, secret, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute))}}), ErrTokenExpired},
+		{"not yet valid", sign(jwt.SigningMethodHS256, secret, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)), NotBefore: jwt.NewNumericDate(now.Add(time.Minute))}}), ErrTokenNotValidYet},
+		{"no expiry", sign(jwt.SigningMethodHS256, secret, Claims{UserID: 1}), ErrTokenNoExpiry},
+		{"forged", sign(jwt.SigningMethodHS256, []byte("other"), Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}}), ErrTokenBadSignature},
+		{"wrong alg", sign(jwt.SigningMethodHS512, secret, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}}), ErrTokenBadAlgorithm},
+		{"garbage", "not.a.token", ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ks.ParseToken(tt.token)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestRenewAuthCookie(t *testing.T) {
+	secret := []byte("secret")
+	SetKeySet(NewKeySet(Key{Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}, nil, time.Hour, 2*time.Hour))
+	defer SetKeySet(nil)
+
+	token, err := BuildJWTString(9)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: userCookie, Value: token})
+	w := httptest.NewRecorder()
+
+	require.NoError(t, RenewAuthCookie(w, r))
+	cookies := w.Result().Cookies()
+	defer w.Result().Body.Close()
+	require.Len(t, cookies, 1, "кука должна быть перевыпущена")
+
+	userID, err := GetUserID(cookies[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, 9, userID)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+// Ошибки проверки пользователя
+var (
+	ErrUserBlocked = errors.New("user is blocked")
+	ErrUserErased  = errors.New("user is erased")
+	ErrForbidden   = errors.New("user does not have the required role")
+)
+
+// UserStore - интерфейс хранилища пользователей, из которого берутся роль и признак блокировки
+type UserStore interface {
+	GetUser(ctx context.Context, userID int) (storage.User, error)
+}
+
+var (
+	userStore     UserStore
+	userStoreLock sync.RWMutex
+)
+
+// SetUserStore задаёт хранилище пользователей. Пока оно не задано, блокировки и роли не проверяются
+func SetUserStore(store UserStore) {
+	userStoreLock.Lock()
+	defer userStoreLock.Unlock()
+	userStore = store
+}
+
+func getUserStore() UserStore {
+	userStoreLock.RLock()
+	defer userStoreLock.RUnlock()
+	return userStore
+}
+
+// CheckUser проверяет, что пользователь не заблокирован и не стёрт. Сессия стёртого пользователя
+// остаётся валидной по подписи и сроку, поэтому отклоняется здесь с ErrUserErased
+func CheckUser(ctx context.Context, userID int) error {
+	store := getUserStore()
+	if store == nil {
+		return nil
+	}
+	user, err := store.GetUser(ctx, userID)
+	if err != nil {
+		var notFound *storage.KeyNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		var erased *storage.UserIsErased
+		if errors.As(err, &erased) {
+			return ErrUserErased
+		}
+		return err
+	}
+	if user.IsBlocked {
+		return ErrUserBlocked
+	}
+	return nil
+}
+
+// RequireRole проверяет, что у пользователя есть роль и он не заблокирован
+func RequireRole(ctx context.Context, userID int, role string) error {
+	store := getUserStore()
+	if store == nil {
+		return ErrForbidden
+	}
+	user, err := store.GetUser(ctx, userID)
+	if err != nil {
+		var notFound *storage.KeyNotFoundError
+		var erased *storage.UserIsErased
+		if errors.As(err, &notFound) || errors.As(err, &erased) {
+			return ErrForbidden
+		}
+		return err
+	}
+	if user.IsBlocked {
+		return ErrUserBlocked
+	}
+	if user.Role != role {
+		return ErrForbidden
+	}
+	return nil
+}
+
+type userIDKey struct{}
+
+// WithUserID сохраняет id проверенного пользователя в контексте
+func WithUserID(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFromContext достаёт id пользователя, сохранённый RoleChecker
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(int)
+	return userID, ok
+}
+
+// RoleChecker middleware, пропускающая только пользователей с заданной ролью.
+// Принимается только сессия пользователя, API-ключи не подходят
+type RoleChecker struct {
+	Role string
+}
+
+// Handle для использования RoleChecker в качестве Middleware
+func (c RoleChecker) Handle(next http.Handler) http.Handler {
+
+	check := func(w http.ResponseWriter, r *http.Request) {
+		userID, err := VerifySession(r)
+		if errors.Is(err, ErrUserBlocked) {
+			apierror.WriteCode(w, r, apierror.CodeForbidden, "Forbidden")
+			return
+		}
+		if err != nil {
+			apierror.WriteCode(w, r, apierror.CodeUnauthorized, "Authorize error")
+			return
+		}
+		err = RequireRole(r.Context(), userID, c.Role)
+		if errors.Is(err, ErrUserBlocked) || errors.Is(err, ErrForbidden) {
+			apierror.WriteCode(w, r, apierror.CodeForbidden, "Forbidden")
+			return
+		}
+		if err != nil {
+			apierror.WriteCode(w, r, apierror.CodeInternal, "Something went wrong")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUserID(r.Context(), userID)))
+	}
+	return http.HandlerFunc(check)
+}
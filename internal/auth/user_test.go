@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestRoleChecker(t *testing.T) {
+	st := storage.NewMemory()
+	SetUserStore(st)
+	defer SetUserStore(nil)
+
+	ctx := context.Background()
+	admin, _ := st.CreateNewUser(ctx)
+	user, _ := st.CreateNewUser(ctx)
+	blocked, _ := st.CreateNewUser(ctx)
+	require.NoError(t, st.SetUserRole(ctx, admin, storage.RoleAdmin))
+	require.NoError(t, st.SetUserBlocked(ctx, blocked, true))
+
+	var seen int
+	handler := RoleChecker{Role: storage.RoleAdmin}.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = UserIDFromContext(r.Context())
+	}))
+
+	testCases := []struct {
+		name   string
+		userID int
+		want   int
+	}{
+		{"admin", admin, http.StatusOK},
+		{"user", user, http.StatusForbidden},
+		{"blocked", blocked, http.StatusForbidden},
+		{"anonymous", 0, http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.userID != 0 {
+				token, err := BuildJWTString(tc.userID)
+				require.NoError(t, err)
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+	assert.Equal(t, admin, seen)
+
+	t.Run("blocked session rejected", func(t *testing.T) {
+		token, err := BuildJWTString(blocked)
+		require.NoError(t, err)
+		_, err = VerifyToken(ctx, token)
+		assert.ErrorIs(t, err, ErrUserBlocked)
+	})
+}
+
+func TestErasedUserSession(t *testing.T) {
+	st := storage.NewMemory()
+	SetUserStore(st)
+	defer SetUserStore(nil)
+
+	ctx := context.Background()
+	userID, _ := st.CreateNewUser(ctx)
+	token, err := BuildJWTString(userID)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: userCookie, Value: token})
+	got, err := VerifyUser(r)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got)
+
+	// подпись и срок токена не меняются, но стёртый пользователь больше не принимается
+	require.NoError(t, st.EraseUser(ctx, userID, false))
+	_, err = VerifyUser(r)
+	assert.ErrorIs(t, err, ErrUserErased)
+	_, err = VerifyToken(ctx, token)
+	assert.ErrorIs(t, err, ErrUserErased)
+	assert.ErrorIs(t, RequireRole(ctx, userID, storage.RoleUser), ErrForbidden)
+}
@@ -0,0 +1,305 @@
+// Package acmetest реализует упрощённый ACME-сервер (RFC 8555) в памяти процесса для тестов, по аналогии с Pebble.
+// Заказы сразу считаются подтверждёнными, без проверки владения доменом, сертификаты подписываются собственным CA.
+// Подписи JWS не проверяются
+package acmetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type order struct {
+	Status         string       `json:"status"`
+	Identifiers    []identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+
+	chain []byte
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Server тестовый ACME-сервер
+type Server struct {
+	server *httptest.Server
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	// CertLifetime срок жизни выпускаемых сертификатов
+	CertLifetime time.Duration
+
+	lock   sync.Mutex
+	nonce  int
+	orders []*order
+	issued int
+}
+
+// NewServer запускает ACME-сервер
+func NewServer() *Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acmetest root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{caKey: key, caCert: caCert, CertLifetime: 90 * 24 * time.Hour}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /directory", s.handleDirectory)
+	mux.HandleFunc("HEAD /new-nonce", s.handleNonce)
+	mux.HandleFunc("GET /new-nonce", s.handleNonce)
+	mux.HandleFunc("POST /new-account", s.handleNewAccount)
+	mux.HandleFunc("POST /new-order", s.handleNewOrder)
+	mux.HandleFunc("POST /order/{id}", s.handleOrder)
+	mux.HandleFunc("POST /finalize/{id}", s.handleFinalize)
+	mux.HandleFunc("POST /cert/{id}", s.handleCert)
+	s.server = httptest.NewServer(mux)
+	return s
+}
+
+// DirectoryURL адрес каталога для acme.Client
+func (s *Server) DirectoryURL() string {
+	return s.server.URL + "/directory"
+}
+
+// Roots корневой сертификат, которым подписаны выпущенные сертификаты
+func (s *Server) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.caCert)
+	return pool
+}
+
+// Issued количество выпущенных сертификатов
+func (s *Server) Issued() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.issued
+}
+
+// Close останавливает сервер
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) url(path string, id int) string {
+	return s.server.URL + path + strconv.Itoa(id)
+}
+
+func (s *Server) addNonce(w http.ResponseWriter) {
+	s.lock.Lock()
+	s.nonce++
+	nonce := strconv.Itoa(s.nonce)
+	s.lock.Unlock()
+	w.Header().Set("Replay-Nonce", "nonce-"+nonce)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, location string, body any) {
+	s.addNonce(w)
+	if location != "" {
+		w.Header().Set("Location", location)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, detail string) {
+	s.addNonce(w)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"type":   "urn:ietf:params:acme:error:malformed",
+		"detail": detail,
+	})
+}
+
+// readPayload достаёт полезную нагрузку из JWS в виде flattened JSON
+func readPayload(r *http.Request, v any) error {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return err
+	}
+	if jws.Payload == "" || v == nil {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func (s *Server) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, "", map[string]string{
+		"newNonce":   s.server.URL + "/new-nonce",
+		"newAccount": s.server.URL + "/new-account",
+		"newOrder":   s.server.URL + "/new-order",
+		"revokeCert": s.server.URL + "/revoke-cert",
+		"keyChange":  s.server.URL + "/key-change",
+	})
+}
+
+func (s *Server) handleNonce(w http.ResponseWriter, r *http.Request) {
+	s.addNonce(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleNewAccount(w http.ResponseWriter, r *http.Request) {
+	if err := readPayload(r, nil); err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, s.server.URL+"/account/1", map[string]string{"status": "valid"})
+}
+
+func (s *Server) handleNewOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Identifiers []identifier `json:"identifiers"`
+	}
+	if err := readPayload(r, &req); err != nil || len(req.Identifiers) == 0 {
+		s.writeError(w, http.StatusBadRequest, "bad order")
+		return
+	}
+
+	s.lock.Lock()
+	id := len(s.orders)
+	o := &order{
+		Status:         "ready",
+		Identifiers:    req.Identifiers,
+		Authorizations: []string{},
+		Finalize:       s.url("/finalize/", id),
+	}
+	s.orders = append(s.orders, o)
+	s.lock.Unlock()
+
+	s.writeJSON(w, http.StatusCreated, s.url("/order/", id), o)
+}
+
+func (s *Server) getOrder(r *http.Request) (*order, int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil || id < 0 || id >= len(s.orders) {
+		return nil, 0, false
+	}
+	return s.orders[id], id, true
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) {
+	o, id, ok := s.getOrder(r)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "no such order")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.url("/order/", id), o)
+}
+
+func (s *Server) handleFinalize(w http.ResponseWriter, r *http.Request) {
+	o, id, ok := s.getOrder(r)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "no such order")
+		return
+	}
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	if err := readPayload(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil || csr.CheckSignature() != nil {
+		s.writeError(w, http.StatusBadRequest, "bad csr")
+		return
+	}
+
+	chain, err := s.issue(csr)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	o.Status = "valid"
+	o.Certificate = s.url("/cert/", id)
+	o.chain = chain
+	s.issued++
+	s.lock.Unlock()
+
+	s.writeJSON(w, http.StatusOK, s.url("/order/", id), o)
+}
+
+func (s *Server) handleCert(w http.ResponseWriter, r *http.Request) {
+	o, _, ok := s.getOrder(r)
+	if !ok || o.chain == nil {
+		s.writeError(w, http.StatusNotFound, "no such certificate")
+		return
+	}
+	s.addNonce(w)
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	_, _ = w.Write(o.chain)
+}
+
+func (s *Server) issue(csr *x509.CertificateRequest) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(s.CertLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not issue certificate: %w", err)
+	}
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw})...)
+	return chain, nil
+}
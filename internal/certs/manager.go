@@ -0,0 +1,193 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/wellywell/shorturl/internal/config"
+)
+
+// Источники сертификата сервера
+const (
+	// ModeFiles сертификат и ключ из файлов
+	ModeFiles = "files"
+	// ModeSelfSigned самоподписанный сертификат, который создаётся при первом запуске и сохраняется в файлы
+	ModeSelfSigned = "self-signed"
+	// ModeACME сертификаты от ACME-сервера, например Let's Encrypt
+	ModeACME = "acme"
+)
+
+// Сроки самоподписанного сертификата
+const (
+	selfSignedValidFor    = 365 * 24 * time.Hour
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+	selfSignedCheckPeriod = 12 * time.Hour
+)
+
+// Manager выдаёт TLS-конфигурацию для HTTP и gRPC серверов и продлевает сертификаты в фоне
+type Manager struct {
+	tlsConfig *tls.Config
+	logger    *zap.SugaredLogger
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewManager готовит сертификат сервера согласно настройкам TLSMode. В logger пишутся ошибки продления сертификатов
+func NewManager(conf config.ServerConfig, logger *zap.SugaredLogger) (*Manager, error) {
+	m := &Manager{stop: make(chan struct{}), logger: logger}
+
+	switch conf.TLSMode {
+	case "", ModeFiles:
+		reloader, err := m.newReloader(conf.TLSCertFile, conf.TLSKeyFile, conf.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		m.tlsConfig, err = reloader.TLSConfig(conf.TLSClientAuth)
+		if err != nil {
+			return nil, err
+		}
+
+	case ModeSelfSigned:
+		hosts := SelfSignedHosts(conf)
+		ensure := func() error {
+			_, err := EnsureSelfSigned(conf.TLSCertFile, conf.TLSKeyFile, hosts, selfSignedValidFor, selfSignedRenewBefore)
+			return err
+		}
+		if err := ensure(); err != nil {
+			return nil, err
+		}
+		reloader, err := m.newReloader(conf.TLSCertFile, conf.TLSKeyFile, conf.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		m.tlsConfig, err = reloader.TLSConfig(conf.TLSClientAuth)
+		if err != nil {
+			return nil, err
+		}
+		// перевыпущенный сертификат подхватит Reloader
+		m.every(selfSignedCheckPeriod, func() {
+			if err := ensure(); err != nil {
+				m.logger.Errorln("could not renew self-signed certificate", err)
+			}
+		})
+
+	case ModeACME:
+		domains := splitList(conf.ACMEDomains)
+		if len(domains) == 0 {
+			return nil, fmt.Errorf("ACME mode requires at least one domain")
+		}
+		var clientCAs *Reloader
+		if conf.TLSClientCAFile != "" {
+			var err error
+			clientCAs, err = m.newReloader("", "", conf.TLSClientCAFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// autocert сам продлевает полученные сертификаты в фоне
+		acmeManager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(conf.ACMECacheDir),
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Email:      conf.ACMEEmail,
+			Client:     &acme.Client{DirectoryURL: conf.ACMEDirectoryURL},
+		}
+		base := acmeManager.TLSConfig()
+		// клиенты, обращающиеся по ip-адресу, не передают SNI - им отдаётся сертификат первого домена
+		base.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName == "" {
+				hello.ServerName = domains[0]
+			}
+			return acmeManager.GetCertificate(hello)
+		}
+		var err error
+		m.tlsConfig, err = clientCAs.tlsConfig(base, conf.TLSClientAuth)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q", conf.TLSMode)
+	}
+	return m, nil
+}
+
+// TLSConfig конфигурация для http.Server и credentials.NewTLS
+func (m *Manager) TLSConfig() *tls.Config {
+	return m.tlsConfig
+}
+
+// Close останавливает фоновое продление сертификатов
+func (m *Manager) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+	})
+	m.wg.Wait()
+	return nil
+}
+
+func (m *Manager) every(period time.Duration, fn func()) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
+
+// SelfSignedHosts имена и адреса для самоподписанного сертификата: хосты из настроек и localhost
+func SelfSignedHosts(conf config.ServerConfig) []string {
+	var hosts []string
+	if u, err := url.Parse(conf.ShortURLsAddress); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+	if host, _, err := net.SplitHostPort(conf.BaseAddress); err == nil && host != "" {
+		hosts = append(hosts, host)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// newReloader создаёт Reloader, который пишет ошибки перезагрузки в логгер менеджера
+func (m *Manager) newReloader(certFile string, keyFile string, caFile string) (*Reloader, error) {
+	r, err := NewReloader(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+	r.logger = m.logger
+	return r, nil
+}
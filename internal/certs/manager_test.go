@@ -0,0 +1,139 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/wellywell/shorturl/internal/certs/acmetest"
+	"github.com/wellywell/shorturl/internal/config"
+)
+
+// handshake поднимает TLS-сервер с конфигурацией сервера и возвращает сертификат, который увидел клиент
+func handshake(t *testing.T, serverConfig *tls.Config, serverName string, roots *x509.CertPool) (*x509.Certificate, error) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", listener.Addr().String(), &tls.Config{
+		ServerName: serverName,
+		RootCAs:    roots,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestManagerSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	conf := config.ServerConfig{
+		TLSMode:          ModeSelfSigned,
+		TLSCertFile:      filepath.Join(dir, "tls", "server.crt"),
+		TLSKeyFile:       filepath.Join(dir, "tls", "server.key"),
+		BaseAddress:      "localhost:8080",
+		ShortURLsAddress: "https://short.test",
+	}
+
+	m, err := NewManager(conf, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	defer m.Close()
+
+	first, err := os.ReadFile(conf.TLSCertFile)
+	require.NoError(t, err)
+	info, err := os.Stat(conf.TLSKeyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	selfSigned, err := parsePEMCertificate(first)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(selfSigned)
+
+	cert, err := handshake(t, m.TLSConfig(), "short.test", roots)
+	require.NoError(t, err)
+	assert.Equal(t, "short.test", cert.Subject.CommonName)
+	assert.Contains(t, cert.DNSNames, "localhost")
+
+	// при повторном запуске используется сохранённый сертификат
+	again, err := NewManager(conf, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	defer again.Close()
+	second, err := os.ReadFile(conf.TLSCertFile)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	// истекающий сертификат перевыпускается
+	certFile, keyFile := filepath.Join(dir, "short.crt"), filepath.Join(dir, "short.key")
+	created, err := EnsureSelfSigned(certFile, keyFile, []string{"localhost"}, time.Hour, 0)
+	require.NoError(t, err)
+	assert.True(t, created)
+	renewed, err := EnsureSelfSigned(certFile, keyFile, []string{"localhost"}, time.Hour, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, renewed)
+	renewed, err = EnsureSelfSigned(certFile, keyFile, []string{"localhost"}, time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, renewed)
+}
+
+func TestManagerACME(t *testing.T) {
+	ca := acmetest.NewServer()
+	defer ca.Close()
+
+	conf := config.ServerConfig{
+		TLSMode:          ModeACME,
+		ACMEDomains:      "short.test, www.short.test",
+		ACMEDirectoryURL: ca.DirectoryURL(),
+		ACMECacheDir:     t.TempDir(),
+	}
+
+	m, err := NewManager(conf, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	defer m.Close()
+
+	cert, err := handshake(t, m.TLSConfig(), "short.test", ca.Roots())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"short.test"}, cert.DNSNames)
+	assert.Equal(t, 1, ca.Issued())
+
+	// домен не из списка не обслуживается
+	_, err = handshake(t, m.TLSConfig(), "evil.test", ca.Roots())
+	assert.Error(t, err)
+
+	// сертификат берётся из кэша и после перезапуска
+	restarted, err := NewManager(conf, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	defer restarted.Close()
+	_, err = handshake(t, restarted.TLSConfig(), "short.test", ca.Roots())
+	require.NoError(t, err)
+	assert.Equal(t, 1, ca.Issued())
+
+	_, err = NewManager(config.ServerConfig{TLSMode: ModeACME}, zap.NewNop().Sugar())
+	assert.Error(t, err)
+	_, err = NewManager(config.ServerConfig{TLSMode: "magic"}, zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
+
+func parsePEMCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,212 @@
+// Package certs отвечает за TLS-сертификаты серверов: загрузку из файлов с перечитыванием при изменении
+// и проверку клиентских сертификатов (mTLS)
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Режимы проверки клиентских сертификатов
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// ErrNoClientCA для проверки клиентских сертификатов нужен файл с корневыми сертификатами
+var ErrNoClientCA = errors.New("client CA file is required for client certificate auth")
+
+// defaultCheckInterval как часто проверяется, не изменились ли файлы
+const defaultCheckInterval = time.Second
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// Reloader отдаёт сертификат сервера и корневые сертификаты клиентов, перечитывая файлы, когда они меняются.
+// Перезапускать ListenAndServe или grpc.Serve для смены сертификата не нужно
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	checkInterval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	states    map[string]fileState
+	lastCheck time.Time
+
+	logger *zap.SugaredLogger
+}
+
+// NewReloader загружает сертификат и ключ сервера, и, если caFile не пустой, корневые сертификаты клиентов.
+// Если certFile пустой, Reloader отвечает только за корневые сертификаты клиентов
+func NewReloader(certFile string, keyFile string, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		caFile:        caFile,
+		checkInterval: defaultCheckInterval,
+		logger:        zap.NewNop().Sugar(),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	var files []string
+	if r.certFile != "" {
+		files = append(files, r.certFile, r.keyFile)
+	}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+func (r *Reloader) reload() error {
+	states := make(map[string]fileState)
+	for _, path := range r.files() {
+		state, err := statFile(path)
+		if err != nil {
+			return err
+		}
+		states[path] = state
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		loaded, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("could not load certificate: %w", err)
+		}
+		cert = &loaded
+	}
+
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = cert
+	r.clientCAs = clientCAs
+	r.states = states
+	r.lastCheck = time.Now()
+	return nil
+}
+
+// maybeReload перечитывает файлы, если они изменились. Если новые файлы не загружаются
+// (например, записаны не до конца), продолжает работать старый сертификат
+func (r *Reloader) maybeReload() {
+	r.mu.RLock()
+	due := time.Since(r.lastCheck) >= r.checkInterval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	r.mu.Lock()
+	r.lastCheck = time.Now()
+	changed := false
+	for _, path := range r.files() {
+		state, err := statFile(path)
+		if err == nil && state != r.states[path] {
+			changed = true
+		}
+	}
+	r.mu.Unlock()
+
+	if changed {
+		if err := r.reload(); err != nil {
+			r.logger.Errorln("could not reload certificate", err)
+		}
+	}
+}
+
+// GetCertificate для использования в tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// ClientCAs текущие корневые сертификаты для проверки клиентов
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs
+}
+
+// TLSConfig конфигурация сервера. clientAuth - none, optional либо require
+func (r *Reloader) TLSConfig(clientAuth string) (*tls.Config, error) {
+	return r.tlsConfig(&tls.Config{GetCertificate: r.GetCertificate}, clientAuth)
+}
+
+// tlsConfig дополняет base проверкой клиентских сертификатов из файлов Reloader
+func (r *Reloader) tlsConfig(base *tls.Config, clientAuth string) (*tls.Config, error) {
+	authType, err := parseClientAuth(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if authType != tls.NoClientCert && (r == nil || r.caFile == "") {
+		return nil, ErrNoClientCA
+	}
+
+	base.MinVersion = tls.VersionTLS12
+	base.ClientAuth = authType
+	if authType == tls.NoClientCert {
+		return base, nil
+	}
+	// корневые сертификаты клиентов тоже могут смениться, поэтому конфиг собирается на каждое соединение
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		conf := base.Clone()
+		conf.GetConfigForClient = nil
+		conf.ClientCAs = r.ClientCAs()
+		return conf, nil
+	}
+	return base, nil
+}
+
+func parseClientAuth(value string) (tls.ClientAuthType, error) {
+	switch value {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", value)
+}
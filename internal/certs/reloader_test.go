@@ -0,0 +1,203 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/auth"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issue выпускает сертификат, подписанный parent, либо самоподписанный, если parent nil
+func issue(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func newCA(t *testing.T, name string) *testCert {
+	return issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func (c *testCert) write(t *testing.T, certFile string, keyFile string) {
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	if keyFile == "" {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+func serverCert(t *testing.T, ca *testCert, name string) *testCert {
+	return issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+}
+
+func TestReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+
+	ca := newCA(t, "ca")
+	serverCert(t, ca, "first").write(t, certFile, keyFile)
+
+	r, err := NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	r.checkInterval = 0
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", cert.Leaf.Subject.CommonName)
+
+	// недописанный файл не ломает работающий сертификат
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0o600))
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", cert.Leaf.Subject.CommonName)
+
+	serverCert(t, ca, "second").write(t, certFile, keyFile)
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", cert.Leaf.Subject.CommonName)
+}
+
+func TestReloaderTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newCA(t, "ca")
+	serverCert(t, ca, "server").write(t, certFile, keyFile)
+	ca.write(t, caFile, "")
+
+	r, err := NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	_, err = r.TLSConfig(ClientAuthRequire)
+	assert.ErrorIs(t, err, ErrNoClientCA)
+	_, err = r.TLSConfig("sometimes")
+	assert.Error(t, err)
+
+	r, err = NewReloader(certFile, keyFile, caFile)
+	require.NoError(t, err)
+	tlsConfig, err := r.TLSConfig(ClientAuthOptional)
+	require.NoError(t, err)
+
+	identities, err := auth.ParseCertIdentities("alice=user:7,spiffe://shorturl/monitoring=service:monitoring")
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(auth.ClientCertAuth{Identities: identities}.Handle(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := auth.CertIdentityFromContext(r.Context())
+			if !ok {
+				fmt.Fprint(w, "anonymous")
+				return
+			}
+			fmt.Fprintf(w, "%d/%s", identity.UserID, identity.Service)
+		})))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(clientCerts ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs: roots,
+			// сертификат отправляется, даже если сервер ждёт другой центр сертификации
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if len(clientCerts) == 0 {
+					return &tls.Certificate{}, nil
+				}
+				return &clientCerts[0], nil
+			},
+		}}}
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body := make([]byte, 64)
+		n, _ := res.Body.Read(body)
+		return string(body[:n]), nil
+	}
+
+	alice := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "alice"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	body, err := get(alice.tlsCertificate())
+	require.NoError(t, err)
+	assert.Equal(t, "7/", body)
+
+	spiffe, err := url.Parse("spiffe://shorturl/monitoring")
+	require.NoError(t, err)
+	monitoring := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "unused"},
+		URIs:        []*url.URL{spiffe},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	body, err = get(monitoring.tlsCertificate())
+	require.NoError(t, err)
+	assert.Equal(t, "0/monitoring", body)
+
+	body, err = get()
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous", body)
+
+	// сертификат чужого центра сертификации не принимается
+	stranger := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "alice"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, newCA(t, "other"))
+	_, err = get(stranger.tlsCertificate())
+	assert.Error(t, err)
+}
@@ -0,0 +1,193 @@
+// Package clientip определяет ip-адрес клиента с учётом доверенных прокси.
+// Заголовки X-Forwarded-For, Forwarded и X-Real-IP учитываются только если запрос пришёл от доверенного прокси
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Prefixes набор подсетей IPv4 и IPv6
+type Prefixes []netip.Prefix
+
+// ParsePrefixes разбирает список подсетей через запятую. Отдельный адрес считается подсетью из одного адреса
+func ParsePrefixes(value string) (Prefixes, error) {
+	var result Prefixes
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("bad subnet %q: %w", item, err)
+			}
+			addr = addr.Unmap()
+			result = append(result, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("bad subnet %q: %w", item, err)
+		}
+		result = append(result, prefix.Masked())
+	}
+	return result, nil
+}
+
+// Contains проверяет вхождение адреса хотя бы в одну из подсетей
+func (p Prefixes) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver определяет адрес клиента. Без доверенных прокси адресом клиента всегда считается RemoteAddr
+type Resolver struct {
+	proxies Prefixes
+}
+
+// NewResolver инициализирует Resolver со списком подсетей доверенных прокси через запятую
+func NewResolver(trustedProxies string) (*Resolver, error) {
+	proxies, err := ParsePrefixes(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{proxies: proxies}, nil
+}
+
+// IsTrustedProxy проверяет, что адрес принадлежит доверенному прокси
+func (res *Resolver) IsTrustedProxy(addr netip.Addr) bool {
+	return res != nil && res.proxies.Contains(addr)
+}
+
+// ClientIP возвращает адрес клиента. Цепочка адресов из Forwarded, либо X-Forwarded-For,
+// просматривается справа налево, пока адреса принадлежат доверенным прокси
+func (res *Resolver) ClientIP(r *http.Request) netip.Addr {
+	addr, ok := remoteAddr(r)
+	if !ok || !res.IsTrustedProxy(addr) {
+		return addr
+	}
+
+	chain, found := forwardedChain(r.Header)
+	if !found {
+		chain, found = forwardedForChain(r.Header)
+	}
+	if !found {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap()
+		}
+		return addr
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop, err := parseHop(chain[i])
+		if err != nil {
+			// дальше этого звена цепочке доверять нельзя
+			return addr
+		}
+		addr = hop
+		if !res.proxies.Contains(addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+type contextKey struct{}
+
+// Handle для использования Resolver в качестве Middleware. Сохраняет адрес клиента в контексте запроса
+func (res *Resolver) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := NewContext(r.Context(), res.ClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// NewContext сохраняет адрес клиента в контексте
+func NewContext(ctx context.Context, addr netip.Addr) context.Context {
+	return context.WithValue(ctx, contextKey{}, addr)
+}
+
+// FromContext достаёт адрес клиента, сохранённый Resolver
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(contextKey{}).(netip.Addr)
+	return addr, ok && addr.IsValid()
+}
+
+// FromRequest возвращает адрес, определённый Resolver, а если middleware не подключена - RemoteAddr
+func FromRequest(r *http.Request) netip.Addr {
+	if addr, ok := FromContext(r.Context()); ok {
+		return addr
+	}
+	addr, _ := remoteAddr(r)
+	return addr
+}
+
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// forwardedChain достаёт значения for из заголовков Forwarded (RFC 7239)
+func forwardedChain(header http.Header) ([]string, bool) {
+	values := header.Values("Forwarded")
+	if len(values) == 0 {
+		return nil, false
+	}
+	var chain []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var forValue string
+			for _, pair := range strings.Split(element, ";") {
+				name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					forValue = strings.Trim(val, `"`)
+				}
+			}
+			chain = append(chain, forValue)
+		}
+	}
+	return chain, true
+}
+
+func forwardedForChain(header http.Header) ([]string, bool) {
+	values := header.Values("X-Forwarded-For")
+	if len(values) == 0 {
+		return nil, false
+	}
+	var chain []string
+	for _, value := range values {
+		chain = append(chain, strings.Split(value, ",")...)
+	}
+	return chain, true
+}
+
+// parseHop разбирает адрес звена цепочки: 192.0.2.1, 192.0.2.1:80, [2001:db8::1]:80 или 2001:db8::1
+func parseHop(value string) (netip.Addr, error) {
+	value = strings.TrimSpace(value)
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,88 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes("10.0.0.0/8, 192.168.1.7,2001:db8::/32")
+	require.NoError(t, err)
+	assert.Len(t, prefixes, 3)
+
+	_, err = ParsePrefixes("10.0.0.0/8,foo")
+	assert.Error(t, err)
+
+	prefixes, err = ParsePrefixes("")
+	require.NoError(t, err)
+	assert.Empty(t, prefixes)
+}
+
+func TestResolverClientIP(t *testing.T) {
+	resolver, err := NewResolver("10.0.0.0/8,2001:db8:ffff::/48")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"untrusted peer headers ignored", "203.0.113.5:1234",
+			map[string][]string{"X-Forwarded-For": {"1.1.1.1"}, "X-Real-Ip": {"1.1.1.1"}}, "203.0.113.5"},
+		{"xff one proxy", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.7"}}, "198.51.100.7"},
+		{"xff spoofed left part", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.7, 10.0.0.9"}}, "198.51.100.7"},
+		{"xff several headers", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"1.1.1.1", "198.51.100.7"}}, "198.51.100.7"},
+		{"xff garbage stops chain", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.7, garbage"}}, "10.0.0.1"},
+		{"xff all trusted", "10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"forwarded", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {`for=192.0.2.60;proto=http;by=10.0.0.1, for="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17"},
+		{"forwarded wins over xff", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=192.0.2.60"}, "X-Forwarded-For": {"198.51.100.7"}}, "192.0.2.60"},
+		{"forwarded unknown", "10.0.0.1:1234",
+			map[string][]string{"Forwarded": {"for=unknown"}}, "10.0.0.1"},
+		{"ipv6 proxy", "[2001:db8:ffff::1]:443",
+			map[string][]string{"X-Forwarded-For": {"192.0.2.1"}}, "192.0.2.1"},
+		{"real ip from trusted proxy", "10.0.0.1:1234",
+			map[string][]string{"X-Real-Ip": {"192.0.2.1"}}, "192.0.2.1"},
+		{"mapped ipv4", "[::ffff:203.0.113.5]:1234", nil, "203.0.113.5"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for name, values := range tc.headers {
+				for _, value := range values {
+					r.Header.Add(name, value)
+				}
+			}
+			assert.Equal(t, tc.want, resolver.ClientIP(r).String())
+		})
+	}
+}
+
+func TestResolverHandle(t *testing.T) {
+	resolver, err := NewResolver("")
+	require.NoError(t, err)
+
+	var got string
+	handler := resolver.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r).String()
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.5:1234"
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "203.0.113.5", got)
+}
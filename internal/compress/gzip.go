@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/wellywell/shorturl/internal/apierror"
 )
 
 // ResponseGzipper используется для сжатия response
@@ -81,7 +83,7 @@ func (u RequestUngzipper) Handle(next http.Handler) http.Handler {
 			err = u.reader.Reset(r.Body)
 		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.Wrap(apierror.CodeBadRequest, "Could not decompress body", err))
 			return
 		}
 		r.Body = u.reader
@@ -7,6 +7,8 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 )
@@ -19,7 +21,150 @@ type ServerConfig struct {
 	DatabaseDSN      string `env:"DATABASE_DSN" json:"database_dsn"`
 	EnableHTTPS      bool   `env:"ENABLE_HTTPS" json:"enable_https"`
 	ConfigFile       string `env:"CONFIG"`
-	Trusted          string `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
+	// Trusted доверенные подсети IPv4 и IPv6 через запятую
+	Trusted string `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
+	// TrustedGRPCMethods методы gRPC через запятую, доступные только из доверенных подсетей: полное имя
+	// /package.Service/Method, либо /package.Service/ для всех методов сервиса, none - ни одного
+	TrustedGRPCMethods string `env:"TRUSTED_GRPC_METHODS" json:"trusted_grpc_methods"`
+	// TrustedProxies подсети прокси через запятую, которым разрешено передавать адрес клиента
+	// в X-Forwarded-For, Forwarded и X-Real-IP
+	TrustedProxies string `env:"TRUSTED_PROXIES" json:"trusted_proxies"`
+
+	// Настройки подписи JWT. Алгоритм HS256 использует JWTSecret или JWTSecretFile,
+	// RS256 и EdDSA - приватный ключ в PEM из JWTSigningKeyFile
+	JWTAlgorithm      string `env:"JWT_ALGORITHM" json:"jwt_algorithm"`
+	JWTSecret         string `env:"JWT_SECRET" json:"jwt_secret"`
+	JWTSecretFile     string `env:"JWT_SECRET_FILE" json:"jwt_secret_file"`
+	JWTSigningKeyFile string `env:"JWT_SIGNING_KEY_FILE" json:"jwt_signing_key_file"`
+	JWTKeyID          string `env:"JWT_KEY_ID" json:"jwt_key_id"`
+	// JWTVerificationKeys дополнительные ключи только для проверки, в формате kid=path,kid=path
+	JWTVerificationKeys string   `env:"JWT_VERIFICATION_KEYS" json:"jwt_verification_keys"`
+	JWTTokenTTL         Duration `env:"JWT_TOKEN_TTL" json:"jwt_token_ttl"`
+	JWTRenewBefore      Duration `env:"JWT_RENEW_BEFORE" json:"jwt_renew_before"`
+
+	// Атрибуты авторизационной куки. CookieSecure: true, false, либо пусто - тогда как EnableHTTPS
+	CookieSecure   string   `env:"COOKIE_SECURE" json:"cookie_secure"`
+	CookieSameSite string   `env:"COOKIE_SAMESITE" json:"cookie_samesite"`
+	CookieDomain   string   `env:"COOKIE_DOMAIN" json:"cookie_domain"`
+	CookiePath     string   `env:"COOKIE_PATH" json:"cookie_path"`
+	CookieMaxAge   Duration `env:"COOKIE_MAX_AGE" json:"cookie_max_age"`
+	// CSRFMode режим защиты от CSRF: origin, double-submit или off
+	CSRFMode string `env:"CSRF_MODE" json:"csrf_mode"`
+	// CSRFTrustedOrigins дополнительные разрешённые Origin через запятую
+	CSRFTrustedOrigins string `env:"CSRF_TRUSTED_ORIGINS" json:"csrf_trusted_origins"`
+
+	// Вход через OpenID Connect провайдера, включается заданием OIDCIssuer.
+	// OIDCRedirectURL по умолчанию - /auth/callback относительно BASE_URL
+	OIDCIssuer       string `env:"OIDC_ISSUER" json:"oidc_issuer"`
+	OIDCClientID     string `env:"OIDC_CLIENT_ID" json:"oidc_client_id"`
+	OIDCClientSecret string `env:"OIDC_CLIENT_SECRET" json:"oidc_client_secret"`
+	OIDCRedirectURL  string `env:"OIDC_REDIRECT_URL" json:"oidc_redirect_url"`
+	// OIDCScopes запрашиваемые области через пробел
+	OIDCScopes string `env:"OIDC_SCOPES" json:"oidc_scopes"`
+
+	// TLSMode источник сертификата сервера: files, self-signed или acme.
+	// В режиме self-signed сертификат создаётся при первом запуске и сохраняется в TLSCertFile и TLSKeyFile
+	TLSMode string `env:"TLS_MODE" json:"tls_mode"`
+	// Сертификат и ключ сервера в PEM. Файлы перечитываются при изменении без перезапуска
+	TLSCertFile string `env:"TLS_CERT_FILE" json:"tls_cert_file"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE" json:"tls_key_file"`
+	// TLSClientCAFile корневые сертификаты для проверки клиентских сертификатов (mTLS)
+	TLSClientCAFile string `env:"TLS_CLIENT_CA_FILE" json:"tls_client_ca_file"`
+	// TLSClientAuth проверка клиентских сертификатов: none, optional или require.
+	// По умолчанию optional, если задан TLSClientCAFile
+	TLSClientAuth string `env:"TLS_CLIENT_AUTH" json:"tls_client_auth"`
+	// TLSClientIdentities соответствие имён из клиентских сертификатов (CN или SAN) пользователям и сервисам,
+	// через запятую: name=user:ID или name=service:NAME
+	TLSClientIdentities string `env:"TLS_CLIENT_IDENTITIES" json:"tls_client_identities"`
+
+	// Получение сертификатов по ACME для доменов ACMEDomains через запятую.
+	// ACMEDirectoryURL по умолчанию - Let's Encrypt, полученные сертификаты хранятся в ACMECacheDir
+	ACMEDomains      string `env:"ACME_DOMAINS" json:"acme_domains"`
+	ACMEEmail        string `env:"ACME_EMAIL" json:"acme_email"`
+	ACMEDirectoryURL string `env:"ACME_DIRECTORY_URL" json:"acme_directory_url"`
+	ACMECacheDir     string `env:"ACME_CACHE_DIR" json:"acme_cache_dir"`
+
+	// AdminUsers id пользователей через запятую, которым при старте выдаётся роль администратора
+	AdminUsers string `env:"ADMIN_USERS" json:"admin_users"`
+
+	// Лимиты частоты запросов вида "60/m" или "10/s:20" (после двоеточия - допустимый всплеск), пустой - без ограничений.
+	// RateLimitBatch считается в ссылках, RateLimitUsers - новые анонимные пользователи с одного ip-адреса
+	RateLimitShorten  string `env:"RATE_LIMIT_SHORTEN" json:"rate_limit_shorten"`
+	RateLimitBatch    string `env:"RATE_LIMIT_BATCH" json:"rate_limit_batch"`
+	RateLimitUsers    string `env:"RATE_LIMIT_USERS" json:"rate_limit_users"`
+	RateLimitRedirect string `env:"RATE_LIMIT_REDIRECT" json:"rate_limit_redirect"`
+	// RateLimitStore где хранить состояние лимитов: memory или postgres, чтобы лимиты были общими для реплик
+	RateLimitStore string `env:"RATE_LIMIT_STORE" json:"rate_limit_store"`
+
+	// MaxBodySize максимальный размер тела запроса в байтах, MaxBatchSize - количество ссылок в пакетном запросе,
+	// MaxDeleteSize - в запросе на удаление
+	MaxBodySize   int64 `env:"MAX_BODY_SIZE" json:"max_body_size"`
+	MaxBatchSize  int   `env:"MAX_BATCH_SIZE" json:"max_batch_size"`
+	MaxDeleteSize int   `env:"MAX_DELETE_SIZE" json:"max_delete_size"`
+
+	// IdempotencyTTL сколько хранится ответ на запрос с заголовком Idempotency-Key
+	IdempotencyTTL Duration `env:"IDEMPOTENCY_TTL" json:"idempotency_ttl"`
+
+	// ServerMode какие серверы запускает команда server: http, grpc или both
+	ServerMode string `env:"SERVER_MODE" json:"server_mode"`
+	// GRPCAddress отдельный адрес gRPC-сервера. Если не задан, в режиме both gRPC и HTTP делят BaseAddress,
+	// а в режиме grpc сервер слушает BaseAddress
+	GRPCAddress string `env:"GRPC_ADDRESS" json:"grpc_address"`
+
+	// ShutdownOrder порядок шагов остановки через запятую: http, grpc, delete-queue, scheduler, storage.
+	// ShutdownTimeouts таймауты шагов вида "http=10s,delete-queue=30s"
+	ShutdownOrder    string `env:"SHUTDOWN_ORDER" json:"shutdown_order"`
+	ShutdownTimeouts string `env:"SHUTDOWN_TIMEOUTS" json:"shutdown_timeouts"`
+
+	// Параметры обработчика очереди удаления: размер пакета, как часто сбрасывается неполный пакет,
+	// количество обработчиков, повторов при ошибке хранилища и пауза перед первым повтором
+	DeleteBatchSize    int      `env:"DELETE_BATCH_SIZE" json:"delete_batch_size"`
+	DeleteMaxLatency   Duration `env:"DELETE_MAX_LATENCY" json:"delete_max_latency"`
+	DeleteWorkers      int      `env:"DELETE_WORKERS" json:"delete_workers"`
+	DeleteRetries      int      `env:"DELETE_RETRIES" json:"delete_retries"`
+	DeleteRetryBackoff Duration `env:"DELETE_RETRY_BACKOFF" json:"delete_retry_backoff"`
+	// DeletePollInterval как часто проверяются задания на удаление, созданные другими репликами.
+	// DeleteJobLease через сколько невыполненное задание снова может забрать другой обработчик
+	DeletePollInterval Duration `env:"DELETE_POLL_INTERVAL" json:"delete_poll_interval"`
+	DeleteJobLease     Duration `env:"DELETE_JOB_LEASE" json:"delete_job_lease"`
+	// DeleteMaxAttempts после скольких попыток задание на удаление отмечается failed.
+	// DeleteJobRetention сколько хранятся выполненные и неудавшиеся задания
+	DeleteMaxAttempts  int      `env:"DELETE_MAX_ATTEMPTS" json:"delete_max_attempts"`
+	DeleteJobRetention Duration `env:"DELETE_JOB_RETENTION" json:"delete_job_retention"`
+
+	// JobIntervals периоды фоновых задач вида "compact=1h", off выключает задачу
+	JobIntervals string `env:"JOB_INTERVALS" json:"job_intervals"`
+
+	// LinkRetention через сколько удалённые и истёкшие ссылки стираются окончательно, 0 - хранятся всегда.
+	// LinkTombstones оставляет короткие id стёртых ссылок занятыми, чтобы их нельзя было выдать другому пользователю
+	LinkRetention  Duration `env:"LINK_RETENTION" json:"link_retention"`
+	LinkTombstones bool     `env:"LINK_TOMBSTONES" json:"link_tombstones"`
+
+	// GatewayAddress адрес, на котором gRPC-сервер отдаёт JSON/HTTP фасад grpc-gateway. Пустой - фасад выключен
+	GatewayAddress string `env:"GATEWAY_ADDRESS" json:"gateway_address"`
+
+	// GRPCServices служебные сервисы gRPC-сервера через запятую: health, reflection, channelz, none - ни одного.
+	// GRPCHealthInterval как часто health-сервис проверяет хранилище
+	GRPCServices       string   `env:"GRPC_SERVICES" json:"grpc_services"`
+	GRPCHealthInterval Duration `env:"GRPC_HEALTH_INTERVAL" json:"grpc_health_interval"`
+}
+
+// Duration - time.Duration, которую можно задавать строкой вида "1h30m" в env, флагах и json
+type Duration time.Duration
+
+// UnmarshalText разбирает длительность из строки
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText форматирует длительность в строку
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
 }
 
 func parseFileParams(name string) ServerConfig {
@@ -42,7 +187,7 @@ func parseFileParams(name string) ServerConfig {
 }
 
 type configValue interface {
-	~bool | ~string
+	~bool | ~string | ~int | ~int64
 }
 
 func firstNotZero[T configValue](values ...T) T {
@@ -71,7 +216,68 @@ func NewConfig() (*ServerConfig, error) {
 	flag.StringVar(&commandLineParams.DatabaseDSN, "d", "", "Database DSN")
 	flag.BoolVar(&commandLineParams.EnableHTTPS, "s", false, "Enable HTTPS")
 	flag.StringVar(&commandLineParams.ConfigFile, "c", "", "Config file")
-	flag.StringVar(&commandLineParams.Trusted, "t", "", "Trusted subnet")
+	flag.StringVar(&commandLineParams.Trusted, "t", "", "Trusted subnets, comma separated")
+	flag.StringVar(&commandLineParams.TrustedProxies, "trusted-proxies", "", "Trusted proxy subnets, comma separated")
+	flag.StringVar(&commandLineParams.TrustedGRPCMethods, "trusted-grpc-methods", "", "gRPC methods allowed only from trusted subnets, comma separated, or none")
+	flag.StringVar(&commandLineParams.JWTAlgorithm, "jwt-algorithm", "", "JWT signing algorithm: HS256, RS256 or EdDSA")
+	flag.StringVar(&commandLineParams.JWTSecret, "jwt-secret", "", "JWT HS256 secret")
+	flag.StringVar(&commandLineParams.JWTSecretFile, "jwt-secret-file", "", "File with JWT HS256 secret")
+	flag.StringVar(&commandLineParams.JWTSigningKeyFile, "jwt-signing-key-file", "", "PEM private key for RS256 or EdDSA")
+	flag.StringVar(&commandLineParams.JWTKeyID, "jwt-key-id", "", "Key id (kid) of the signing key")
+	flag.StringVar(&commandLineParams.JWTVerificationKeys, "jwt-verification-keys", "", "Extra verification keys as kid=path,kid=path")
+	flag.TextVar(&commandLineParams.JWTTokenTTL, "jwt-token-ttl", Duration(0), "JWT lifetime")
+	flag.TextVar(&commandLineParams.JWTRenewBefore, "jwt-renew-before", Duration(0), "Renew JWT cookie when less than this is left")
+	flag.StringVar(&commandLineParams.CookieSecure, "cookie-secure", "", "Secure cookie attribute: true or false, defaults to HTTPS mode")
+	flag.StringVar(&commandLineParams.CookieSameSite, "cookie-samesite", "", "SameSite cookie attribute: lax, strict or none")
+	flag.StringVar(&commandLineParams.CookieDomain, "cookie-domain", "", "Domain cookie attribute")
+	flag.StringVar(&commandLineParams.CookiePath, "cookie-path", "", "Path cookie attribute")
+	flag.TextVar(&commandLineParams.CookieMaxAge, "cookie-max-age", Duration(0), "Max-Age cookie attribute, defaults to JWT lifetime")
+	flag.StringVar(&commandLineParams.CSRFMode, "csrf-mode", "", "CSRF protection: origin, double-submit or off")
+	flag.StringVar(&commandLineParams.CSRFTrustedOrigins, "csrf-trusted-origins", "", "Extra trusted origins for CSRF checks")
+	flag.StringVar(&commandLineParams.OIDCIssuer, "oidc-issuer", "", "OpenID Connect issuer URL, enables OIDC login")
+	flag.StringVar(&commandLineParams.OIDCClientID, "oidc-client-id", "", "OpenID Connect client id")
+	flag.StringVar(&commandLineParams.OIDCClientSecret, "oidc-client-secret", "", "OpenID Connect client secret")
+	flag.StringVar(&commandLineParams.OIDCRedirectURL, "oidc-redirect-url", "", "OpenID Connect redirect URL")
+	flag.StringVar(&commandLineParams.OIDCScopes, "oidc-scopes", "", "OpenID Connect scopes, space separated")
+	flag.StringVar(&commandLineParams.TLSMode, "tls-mode", "", "Server certificate source: files, self-signed or acme")
+	flag.StringVar(&commandLineParams.TLSCertFile, "tls-cert-file", "", "Server certificate PEM file")
+	flag.StringVar(&commandLineParams.TLSKeyFile, "tls-key-file", "", "Server private key PEM file")
+	flag.StringVar(&commandLineParams.TLSClientCAFile, "tls-client-ca-file", "", "CA bundle for client certificates")
+	flag.StringVar(&commandLineParams.TLSClientAuth, "tls-client-auth", "", "Client certificate auth: none, optional or require")
+	flag.StringVar(&commandLineParams.TLSClientIdentities, "tls-client-identities", "", "Client certificate identities as name=user:ID,name=service:NAME")
+	flag.StringVar(&commandLineParams.ACMEDomains, "acme-domains", "", "Comma separated domains for ACME certificates")
+	flag.StringVar(&commandLineParams.ACMEEmail, "acme-email", "", "Contact email for the ACME account")
+	flag.StringVar(&commandLineParams.ACMEDirectoryURL, "acme-directory-url", "", "ACME directory URL, defaults to Let's Encrypt")
+	flag.StringVar(&commandLineParams.ACMECacheDir, "acme-cache-dir", "", "Directory to store ACME certificates")
+	flag.StringVar(&commandLineParams.AdminUsers, "admin-users", "", "Comma separated ids of admin users")
+	flag.StringVar(&commandLineParams.RateLimitShorten, "rate-limit-shorten", "", "Shorten requests limit per user or ip, e.g. 60/m")
+	flag.StringVar(&commandLineParams.RateLimitBatch, "rate-limit-batch", "", "Batch shortened links limit per user, e.g. 1000/h")
+	flag.StringVar(&commandLineParams.RateLimitUsers, "rate-limit-users", "", "New anonymous users limit per ip, e.g. 10/h")
+	flag.StringVar(&commandLineParams.RateLimitRedirect, "rate-limit-redirect", "", "Redirects limit per user or ip, e.g. 100/s:200")
+	flag.StringVar(&commandLineParams.RateLimitStore, "rate-limit-store", "", "Rate limit state store: memory or postgres")
+	flag.Int64Var(&commandLineParams.MaxBodySize, "max-body-size", 0, "Max request body size in bytes")
+	flag.IntVar(&commandLineParams.MaxBatchSize, "max-batch-size", 0, "Max number of links in a batch request")
+	flag.IntVar(&commandLineParams.MaxDeleteSize, "max-delete-size", 0, "Max number of links in a delete request")
+	flag.TextVar(&commandLineParams.IdempotencyTTL, "idempotency-ttl", Duration(0), "How long to replay responses for Idempotency-Key")
+	flag.StringVar(&commandLineParams.ServerMode, "mode", "", "Servers to run: http, grpc or both")
+	flag.StringVar(&commandLineParams.GRPCAddress, "grpc-address", "", "Separate address for the gRPC server")
+	flag.StringVar(&commandLineParams.ShutdownOrder, "shutdown-order", "", "Shutdown stages order, comma separated")
+	flag.StringVar(&commandLineParams.ShutdownTimeouts, "shutdown-timeouts", "", "Shutdown stage timeouts as stage=duration,stage=duration")
+	flag.IntVar(&commandLineParams.DeleteBatchSize, "delete-batch-size", 0, "Number of links deleted in one storage call")
+	flag.TextVar(&commandLineParams.DeleteMaxLatency, "delete-max-latency", Duration(0), "How often an incomplete delete batch is flushed")
+	flag.IntVar(&commandLineParams.DeleteWorkers, "delete-workers", 0, "Number of delete queue workers")
+	flag.IntVar(&commandLineParams.DeleteRetries, "delete-retries", 0, "How many times a failed delete batch is retried")
+	flag.TextVar(&commandLineParams.DeleteRetryBackoff, "delete-retry-backoff", Duration(0), "Pause before the first delete retry, doubled for each next one")
+	flag.TextVar(&commandLineParams.DeletePollInterval, "delete-poll-interval", Duration(0), "How often to look for delete jobs created by other replicas")
+	flag.TextVar(&commandLineParams.DeleteJobLease, "delete-job-lease", Duration(0), "How long a delete job stays claimed before another worker may retry it")
+	flag.IntVar(&commandLineParams.DeleteMaxAttempts, "delete-max-attempts", 0, "How many times a delete job is tried before it is marked failed")
+	flag.TextVar(&commandLineParams.DeleteJobRetention, "delete-job-retention", Duration(0), "How long finished delete jobs are kept")
+	flag.StringVar(&commandLineParams.JobIntervals, "job-intervals", "", "Background job intervals as job=duration,job=off")
+	flag.TextVar(&commandLineParams.LinkRetention, "link-retention", Duration(0), "How long deleted and expired links are kept before being purged, 0 keeps them forever")
+	flag.BoolVar(&commandLineParams.LinkTombstones, "link-tombstones", false, "Keep short ids of purged links reserved")
+	flag.StringVar(&commandLineParams.GatewayAddress, "gateway-address", "", "Address to serve the JSON/HTTP gateway of the gRPC server on")
+	flag.StringVar(&commandLineParams.GRPCServices, "grpc-services", "", "gRPC service endpoints: health, reflection, channelz, comma separated, or none")
+	flag.TextVar(&commandLineParams.GRPCHealthInterval, "grpc-health-interval", Duration(0), "How often the gRPC health service checks the storage")
 	flag.Parse()
 
 	if params.ConfigFile == "" {
@@ -88,6 +294,77 @@ func NewConfig() (*ServerConfig, error) {
 	params.DatabaseDSN = firstNotZero(params.DatabaseDSN, commandLineParams.DatabaseDSN, fileParams.DatabaseDSN)
 	params.EnableHTTPS = firstNotZero(params.EnableHTTPS, commandLineParams.EnableHTTPS, fileParams.EnableHTTPS)
 	params.Trusted = firstNotZero(params.Trusted, commandLineParams.Trusted, fileParams.Trusted)
+	params.TrustedProxies = firstNotZero(params.TrustedProxies, commandLineParams.TrustedProxies, fileParams.TrustedProxies)
+	params.TrustedGRPCMethods = firstNotZero(params.TrustedGRPCMethods, commandLineParams.TrustedGRPCMethods, fileParams.TrustedGRPCMethods,
+		"/handlers.grcp.ShortURLService/GetStats,/handlers.grcp.AdminService/,/grpc.channelz.v1.Channelz/")
+	params.JWTAlgorithm = firstNotZero(params.JWTAlgorithm, commandLineParams.JWTAlgorithm, fileParams.JWTAlgorithm, "HS256")
+	params.JWTSecret = firstNotZero(params.JWTSecret, commandLineParams.JWTSecret, fileParams.JWTSecret)
+	params.JWTSecretFile = firstNotZero(params.JWTSecretFile, commandLineParams.JWTSecretFile, fileParams.JWTSecretFile)
+	params.JWTSigningKeyFile = firstNotZero(params.JWTSigningKeyFile, commandLineParams.JWTSigningKeyFile, fileParams.JWTSigningKeyFile)
+	params.JWTKeyID = firstNotZero(params.JWTKeyID, commandLineParams.JWTKeyID, fileParams.JWTKeyID)
+	params.JWTVerificationKeys = firstNotZero(params.JWTVerificationKeys, commandLineParams.JWTVerificationKeys, fileParams.JWTVerificationKeys)
+	params.JWTTokenTTL = firstNotZero(params.JWTTokenTTL, commandLineParams.JWTTokenTTL, fileParams.JWTTokenTTL, Duration(30*24*time.Hour))
+	params.JWTRenewBefore = firstNotZero(params.JWTRenewBefore, commandLineParams.JWTRenewBefore, fileParams.JWTRenewBefore, Duration(7*24*time.Hour))
+
+	params.CookieSecure = firstNotZero(params.CookieSecure, commandLineParams.CookieSecure, fileParams.CookieSecure)
+	params.CookieSameSite = firstNotZero(params.CookieSameSite, commandLineParams.CookieSameSite, fileParams.CookieSameSite, "lax")
+	params.CookieDomain = firstNotZero(params.CookieDomain, commandLineParams.CookieDomain, fileParams.CookieDomain)
+	params.CookiePath = firstNotZero(params.CookiePath, commandLineParams.CookiePath, fileParams.CookiePath, "/")
+	params.CookieMaxAge = firstNotZero(params.CookieMaxAge, commandLineParams.CookieMaxAge, fileParams.CookieMaxAge, params.JWTTokenTTL)
+	params.CSRFMode = firstNotZero(params.CSRFMode, commandLineParams.CSRFMode, fileParams.CSRFMode, "origin")
+	params.CSRFTrustedOrigins = firstNotZero(params.CSRFTrustedOrigins, commandLineParams.CSRFTrustedOrigins, fileParams.CSRFTrustedOrigins)
+
+	params.OIDCIssuer = firstNotZero(params.OIDCIssuer, commandLineParams.OIDCIssuer, fileParams.OIDCIssuer)
+	params.OIDCClientID = firstNotZero(params.OIDCClientID, commandLineParams.OIDCClientID, fileParams.OIDCClientID)
+	params.OIDCClientSecret = firstNotZero(params.OIDCClientSecret, commandLineParams.OIDCClientSecret, fileParams.OIDCClientSecret)
+	params.OIDCRedirectURL = firstNotZero(params.OIDCRedirectURL, commandLineParams.OIDCRedirectURL, fileParams.OIDCRedirectURL,
+		strings.TrimSuffix(params.ShortURLsAddress, "/")+"/auth/callback")
+	params.OIDCScopes = firstNotZero(params.OIDCScopes, commandLineParams.OIDCScopes, fileParams.OIDCScopes, "openid profile email")
+	params.TLSMode = firstNotZero(params.TLSMode, commandLineParams.TLSMode, fileParams.TLSMode, "files")
+	params.TLSCertFile = firstNotZero(params.TLSCertFile, commandLineParams.TLSCertFile, fileParams.TLSCertFile, "server.rsa.crt")
+	params.TLSKeyFile = firstNotZero(params.TLSKeyFile, commandLineParams.TLSKeyFile, fileParams.TLSKeyFile, "server.rsa.key")
+	params.TLSClientCAFile = firstNotZero(params.TLSClientCAFile, commandLineParams.TLSClientCAFile, fileParams.TLSClientCAFile)
+	defaultClientAuth := "none"
+	if params.TLSClientCAFile != "" {
+		defaultClientAuth = "optional"
+	}
+	params.TLSClientAuth = firstNotZero(params.TLSClientAuth, commandLineParams.TLSClientAuth, fileParams.TLSClientAuth, defaultClientAuth)
+	params.TLSClientIdentities = firstNotZero(params.TLSClientIdentities, commandLineParams.TLSClientIdentities, fileParams.TLSClientIdentities)
+	params.ACMEDomains = firstNotZero(params.ACMEDomains, commandLineParams.ACMEDomains, fileParams.ACMEDomains)
+	params.ACMEEmail = firstNotZero(params.ACMEEmail, commandLineParams.ACMEEmail, fileParams.ACMEEmail)
+	params.ACMEDirectoryURL = firstNotZero(params.ACMEDirectoryURL, commandLineParams.ACMEDirectoryURL, fileParams.ACMEDirectoryURL)
+	params.ACMECacheDir = firstNotZero(params.ACMECacheDir, commandLineParams.ACMECacheDir, fileParams.ACMECacheDir, "acme-cache")
+
+	params.AdminUsers = firstNotZero(params.AdminUsers, commandLineParams.AdminUsers, fileParams.AdminUsers)
+
+	params.RateLimitShorten = firstNotZero(params.RateLimitShorten, commandLineParams.RateLimitShorten, fileParams.RateLimitShorten)
+	params.RateLimitBatch = firstNotZero(params.RateLimitBatch, commandLineParams.RateLimitBatch, fileParams.RateLimitBatch)
+	params.RateLimitUsers = firstNotZero(params.RateLimitUsers, commandLineParams.RateLimitUsers, fileParams.RateLimitUsers)
+	params.RateLimitRedirect = firstNotZero(params.RateLimitRedirect, commandLineParams.RateLimitRedirect, fileParams.RateLimitRedirect)
+	params.RateLimitStore = firstNotZero(params.RateLimitStore, commandLineParams.RateLimitStore, fileParams.RateLimitStore, "memory")
+	params.MaxBodySize = firstNotZero(params.MaxBodySize, commandLineParams.MaxBodySize, fileParams.MaxBodySize, 1<<20)
+	params.MaxBatchSize = firstNotZero(params.MaxBatchSize, commandLineParams.MaxBatchSize, fileParams.MaxBatchSize, 1000)
+	params.MaxDeleteSize = firstNotZero(params.MaxDeleteSize, commandLineParams.MaxDeleteSize, fileParams.MaxDeleteSize, 1000)
+	params.IdempotencyTTL = firstNotZero(params.IdempotencyTTL, commandLineParams.IdempotencyTTL, fileParams.IdempotencyTTL, Duration(24*time.Hour))
+	params.DeleteBatchSize = firstNotZero(params.DeleteBatchSize, commandLineParams.DeleteBatchSize, fileParams.DeleteBatchSize, 100)
+	params.DeleteMaxLatency = firstNotZero(params.DeleteMaxLatency, commandLineParams.DeleteMaxLatency, fileParams.DeleteMaxLatency, Duration(100*time.Millisecond))
+	params.DeleteWorkers = firstNotZero(params.DeleteWorkers, commandLineParams.DeleteWorkers, fileParams.DeleteWorkers, 1)
+	params.DeleteRetries = firstNotZero(params.DeleteRetries, commandLineParams.DeleteRetries, fileParams.DeleteRetries, 3)
+	params.DeleteRetryBackoff = firstNotZero(params.DeleteRetryBackoff, commandLineParams.DeleteRetryBackoff, fileParams.DeleteRetryBackoff, Duration(100*time.Millisecond))
+	params.DeletePollInterval = firstNotZero(params.DeletePollInterval, commandLineParams.DeletePollInterval, fileParams.DeletePollInterval, Duration(time.Second))
+	params.DeleteJobLease = firstNotZero(params.DeleteJobLease, commandLineParams.DeleteJobLease, fileParams.DeleteJobLease, Duration(5*time.Minute))
+	params.DeleteMaxAttempts = firstNotZero(params.DeleteMaxAttempts, commandLineParams.DeleteMaxAttempts, fileParams.DeleteMaxAttempts, 10)
+	params.DeleteJobRetention = firstNotZero(params.DeleteJobRetention, commandLineParams.DeleteJobRetention, fileParams.DeleteJobRetention, Duration(7*24*time.Hour))
+	params.ServerMode = firstNotZero(params.ServerMode, commandLineParams.ServerMode, fileParams.ServerMode, "both")
+	params.GRPCAddress = firstNotZero(params.GRPCAddress, commandLineParams.GRPCAddress, fileParams.GRPCAddress)
+	params.ShutdownOrder = firstNotZero(params.ShutdownOrder, commandLineParams.ShutdownOrder, fileParams.ShutdownOrder)
+	params.ShutdownTimeouts = firstNotZero(params.ShutdownTimeouts, commandLineParams.ShutdownTimeouts, fileParams.ShutdownTimeouts)
+	params.JobIntervals = firstNotZero(params.JobIntervals, commandLineParams.JobIntervals, fileParams.JobIntervals)
+	params.LinkRetention = firstNotZero(params.LinkRetention, commandLineParams.LinkRetention, fileParams.LinkRetention)
+	params.LinkTombstones = firstNotZero(params.LinkTombstones, commandLineParams.LinkTombstones, fileParams.LinkTombstones)
+	params.GatewayAddress = firstNotZero(params.GatewayAddress, commandLineParams.GatewayAddress, fileParams.GatewayAddress)
+	params.GRPCServices = firstNotZero(params.GRPCServices, commandLineParams.GRPCServices, fileParams.GRPCServices, "health")
+	params.GRPCHealthInterval = firstNotZero(params.GRPCHealthInterval, commandLineParams.GRPCHealthInterval, fileParams.GRPCHealthInterval, Duration(5*time.Second))
 
 	return &params, nil
 }
@@ -0,0 +1,146 @@
+// Package gateway JSON/HTTP фасад над ShortURLService. Маршруты генерирует grpc-gateway из аннотаций
+// google.api.http в shorturl.proto, а запросы проходят через тот же gRPC-сервер с теми же перехватчиками,
+// поэтому поведение обоих транспортов совпадает
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/textproto"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/clientip"
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+)
+
+// ClientIPMetadata ключ метаданных, в котором шлюз передаёт адрес HTTP-клиента
+const ClientIPMetadata = "x-gateway-client-ip"
+
+// forwardedHeaders заголовки HTTP-запроса, которые передаются в метаданные вызова.
+// Authorization grpc-gateway передаёт сам, остальные заголовки отбрасываются, чтобы клиент
+// не мог подменить служебные метаданные, например ClientIPMetadata
+var forwardedHeaders = map[string]bool{
+	"x-request-id":    true,
+	"idempotency-key": true,
+	"token":           true,
+}
+
+// returnedHeaders метаданные ответа gRPC, которые возвращаются клиенту заголовками HTTP
+var returnedHeaders = map[string]bool{
+	"x-request-id":        true,
+	"token":               true,
+	"retry-after":         true,
+	"idempotent-replayed": true,
+}
+
+// bufferSize размер буфера соединения в памяти между шлюзом и gRPC-сервером
+const bufferSize = 1 << 20
+
+// NewHandler создаёт http.Handler шлюза, который вызывает ShortURLService через conn.
+// Адрес клиента определяется resolver с учётом доверенных прокси
+func NewHandler(ctx context.Context, conn *grpc.ClientConn, resolver *clientip.Resolver) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeader),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeader),
+		runtime.WithMetadata(clientMetadata),
+		runtime.WithErrorHandler(writeError),
+		runtime.WithRoutingErrorHandler(writeRoutingError),
+		// имена полей как в proto и в HTTP API: short_url, original_url
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+	)
+	if err := pb.RegisterShortURLServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return resolver.Handle(mux), nil
+}
+
+// Dial запускает srv на соединении в памяти и возвращает клиентское соединение с ним.
+// Такое соединение недоступно снаружи процесса, поэтому серверу можно доверять ClientIPMetadata
+func Dial(srv *grpc.Server) (*grpc.ClientConn, error) {
+	listener := bufconn.Listen(bufferSize)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	return grpc.NewClient("passthrough:///gateway",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+}
+
+// PeerInterceptor подставляет адрес HTTP-клиента из ClientIPMetadata вместо адреса пира, чтобы
+// проверки подсети и лимиты работали так же, как для прямых вызовов. Используется только на сервере из Dial
+type PeerInterceptor struct{}
+
+// Unary для использования PeerInterceptor в качестве grpc.UnaryServerInterceptor
+func (PeerInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(ClientIPMetadata); len(values) > 0 {
+		if addr, err := netip.ParseAddr(values[len(values)-1]); err == nil {
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, 0))})
+		}
+	}
+	return handler(ctx, req)
+}
+
+func incomingHeader(key string) (string, bool) {
+	key = strings.ToLower(key)
+	return key, forwardedHeaders[key]
+}
+
+func outgoingHeader(key string) (string, bool) {
+	return textproto.CanonicalMIMEHeaderKey(key), returnedHeaders[strings.ToLower(key)]
+}
+
+func clientMetadata(ctx context.Context, r *http.Request) metadata.MD {
+	if addr := clientip.FromRequest(r); addr.IsValid() {
+		return metadata.Pairs(ClientIPMetadata, addr.String())
+	}
+	return nil
+}
+
+// writeError отвечает на ошибку gRPC в формате application/problem+json, как HTTP API
+func writeError(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	apiErr, correlationID := apierror.FromStatus(err)
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for key, values := range md.HeaderMD {
+			if name, ok := outgoingHeader(key); ok && len(values) > 0 {
+				w.Header().Set(name, values[0])
+			}
+		}
+	}
+	if correlationID == "" {
+		correlationID = w.Header().Get(apierror.CorrelationHeader)
+	}
+	if correlationID != "" {
+		r = r.WithContext(apierror.WithCorrelationID(r.Context(), correlationID))
+	}
+	apierror.Write(w, r, apiErr)
+}
+
+// writeRoutingError отвечает на запрос к несуществующему маршруту
+func writeRoutingError(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, status int) {
+	switch status {
+	case http.StatusNotFound:
+		apierror.WriteCode(w, r, apierror.CodeNotFound, "Not found")
+	case http.StatusMethodNotAllowed:
+		apierror.WriteCode(w, r, apierror.CodeMethodNotAllowed, "Method not allowed")
+	default:
+		apierror.WriteCode(w, r, apierror.CodeBadRequest, http.StatusText(status))
+	}
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/clientip"
+	"github.com/wellywell/shorturl/internal/config"
+	"github.com/wellywell/shorturl/internal/handlers/grpc/handlers"
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+var mockConfig = config.ServerConfig{BaseAddress: "localhost:8080", ShortURLsAddress: "http://localhost:8080", Trusted: "10.0.0.0/8"}
+
+func newGateway(t *testing.T) (http.Handler, pb.ShortURLServiceClient) {
+	subnet, err := handlers.NewSubnetInterceptor(mockConfig.Trusted, "", pb.ShortURLService_GetStats_FullMethodName)
+	require.NoError(t, err)
+
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(PeerInterceptor{}.Unary, handlers.CorrelationInterceptor{}.Unary, subnet.Unary))
+	st := storage.NewMemory()
+	pb.RegisterShortURLServiceServer(srv, handlers.NewShorturlServer(st, tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig), mockConfig))
+	t.Cleanup(srv.Stop)
+
+	conn, err := Dial(srv)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	resolver, err := clientip.NewResolver("")
+	require.NoError(t, err)
+	handler, err := NewHandler(context.Background(), conn, resolver)
+	require.NoError(t, err)
+	return handler, pb.NewShortURLServiceClient(conn)
+}
+
+func TestGateway(t *testing.T) {
+	handler, client := newGateway(t)
+
+	serve := func(method string, target string, body string, header http.Header, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		if remoteAddr != "" {
+			r.RemoteAddr = remoteAddr
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/gateway/v1/shorten", `{"url": "https://example.com/gateway"}`, nil, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	token := w.Header().Get("Token")
+	assert.NotEmpty(t, token)
+	assert.NotEmpty(t, w.Header().Get(apierror.CorrelationHeader))
+	var shortened struct {
+		Result    string `json:"result"`
+		IsCreated bool   `json:"is_created"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+	assert.True(t, shortened.IsCreated)
+	id := shortened.Result[strings.LastIndex(shortened.Result, "/")+1:]
+
+	t.Run("get full url", func(t *testing.T) {
+		w := serve(http.MethodGet, "/gateway/v1/links/"+id, "", nil, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"full_url": "https://example.com/gateway"}`, w.Body.String())
+	})
+
+	t.Run("user urls", func(t *testing.T) {
+		w := serve(http.MethodGet, "/gateway/v1/user/urls", "", http.Header{"Token": {token}}, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"data": [{"short_url": "`+shortened.Result+`", "original_url": "https://example.com/gateway"}]}`, w.Body.String())
+	})
+
+	t.Run("errors match grpc", func(t *testing.T) {
+		// ошибка шлюза - тот же код, что и у gRPC-вызова, в формате problem+json
+		_, err := client.GetFullURL(context.Background(), &pb.FullURLRequest{ShortId: "missing"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		w := serve(http.MethodGet, "/gateway/v1/links/missing", "", http.Header{"X-Request-Id": {"gw-1"}}, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, apierror.ProblemContentType, w.Header().Get("Content-Type"))
+		var problem struct {
+			Code          string `json:"code"`
+			CorrelationID string `json:"correlation_id"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, string(apierror.CodeFromStatus(err)), problem.Code)
+		assert.Equal(t, "gw-1", problem.CorrelationID)
+	})
+
+	t.Run("client address", func(t *testing.T) {
+		w := serve(http.MethodGet, "/gateway/v1/internal/stats", "", nil, "192.168.1.1:1234")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// заголовок с адресом клиента не передаётся в метаданные
+		w = serve(http.MethodGet, "/gateway/v1/internal/stats", "", http.Header{"X-Gateway-Client-Ip": {"10.0.0.1"}}, "192.168.1.1:1234")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = serve(http.MethodGet, "/gateway/v1/internal/stats", "", nil, "10.0.0.1:1234")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		w := serve(http.MethodGet, "/gateway/v1/unknown", "", nil, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, apierror.ProblemContentType, w.Header().Get("Content-Type"))
+	})
+}
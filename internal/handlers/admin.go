@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+// Действия администраторов, которые попадают в журнал аудита
+const (
+	AuditLinkDelete  = "link.delete"
+	AuditLinkDisable = "link.disable"
+	AuditLinkEnable  = "link.enable"
+	AuditUserBlock   = "user.block"
+	AuditUserUnblock = "user.unblock"
+	AuditUserAdmin   = "user.grant_admin"
+	AuditUserErase   = "user.erase"
+)
+
+// Ограничения на размер списков, которые отдаёт API администратора
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 1000
+)
+
+// ErrSelfBlock администратор не может заблокировать сам себя
+var ErrSelfBlock = errors.New("admin cannot block themselves")
+
+// ErrSelfErase администратор не может стереть сам себя
+var ErrSelfErase = errors.New("admin cannot erase themselves")
+
+// AdminStorage - интерфейс хранилища для операций администратора
+type AdminStorage interface {
+	GetUser(ctx context.Context, userID int) (storage.User, error)
+	SetUserRole(ctx context.Context, userID int, role string) error
+	SetUserBlocked(ctx context.Context, userID int, blocked bool) error
+	GetLink(ctx context.Context, key string) (storage.LinkInfo, error)
+	SetLinkDisabled(ctx context.Context, key string, disabled bool) error
+	ForceDeleteLink(ctx context.Context, key string) error
+	GetRecentLinks(ctx context.Context, limit int) ([]storage.LinkInfo, error)
+	AddAuditRecord(ctx context.Context, record storage.AuditRecord) (storage.AuditRecord, error)
+	GetAuditRecords(ctx context.Context, limit int) ([]storage.AuditRecord, error)
+	GetJobRuns(ctx context.Context, limit int) ([]storage.JobRun, error)
+	EraseUser(ctx context.Context, userID int, tombstones bool) error
+}
+
+// Admin операции администратора, общие для HTTP и gRPC. Каждое изменение записывается в журнал аудита
+type Admin struct {
+	store AdminStorage
+}
+
+// NewAdmin инициализирует Admin
+func NewAdmin(store AdminStorage) *Admin {
+	return &Admin{store: store}
+}
+
+// GetLink возвращает ссылку и её владельца
+func (a *Admin) GetLink(ctx context.Context, key string) (storage.LinkInfo, error) {
+	return a.store.GetLink(ctx, key)
+}
+
+// RecentLinks возвращает последние созданные ссылки
+func (a *Admin) RecentLinks(ctx context.Context, limit int) ([]storage.LinkInfo, error) {
+	return a.store.GetRecentLinks(ctx, NormalizeLimit(limit))
+}
+
+// AuditRecords возвращает последние записи журнала аудита
+func (a *Admin) AuditRecords(ctx context.Context, limit int) ([]storage.AuditRecord, error) {
+	return a.store.GetAuditRecords(ctx, NormalizeLimit(limit))
+}
+
+// JobRuns возвращает последние запуски фоновых задач
+func (a *Admin) JobRuns(ctx context.Context, limit int) ([]storage.JobRun, error) {
+	return a.store.GetJobRuns(ctx, NormalizeLimit(limit))
+}
+
+// DeleteLink удаляет ссылку независимо от владельца
+func (a *Admin) DeleteLink(ctx context.Context, actorID int, key string) error {
+	link, err := a.store.GetLink(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := a.store.ForceDeleteLink(ctx, key); err != nil {
+		return err
+	}
+	return a.audit(ctx, actorID, AuditLinkDelete, key, link.FullURL)
+}
+
+// SetLinkDisabled отключает либо включает ссылку. Отключённая ссылка не отдаётся, но остаётся у владельца
+func (a *Admin) SetLinkDisabled(ctx context.Context, actorID int, key string, disabled bool) error {
+	link, err := a.store.GetLink(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := a.store.SetLinkDisabled(ctx, key, disabled); err != nil {
+		return err
+	}
+	action := AuditLinkEnable
+	if disabled {
+		action = AuditLinkDisable
+	}
+	return a.audit(ctx, actorID, action, key, link.FullURL)
+}
+
+// SetUserBlocked блокирует либо разблокирует пользователя
+func (a *Admin) SetUserBlocked(ctx context.Context, actorID int, userID int, blocked bool) error {
+	if blocked && actorID == userID {
+		return ErrSelfBlock
+	}
+	if err := a.store.SetUserBlocked(ctx, userID, blocked); err != nil {
+		return err
+	}
+	action := AuditUserUnblock
+	if blocked {
+		action = AuditUserBlock
+	}
+	return a.audit(ctx, actorID, action, strconv.Itoa(userID), "")
+}
+
+// EraseUser сразу и окончательно стирает все данные пользователя. В журнале аудита остаётся только id
+func (a *Admin) EraseUser(ctx context.Context, actorID int, userID int, tombstones bool) error {
+	if actorID == userID {
+		return ErrSelfErase
+	}
+	if err := a.store.EraseUser(ctx, userID, tombstones); err != nil {
+		return err
+	}
+	return a.audit(ctx, actorID, AuditUserErase, strconv.Itoa(userID), "")
+}
+
+// GrantAdmins выдаёт роль администратора пользователям из настроек.
+// В журнал попадают только реальные изменения, от имени actor 0
+func (a *Admin) GrantAdmins(ctx context.Context, userIDs []int) error {
+	for _, userID := range userIDs {
+		user, err := a.store.GetUser(ctx, userID)
+		if err == nil && user.Role == storage.RoleAdmin {
+			continue
+		}
+		if err := a.store.SetUserRole(ctx, userID, storage.RoleAdmin); err != nil {
+			return fmt.Errorf("could not grant admin role to user %d: %w", userID, err)
+		}
+		if err := a.audit(ctx, 0, AuditUserAdmin, strconv.Itoa(userID), "from config"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Admin) audit(ctx context.Context, actorID int, action string, target string, details string) error {
+	_, err := a.store.AddAuditRecord(ctx, storage.AuditRecord{
+		ActorID: actorID,
+		Action:  action,
+		Target:  target,
+		Details: details,
+	})
+	return err
+}
+
+// NormalizeLimit приводит размер запрошенного списка к допустимому
+func NormalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultListLimit
+	}
+	return min(limit, MaxListLimit)
+}
+
+// ParseUserIDs разбирает список id пользователей через запятую
+func ParseUserIDs(ids string) ([]int, error) {
+	var result []int
+	for _, item := range strings.Split(ids, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, err := strconv.Atoi(item)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("bad user id %q", item)
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/wellywell/shorturl/internal/config"
 	"github.com/wellywell/shorturl/internal/storage"
@@ -14,13 +15,41 @@ type Storage interface {
 	Put(ctx context.Context, key string, val string, user int) error
 }
 
-// GetShortURL создаёт, сохраняет и возвращает короткую ссылку
+// LinkStorage - хранилище, сохраняющее ссылку сразу со сроком действия
+type LinkStorage interface {
+	PutLink(ctx context.Context, key string, val string, user int, expiresAt *time.Time) error
+}
+
+// GetShortURL создаёт, сохраняет и возвращает короткую ссылку. Если длинная ссылка уже сокращена,
+// возвращает существующую короткую ссылку и isCreated false
 func GetShortURL(ctx context.Context, longURL string, user int, st Storage, conf config.ServerConfig) (URL string, isCreated bool, err error) {
+	id, isCreated, err := CreateShortURL(ctx, longURL, user, st)
+	if err != nil {
+		return "", false, err
+	}
+	return url.FormatShortURL(conf.ShortURLsAddress, id), isCreated, nil
+}
+
+// CreateShortURL создаёт и сохраняет короткую ссылку, возвращает её id
+func CreateShortURL(ctx context.Context, longURL string, user int, st Storage) (id string, isCreated bool, err error) {
+	return createShortURL(longURL, func(key string) error {
+		return st.Put(ctx, key, longURL, user)
+	})
+}
+
+// CreateLink создаёт и сохраняет короткую ссылку со сроком действия одним обращением к хранилищу, возвращает её id
+func CreateLink(ctx context.Context, longURL string, user int, expiresAt *time.Time, st LinkStorage) (id string, isCreated bool, err error) {
+	return createShortURL(longURL, func(key string) error {
+		return st.PutLink(ctx, key, longURL, user, expiresAt)
+	})
+}
+
+func createShortURL(longURL string, put func(key string) error) (id string, isCreated bool, err error) {
 	shortURLID := url.MakeShortURLID(longURL)
 
 	// Handle collisions
 	for {
-		err := st.Put(ctx, shortURLID, longURL, user)
+		err := put(shortURLID)
 		if err == nil {
 			break
 		}
@@ -31,10 +60,10 @@ func GetShortURL(ctx context.Context, longURL string, user int, st Storage, conf
 			// сгенерить новую ссылку и попробовать заново
 			shortURLID = url.MakeShortURLID(longURL)
 		} else if errors.As(err, &valueExists) {
-			return url.FormatShortURL(conf.ShortURLsAddress, valueExists.ExistingKey), false, nil
+			return valueExists.ExistingKey, false, nil
 		} else {
 			return "", false, err
 		}
 	}
-	return url.FormatShortURL(conf.ShortURLsAddress, shortURLID), true, nil
+	return shortURLID, true, nil
 }
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/config"
+	"github.com/wellywell/shorturl/internal/handlers"
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/url"
+)
+
+// AdminServer реализует AdminService. Проверяет роль администратора,
+// проверка доверенной подсети выполняется SubnetInterceptor
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+
+	admin  *handlers.Admin
+	config config.ServerConfig
+}
+
+// NewAdminServer инициализирует AdminServer
+func NewAdminServer(store handlers.AdminStorage, config config.ServerConfig) *AdminServer {
+	return &AdminServer{
+		admin:  handlers.NewAdmin(store),
+		config: config,
+	}
+}
+
+// GetLink возвращает ссылку вместе с её владельцем
+func (s *AdminServer) GetLink(ctx context.Context, in *pb.GetLinkRequest) (*pb.GetLinkResponse, error) {
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	link, err := s.admin.GetLink(ctx, in.Id)
+	if err != nil {
+		return nil, adminStatus(ctx, err)
+	}
+	return &pb.GetLinkResponse{Link: s.newAdminLink(link)}, nil
+}
+
+// DeleteLink удаляет ссылку независимо от владельца
+func (s *AdminServer) DeleteLink(ctx context.Context, in *pb.DeleteLinkRequest) (*pb.DeleteLinkResponse, error) {
+	actorID, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.admin.DeleteLink(ctx, actorID, in.Id); err != nil {
+		return nil, adminStatus(ctx, err)
+	}
+	return &pb.DeleteLinkResponse{}, nil
+}
+
+// SetLinkDisabled отключает либо включает ссылку
+func (s *AdminServer) SetLinkDisabled(ctx context.Context, in *pb.SetLinkDisabledRequest) (*pb.SetLinkDisabledResponse, error) {
+	actorID, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.admin.SetLinkDisabled(ctx, actorID, in.Id, in.Disabled); err != nil {
+		return nil, adminStatus(ctx, err)
+	}
+	return &pb.SetLinkDisabledResponse{}, nil
+}
+
+// SetUserBlocked блокирует либо разблокирует пользователя
+func (s *AdminServer) SetUserBlocked(ctx context.Context, in *pb.SetUserBlockedRequest) (*pb.SetUserBlockedResponse, error) {
+	actorID, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.admin.SetUserBlocked(ctx, actorID, int(in.UserId), in.Blocked); err != nil {
+		return nil, adminStatus(ctx, err)
+	}
+	return &pb.SetUserBlockedResponse{}, nil
+}
+
+// ListRecentLinks возвращает последние созданные ссылки
+func (s *AdminServer) ListRecentLinks(ctx context.Context, in *pb.ListRecentLinksRequest) (*pb.ListRecentLinksResponse, error) {
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	links, err := s.admin.RecentLinks(ctx, int(in.Limit))
+	if err != nil {
+		return nil, adminStatus(ctx, err)
+	}
+	respData := make([]*pb.AdminLink, len(links))
+	for i, link := range links {
+		respData[i] = s.newAdminLink(link)
+	}
+	return &pb.ListRecentLinksResponse{Links: respData}, nil
+}
+
+// ListAuditRecords возвращает последние записи журнала аудита
+func (s *AdminServer) ListAuditRecords(ctx context.Context, in *pb.ListAuditRecordsRequest) (*pb.ListAuditRecordsResponse, error) {
+	if _, err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	records, err := s.admin.AuditRecords(ctx, int(in.Limit))
+	if err != nil {
+		return nil, adminStatus(ctx, err)
+	}
+	respData := make([]*pb.AuditRecord, len(records))
+	for i, record := range records {
+		respData[i] = &pb.AuditRecord{
+			Id:        int32(record.ID),
+			CreatedAt: timestamppb.New(record.CreatedAt),
+			ActorId:   int32(record.ActorID),
+			Action:    record.Action,
+			Target:    record.Target,
+			Details:   record.Details,
+		}
+	}
+	return &pb.ListAuditRecordsResponse{Records: respData}, nil
+}
+
+func (s *AdminServer) newAdminLink(link storage.LinkInfo) *pb.AdminLink {
+	return &pb.AdminLink{
+		Id:          link.ShortURL,
+		ShortUrl:    url.FormatShortURL(s.config.ShortURLsAddress, link.ShortURL),
+		OriginalUrl: link.FullURL,
+		UserId:      int32(link.UserID),
+		IsDeleted:   link.IsDeleted,
+		IsDisabled:  link.IsDisabled,
+		CreatedAt:   timestamppb.New(link.CreatedAt),
+	}
+}
+
+// authorize проверяет роль администратора. Принимается только JWT сессии
+func (s *AdminServer) authorize(ctx context.Context) (int, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 {
+		token, _ = auth.ParseBearer(values[0])
+	} else if values := md.Get("token"); len(values) > 0 {
+		token = values[0]
+	}
+	if token == "" || auth.IsAPIKey(token) {
+		return 0, apierror.StatusCode(ctx, apierror.CodeUnauthorized, "Admin session required")
+	}
+	userID, err := auth.VerifyToken(ctx, token)
+	if err != nil {
+		return 0, authStatus(ctx, err, "Admin session required")
+	}
+
+	err = auth.RequireRole(ctx, userID, storage.RoleAdmin)
+	if errors.Is(err, auth.ErrForbidden) || errors.Is(err, auth.ErrUserBlocked) {
+		return 0, apierror.StatusCode(ctx, apierror.CodeForbidden, "Forbidden")
+	}
+	if err != nil {
+		return 0, apierror.StatusCode(ctx, apierror.CodeInternal, "Unknown")
+	}
+	return userID, nil
+}
+
+func adminStatus(ctx context.Context, err error) error {
+	if errors.Is(err, handlers.ErrSelfBlock) {
+		return apierror.StatusCode(ctx, apierror.CodeBadRequest, err.Error())
+	}
+	return apierror.Status(ctx, err)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestAdminServer(t *testing.T) {
+	st := storage.NewMemory()
+	auth.SetUserStore(st)
+	defer auth.SetUserStore(nil)
+
+	ctx := context.Background()
+	admin, _ := st.CreateNewUser(ctx)
+	owner, _ := st.CreateNewUser(ctx)
+	require.NoError(t, st.SetUserRole(ctx, admin, storage.RoleAdmin))
+	require.NoError(t, st.Put(ctx, "abc", "https://example.com", owner))
+
+	s := NewAdminServer(st, mockConfig)
+
+	withUser := func(userID int) context.Context {
+		token, err := auth.BuildJWTString(userID)
+		require.NoError(t, err)
+		return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	testCases := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"admin", withUser(admin), codes.OK},
+		{"not admin", withUser(owner), codes.PermissionDenied},
+		{"no session", ctx, codes.Unauthenticated},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.GetLink(tc.ctx, &pb.GetLinkRequest{Id: "abc"})
+			assert.Equal(t, tc.want, status.Code(err))
+		})
+	}
+
+	adminCtx := withUser(admin)
+
+	resp, err := s.GetLink(adminCtx, &pb.GetLinkRequest{Id: "abc"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(owner), resp.Link.UserId)
+
+	_, err = s.GetLink(adminCtx, &pb.GetLinkRequest{Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = s.SetLinkDisabled(adminCtx, &pb.SetLinkDisabledRequest{Id: "abc", Disabled: true})
+	require.NoError(t, err)
+	_, err = st.Get(ctx, "abc")
+	assert.Error(t, err)
+
+	_, err = s.SetUserBlocked(adminCtx, &pb.SetUserBlockedRequest{UserId: int32(admin), Blocked: true})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.SetUserBlocked(adminCtx, &pb.SetUserBlockedRequest{UserId: int32(owner), Blocked: true})
+	require.NoError(t, err)
+
+	links, err := s.ListRecentLinks(adminCtx, &pb.ListRecentLinksRequest{})
+	require.NoError(t, err)
+	require.Len(t, links.Links, 1)
+	assert.True(t, links.Links[0].IsDisabled)
+
+	records, err := s.ListAuditRecords(adminCtx, &pb.ListAuditRecordsRequest{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, records.Records, 1)
+	assert.Equal(t, "user.block", records.Records[0].Action)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/wellywell/shorturl/internal/auth"
+)
+
+// ClientCertInterceptor сохраняет в контексте пользователя или сервис по проверенному клиентскому сертификату
+type ClientCertInterceptor struct {
+	Identities auth.CertIdentities
+}
+
+// Unary для использования ClientCertInterceptor в качестве grpc.UnaryServerInterceptor
+func (c ClientCertInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(c.identify(ctx), req)
+}
+
+// Stream для использования ClientCertInterceptor в качестве grpc.StreamServerInterceptor
+func (c ClientCertInterceptor) Stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, withContext(ss, c.identify(ss.Context())))
+}
+
+func (c ClientCertInterceptor) identify(ctx context.Context) context.Context {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			if identity, ok := c.Identities.LookupChains(tlsInfo.State.VerifiedChains); ok {
+				ctx = auth.WithCertIdentity(ctx, identity)
+			}
+		}
+	}
+	return ctx
+}
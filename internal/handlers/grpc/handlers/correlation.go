@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+)
+
+// correlationMetadataKey ключ метаданных с идентификатором запроса
+var correlationMetadataKey = strings.ToLower(apierror.CorrelationHeader)
+
+// CorrelationInterceptor присваивает вызову идентификатор из метаданных x-request-id либо новый
+// и возвращает его клиенту в заголовке. Должен стоять первым в цепочке, чтобы идентификатор попадал во все ошибки
+type CorrelationInterceptor struct{}
+
+// Unary для использования CorrelationInterceptor в качестве grpc.UnaryServerInterceptor
+func (c CorrelationInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(c.correlate(ctx), req)
+}
+
+// Stream для использования CorrelationInterceptor в качестве grpc.StreamServerInterceptor
+func (c CorrelationInterceptor) Stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, withContext(ss, c.correlate(ss.Context())))
+}
+
+func (CorrelationInterceptor) correlate(ctx context.Context) context.Context {
+	var fromClient string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(correlationMetadataKey); len(values) > 0 {
+			fromClient = values[0]
+		}
+	}
+	id := apierror.NewCorrelationID(fromClient)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(correlationMetadataKey, id))
+	return apierror.WithCorrelationID(ctx, id)
+}
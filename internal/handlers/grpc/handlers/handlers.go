@@ -5,17 +5,19 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/wellywell/shorturl/internal/apierror"
 	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/clientip"
 	"github.com/wellywell/shorturl/internal/config"
 	"github.com/wellywell/shorturl/internal/handlers"
 	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/ratelimit"
 	"github.com/wellywell/shorturl/internal/storage"
 	"github.com/wellywell/shorturl/internal/url"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 // Storage - интерфейс хранилища коротких ссылок
@@ -25,10 +27,22 @@ type Storage interface {
 	PutBatch(ctx context.Context, records ...storage.URLRecord) error
 	CreateNewUser(ctx context.Context) (int, error)
 	GetUserURLS(ctx context.Context, userID int) ([]storage.URLRecord, error)
+	GetUserURLSPage(ctx context.Context, userID int, after string, limit int) ([]storage.URLRecord, error)
 	CountURLs(ctx context.Context) (int, error)
 	CountUsers(ctx context.Context) (int, error)
+	Ping(ctx context.Context) error
+}
+
+// DeleteQueue - очередь заданий на удаление ссылок
+type DeleteQueue interface {
+	Enqueue(ctx context.Context, userID int, shortURLs ...string) (storage.DeleteJob, error)
+	Delete(ctx context.Context, userID int, shortURLs ...string) ([]storage.DeleteResult, error)
+	Job(ctx context.Context, userID int, id int) (storage.DeleteJob, error)
 }
 
+// errBadCredentials явно переданные учётные данные не прошли проверку
+var errBadCredentials = errors.New("bad credentials")
+
 // ShorturlServer поддерживает все необходимые методы сервера.
 type ShorturlServer struct {
 	// нужно встраивать тип pb.Unimplemented<TypeName>
@@ -36,12 +50,13 @@ type ShorturlServer struct {
 	pb.UnimplementedShortURLServiceServer
 
 	urls        Storage
-	deleteQueue chan storage.ToDelete
+	deleteQueue DeleteQueue
 	config      config.ServerConfig
+	limiter     *ratelimit.Limiter
 }
 
 // NewURLsHandler инициализирует URLsHandler, необходимого для работы хендлеров
-func NewShorturlServer(storage Storage, queue chan storage.ToDelete, config config.ServerConfig) *ShorturlServer {
+func NewShorturlServer(storage Storage, queue DeleteQueue, config config.ServerConfig) *ShorturlServer {
 	return &ShorturlServer{
 		urls:        storage,
 		deleteQueue: queue,
@@ -49,25 +64,30 @@ func NewShorturlServer(storage Storage, queue chan storage.ToDelete, config conf
 	}
 }
 
+// SetRateLimiter включает ограничение размера пакетов и создания пользователей
+func (s *ShorturlServer) SetRateLimiter(limiter *ratelimit.Limiter) {
+	s.limiter = limiter
+}
+
 // ShortenURL метод для сокращения ссылки
 func (s *ShorturlServer) ShortenURL(ctx context.Context, in *pb.ShortenURLRequest) (*pb.ShortenURLResponse, error) {
-	userID, err := s.getOrCreateUser(ctx)
+	userID, err := s.getOrCreateUser(ctx, auth.ScopeLinksWrite)
 
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "Error authenticating or creating user")
+		return nil, authStatus(ctx, err, "Error authenticating or creating user")
 	}
 
 	err = s.setAuth(ctx, userID)
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "Error authenticating user")
+		return nil, apierror.StatusCode(ctx, apierror.CodeUnauthorized, "Error authenticating user")
 	}
 	if !url.Validate(in.Url) {
-		return nil, status.Errorf(codes.InvalidArgument, "URL must be of length from 1 to 250")
+		return nil, apierror.StatusCode(ctx, apierror.CodeValidation, "URL must be of length from 1 to 250")
 	}
 
 	shortURL, isCreated, err := handlers.GetShortURL(ctx, in.Url, userID, s.urls, s.config)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Could not store url")
+		return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not store url")
 	}
 
 	result := pb.ShortenURLResponse{
@@ -79,20 +99,28 @@ func (s *ShorturlServer) ShortenURL(ctx context.Context, in *pb.ShortenURLReques
 
 // ShortenBatch сокращает набор ссылок
 func (s *ShorturlServer) ShortenBatch(ctx context.Context, in *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
-	userID, err := s.getOrCreateUser(ctx)
+	userID, err := s.getOrCreateUser(ctx, auth.ScopeLinksWrite)
 
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "Error authenticating user")
+		return nil, authStatus(ctx, err, "Error authenticating user")
 	}
 
 	err = s.setAuth(ctx, userID)
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "Error authenticating user")
+		return nil, apierror.StatusCode(ctx, apierror.CodeUnauthorized, "Error authenticating user")
 	}
 
 	if len(in.Data) == 0 {
 		return &pb.ShortenBatchResponse{}, nil
 	}
+	if err := checkListSize(ctx, len(in.Data), s.config.MaxBatchSize); err != nil {
+		return nil, err
+	}
+
+	err = s.limiter.Allow(ctx, ratelimit.BucketBatch, ratelimit.UserKey(userID), len(in.Data))
+	if exceeded, ok := ratelimit.IsExceeded(err); ok {
+		return nil, exceededStatus(ctx, exceeded)
+	}
 
 	records := make([]storage.URLRecord, len(in.Data))
 	respData := make([]*pb.ShortenBatchOutData, len(in.Data))
@@ -113,7 +141,7 @@ func (s *ShorturlServer) ShortenBatch(ctx context.Context, in *pb.ShortenBatchRe
 	err = s.urls.PutBatch(ctx, records...)
 	if err != nil {
 		// В случае возникновения коллизий тут, завершаемся с ошибкой
-		return nil, status.Errorf(codes.Internal, "Could not store values")
+		return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not store values")
 	}
 	return &pb.ShortenBatchResponse{Data: respData}, nil
 }
@@ -121,63 +149,93 @@ func (s *ShorturlServer) ShortenBatch(ctx context.Context, in *pb.ShortenBatchRe
 // GetFullURL получить длинную ссылку по id короткой
 func (s *ShorturlServer) GetFullURL(ctx context.Context, in *pb.FullURLRequest) (*pb.FullURLResponse, error) {
 	if in.ShortId == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "Id not passed")
+		return nil, apierror.StatusCode(ctx, apierror.CodeBadRequest, "Id not passed")
 	}
 	url, err := s.urls.Get(ctx, in.ShortId)
 
 	if err != nil {
-		var keyNotFound *storage.KeyNotFoundError
-		if errors.As(err, &keyNotFound) {
-			return nil, status.Errorf(codes.NotFound, "Not found")
-		}
-		var keyDeleted *storage.RecordIsDeleted
-		if errors.As(err, &keyDeleted) {
-			return nil, status.Errorf(codes.ResourceExhausted, "Gone")
-		}
-		return nil, status.Errorf(codes.Internal, "Unknown")
+		// удалённая или отключённая ссылка - NotFound с кодом gone в деталях ошибки
+		return nil, apierror.Status(ctx, err)
 	}
 	return &pb.FullURLResponse{FullUrl: url}, nil
 }
 
 // Ping проверка работоспособности сервиса
 func (s *ShorturlServer) Ping(ctx context.Context, in *pb.PingRequest) (*pb.PingResponse, error) {
-	conn, err := pgx.Connect(ctx, s.config.DatabaseDSN)
-	if err != nil {
-		return nil, status.Errorf(codes.Unavailable, "Database unaccessable")
+	if err := s.urls.Ping(ctx); err != nil {
+		return nil, apierror.StatusCode(ctx, apierror.CodeUnavailable, "Storage unaccessable")
 	}
-	defer func() {
-		err := conn.Close(ctx)
-		if err != nil {
-			fmt.Println(err)
-		}
-	}()
 	return &pb.PingResponse{}, nil
 }
 
-// DeleteUserURLS удаляет урлы по запросу
+// DeleteUserURLS удаляет урлы по запросу: создаёт задание на удаление, либо с sync удаляет сразу
+// и возвращает результат по каждой ссылке
 func (s *ShorturlServer) DeleteUserURLS(ctx context.Context, in *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
-	user, err := s.getUser(ctx)
+	user, err := getUser(ctx, auth.ScopeLinksWrite)
+
+	if err != nil {
+		return nil, authStatus(ctx, err, "Unknown user")
+	}
+	if err := checkListSize(ctx, len(in.Data), s.config.MaxDeleteSize); err != nil {
+		return nil, err
+	}
+
+	if in.Sync {
+		results, err := s.deleteQueue.Delete(ctx, user, in.Data...)
+		if err != nil {
+			return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not delete")
+		}
+		return &pb.DeleteUserURLsResponse{Results: newDeleteResults(results)}, nil
+	}
+	job, err := s.deleteQueue.Enqueue(ctx, user, in.Data...)
+	if err != nil {
+		return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not queue deletion")
+	}
+	return &pb.DeleteUserURLsResponse{JobId: int32(job.ID)}, nil
+}
 
+// GetDeleteJob возвращает статус задания на удаление, созданного пользователем
+func (s *ShorturlServer) GetDeleteJob(ctx context.Context, in *pb.GetDeleteJobRequest) (*pb.GetDeleteJobResponse, error) {
+	user, err := getUser(ctx, auth.ScopeLinksRead)
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "Unknown user")
+		return nil, authStatus(ctx, err, "Unknown user")
+	}
+	job, err := s.deleteQueue.Job(ctx, user, int(in.JobId))
+	if err != nil {
+		return nil, apierror.Status(ctx, err)
+	}
+	resp := &pb.GetDeleteJobResponse{
+		Id:        int32(job.ID),
+		Status:    job.Status,
+		ShortUrls: job.ShortURLs,
+		Attempts:  int32(job.Attempts),
+		CreatedAt: timestamppb.New(job.CreatedAt),
+		Results:   newDeleteResults(job.Results),
 	}
+	if job.DoneAt != nil {
+		resp.DoneAt = timestamppb.New(*job.DoneAt)
+	}
+	return resp, nil
+}
 
-	for _, rec := range in.Data {
-		s.deleteQueue <- storage.ToDelete{UserID: user, ShortURL: rec}
+func newDeleteResults(results []storage.DeleteResult) []*pb.DeleteResult {
+	out := make([]*pb.DeleteResult, len(results))
+	for i, result := range results {
+		out[i] = &pb.DeleteResult{ShortUrl: result.ShortURL, Status: result.Status}
 	}
-	return &pb.DeleteUserURLsResponse{}, nil
+	return out
 }
 
 // GetUserURLS вернёт все урлы пользователя
 func (s *ShorturlServer) GetUserURLs(ctx context.Context, in *pb.GetUserURLsRequest) (*pb.GetUserURLsResponse, error) {
-	user, err := s.getUser(ctx)
+	user, err := getUser(ctx, auth.ScopeLinksRead)
 
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "Unknown user")
+		return nil, authStatus(ctx, err, "Unknown user")
 	}
 	urls, err := s.urls.GetUserURLS(ctx, user)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Unkwnown error")
+		return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Unkwnown error")
 	}
 	if len(urls) == 0 {
 		return &pb.GetUserURLsResponse{}, nil
@@ -197,20 +255,39 @@ func (s *ShorturlServer) GetUserURLs(ctx context.Context, in *pb.GetUserURLsRequ
 func (s *ShorturlServer) GetStats(ctx context.Context, in *pb.GetStatsRequest) (*pb.GetStatsResponse, error) {
 	users, err := s.urls.CountUsers(ctx)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Could not count users")
+		return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not count users")
 	}
 	urls, err := s.urls.CountURLs(ctx)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Could not count urls")
+		return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not count urls")
 	}
 	return &pb.GetStatsResponse{Urls: int32(urls), Users: int32(users)}, nil
 }
 
-func (s *ShorturlServer) getUser(ctx context.Context) (int, error) {
+// getUser достаёт пользователя из метаданных или клиентского сертификата
+func getUser(ctx context.Context, scope string) (int, error) {
 	var token string
 
 	md, ok := metadata.FromIncomingContext(ctx)
 	if ok {
+		// API-ключ или JWT в метаданных authorization: Bearer <token>
+		if values := md.Get("authorization"); len(values) > 0 {
+			bearer, ok := auth.ParseBearer(values[0])
+			if !ok {
+				return 0, errBadCredentials
+			}
+			userID, err := auth.VerifyBearer(ctx, bearer, scope)
+			if err != nil {
+				return 0, fmt.Errorf("%w: %w", errBadCredentials, err)
+			}
+			return userID, nil
+		}
+		if identity, ok := auth.CertIdentityFromContext(ctx); ok && identity.UserID != 0 {
+			if err := auth.CheckUser(ctx, identity.UserID); err != nil {
+				return 0, fmt.Errorf("%w: %w", errBadCredentials, err)
+			}
+			return identity.UserID, nil
+		}
 		values := md.Get("token")
 		if len(values) > 0 {
 			// ключ содержит слайс строк, получаем первую строку
@@ -219,25 +296,59 @@ func (s *ShorturlServer) getUser(ctx context.Context) (int, error) {
 	}
 
 	if token != "" {
-		userID, err := auth.GetUserID(token)
+		userID, err := auth.VerifyToken(ctx, token)
 		if err == nil {
 			return userID, nil
 		}
+		if errors.Is(err, auth.ErrUserBlocked) {
+			return 0, fmt.Errorf("%w: %w", errBadCredentials, err)
+		}
 	}
 	return 0, fmt.Errorf("not authorized")
 }
 
-func (s *ShorturlServer) getOrCreateUser(ctx context.Context) (int, error) {
+// checkListSize проверяет количество элементов в запросе, limit 0 - без ограничения.
+// Размер всего сообщения ограничивается опцией сервера grpc.MaxRecvMsgSize
+func checkListSize(ctx context.Context, size int, limit int) error {
+	if limit > 0 && size > limit {
+		return apierror.Status(ctx, apierror.Newf(apierror.CodePayloadTooLarge,
+			"Too many items in request, limit is %d", limit).With("limit", limit))
+	}
+	return nil
+}
+
+// authStatus ошибка для неудачной авторизации: заблокированному пользователю PermissionDenied,
+// при исчерпанном лимите на создание пользователей ResourceExhausted
+func authStatus(ctx context.Context, err error, msg string) error {
+	if exceeded, ok := ratelimit.IsExceeded(err); ok {
+		return exceededStatus(ctx, exceeded)
+	}
+	if errors.Is(err, auth.ErrUserBlocked) {
+		return apierror.StatusCode(ctx, apierror.CodeForbidden, "User is blocked")
+	}
+	return apierror.StatusCode(ctx, apierror.CodeUnauthorized, msg)
+}
+
+func (s *ShorturlServer) getOrCreateUser(ctx context.Context, scope string) (int, error) {
 
 	var userID int
 
-	userID, err := s.getUser(ctx)
+	userID, err := getUser(ctx, scope)
 
 	if err == nil {
 		return userID, err
 	}
+	if errors.Is(err, errBadCredentials) {
+		return 0, err
+	}
 
 	// user not verified, create new one
+	ip, _ := clientip.FromContext(ctx)
+	err = s.limiter.Allow(ctx, ratelimit.BucketUsers, ratelimit.IPKey(ip.String()), 1)
+	if exceeded, ok := ratelimit.IsExceeded(err); ok {
+		setRetryAfter(ctx, exceeded)
+		return 0, err
+	}
 	userID, err = s.urls.CreateNewUser(ctx)
 	if err != nil {
 		return 0, err
@@ -2,17 +2,30 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"net"
+	"net/netip"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
 	"github.com/wellywell/shorturl/internal/config"
+	commonhandlers "github.com/wellywell/shorturl/internal/handlers"
 	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/ratelimit"
 	"github.com/wellywell/shorturl/internal/storage"
 	"github.com/wellywell/shorturl/internal/tasks"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 var mockConfig = config.ServerConfig{BaseAddress: "localhost:8080", ShortURLsAddress: "http://localhost:8080"}
@@ -157,26 +170,42 @@ func TestShorturlServer_GetFullURL(t *testing.T) {
 			}
 		})
 	}
+
+	// отключённая ссылка - NotFound, как и 410 в HTTP API, с кодом gone в деталях ошибки
+	assert.NoError(t, storage.SetLinkDisabled(ctx, shortURL, true))
+	_, err = s.GetFullURL(ctx, &pb.FullURLRequest{ShortId: shortURL})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, apierror.CodeGone, apierror.CodeFromStatus(err))
 }
 
-func TestShorturlServer_Ping(t *testing.T) {
+// unavailableStorage хранилище в памяти, Ping которого возвращает err
+type unavailableStorage struct {
+	*storage.Memory
+	err error
+}
 
-	storage := storage.NewMemory()
-	s := &ShorturlServer{
-		urls:   storage,
-		config: mockConfig,
-	}
+func (u unavailableStorage) Ping(ctx context.Context) error {
+	return u.err
+}
+
+func TestShorturlServer_Ping(t *testing.T) {
 
 	ctx := grpc.NewContextWithServerTransportStream(context.Background(), &mockServerTransportStream{})
 
 	tests := []struct {
 		name    string
+		ping    error
 		wantErr bool
 	}{
-		{"no db", true},
+		{"storage available", nil, false},
+		{"storage unavailable", errors.New("connection refused"), true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			s := &ShorturlServer{
+				urls:   unavailableStorage{Memory: storage.NewMemory(), err: tt.ping},
+				config: mockConfig,
+			}
 			_, err := s.Ping(ctx, &pb.PingRequest{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ShorturlServer.Ping() error = %v, wantErr %v", err, tt.wantErr)
@@ -189,7 +218,7 @@ func TestShorturlServer_Ping(t *testing.T) {
 func TestShorturlServer_DeleteUserURLS(t *testing.T) {
 	st := storage.NewMemory()
 
-	deleteQueue := make(chan storage.ToDelete)
+	deleteQueue := tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig)
 	s := &ShorturlServer{
 		urls:        st,
 		config:      mockConfig,
@@ -220,7 +249,8 @@ func TestShorturlServer_DeleteUserURLS(t *testing.T) {
 		{"unauthorized", args{ctx, &pb.DeleteUserURLsRequest{Data: []string{shortURL}}}, true},
 		{"success", args{tokenCtx, &pb.DeleteUserURLsRequest{Data: []string{shortURL}}}, false},
 	}
-	go tasks.DeleteWorker(deleteQueue, st)
+	go deleteQueue.Run(context.Background())
+	defer deleteQueue.Close()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			_, err := s.DeleteUserURLS(tt.args.ctx, tt.args.in)
@@ -232,6 +262,38 @@ func TestShorturlServer_DeleteUserURLS(t *testing.T) {
 	}
 }
 
+func TestShorturlServer_DeleteResults(t *testing.T) {
+	st := storage.NewMemory()
+	s := &ShorturlServer{urls: st, config: mockConfig, deleteQueue: tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig)}
+
+	userID, err := st.CreateNewUser(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, st.Put(context.Background(), "mine", "https://example.com/mine", userID))
+	require.NoError(t, st.Put(context.Background(), "theirs", "https://example.com/theirs", userID+1))
+	token, err := auth.BuildJWTString(userID)
+	require.NoError(t, err)
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), &mockServerTransportStream{})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("token", token))
+
+	deleted, err := s.DeleteUserURLS(ctx, &pb.DeleteUserURLsRequest{Data: []string{"mine", "theirs"}, Sync: true})
+	require.NoError(t, err)
+	assert.Zero(t, deleted.JobId)
+	require.Len(t, deleted.Results, 2)
+	assert.Equal(t, storage.DeleteDeleted, deleted.Results[0].Status)
+	assert.Equal(t, storage.DeleteNotOwner, deleted.Results[1].Status)
+
+	queued, err := s.DeleteUserURLS(ctx, &pb.DeleteUserURLsRequest{Data: []string{"mine"}})
+	require.NoError(t, err)
+	job, err := s.GetDeleteJob(ctx, &pb.GetDeleteJobRequest{JobId: queued.JobId})
+	require.NoError(t, err)
+	assert.Equal(t, storage.DeleteJobPending, job.Status)
+	assert.Equal(t, []string{"mine"}, job.ShortUrls)
+	assert.Nil(t, job.DoneAt)
+
+	_, err = s.GetDeleteJob(ctx, &pb.GetDeleteJobRequest{JobId: queued.JobId + 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
 func TestShorturlServer_GetUserURLs(t *testing.T) {
 	st := storage.NewMemory()
 
@@ -313,3 +375,167 @@ func TestShorturlServer_GetStats(t *testing.T) {
 		})
 	}
 }
+
+func TestSubnetInterceptor(t *testing.T) {
+	interceptor, err := NewSubnetInterceptor("192.168.0.0/24,2001:db8::/32", "10.0.0.0/8",
+		pb.ShortURLService_GetStats_FullMethodName,
+		"/"+pb.AdminService_ServiceDesc.ServiceName+"/",
+	)
+	assert.NoError(t, err)
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	withPeer := func(addr string, md metadata.MD) context.Context {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addr))})
+		return metadata.NewIncomingContext(ctx, md)
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+	}{
+		{"trusted peer", withPeer("192.168.0.5:5000", nil), pb.ShortURLService_GetStats_FullMethodName, codes.OK},
+		{"trusted ipv6 peer", withPeer("[2001:db8::5]:5000", nil), pb.ShortURLService_GetStats_FullMethodName, codes.OK},
+		{"untrusted peer", withPeer("203.0.113.1:5000", nil), pb.ShortURLService_GetStats_FullMethodName, codes.PermissionDenied},
+		{"spoofed x-real-ip", withPeer("203.0.113.1:5000", metadata.Pairs("x-real-ip", "192.168.0.5")),
+			pb.ShortURLService_GetStats_FullMethodName, codes.PermissionDenied},
+		{"x-real-ip from proxy", withPeer("10.0.0.1:5000", metadata.Pairs("x-real-ip", "192.168.0.5")),
+			pb.ShortURLService_GetStats_FullMethodName, codes.OK},
+		{"untrusted via proxy", withPeer("10.0.0.1:5000", metadata.Pairs("x-real-ip", "203.0.113.1")),
+			pb.ShortURLService_GetStats_FullMethodName, codes.PermissionDenied},
+		{"no peer", context.Background(), pb.ShortURLService_GetStats_FullMethodName, codes.PermissionDenied},
+		{"admin service", withPeer("203.0.113.1:5000", nil), pb.AdminService_GetLink_FullMethodName, codes.PermissionDenied},
+		{"unprotected method", withPeer("203.0.113.1:5000", nil), pb.ShortURLService_Ping_FullMethodName, codes.OK},
+		// клиентский сертификат сервиса не отменяет проверку подсети
+		{"service certificate", auth.WithCertIdentity(withPeer("203.0.113.1:5000", nil), auth.CertIdentity{Service: "monitoring"}),
+			pb.ShortURLService_GetStats_FullMethodName, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interceptor.Unary(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			assert.Equal(t, tt.want, status.Code(err))
+		})
+	}
+
+	_, err = NewSubnetInterceptor("bad", "")
+	assert.Error(t, err)
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.BucketShorten: {Rate: 1.0 / 60, Burst: 2},
+		ratelimit.BucketUsers:   {Rate: 1.0 / 3600, Burst: 1},
+	})
+	interceptor, err := NewRateLimitInterceptor(limiter, "", map[string]string{
+		pb.ShortURLService_ShortenURL_FullMethodName: ratelimit.BucketShorten,
+	})
+	assert.NoError(t, err)
+
+	s := &ShorturlServer{urls: storage.NewMemory(), config: mockConfig}
+	s.SetRateLimiter(limiter)
+
+	call := func(addr string, method string) (*mockServerTransportStream, error) {
+		stream := &mockServerTransportStream{}
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addr))})
+		ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+		_, err := interceptor.Unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+			return s.ShortenURL(ctx, &pb.ShortenURLRequest{Url: "https://example.com/" + addr})
+		})
+		return stream, err
+	}
+
+	// первый вызов создаёт пользователя, второй с того же адреса упирается в лимит на создание пользователей
+	_, err = call("203.0.113.1:5000", pb.ShortURLService_ShortenURL_FullMethodName)
+	assert.NoError(t, err)
+	stream, err := call("203.0.113.1:5000", pb.ShortURLService_ShortenURL_FullMethodName)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"3600"}, stream.Header.Get("retry-after"))
+
+	// исчерпан лимит на сокращение для адреса
+	stream, err = call("203.0.113.1:5000", pb.ShortURLService_ShortenURL_FullMethodName)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"60"}, stream.Header.Get("retry-after"))
+
+	// лимиты считаются отдельно для каждого адреса, методы без лимита не ограничиваются
+	_, err = call("203.0.113.2:5000", pb.ShortURLService_ShortenURL_FullMethodName)
+	assert.NoError(t, err)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort("203.0.113.1:5000"))})
+	_, err = interceptor.Unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: pb.ShortURLService_Ping_FullMethodName},
+		func(ctx context.Context, req any) (any, error) {
+			return "ok", nil
+		})
+	assert.NoError(t, err)
+}
+
+func TestIdempotencyInterceptor(t *testing.T) {
+	store := storage.NewMemory()
+	s := &ShorturlServer{urls: store, config: mockConfig}
+	interceptor := NewIdempotencyInterceptor(commonhandlers.NewIdempotency(store, time.Hour), map[string]func() proto.Message{
+		pb.ShortURLService_ShortenBatch_FullMethodName: func() proto.Message { return &pb.ShortenBatchResponse{} },
+	})
+
+	userID, err := store.CreateNewUser(context.Background())
+	assert.NoError(t, err)
+	token, err := auth.BuildJWTString(userID)
+	assert.NoError(t, err)
+
+	call := func(key string, url string) (*pb.ShortenBatchResponse, *mockServerTransportStream, error) {
+		stream := &mockServerTransportStream{}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("token", token, "idempotency-key", key))
+		in := &pb.ShortenBatchRequest{Data: []*pb.ShortenBatchInData{{CorrelationId: "1", OriginalUrl: url}}}
+		resp, err := interceptor.Unary(ctx, in, &grpc.UnaryServerInfo{FullMethod: pb.ShortURLService_ShortenBatch_FullMethodName},
+			func(ctx context.Context, req any) (any, error) {
+				return s.ShortenBatch(ctx, req.(*pb.ShortenBatchRequest))
+			})
+		if err != nil {
+			return nil, stream, err
+		}
+		return resp.(*pb.ShortenBatchResponse), stream, nil
+	}
+
+	first, _, err := call("retry-1", "https://example.com/1")
+	assert.NoError(t, err)
+	retry, stream, err := call("retry-1", "https://example.com/1")
+	assert.NoError(t, err)
+	assert.Equal(t, first.Data[0].ShortUrl, retry.Data[0].ShortUrl)
+	assert.Equal(t, []string{"true"}, stream.Header.Get("idempotent-replayed"))
+
+	links, err := store.GetUserURLS(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Len(t, links, 1)
+
+	_, _, err = call("retry-1", "https://example.com/2")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestShorturlServer_ListLimits(t *testing.T) {
+	conf := mockConfig
+	conf.MaxBatchSize = 1
+	conf.MaxDeleteSize = 1
+	st := storage.NewMemory()
+	s := &ShorturlServer{urls: st, config: conf, deleteQueue: tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig)}
+
+	userID, err := s.urls.CreateNewUser(context.Background())
+	assert.NoError(t, err)
+	token, err := auth.BuildJWTString(userID)
+	assert.NoError(t, err)
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), &mockServerTransportStream{})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("token", token))
+
+	_, err = s.ShortenBatch(ctx, &pb.ShortenBatchRequest{Data: []*pb.ShortenBatchInData{
+		{CorrelationId: "1", OriginalUrl: "a"}, {CorrelationId: "2", OriginalUrl: "b"},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "limit is 1")
+
+	_, err = s.DeleteUserURLS(ctx, &pb.DeleteUserURLsRequest{Data: []string{"a", "b"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	deleted, err := s.DeleteUserURLS(ctx, &pb.DeleteUserURLsRequest{Data: []string{"a"}})
+	assert.NoError(t, err)
+	assert.NotZero(t, deleted.JobId)
+}
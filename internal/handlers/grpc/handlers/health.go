@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+)
+
+// HealthStorage хранилище, доступность которого проверяет HealthChecker
+type HealthStorage interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthChecker сервис grpc.health.v1, состояние которого зависит от доступности хранилища.
+// Состояние выставляется для всего сервера ("") и для ShortURLService
+type HealthChecker struct {
+	server   *health.Server
+	store    HealthStorage
+	interval time.Duration
+	services []string
+	logger   *zap.SugaredLogger
+}
+
+// NewHealthChecker инициализирует HealthChecker. До первой проверки сервисы считаются недоступными
+func NewHealthChecker(store HealthStorage, interval time.Duration) *HealthChecker {
+	h := &HealthChecker{
+		server:   health.NewServer(),
+		store:    store,
+		interval: interval,
+		services: []string{"", pb.ShortURLService_ServiceDesc.ServiceName},
+		logger:   zap.NewNop().Sugar(),
+	}
+	h.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return h
+}
+
+// SetLogger задаёт логгер для ошибок проверки хранилища
+func (h *HealthChecker) SetLogger(logger *zap.SugaredLogger) {
+	h.logger = logger
+}
+
+// Register регистрирует сервис health на сервере. Один HealthChecker можно зарегистрировать на нескольких серверах
+func (h *HealthChecker) Register(srv grpc.ServiceRegistrar) {
+	healthpb.RegisterHealthServer(srv, h.server)
+}
+
+// Check проверяет хранилище и обновляет состояние сервисов
+func (h *HealthChecker) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, h.interval)
+	defer cancel()
+	if err := h.store.Ping(ctx); err != nil {
+		h.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+		return err
+	}
+	h.setStatus(healthpb.HealthCheckResponse_SERVING)
+	return nil
+}
+
+// Run проверяет хранилище сразу и затем раз в interval, пока не отменён ctx
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		if err := h.Check(ctx); err != nil && ctx.Err() == nil {
+			h.logger.Errorw("health check failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown переводит все сервисы в NOT_SERVING до конца работы, чтобы клиенты перестали присылать новые вызовы
+func (h *HealthChecker) Shutdown() {
+	h.server.Shutdown()
+}
+
+func (h *HealthChecker) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range h.services {
+		h.server.SetServingStatus(service, status)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+)
+
+// pingStorage хранилище, доступность которого задаётся в тесте
+type pingStorage struct {
+	err error
+}
+
+func (p *pingStorage) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func TestHealthChecker(t *testing.T) {
+	store := &pingStorage{}
+	h := NewHealthChecker(store, time.Second)
+	ctx := context.Background()
+
+	statusOf := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := h.server.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+
+	// до первой проверки сервис недоступен
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, statusOf(""))
+
+	require.NoError(t, h.Check(ctx))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, statusOf(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, statusOf(pb.ShortURLService_ServiceDesc.ServiceName))
+
+	store.err = errors.New("connection refused")
+	assert.Error(t, h.Check(ctx))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, statusOf(pb.ShortURLService_ServiceDesc.ServiceName))
+
+	// после Shutdown проверки уже не меняют состояние
+	store.err = nil
+	h.Shutdown()
+	require.NoError(t, h.Check(ctx))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, statusOf(""))
+}
+
+func TestHealthCheckerRunLogs(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	h := NewHealthChecker(&pingStorage{err: errors.New("connection refused")}, 10*time.Millisecond)
+	h.SetLogger(zap.New(core).Sugar())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("health check failed").Len() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
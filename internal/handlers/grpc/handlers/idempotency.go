@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/handlers"
+)
+
+// idempotencyKeyMetadata ключ метаданных с ключом идемпотентности
+const idempotencyKeyMetadata = "idempotency-key"
+
+// IdempotencyInterceptor сохраняет первый ответ на вызов с метаданными idempotency-key и отдаёт его на повторы.
+// Ключ учитывается только для авторизованного пользователя
+type IdempotencyInterceptor struct {
+	idempotency *handlers.Idempotency
+	methods     map[string]func() proto.Message
+	logger      *zap.SugaredLogger
+}
+
+// NewIdempotencyInterceptor инициализирует IdempotencyInterceptor.
+// methods сопоставляет полное имя метода конструктору пустого ответа, в который разбирается сохранённый ответ
+func NewIdempotencyInterceptor(idempotency *handlers.Idempotency, methods map[string]func() proto.Message) *IdempotencyInterceptor {
+	return &IdempotencyInterceptor{idempotency: idempotency, methods: methods, logger: zap.NewNop().Sugar()}
+}
+
+// SetLogger задаёт логгер для ошибок сохранения ответа и освобождения ключа
+func (i *IdempotencyInterceptor) SetLogger(logger *zap.SugaredLogger) {
+	i.logger = logger
+}
+
+// Unary для использования IdempotencyInterceptor в качестве grpc.UnaryServerInterceptor
+func (i *IdempotencyInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	newResponse, ok := i.methods[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(idempotencyKeyMetadata)
+	if len(values) == 0 {
+		return handler(ctx, req)
+	}
+	key := values[0]
+	userID, err := getUser(ctx, auth.ScopeLinksWrite)
+	if err != nil {
+		return handler(ctx, req)
+	}
+
+	request, err := proto.MarshalOptions{Deterministic: true}.Marshal(req.(proto.Message))
+	if err != nil {
+		return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not check idempotency key")
+	}
+	replay, err := i.idempotency.Begin(ctx, userID, key, handlers.RequestHash([]byte(info.FullMethod), request))
+	switch {
+	case errors.Is(err, handlers.ErrBadIdempotencyKey):
+		return nil, apierror.StatusCode(ctx, apierror.CodeBadRequest, "Bad idempotency key")
+	case errors.Is(err, handlers.ErrIdempotencyKeyReused):
+		return nil, apierror.StatusCode(ctx, apierror.CodeUnprocessable, "Idempotency key reused with different request")
+	case errors.Is(err, handlers.ErrIdempotencyKeyInProgress):
+		return nil, apierror.StatusCode(ctx, apierror.CodeConflict, "Request with this idempotency key is in progress")
+	case err != nil:
+		return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not check idempotency key")
+	}
+
+	if replay != nil {
+		resp := newResponse()
+		if err := proto.Unmarshal(replay.Body, resp); err != nil {
+			return nil, apierror.StatusCode(ctx, apierror.CodeInternal, "Could not read saved response")
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs("idempotent-replayed", "true"))
+		return resp, nil
+	}
+
+	// если обработчик упал, ключ освобождается, чтобы вызов можно было повторить
+	defer func() {
+		if p := recover(); p != nil {
+			if err := i.idempotency.Release(ctx, userID, key); err != nil {
+				i.logger.Errorw("could not release idempotency key", "user", userID, "error", err)
+			}
+			panic(p)
+		}
+	}()
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		// неудавшийся вызов можно повторить с тем же ключом
+		if err := i.idempotency.Release(ctx, userID, key); err != nil {
+			i.logger.Errorw("could not release idempotency key", "user", userID, "error", err)
+		}
+		return nil, err
+	}
+	body, err := proto.Marshal(resp.(proto.Message))
+	if err == nil {
+		err = i.idempotency.Complete(ctx, userID, key, http.StatusOK, "application/x-protobuf", "", body)
+	}
+	if err != nil {
+		i.logger.Errorw("could not save idempotent response", "user", userID, "error", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/clientip"
+	"github.com/wellywell/shorturl/internal/ratelimit"
+)
+
+// RateLimitInterceptor ограничивает частоту вызовов методов. Вызовы авторизованного пользователя
+// считаются по его id, остальные - по адресу клиента. Адрес клиента сохраняется в контексте для обработчиков
+type RateLimitInterceptor struct {
+	limiter  *ratelimit.Limiter
+	resolver *clientip.Resolver
+	methods  map[string]string
+}
+
+// NewRateLimitInterceptor инициализирует RateLimitInterceptor.
+// methods сопоставляет полное имя метода вида /package.Service/Method ограничиваемому действию
+func NewRateLimitInterceptor(limiter *ratelimit.Limiter, trustedProxies string, methods map[string]string) (*RateLimitInterceptor, error) {
+	resolver, err := clientip.NewResolver(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimitInterceptor{limiter: limiter, resolver: resolver, methods: methods}, nil
+}
+
+// Unary для использования RateLimitInterceptor в качестве grpc.UnaryServerInterceptor
+func (i *RateLimitInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := i.allow(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// Stream для использования RateLimitInterceptor в качестве grpc.StreamServerInterceptor.
+// Открытие потока считается одним вызовом, сообщения внутри потока ограничивает сам обработчик
+func (i *RateLimitInterceptor) Stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := i.allow(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, withContext(ss, ctx))
+}
+
+func (i *RateLimitInterceptor) allow(ctx context.Context, method string) (context.Context, error) {
+	addr := clientIP(ctx, i.resolver)
+	if addr.IsValid() {
+		ctx = clientip.NewContext(ctx, addr)
+	}
+
+	if bucket, ok := i.methods[method]; ok {
+		key := ratelimit.IPKey(addr.String())
+		if userID, err := getUser(ctx, ""); err == nil {
+			key = ratelimit.UserKey(userID)
+		}
+		err := i.limiter.Allow(ctx, bucket, key, 1)
+		if exceeded, ok := ratelimit.IsExceeded(err); ok {
+			return ctx, exceededStatus(ctx, exceeded)
+		}
+	}
+	return ctx, nil
+}
+
+// exceededStatus ошибка ResourceExhausted, время до повтора в секундах передаётся в заголовке retry-after
+func exceededStatus(ctx context.Context, exceeded *ratelimit.ExceededError) error {
+	setRetryAfter(ctx, exceeded)
+	return apierror.Status(ctx, apierror.New(apierror.CodeRateLimited, "Too many requests").
+		With("bucket", exceeded.Bucket).
+		With("retry_after", exceeded.RetryAfterSeconds()))
+}
+
+func setRetryAfter(ctx context.Context, exceeded *ratelimit.ExceededError) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(exceeded.RetryAfterSeconds())))
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/handlers"
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/ratelimit"
+	"github.com/wellywell/shorturl/internal/url"
+)
+
+// serverStream поток с контекстом, дополненным перехватчиком
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context возвращает дополненный контекст
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// withContext подменяет контекст потока, если перехватчик его изменил
+func withContext(ss grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	if ctx == ss.Context() {
+		return ss
+	}
+	return &serverStream{ServerStream: ss, ctx: ctx}
+}
+
+// listUserURLsPageSize сколько ссылок ListUserURLs читает из хранилища за раз
+const listUserURLsPageSize = 100
+
+// ListUserURLs отправляет ссылки пользователя по одной
+func (s *ShorturlServer) ListUserURLs(in *pb.ListUserURLsRequest, stream grpc.ServerStreamingServer[pb.URLData]) error {
+	ctx := stream.Context()
+	user, err := getUser(ctx, auth.ScopeLinksRead)
+	if err != nil {
+		return authStatus(ctx, err, "Unknown user")
+	}
+	// ссылки читаются страницами и отправляются по мере чтения
+	after := ""
+	for {
+		urls, err := s.urls.GetUserURLSPage(ctx, user, after, listUserURLsPageSize)
+		if err != nil {
+			return apierror.StatusCode(ctx, apierror.CodeInternal, "Unkwnown error")
+		}
+		for _, data := range urls {
+			err := stream.Send(&pb.URLData{
+				ShortUrl:    url.FormatShortURL(s.config.ShortURLsAddress, data.ShortURL),
+				OriginalUrl: data.FullURL,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(urls) < listUserURLsPageSize {
+			return nil
+		}
+		after = urls[len(urls)-1].ShortURL
+	}
+}
+
+// ShortenStream сокращает ссылки по мере получения. Каждая ссылка учитывается в лимите пакетов пользователя,
+// ссылка, не прошедшая проверку, возвращается с ошибкой, а поток продолжается
+func (s *ShorturlServer) ShortenStream(stream grpc.BidiStreamingServer[pb.ShortenStreamRequest, pb.ShortenStreamResponse]) error {
+	ctx := stream.Context()
+	userID, err := s.getOrCreateUser(ctx, auth.ScopeLinksWrite)
+	if err != nil {
+		return authStatus(ctx, err, "Error authenticating user")
+	}
+	if err := s.setAuth(ctx, userID); err != nil {
+		return apierror.StatusCode(ctx, apierror.CodeUnauthorized, "Error authenticating user")
+	}
+
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp := &pb.ShortenStreamResponse{CorrelationId: in.CorrelationId}
+		if !url.Validate(in.OriginalUrl) {
+			resp.Error = "URL must be of length from 1 to 250"
+		} else {
+			err = s.limiter.Allow(ctx, ratelimit.BucketBatch, ratelimit.UserKey(userID), 1)
+			if exceeded, ok := ratelimit.IsExceeded(err); ok {
+				return exceededStatus(ctx, exceeded)
+			}
+			resp.ShortUrl, resp.IsCreated, err = handlers.GetShortURL(ctx, in.OriginalUrl, userID, s.urls, s.config)
+			if err != nil {
+				return apierror.StatusCode(ctx, apierror.CodeInternal, "Could not store url")
+			}
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// DeleteUserURLsStream удаляет ссылки из всех сообщений потока: каждое сообщение становится отдельным заданием,
+// либо с sync удаляется сразу. Ответ отправляется после того, как клиент закрыл поток
+func (s *ShorturlServer) DeleteUserURLsStream(stream grpc.ClientStreamingServer[pb.DeleteUserURLsRequest, pb.DeleteUserURLsStreamResponse]) error {
+	ctx := stream.Context()
+	user, err := getUser(ctx, auth.ScopeLinksWrite)
+	if err != nil {
+		return authStatus(ctx, err, "Unknown user")
+	}
+
+	resp := &pb.DeleteUserURLsStreamResponse{}
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkListSize(ctx, len(in.Data), s.config.MaxDeleteSize); err != nil {
+			return err
+		}
+		if len(in.Data) == 0 {
+			continue
+		}
+
+		if in.Sync {
+			results, err := s.deleteQueue.Delete(ctx, user, in.Data...)
+			if err != nil {
+				return apierror.StatusCode(ctx, apierror.CodeInternal, "Could not delete")
+			}
+			resp.Results = append(resp.Results, newDeleteResults(results)...)
+			continue
+		}
+		job, err := s.deleteQueue.Enqueue(ctx, user, in.Data...)
+		if err != nil {
+			return apierror.StatusCode(ctx, apierror.CodeInternal, "Could not queue deletion")
+		}
+		resp.JobIds = append(resp.JobIds, int32(job.ID))
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	pb "github.com/wellywell/shorturl/internal/handlers/grpc/proto"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+// newStreamClient запускает ShorturlServer на соединении в памяти
+func newStreamClient(t *testing.T, st *storage.Memory) pb.ShortURLServiceClient {
+	conf := mockConfig
+	conf.MaxDeleteSize = 2
+	srv := grpc.NewServer(grpc.ChainStreamInterceptor(CorrelationInterceptor{}.Stream))
+	pb.RegisterShortURLServiceServer(srv, NewShorturlServer(st, tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig), conf))
+
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewShortURLServiceClient(conn)
+}
+
+func userContext(t *testing.T, userID int) context.Context {
+	token, err := auth.BuildJWTString(userID)
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), "token", token)
+}
+
+func TestShorturlServer_ListUserURLs(t *testing.T) {
+	st := storage.NewMemory()
+	client := newStreamClient(t, st)
+	ctx := context.Background()
+	userID, _ := st.CreateNewUser(ctx)
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, st.Put(ctx, key, "https://example.com/"+key, userID))
+	}
+	require.NoError(t, st.Put(ctx, "other", "https://example.com/other", userID+1))
+
+	stream, err := client.ListUserURLs(userContext(t, userID), &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	var received []string
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		received = append(received, data.OriginalUrl)
+	}
+	assert.ElementsMatch(t, []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}, received)
+
+	stream, err = client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestShorturlServer_ListUserURLsPages(t *testing.T) {
+	st := storage.NewMemory()
+	client := newStreamClient(t, st)
+	ctx := context.Background()
+	userID, _ := st.CreateNewUser(ctx)
+
+	// ссылок больше, чем помещается на одну страницу хранилища
+	var want []string
+	for i := range 2*listUserURLsPageSize + 1 {
+		key := fmt.Sprintf("key%03d", i)
+		require.NoError(t, st.Put(ctx, key, "https://example.com/"+key, userID))
+		want = append(want, "https://example.com/"+key)
+	}
+
+	stream, err := client.ListUserURLs(userContext(t, userID), &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	var received []string
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		received = append(received, data.OriginalUrl)
+	}
+	assert.Equal(t, want, received)
+}
+
+func TestShorturlServer_ShortenStream(t *testing.T) {
+	st := storage.NewMemory()
+	client := newStreamClient(t, st)
+
+	stream, err := client.ShortenStream(context.Background())
+	require.NoError(t, err)
+
+	// ответ на каждую ссылку приходит до отправки следующей
+	require.NoError(t, stream.Send(&pb.ShortenStreamRequest{CorrelationId: "1", OriginalUrl: "https://example.com"}))
+	first, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "1", first.CorrelationId)
+	assert.True(t, first.IsCreated)
+	assert.Empty(t, first.Error)
+
+	require.NoError(t, stream.Send(&pb.ShortenStreamRequest{CorrelationId: "2", OriginalUrl: ""}))
+	invalid, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "2", invalid.CorrelationId)
+	assert.NotEmpty(t, invalid.Error)
+	assert.Empty(t, invalid.ShortUrl)
+
+	require.NoError(t, stream.Send(&pb.ShortenStreamRequest{CorrelationId: "3", OriginalUrl: "https://example.org"}))
+	third, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "3", third.CorrelationId)
+	assert.NotEqual(t, first.ShortUrl, third.ShortUrl)
+
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	// новому пользователю выдан токен, идентификатор запроса возвращается в заголовке
+	header, err := stream.Header()
+	require.NoError(t, err)
+	assert.NotEmpty(t, header.Get("token"))
+	assert.NotEmpty(t, header.Get(apierror.CorrelationHeader))
+}
+
+func TestShorturlServer_DeleteUserURLsStream(t *testing.T) {
+	st := storage.NewMemory()
+	client := newStreamClient(t, st)
+	ctx := context.Background()
+	userID, _ := st.CreateNewUser(ctx)
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, st.Put(ctx, key, "https://example.com/"+key, userID))
+	}
+
+	stream, err := client.DeleteUserURLsStream(userContext(t, userID))
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.DeleteUserURLsRequest{Data: []string{"a", "missing"}, Sync: true}))
+	require.NoError(t, stream.Send(&pb.DeleteUserURLsRequest{Data: []string{"b", "c"}}))
+	resp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, storage.DeleteDeleted, resp.Results[0].Status)
+	assert.Equal(t, storage.DeleteNotFound, resp.Results[1].Status)
+	require.Len(t, resp.JobIds, 1)
+	job, err := st.GetDeleteJob(ctx, userID, int(resp.JobIds[0]))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, job.ShortURLs)
+
+	// лимит MaxDeleteSize действует на каждое сообщение
+	stream, err = client.DeleteUserURLsStream(userContext(t, userID))
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.DeleteUserURLsRequest{Data: []string{"a", "b", "c"}}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
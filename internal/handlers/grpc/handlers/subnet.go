@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/clientip"
+)
+
+// SubnetInterceptor пропускает вызовы выбранных методов только из доверенных подсетей.
+// Адрес клиента - адрес пира, а метаданные x-real-ip учитываются, только если пир - доверенный прокси
+type SubnetInterceptor struct {
+	trusted  clientip.Prefixes
+	resolver *clientip.Resolver
+	methods  []string
+}
+
+// NewSubnetInterceptor инициализирует SubnetInterceptor. Подсети задаются через запятую.
+// methods - полные имена методов вида /package.Service/Method, либо /package.Service/ для всех методов сервиса
+func NewSubnetInterceptor(trusted string, trustedProxies string, methods ...string) (*SubnetInterceptor, error) {
+	prefixes, err := clientip.ParsePrefixes(trusted)
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := clientip.NewResolver(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &SubnetInterceptor{trusted: prefixes, resolver: resolver, methods: methods}, nil
+}
+
+// Unary для использования SubnetInterceptor в качестве grpc.UnaryServerInterceptor
+func (i *SubnetInterceptor) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := i.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// Stream для использования SubnetInterceptor в качестве grpc.StreamServerInterceptor
+func (i *SubnetInterceptor) Stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := i.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (i *SubnetInterceptor) check(ctx context.Context, method string) error {
+	if i.protects(method) {
+		addr := clientIP(ctx, i.resolver)
+		if !addr.IsValid() || !i.trusted.Contains(addr) {
+			return apierror.StatusCode(ctx, apierror.CodeForbidden, "Not trusted network")
+		}
+	}
+	return nil
+}
+
+func (i *SubnetInterceptor) protects(method string) bool {
+	return slices.ContainsFunc(i.methods, func(m string) bool {
+		if strings.HasSuffix(m, "/") {
+			return strings.HasPrefix(method, m)
+		}
+		return m == method
+	})
+}
+
+// clientIP адрес клиента: адрес пира, либо x-real-ip из метаданных, если пир - доверенный прокси
+func clientIP(ctx context.Context, resolver *clientip.Resolver) netip.Addr {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return netip.Addr{}
+	}
+	addrPort, err := netip.ParseAddrPort(p.Addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr := addrPort.Addr().Unmap()
+	if !resolver.IsTrustedProxy(addr) {
+		return addr
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-real-ip"); len(values) > 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(values[0])); err == nil {
+			return realIP.Unmap()
+		}
+	}
+	return addr
+}
@@ -20,24 +20,37 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ShortURLService_ShortenURL_FullMethodName     = "/handlers.grcp.ShortURLService/ShortenURL"
-	ShortURLService_ShortenBatch_FullMethodName   = "/handlers.grcp.ShortURLService/ShortenBatch"
-	ShortURLService_GetFullURL_FullMethodName     = "/handlers.grcp.ShortURLService/GetFullURL"
-	ShortURLService_DeleteUserURLS_FullMethodName = "/handlers.grcp.ShortURLService/DeleteUserURLS"
-	ShortURLService_GetUserURLs_FullMethodName    = "/handlers.grcp.ShortURLService/GetUserURLs"
-	ShortURLService_GetStats_FullMethodName       = "/handlers.grcp.ShortURLService/GetStats"
-	ShortURLService_Ping_FullMethodName           = "/handlers.grcp.ShortURLService/Ping"
+	ShortURLService_ShortenURL_FullMethodName           = "/handlers.grcp.ShortURLService/ShortenURL"
+	ShortURLService_ShortenBatch_FullMethodName         = "/handlers.grcp.ShortURLService/ShortenBatch"
+	ShortURLService_GetFullURL_FullMethodName           = "/handlers.grcp.ShortURLService/GetFullURL"
+	ShortURLService_DeleteUserURLS_FullMethodName       = "/handlers.grcp.ShortURLService/DeleteUserURLS"
+	ShortURLService_GetDeleteJob_FullMethodName         = "/handlers.grcp.ShortURLService/GetDeleteJob"
+	ShortURLService_GetUserURLs_FullMethodName          = "/handlers.grcp.ShortURLService/GetUserURLs"
+	ShortURLService_ListUserURLs_FullMethodName         = "/handlers.grcp.ShortURLService/ListUserURLs"
+	ShortURLService_ShortenStream_FullMethodName        = "/handlers.grcp.ShortURLService/ShortenStream"
+	ShortURLService_DeleteUserURLsStream_FullMethodName = "/handlers.grcp.ShortURLService/DeleteUserURLsStream"
+	ShortURLService_GetStats_FullMethodName             = "/handlers.grcp.ShortURLService/GetStats"
+	ShortURLService_Ping_FullMethodName                 = "/handlers.grcp.ShortURLService/Ping"
 )
 
 // ShortURLServiceClient is the client API for ShortURLService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ShortURLService также доступен как JSON/HTTP через grpc-gateway по путям из аннотаций google.api.http
 type ShortURLServiceClient interface {
 	ShortenURL(ctx context.Context, in *ShortenURLRequest, opts ...grpc.CallOption) (*ShortenURLResponse, error)
 	ShortenBatch(ctx context.Context, in *ShortenBatchRequest, opts ...grpc.CallOption) (*ShortenBatchResponse, error)
 	GetFullURL(ctx context.Context, in *FullURLRequest, opts ...grpc.CallOption) (*FullURLResponse, error)
 	DeleteUserURLS(ctx context.Context, in *DeleteUserURLsRequest, opts ...grpc.CallOption) (*DeleteUserURLsResponse, error)
+	GetDeleteJob(ctx context.Context, in *GetDeleteJobRequest, opts ...grpc.CallOption) (*GetDeleteJobResponse, error)
 	GetUserURLs(ctx context.Context, in *GetUserURLsRequest, opts ...grpc.CallOption) (*GetUserURLsResponse, error)
+	// ListUserURLs отдаёт ссылки пользователя по одной, размер ответа не ограничен размером сообщения
+	ListUserURLs(ctx context.Context, in *ListUserURLsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[URLData], error)
+	// ShortenStream сокращает ссылки по мере получения и отвечает на каждую, как только она сохранена
+	ShortenStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ShortenStreamRequest, ShortenStreamResponse], error)
+	// DeleteUserURLsStream удаляет ссылки, присланные несколькими сообщениями. Лимит MaxDeleteSize действует на каждое сообщение
+	DeleteUserURLsStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DeleteUserURLsRequest, DeleteUserURLsStreamResponse], error)
 	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
 	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
 }
@@ -90,6 +103,16 @@ func (c *shortURLServiceClient) DeleteUserURLS(ctx context.Context, in *DeleteUs
 	return out, nil
 }
 
+func (c *shortURLServiceClient) GetDeleteJob(ctx context.Context, in *GetDeleteJobRequest, opts ...grpc.CallOption) (*GetDeleteJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetDeleteJobResponse)
+	err := c.cc.Invoke(ctx, ShortURLService_GetDeleteJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shortURLServiceClient) GetUserURLs(ctx context.Context, in *GetUserURLsRequest, opts ...grpc.CallOption) (*GetUserURLsResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(GetUserURLsResponse)
@@ -100,6 +123,51 @@ func (c *shortURLServiceClient) GetUserURLs(ctx context.Context, in *GetUserURLs
 	return out, nil
 }
 
+func (c *shortURLServiceClient) ListUserURLs(ctx context.Context, in *ListUserURLsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[URLData], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ShortURLService_ServiceDesc.Streams[0], ShortURLService_ListUserURLs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListUserURLsRequest, URLData]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortURLService_ListUserURLsClient = grpc.ServerStreamingClient[URLData]
+
+func (c *shortURLServiceClient) ShortenStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ShortenStreamRequest, ShortenStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ShortURLService_ServiceDesc.Streams[1], ShortURLService_ShortenStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ShortenStreamRequest, ShortenStreamResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortURLService_ShortenStreamClient = grpc.BidiStreamingClient[ShortenStreamRequest, ShortenStreamResponse]
+
+func (c *shortURLServiceClient) DeleteUserURLsStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DeleteUserURLsRequest, DeleteUserURLsStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ShortURLService_ServiceDesc.Streams[2], ShortURLService_DeleteUserURLsStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DeleteUserURLsRequest, DeleteUserURLsStreamResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortURLService_DeleteUserURLsStreamClient = grpc.ClientStreamingClient[DeleteUserURLsRequest, DeleteUserURLsStreamResponse]
+
 func (c *shortURLServiceClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(GetStatsResponse)
@@ -123,12 +191,21 @@ func (c *shortURLServiceClient) Ping(ctx context.Context, in *PingRequest, opts
 // ShortURLServiceServer is the server API for ShortURLService service.
 // All implementations must embed UnimplementedShortURLServiceServer
 // for forward compatibility.
+//
+// ShortURLService также доступен как JSON/HTTP через grpc-gateway по путям из аннотаций google.api.http
 type ShortURLServiceServer interface {
 	ShortenURL(context.Context, *ShortenURLRequest) (*ShortenURLResponse, error)
 	ShortenBatch(context.Context, *ShortenBatchRequest) (*ShortenBatchResponse, error)
 	GetFullURL(context.Context, *FullURLRequest) (*FullURLResponse, error)
 	DeleteUserURLS(context.Context, *DeleteUserURLsRequest) (*DeleteUserURLsResponse, error)
+	GetDeleteJob(context.Context, *GetDeleteJobRequest) (*GetDeleteJobResponse, error)
 	GetUserURLs(context.Context, *GetUserURLsRequest) (*GetUserURLsResponse, error)
+	// ListUserURLs отдаёт ссылки пользователя по одной, размер ответа не ограничен размером сообщения
+	ListUserURLs(*ListUserURLsRequest, grpc.ServerStreamingServer[URLData]) error
+	// ShortenStream сокращает ссылки по мере получения и отвечает на каждую, как только она сохранена
+	ShortenStream(grpc.BidiStreamingServer[ShortenStreamRequest, ShortenStreamResponse]) error
+	// DeleteUserURLsStream удаляет ссылки, присланные несколькими сообщениями. Лимит MaxDeleteSize действует на каждое сообщение
+	DeleteUserURLsStream(grpc.ClientStreamingServer[DeleteUserURLsRequest, DeleteUserURLsStreamResponse]) error
 	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
 	Ping(context.Context, *PingRequest) (*PingResponse, error)
 	mustEmbedUnimplementedShortURLServiceServer()
@@ -153,9 +230,21 @@ func (UnimplementedShortURLServiceServer) GetFullURL(context.Context, *FullURLRe
 func (UnimplementedShortURLServiceServer) DeleteUserURLS(context.Context, *DeleteUserURLsRequest) (*DeleteUserURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteUserURLS not implemented")
 }
+func (UnimplementedShortURLServiceServer) GetDeleteJob(context.Context, *GetDeleteJobRequest) (*GetDeleteJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeleteJob not implemented")
+}
 func (UnimplementedShortURLServiceServer) GetUserURLs(context.Context, *GetUserURLsRequest) (*GetUserURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUserURLs not implemented")
 }
+func (UnimplementedShortURLServiceServer) ListUserURLs(*ListUserURLsRequest, grpc.ServerStreamingServer[URLData]) error {
+	return status.Errorf(codes.Unimplemented, "method ListUserURLs not implemented")
+}
+func (UnimplementedShortURLServiceServer) ShortenStream(grpc.BidiStreamingServer[ShortenStreamRequest, ShortenStreamResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ShortenStream not implemented")
+}
+func (UnimplementedShortURLServiceServer) DeleteUserURLsStream(grpc.ClientStreamingServer[DeleteUserURLsRequest, DeleteUserURLsStreamResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DeleteUserURLsStream not implemented")
+}
 func (UnimplementedShortURLServiceServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
 }
@@ -255,6 +344,24 @@ func _ShortURLService_DeleteUserURLS_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShortURLService_GetDeleteJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeleteJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortURLServiceServer).GetDeleteJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortURLService_GetDeleteJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortURLServiceServer).GetDeleteJob(ctx, req.(*GetDeleteJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ShortURLService_GetUserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetUserURLsRequest)
 	if err := dec(in); err != nil {
@@ -273,6 +380,31 @@ func _ShortURLService_GetUserURLs_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShortURLService_ListUserURLs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListUserURLsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShortURLServiceServer).ListUserURLs(m, &grpc.GenericServerStream[ListUserURLsRequest, URLData]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortURLService_ListUserURLsServer = grpc.ServerStreamingServer[URLData]
+
+func _ShortURLService_ShortenStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortURLServiceServer).ShortenStream(&grpc.GenericServerStream[ShortenStreamRequest, ShortenStreamResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortURLService_ShortenStreamServer = grpc.BidiStreamingServer[ShortenStreamRequest, ShortenStreamResponse]
+
+func _ShortURLService_DeleteUserURLsStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortURLServiceServer).DeleteUserURLsStream(&grpc.GenericServerStream[DeleteUserURLsRequest, DeleteUserURLsStreamResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortURLService_DeleteUserURLsStreamServer = grpc.ClientStreamingServer[DeleteUserURLsRequest, DeleteUserURLsStreamResponse]
+
 func _ShortURLService_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetStatsRequest)
 	if err := dec(in); err != nil {
@@ -332,6 +464,10 @@ var ShortURLService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteUserURLS",
 			Handler:    _ShortURLService_DeleteUserURLS_Handler,
 		},
+		{
+			MethodName: "GetDeleteJob",
+			Handler:    _ShortURLService_GetDeleteJob_Handler,
+		},
 		{
 			MethodName: "GetUserURLs",
 			Handler:    _ShortURLService_GetUserURLs_Handler,
@@ -345,6 +481,319 @@ var ShortURLService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _ShortURLService_Ping_Handler,
 		},
 	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListUserURLs",
+			Handler:       _ShortURLService_ListUserURLs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ShortenStream",
+			Handler:       _ShortURLService_ShortenStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DeleteUserURLsStream",
+			Handler:       _ShortURLService_DeleteUserURLsStream_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/shorturl.proto",
+}
+
+const (
+	AdminService_GetLink_FullMethodName          = "/handlers.grcp.AdminService/GetLink"
+	AdminService_DeleteLink_FullMethodName       = "/handlers.grcp.AdminService/DeleteLink"
+	AdminService_SetLinkDisabled_FullMethodName  = "/handlers.grcp.AdminService/SetLinkDisabled"
+	AdminService_SetUserBlocked_FullMethodName   = "/handlers.grcp.AdminService/SetUserBlocked"
+	AdminService_ListRecentLinks_FullMethodName  = "/handlers.grcp.AdminService/ListRecentLinks"
+	AdminService_ListAuditRecords_FullMethodName = "/handlers.grcp.AdminService/ListAuditRecords"
+)
+
+// AdminServiceClient is the client API for AdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// AdminService доступен только администраторам из доверенной подсети
+type AdminServiceClient interface {
+	GetLink(ctx context.Context, in *GetLinkRequest, opts ...grpc.CallOption) (*GetLinkResponse, error)
+	DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error)
+	SetLinkDisabled(ctx context.Context, in *SetLinkDisabledRequest, opts ...grpc.CallOption) (*SetLinkDisabledResponse, error)
+	SetUserBlocked(ctx context.Context, in *SetUserBlockedRequest, opts ...grpc.CallOption) (*SetUserBlockedResponse, error)
+	ListRecentLinks(ctx context.Context, in *ListRecentLinksRequest, opts ...grpc.CallOption) (*ListRecentLinksResponse, error)
+	ListAuditRecords(ctx context.Context, in *ListAuditRecordsRequest, opts ...grpc.CallOption) (*ListAuditRecordsResponse, error)
+}
+
+type adminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminServiceClient(cc grpc.ClientConnInterface) AdminServiceClient {
+	return &adminServiceClient{cc}
+}
+
+func (c *adminServiceClient) GetLink(ctx context.Context, in *GetLinkRequest, opts ...grpc.CallOption) (*GetLinkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetLinkResponse)
+	err := c.cc.Invoke(ctx, AdminService_GetLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteLinkResponse)
+	err := c.cc.Invoke(ctx, AdminService_DeleteLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) SetLinkDisabled(ctx context.Context, in *SetLinkDisabledRequest, opts ...grpc.CallOption) (*SetLinkDisabledResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetLinkDisabledResponse)
+	err := c.cc.Invoke(ctx, AdminService_SetLinkDisabled_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) SetUserBlocked(ctx context.Context, in *SetUserBlockedRequest, opts ...grpc.CallOption) (*SetUserBlockedResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetUserBlockedResponse)
+	err := c.cc.Invoke(ctx, AdminService_SetUserBlocked_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) ListRecentLinks(ctx context.Context, in *ListRecentLinksRequest, opts ...grpc.CallOption) (*ListRecentLinksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRecentLinksResponse)
+	err := c.cc.Invoke(ctx, AdminService_ListRecentLinks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) ListAuditRecords(ctx context.Context, in *ListAuditRecordsRequest, opts ...grpc.CallOption) (*ListAuditRecordsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAuditRecordsResponse)
+	err := c.cc.Invoke(ctx, AdminService_ListAuditRecords_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServiceServer is the server API for AdminService service.
+// All implementations must embed UnimplementedAdminServiceServer
+// for forward compatibility.
+//
+// AdminService доступен только администраторам из доверенной подсети
+type AdminServiceServer interface {
+	GetLink(context.Context, *GetLinkRequest) (*GetLinkResponse, error)
+	DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error)
+	SetLinkDisabled(context.Context, *SetLinkDisabledRequest) (*SetLinkDisabledResponse, error)
+	SetUserBlocked(context.Context, *SetUserBlockedRequest) (*SetUserBlockedResponse, error)
+	ListRecentLinks(context.Context, *ListRecentLinksRequest) (*ListRecentLinksResponse, error)
+	ListAuditRecords(context.Context, *ListAuditRecordsRequest) (*ListAuditRecordsResponse, error)
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+// UnimplementedAdminServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAdminServiceServer struct{}
+
+func (UnimplementedAdminServiceServer) GetLink(context.Context, *GetLinkRequest) (*GetLinkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLink not implemented")
+}
+func (UnimplementedAdminServiceServer) DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLink not implemented")
+}
+func (UnimplementedAdminServiceServer) SetLinkDisabled(context.Context, *SetLinkDisabledRequest) (*SetLinkDisabledResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLinkDisabled not implemented")
+}
+func (UnimplementedAdminServiceServer) SetUserBlocked(context.Context, *SetUserBlockedRequest) (*SetUserBlockedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetUserBlocked not implemented")
+}
+func (UnimplementedAdminServiceServer) ListRecentLinks(context.Context, *ListRecentLinksRequest) (*ListRecentLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecentLinks not implemented")
+}
+func (UnimplementedAdminServiceServer) ListAuditRecords(context.Context, *ListAuditRecordsRequest) (*ListAuditRecordsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditRecords not implemented")
+}
+func (UnimplementedAdminServiceServer) mustEmbedUnimplementedAdminServiceServer() {}
+func (UnimplementedAdminServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServiceServer will
+// result in compilation errors.
+type UnsafeAdminServiceServer interface {
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+func RegisterAdminServiceServer(s grpc.ServiceRegistrar, srv AdminServiceServer) {
+	// If the following call pancis, it indicates UnimplementedAdminServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AdminService_ServiceDesc, srv)
+}
+
+func _AdminService_GetLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).GetLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_GetLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).GetLink(ctx, req.(*GetLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_DeleteLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).DeleteLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_DeleteLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).DeleteLink(ctx, req.(*DeleteLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_SetLinkDisabled_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkDisabledRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).SetLinkDisabled(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_SetLinkDisabled_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).SetLinkDisabled(ctx, req.(*SetLinkDisabledRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_SetUserBlocked_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetUserBlockedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).SetUserBlocked(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_SetUserBlocked_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).SetUserBlocked(ctx, req.(*SetUserBlockedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_ListRecentLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecentLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).ListRecentLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_ListRecentLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).ListRecentLinks(ctx, req.(*ListRecentLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_ListAuditRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuditRecordsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).ListAuditRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_ListAuditRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).ListAuditRecords(ctx, req.(*ListAuditRecordsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AdminService_ServiceDesc is the grpc.ServiceDesc for AdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "handlers.grcp.AdminService",
+	HandlerType: (*AdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetLink",
+			Handler:    _AdminService_GetLink_Handler,
+		},
+		{
+			MethodName: "DeleteLink",
+			Handler:    _AdminService_DeleteLink_Handler,
+		},
+		{
+			MethodName: "SetLinkDisabled",
+			Handler:    _AdminService_SetLinkDisabled_Handler,
+		},
+		{
+			MethodName: "SetUserBlocked",
+			Handler:    _AdminService_SetUserBlocked_Handler,
+		},
+		{
+			MethodName: "ListRecentLinks",
+			Handler:    _AdminService_ListRecentLinks_Handler,
+		},
+		{
+			MethodName: "ListAuditRecords",
+			Handler:    _AdminService_ListAuditRecords_Handler,
+		},
+	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/shorturl.proto",
 }
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/config"
+	"github.com/wellywell/shorturl/internal/handlers"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/url"
+)
+
+// AdminHandler хендлеры API администратора. Проверка роли и подсети выполняется middleware в роутере
+type AdminHandler struct {
+	admin  *handlers.Admin
+	config config.ServerConfig
+}
+
+// NewAdminHandler инициализирует AdminHandler
+func NewAdminHandler(store handlers.AdminStorage, config config.ServerConfig) *AdminHandler {
+	return &AdminHandler{
+		admin:  handlers.NewAdmin(store),
+		config: config,
+	}
+}
+
+type adminLinkData struct {
+	ID          string     `json:"id"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	UserID      int        `json:"user_id"`
+	IsDeleted   bool       `json:"is_deleted"`
+	IsDisabled  bool       `json:"is_disabled"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (ah *AdminHandler) newLinkData(link storage.LinkInfo) adminLinkData {
+	return adminLinkData{
+		ID:          link.ShortURL,
+		ShortURL:    url.FormatShortURL(ah.config.ShortURLsAddress, link.ShortURL),
+		OriginalURL: link.FullURL,
+		UserID:      link.UserID,
+		IsDeleted:   link.IsDeleted,
+		IsDisabled:  link.IsDisabled,
+		CreatedAt:   link.CreatedAt,
+		DeletedAt:   link.DeletedAt,
+	}
+}
+
+// HandleRecentLinks возвращает последние созданные ссылки, количество задаётся параметром limit
+func (ah *AdminHandler) HandleRecentLinks(w http.ResponseWriter, req *http.Request) {
+	limit, err := parseLimit(req)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad limit")
+		return
+	}
+	links, err := ah.admin.RecentLinks(req.Context(), limit)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Error getting data")
+		return
+	}
+	respData := make([]adminLinkData, len(links))
+	for i, link := range links {
+		respData[i] = ah.newLinkData(link)
+	}
+	writeJSON(w, req, respData)
+}
+
+// HandleGetLink возвращает ссылку вместе с её владельцем
+func (ah *AdminHandler) HandleGetLink(w http.ResponseWriter, req *http.Request) {
+	link, err := ah.admin.GetLink(req.Context(), req.PathValue("id"))
+	if err != nil {
+		adminError(w, req, err)
+		return
+	}
+	writeJSON(w, req, ah.newLinkData(link))
+}
+
+// HandleDeleteLink удаляет ссылку независимо от владельца
+func (ah *AdminHandler) HandleDeleteLink(w http.ResponseWriter, req *http.Request) {
+	actorID, _ := auth.UserIDFromContext(req.Context())
+	if err := ah.admin.DeleteLink(req.Context(), actorID, req.PathValue("id")); err != nil {
+		adminError(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDisableLink отключает ссылку
+func (ah *AdminHandler) HandleDisableLink(w http.ResponseWriter, req *http.Request) {
+	ah.setLinkDisabled(w, req, true)
+}
+
+// HandleEnableLink снова включает отключённую ссылку
+func (ah *AdminHandler) HandleEnableLink(w http.ResponseWriter, req *http.Request) {
+	ah.setLinkDisabled(w, req, false)
+}
+
+func (ah *AdminHandler) setLinkDisabled(w http.ResponseWriter, req *http.Request, disabled bool) {
+	actorID, _ := auth.UserIDFromContext(req.Context())
+	if err := ah.admin.SetLinkDisabled(req.Context(), actorID, req.PathValue("id"), disabled); err != nil {
+		adminError(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleBlockUser блокирует пользователя
+func (ah *AdminHandler) HandleBlockUser(w http.ResponseWriter, req *http.Request) {
+	ah.setUserBlocked(w, req, true)
+}
+
+// HandleUnblockUser разблокирует пользователя
+func (ah *AdminHandler) HandleUnblockUser(w http.ResponseWriter, req *http.Request) {
+	ah.setUserBlocked(w, req, false)
+}
+
+func (ah *AdminHandler) setUserBlocked(w http.ResponseWriter, req *http.Request, blocked bool) {
+	userID, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad user id")
+		return
+	}
+	actorID, _ := auth.UserIDFromContext(req.Context())
+	if err := ah.admin.SetUserBlocked(req.Context(), actorID, userID, blocked); err != nil {
+		adminError(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleEraseUser сразу стирает все данные пользователя. Короткие id его ссылок остаются занятыми,
+// если так настроено для стирания удалённых ссылок
+func (ah *AdminHandler) HandleEraseUser(w http.ResponseWriter, req *http.Request) {
+	userID, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad user id")
+		return
+	}
+	actorID, _ := auth.UserIDFromContext(req.Context())
+	if err := ah.admin.EraseUser(req.Context(), actorID, userID, ah.config.LinkTombstones); err != nil {
+		adminError(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAudit возвращает последние записи журнала аудита, количество задаётся параметром limit
+func (ah *AdminHandler) HandleAudit(w http.ResponseWriter, req *http.Request) {
+	limit, err := parseLimit(req)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad limit")
+		return
+	}
+	records, err := ah.admin.AuditRecords(req.Context(), limit)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Error getting data")
+		return
+	}
+	writeJSON(w, req, records)
+}
+
+// HandleJobRuns возвращает последние запуски фоновых задач с результатом, количество задаётся параметром limit
+func (ah *AdminHandler) HandleJobRuns(w http.ResponseWriter, req *http.Request) {
+	limit, err := parseLimit(req)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad limit")
+		return
+	}
+	runs, err := ah.admin.JobRuns(req.Context(), limit)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Error getting data")
+		return
+	}
+	writeJSON(w, req, runs)
+}
+
+func parseLimit(req *http.Request) (int, error) {
+	value := req.URL.Query().Get("limit")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func adminError(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, handlers.ErrSelfBlock) || errors.Is(err, handlers.ErrSelfErase) {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	apierror.Write(w, req, err)
+}
+
+func writeJSON(w http.ResponseWriter, req *http.Request, data any) {
+	writeJSONStatus(w, req, http.StatusOK, data)
+}
+
+func writeJSONStatus(w http.ResponseWriter, req *http.Request, status int, data any) {
+	response, err := json.Marshal(data)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not serialize result")
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(response)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	commonhandlers "github.com/wellywell/shorturl/internal/handlers"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestAdminHandler(t *testing.T) {
+	st := storage.NewMemory()
+	auth.SetUserStore(st)
+	defer auth.SetUserStore(nil)
+
+	ctx := context.Background()
+	admin, _ := st.CreateNewUser(ctx)
+	owner, _ := st.CreateNewUser(ctx)
+	require.NoError(t, st.SetUserRole(ctx, admin, storage.RoleAdmin))
+	require.NoError(t, st.Put(ctx, "abc", "https://example.com", owner))
+
+	ah := NewAdminHandler(st, mockConfig)
+	urls := &URLsHandler{urls: st, config: mockConfig}
+
+	// serve вызывает хендлер так же, как роутер: через RoleChecker и с параметром пути
+	serve := func(handler http.HandlerFunc, method string, id string, userID int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/admin/", nil)
+		r.SetPathValue("id", id)
+		token, err := auth.BuildJWTString(userID)
+		require.NoError(t, err)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		auth.RoleChecker{Role: storage.RoleAdmin}.Handle(handler).ServeHTTP(w, r)
+		return w
+	}
+	getFull := func(id string) int {
+		r := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+		r.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		urls.HandleGetFullURL(w, r)
+		return w.Code
+	}
+
+	t.Run("not admin", func(t *testing.T) {
+		w := serve(ah.HandleGetLink, http.MethodGet, "abc", owner)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("get link", func(t *testing.T) {
+		w := serve(ah.HandleGetLink, http.MethodGet, "abc", admin)
+		require.Equal(t, http.StatusOK, w.Code)
+		var link adminLinkData
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+		assert.Equal(t, owner, link.UserID)
+		assert.Equal(t, "https://example.com", link.OriginalURL)
+
+		w = serve(ah.HandleGetLink, http.MethodGet, "missing", admin)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("disable and enable", func(t *testing.T) {
+		w := serve(ah.HandleDisableLink, http.MethodPost, "abc", admin)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, http.StatusGone, getFull("abc"))
+
+		w = serve(ah.HandleEnableLink, http.MethodPost, "abc", admin)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, http.StatusTemporaryRedirect, getFull("abc"))
+	})
+
+	t.Run("block user", func(t *testing.T) {
+		w := serve(ah.HandleBlockUser, http.MethodPost, "2", admin)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		token, _ := auth.BuildJWTString(owner)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		urls.HandleUserURLS(rec, r)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		w = serve(ah.HandleBlockUser, http.MethodPost, "1", admin)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = serve(ah.HandleBlockUser, http.MethodPost, "x", admin)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("delete link", func(t *testing.T) {
+		w := serve(ah.HandleDeleteLink, http.MethodDelete, "abc", admin)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, http.StatusGone, getFull("abc"))
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		w := serve(ah.HandleAudit, http.MethodGet, "", admin)
+		require.Equal(t, http.StatusOK, w.Code)
+		var records []storage.AuditRecord
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &records))
+		require.Len(t, records, 4)
+		assert.Equal(t, commonhandlers.AuditLinkDelete, records[0].Action)
+		assert.Equal(t, admin, records[0].ActorID)
+		assert.Equal(t, commonhandlers.AuditLinkDisable, records[3].Action)
+	})
+
+	t.Run("job runs", func(t *testing.T) {
+		_, err := st.AddJobRun(ctx, storage.JobRun{Job: "compact", Status: storage.JobRunOK})
+		require.NoError(t, err)
+		_, err = st.AddJobRun(ctx, storage.JobRun{Job: "compact", Status: storage.JobRunFailed, Error: "disk full"})
+		require.NoError(t, err)
+
+		w := serve(ah.HandleJobRuns, http.MethodGet, "", admin)
+		require.Equal(t, http.StatusOK, w.Code)
+		var runs []storage.JobRun
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+		require.Len(t, runs, 2)
+		assert.Equal(t, storage.JobRunFailed, runs[0].Status)
+		assert.Equal(t, "disk full", runs[0].Error)
+
+		w = serve(ah.HandleJobRuns, http.MethodGet, "", owner)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("erase user", func(t *testing.T) {
+		require.NoError(t, st.Put(ctx, "xyz", "https://example.org", owner))
+		_, err := st.CreateAPIKey(ctx, storage.APIKey{UserID: owner, Hash: "hash"})
+		require.NoError(t, err)
+
+		require.NoError(t, st.SetUserBlocked(ctx, owner, false))
+
+		// userURLs запрашивает ссылки с авторизационной кукой владельца, выданной до стирания
+		token, err := auth.BuildJWTString(owner)
+		require.NoError(t, err)
+		userURLs := func() int {
+			r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			r.AddCookie(&http.Cookie{Name: "_user", Value: token})
+			w := httptest.NewRecorder()
+			urls.HandleUserURLS(w, r)
+			return w.Code
+		}
+		require.Equal(t, http.StatusOK, userURLs())
+
+		w := serve(ah.HandleEraseUser, http.MethodDelete, "1", admin)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = serve(ah.HandleEraseUser, http.MethodDelete, "2", admin)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, http.StatusNotFound, getFull("xyz"))
+		keys, err := st.GetUserAPIKeys(ctx, owner)
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+		_, err = st.GetUser(ctx, owner)
+		var erased *storage.UserIsErased
+		assert.ErrorAs(t, err, &erased)
+		assert.Equal(t, http.StatusUnauthorized, userURLs())
+
+		records, err := st.GetAuditRecords(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, commonhandlers.AuditUserErase, records[0].Action)
+		assert.Equal(t, "2", records[0].Target)
+	})
+}
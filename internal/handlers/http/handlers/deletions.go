@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+// DeletionsPath путь заданий на удаление ссылок пользователя
+const DeletionsPath = "/api/user/urls/deletions"
+
+// deleteJobData задание на удаление в ответах API
+type deleteJobData struct {
+	ID        int        `json:"id"`
+	Status    string     `json:"status"`
+	ShortURLs []string   `json:"short_urls"`
+	Attempts  int        `json:"attempts"`
+	CreatedAt time.Time  `json:"created_at"`
+	DoneAt    *time.Time `json:"done_at,omitempty"`
+	// Results результаты по каждой ссылке, когда задание выполнено
+	Results []storage.DeleteResult `json:"results,omitempty"`
+}
+
+// deleteResultsData ответ на синхронное удаление ссылок
+type deleteResultsData struct {
+	Results []storage.DeleteResult `json:"results"`
+}
+
+func newDeleteJobData(job storage.DeleteJob) deleteJobData {
+	return deleteJobData{
+		ID:        job.ID,
+		Status:    job.Status,
+		ShortURLs: job.ShortURLs,
+		Attempts:  job.Attempts,
+		CreatedAt: job.CreatedAt,
+		DoneAt:    job.DoneAt,
+		Results:   job.Results,
+	}
+}
+
+// writeDeleteJobAccepted отвечает 202 со ссылкой на созданное задание
+func writeDeleteJobAccepted(w http.ResponseWriter, req *http.Request, job storage.DeleteJob) {
+	w.Header().Set("Location", DeletionsPath+"/"+strconv.Itoa(job.ID))
+	writeJSONStatus(w, req, http.StatusAccepted, newDeleteJobData(job))
+}
+
+// HandleDeleteJob обрабатывает запрос статуса задания на удаление ссылок
+func (uh *URLsHandler) HandleDeleteJob(w http.ResponseWriter, req *http.Request) {
+	userID, err := uh.verifyUser(w, req, auth.ScopeLinksRead)
+	if err != nil {
+		authError(w, req, err)
+		return
+	}
+	jobID, err := strconv.Atoi(req.PathValue("job"))
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad job id")
+		return
+	}
+
+	job, err := uh.deleteQueue.Job(req.Context(), userID, jobID)
+	if err != nil {
+		apierror.Write(w, req, err)
+		return
+	}
+	writeJSON(w, req, newDeleteJobData(job))
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+func TestDeleteJobStatus(t *testing.T) {
+	st := storage.NewMemory()
+	ctx := context.Background()
+	owner, _ := st.CreateNewUser(ctx)
+	other, _ := st.CreateNewUser(ctx)
+	uh := NewURLsHandler(st, tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig), mockConfig)
+
+	serve := func(handler http.HandlerFunc, method string, job string, body string, userID int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, DeletionsPath, strings.NewReader(body))
+		r.SetPathValue("job", job)
+		token, err := auth.BuildJWTString(userID)
+		require.NoError(t, err)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := serve(uh.HandleDeleteUserURLS, http.MethodDelete, "", `["abc", "def"]`, owner)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var created deleteJobData
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	id := strconv.Itoa(created.ID)
+	assert.Equal(t, DeletionsPath+"/"+id, w.Header().Get("Location"))
+
+	w = serve(uh.HandleDeleteJob, http.MethodGet, id, "", owner)
+	require.Equal(t, http.StatusOK, w.Code)
+	var job deleteJobData
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, storage.DeleteJobPending, job.Status)
+	assert.Equal(t, []string{"abc", "def"}, job.ShortURLs)
+
+	_, _, err := st.ClaimDeleteJobs(ctx, 1, job.CreatedAt, 0)
+	require.NoError(t, err)
+	results := []storage.DeleteResult{{ShortURL: "abc", Status: storage.DeleteDeleted}, {ShortURL: "def", Status: storage.DeleteNotFound}}
+	require.NoError(t, st.CompleteDeleteJobs(ctx, storage.DeleteJob{ID: job.ID, Results: results}))
+	w = serve(uh.HandleDeleteJob, http.MethodGet, id, "", owner)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, storage.DeleteJobDone, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.NotNil(t, job.DoneAt)
+	assert.Equal(t, results, job.Results)
+
+	w = serve(uh.HandleDeleteJob, http.MethodGet, id, "", other)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(uh.HandleDeleteJob, http.MethodGet, "first", "", owner)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDeleteUserURLsSync(t *testing.T) {
+	st := storage.NewMemory()
+	ctx := context.Background()
+	owner, _ := st.CreateNewUser(ctx)
+	other, _ := st.CreateNewUser(ctx)
+	require.NoError(t, st.Put(ctx, "mine", "https://example.com/mine", owner))
+	require.NoError(t, st.Put(ctx, "gone", "https://example.com/gone", owner))
+	require.NoError(t, st.Put(ctx, "theirs", "https://example.com/theirs", other))
+	_, err := st.DeleteBatch(ctx, storage.ToDelete{ShortURL: "gone", UserID: owner})
+	require.NoError(t, err)
+	uh := NewURLsHandler(st, tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig), mockConfig)
+
+	serve := func(target string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodDelete, target, strings.NewReader(body))
+		token, err := auth.BuildJWTString(owner)
+		require.NoError(t, err)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		uh.HandleDeleteUserURLS(w, r)
+		return w
+	}
+
+	w := serve("/api/user/urls?sync=true", `["mine", "gone", "theirs", "missing"]`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp deleteResultsData
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []storage.DeleteResult{
+		{ShortURL: "mine", Status: storage.DeleteDeleted},
+		{ShortURL: "gone", Status: storage.DeleteAlreadyDeleted},
+		{ShortURL: "theirs", Status: storage.DeleteNotOwner},
+		{ShortURL: "missing", Status: storage.DeleteNotFound},
+	}, resp.Results)
+
+	_, err = st.Get(ctx, "theirs")
+	assert.NoError(t, err)
+
+	w = serve("/api/user/urls?sync=maybe", `["mine"]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
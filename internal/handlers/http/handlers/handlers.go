@@ -8,12 +8,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
 
+	"github.com/wellywell/shorturl/internal/apierror"
 	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/clientip"
 	"github.com/wellywell/shorturl/internal/config"
 	"github.com/wellywell/shorturl/internal/handlers"
+	"github.com/wellywell/shorturl/internal/ratelimit"
 	"github.com/wellywell/shorturl/internal/storage"
 	"github.com/wellywell/shorturl/internal/url"
 )
@@ -21,35 +27,67 @@ import (
 // Storage - интерфейс хранилища коротких ссылок
 type Storage interface {
 	Put(ctx context.Context, key string, val string, user int) error
+	PutLink(ctx context.Context, key string, val string, user int, expiresAt *time.Time) error
 	Get(ctx context.Context, key string) (string, error)
 	PutBatch(ctx context.Context, records ...storage.URLRecord) error
 	CreateNewUser(ctx context.Context) (int, error)
 	GetUserURLS(ctx context.Context, userID int) ([]storage.URLRecord, error)
 	CountURLs(ctx context.Context) (int, error)
 	CountUsers(ctx context.Context) (int, error)
+	CreateAPIKey(ctx context.Context, key storage.APIKey) (storage.APIKey, error)
+	GetUserAPIKeys(ctx context.Context, userID int) ([]storage.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int, keyID int) error
+	GetOrCreateUserByIdentity(ctx context.Context, issuer string, subject string) (int, error)
+	GetLink(ctx context.Context, key string) (storage.LinkInfo, error)
+	GetUserLinks(ctx context.Context, userID int) ([]storage.LinkInfo, error)
+	UpdateLink(ctx context.Context, key string, userID int, update storage.LinkUpdate) (storage.LinkInfo, error)
 }
 
-// URLsHandler структура, объединяющая в себе хранилище Storage, ServerConfig и канал deleteQueue для создания тасок на удаление ссылок
+// DeleteQueue - очередь заданий на удаление ссылок
+type DeleteQueue interface {
+	Enqueue(ctx context.Context, userID int, shortURLs ...string) (storage.DeleteJob, error)
+	Delete(ctx context.Context, userID int, shortURLs ...string) ([]storage.DeleteResult, error)
+	Job(ctx context.Context, userID int, id int) (storage.DeleteJob, error)
+}
+
+// errBadCredentials явно переданные учётные данные не прошли проверку
+var errBadCredentials = errors.New("bad credentials")
+
+// URLsHandler структура, объединяющая в себе хранилище Storage, ServerConfig и очередь deleteQueue для создания заданий на удаление ссылок
 type URLsHandler struct {
 	urls        Storage
-	deleteQueue chan storage.ToDelete
+	deleteQueue DeleteQueue
 	config      config.ServerConfig
+	oidc        OIDCProvider
+	limiter     *ratelimit.Limiter
+	idempotency *handlers.Idempotency
+	logger      *zap.SugaredLogger
 }
 
 // NewURLsHandler инициализирует URLsHandler, необходимого для работы хендлеров
-func NewURLsHandler(storage Storage, queue chan storage.ToDelete, config config.ServerConfig) *URLsHandler {
+func NewURLsHandler(storage Storage, queue DeleteQueue, config config.ServerConfig) *URLsHandler {
 	return &URLsHandler{
 		urls:        storage,
 		deleteQueue: queue,
 		config:      config,
+		logger:      zap.NewNop().Sugar(),
 	}
 }
 
+// SetLogger задаёт логгер для ошибок, которые уже не попадают в ответ клиенту
+func (uh *URLsHandler) SetLogger(logger *zap.SugaredLogger) {
+	uh.logger = logger
+}
+
+// SetRateLimiter включает ограничение размера пакетов и создания пользователей
+func (uh *URLsHandler) SetRateLimiter(limiter *ratelimit.Limiter) {
+	uh.limiter = limiter
+}
+
 // HandleShortenURLJSON обрабатывает запрос на создание коротких ссылок в формате application/json
 func (uh *URLsHandler) HandleShortenURLJSON(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
-		http.Error(w, "Wrong method",
-			http.StatusMethodNotAllowed)
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
 		return
 	}
 
@@ -57,30 +95,33 @@ func (uh *URLsHandler) HandleShortenURLJSON(w http.ResponseWriter, req *http.Req
 		URL string `json:"url"`
 	}
 
+	uh.limitBody(w, req)
 	err := json.NewDecoder(req.Body).Decode(&data)
 	if err != nil {
-		http.Error(w, "Could not parse body",
-			http.StatusBadRequest)
+		bodyError(w, req, err, "Could not parse body")
 		return
 	}
 
 	longURL := data.URL
 	if !url.Validate(longURL) {
-		http.Error(w, "URL must be of length from 1 to 250", // TODO more informative answer
-			http.StatusBadRequest)
+		apierror.WriteCode(w, req, apierror.CodeValidation, "URL must be of length from 1 to 250")
 		return
 	}
 
 	userID, err := uh.getOrCreateUser(w, req)
 	if err != nil {
-		http.Error(w, "Error authenticating user", http.StatusBadRequest)
+		userError(w, req, err)
 		return
 	}
 
 	shortURL, isCreated, err := handlers.GetShortURL(req.Context(), longURL, userID, uh.urls, uh.config)
 	if err != nil {
-		http.Error(w, "Could not store url",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not store url")
+		return
+	}
+	if !isCreated {
+		// поле result оставлено для клиентов, которые читают из ответа уже существующую ссылку
+		apierror.Write(w, req, apierror.New(apierror.CodeConflict, "URL already shortened").With("result", shortURL))
 		return
 	}
 
@@ -92,22 +133,15 @@ func (uh *URLsHandler) HandleShortenURLJSON(w http.ResponseWriter, req *http.Req
 
 	response, err := json.Marshal(result)
 	if err != nil {
-		http.Error(w, "Could not serialize result",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not serialize result")
 		return
 	}
 
 	w.Header().Set("content-type", "application/json")
-
-	if isCreated {
-		w.WriteHeader(http.StatusCreated)
-	} else {
-		w.WriteHeader(http.StatusConflict)
-	}
+	w.WriteHeader(http.StatusCreated)
 	_, err = w.Write(response)
 	if err != nil {
-		http.Error(w, "Something went wrong",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
 	}
 }
 
@@ -115,8 +149,7 @@ func (uh *URLsHandler) HandleShortenURLJSON(w http.ResponseWriter, req *http.Req
 func (uh *URLsHandler) HandleShortenBatch(w http.ResponseWriter, req *http.Request) {
 
 	if req.Method != http.MethodPost {
-		http.Error(w, "Wrong method",
-			http.StatusMethodNotAllowed)
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
 		return
 	}
 
@@ -124,12 +157,10 @@ func (uh *URLsHandler) HandleShortenBatch(w http.ResponseWriter, req *http.Reque
 		CorrelationID string `json:"correlation_id"`
 		OriginalURL   string `json:"original_url"`
 	}
-	var requestData []inData
-
-	err := json.NewDecoder(req.Body).Decode(&requestData)
+	uh.limitBody(w, req)
+	requestData, err := decodeJSONArray[inData](req.Body, uh.config.MaxBatchSize)
 	if err != nil {
-		http.Error(w, "Could not parse body",
-			http.StatusBadRequest)
+		bodyError(w, req, err, "Could not parse body")
 		return
 	}
 
@@ -145,7 +176,13 @@ func (uh *URLsHandler) HandleShortenBatch(w http.ResponseWriter, req *http.Reque
 		var userID int
 		userID, err = uh.getOrCreateUser(w, req)
 		if err != nil {
-			http.Error(w, "Error authenticating user", http.StatusBadRequest)
+			userError(w, req, err)
+			return
+		}
+
+		err = uh.limiter.Allow(req.Context(), ratelimit.BucketBatch, ratelimit.UserKey(userID), len(requestData))
+		if exceeded, ok := ratelimit.IsExceeded(err); ok {
+			ratelimit.WriteExceeded(w, req, exceeded)
 			return
 		}
 
@@ -167,24 +204,22 @@ func (uh *URLsHandler) HandleShortenBatch(w http.ResponseWriter, req *http.Reque
 		err = uh.urls.PutBatch(req.Context(), records...)
 		if err != nil {
 			// В случае возникновения коллизий тут, завершаемся с ошибкой
-			http.Error(w, "Could not store values",
-				http.StatusInternalServerError)
+			apierror.WriteCode(w, req, apierror.CodeInternal, "Could not store values")
 			return
 		}
 		w.WriteHeader(http.StatusCreated)
 	} else {
 		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 	response, err := json.Marshal(respData)
 	if err != nil {
-		http.Error(w, "Could not serialize result",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not serialize result")
 		return
 	}
 	_, err = w.Write(response)
 	if err != nil {
-		http.Error(w, "Something went wrong",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
 	}
 }
 
@@ -192,35 +227,32 @@ func (uh *URLsHandler) HandleShortenBatch(w http.ResponseWriter, req *http.Reque
 func (uh *URLsHandler) HandleCreateShortURL(w http.ResponseWriter, req *http.Request) {
 
 	if req.Method != http.MethodPost {
-		http.Error(w, "Wrong method",
-			http.StatusMethodNotAllowed)
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
 		return
 	}
 
+	uh.limitBody(w, req)
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
-		http.Error(w, "Something went wrong",
-			http.StatusInternalServerError)
+		bodyError(w, req, err, "Could not read body")
 		return
 	}
 
 	longURL := string(body)
 	if !url.Validate(longURL) {
-		http.Error(w, "URL must be of length from 1 to 250", // TODO more informative answer
-			http.StatusBadRequest)
+		apierror.WriteCode(w, req, apierror.CodeValidation, "URL must be of length from 1 to 250")
 		return
 	}
 
 	userID, err := uh.getOrCreateUser(w, req)
 	if err != nil {
-		http.Error(w, "Error authenticating user", http.StatusBadRequest)
+		userError(w, req, err)
 		return
 	}
 
 	shortURL, isCreated, err := handlers.GetShortURL(req.Context(), longURL, userID, uh.urls, uh.config)
 	if err != nil {
-		http.Error(w, "Could not store url",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not store url")
 		return
 	}
 
@@ -233,8 +265,7 @@ func (uh *URLsHandler) HandleCreateShortURL(w http.ResponseWriter, req *http.Req
 
 	_, err = w.Write([]byte(shortURL))
 	if err != nil {
-		http.Error(w, "Something went wrong",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
 	}
 }
 
@@ -242,32 +273,21 @@ func (uh *URLsHandler) HandleCreateShortURL(w http.ResponseWriter, req *http.Req
 func (uh *URLsHandler) HandleGetFullURL(w http.ResponseWriter, req *http.Request) {
 
 	if req.Method != http.MethodGet {
-		http.Error(w, "Wrong method",
-			http.StatusMethodNotAllowed)
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
 		return
 	}
 
 	idString := req.PathValue("id")
 
 	if idString == "" {
-		http.Error(w, "Id not passed", http.StatusBadRequest)
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Id not passed")
 		return
 	}
 	url, err := uh.urls.Get(req.Context(), idString)
 
 	if err != nil {
-		var keyNotFound *storage.KeyNotFoundError
-		if errors.As(err, &keyNotFound) {
-			http.Error(w, "Not found", http.StatusNotFound)
-			return
-		}
-		var keyDeleted *storage.RecordIsDeleted
-		if errors.As(err, &keyDeleted) {
-			http.Error(w, "Gone", http.StatusGone)
-			return
-		}
-		http.Error(w, "Something went wrong",
-			http.StatusInternalServerError)
+		// не найдена - 404, удалена или отключена - 410
+		apierror.Write(w, req, err)
 		return
 	}
 	w.Header().Set("location", url)
@@ -279,8 +299,7 @@ func (uh *URLsHandler) HandlePing(w http.ResponseWriter, req *http.Request) {
 
 	conn, err := pgx.Connect(req.Context(), uh.config.DatabaseDSN)
 	if err != nil {
-		http.Error(w, "Database unaccessable",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Database unaccessable")
 		return
 	}
 	defer func() {
@@ -292,52 +311,69 @@ func (uh *URLsHandler) HandlePing(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-// HandleDeleteUserURLS обрабатывает запрос на удаление ссылок, принадлежащих данному юзеру
+// HandleDeleteUserURLS обрабатывает запрос на удаление ссылок, принадлежащих данному юзеру.
+// По умолчанию создаёт задание на удаление, с параметром sync=true удаляет сразу и отвечает результатом по каждой ссылке
 func (uh *URLsHandler) HandleDeleteUserURLS(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodDelete {
-		http.Error(w, "Wrong method",
-			http.StatusMethodNotAllowed)
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
 		return
 	}
 
-	userID, err := auth.VerifyUser(req)
+	userID, err := uh.verifyUser(w, req, auth.ScopeLinksWrite)
 	if err != nil {
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
+		authError(w, req, err)
 		return
 	}
 
-	var requestData []string
+	sync := false
+	if value := req.URL.Query().Get("sync"); value != "" {
+		sync, err = strconv.ParseBool(value)
+		if err != nil {
+			apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad sync")
+			return
+		}
+	}
 
-	err = json.NewDecoder(req.Body).Decode(&requestData)
+	uh.limitBody(w, req)
+	requestData, err := decodeJSONArray[string](req.Body, uh.config.MaxDeleteSize)
 	if err != nil {
-		http.Error(w, "Could not parse body",
-			http.StatusBadRequest)
+		bodyError(w, req, err, "Could not parse body")
 		return
 	}
 
-	for _, rec := range requestData {
-		uh.deleteQueue <- storage.ToDelete{UserID: userID, ShortURL: rec}
+	if sync {
+		results, err := uh.deleteQueue.Delete(req.Context(), userID, requestData...)
+		if err != nil {
+			apierror.Write(w, req, err)
+			return
+		}
+		writeJSON(w, req, deleteResultsData{Results: results})
+		return
+	}
+	job, err := uh.deleteQueue.Enqueue(req.Context(), userID, requestData...)
+	if err != nil {
+		apierror.Write(w, req, err)
+		return
 	}
-	w.WriteHeader(http.StatusAccepted)
+	writeDeleteJobAccepted(w, req, job)
 }
 
 // HandleUserURLS обрабатывает запрос на получение списка ссылок, принадлежащих данному пользователю
 func (uh *URLsHandler) HandleUserURLS(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
-		http.Error(w, "Wrong method",
-			http.StatusMethodNotAllowed)
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
 		return
 	}
 
-	userID, err := auth.VerifyUser(req)
+	userID, err := uh.verifyUser(w, req, auth.ScopeLinksRead)
 	if err != nil {
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
+		authError(w, req, err)
 		return
 	}
 	urls, err := uh.urls.GetUserURLS(req.Context(), userID)
 
 	if err != nil {
-		http.Error(w, "Error getting data", http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Error getting data")
 		return
 	}
 
@@ -360,26 +396,69 @@ func (uh *URLsHandler) HandleUserURLS(w http.ResponseWriter, req *http.Request)
 	}
 	response, err := json.Marshal(respData)
 	if err != nil {
-		http.Error(w, "Could not serialize result",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not serialize result")
 		return
 	}
 	w.Header().Set("content-type", "application/json")
 	_, err = w.Write(response)
 	if err != nil {
-		http.Error(w, "Something went wrong",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
 	}
 }
 
+// verifyUser проверяет пользователя и продлевает его сессию
+func (uh *URLsHandler) verifyUser(w http.ResponseWriter, req *http.Request, scope string) (int, error) {
+	userID, err := auth.VerifyUserWithScope(req, scope)
+	if err != nil {
+		return 0, err
+	}
+	if err := auth.RenewAuthCookie(w, req); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// authError отвечает на неудачную авторизацию: заблокированному пользователю 403, иначе 401
+func authError(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, auth.ErrUserBlocked) {
+		apierror.WriteCode(w, req, apierror.CodeForbidden, "User is blocked")
+		return
+	}
+	apierror.WriteCode(w, req, apierror.CodeUnauthorized, "Authorize error")
+}
+
+// userError отвечает на неудачу getOrCreateUser
+func userError(w http.ResponseWriter, req *http.Request, err error) {
+	if exceeded, ok := ratelimit.IsExceeded(err); ok {
+		ratelimit.WriteExceeded(w, req, exceeded)
+		return
+	}
+	if errors.Is(err, errBadCredentials) || errors.Is(err, auth.ErrUserBlocked) {
+		authError(w, req, err)
+		return
+	}
+	apierror.WriteCode(w, req, apierror.CodeBadRequest, "Error authenticating user")
+}
+
 func (uh *URLsHandler) getOrCreateUser(w http.ResponseWriter, req *http.Request) (int, error) {
 
-	userID, err := auth.VerifyUser(req)
+	userID, err := uh.verifyUser(w, req, auth.ScopeLinksWrite)
 	if err == nil {
 		return userID, nil
 	}
+	if errors.Is(err, auth.ErrUserBlocked) {
+		return 0, err
+	}
+	// если ключ или токен передан явно, но не подошёл, нового пользователя не создаём
+	if _, ok := auth.BearerToken(req); ok {
+		return 0, fmt.Errorf("%w: %w", errBadCredentials, err)
+	}
 
 	// user not verified, create new one
+	err = uh.limiter.Allow(req.Context(), ratelimit.BucketUsers, ratelimit.IPKey(clientip.FromRequest(req).String()), 1)
+	if err != nil {
+		return 0, err
+	}
 	userID, err = uh.urls.CreateNewUser(req.Context())
 	if err != nil {
 		return 0, err
@@ -395,15 +474,13 @@ func (uh *URLsHandler) getOrCreateUser(w http.ResponseWriter, req *http.Request)
 func (uh *URLsHandler) HandleGetStats(w http.ResponseWriter, req *http.Request) {
 	users, err := uh.urls.CountUsers(req.Context())
 	if err != nil {
-		http.Error(w, "Could not count users",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not count users")
 		return
 	}
 
 	urls, err := uh.urls.CountURLs(req.Context())
 	if err != nil {
-		http.Error(w, "Could not count users",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not count users")
 		return
 	}
 	result := struct {
@@ -416,16 +493,164 @@ func (uh *URLsHandler) HandleGetStats(w http.ResponseWriter, req *http.Request)
 
 	response, err := json.Marshal(result)
 	if err != nil {
-		http.Error(w, "Could not serialize result",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not serialize result")
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	_, err = w.Write(response)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
+	}
+
+}
+
+type apiKeyData struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func newAPIKeyData(key storage.APIKey) apiKeyData {
+	return apiKeyData{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+// HandleCreateAPIKey создаёт персональный API-ключ пользователя. Сам ключ возвращается только в этом ответе
+func (uh *URLsHandler) HandleCreateAPIKey(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
+		return
+	}
+
+	// управлять ключами можно только из сессии пользователя, но не другим ключом
+	userID, err := auth.VerifySession(req)
+	if err != nil {
+		authError(w, req, err)
+		return
+	}
+
+	var data struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	uh.limitBody(w, req)
+	err = json.NewDecoder(req.Body).Decode(&data)
+	if err != nil {
+		bodyError(w, req, err, "Could not parse body")
+		return
+	}
+	scopes, err := auth.ValidateScopes(data.Scopes)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, err.Error())
+		return
+	}
+
+	rawKey, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not generate key")
+		return
+	}
+	key, err := uh.urls.CreateAPIKey(req.Context(), storage.APIKey{
+		UserID: userID,
+		Name:   data.Name,
+		Prefix: prefix,
+		Hash:   hash,
+		Scopes: scopes,
+	})
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not store key")
+		return
+	}
+
+	result := newAPIKeyData(key)
+	result.Key = rawKey
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not serialize result")
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, err = w.Write(response)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
+	}
+}
+
+// HandleUserAPIKeys возвращает список ключей пользователя, с датой последнего использования
+func (uh *URLsHandler) HandleUserAPIKeys(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
+		return
+	}
+
+	userID, err := auth.VerifySession(req)
+	if err != nil {
+		authError(w, req, err)
+		return
+	}
+	keys, err := uh.urls.GetUserAPIKeys(req.Context(), userID)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Error getting data")
+		return
+	}
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	respData := make([]apiKeyData, len(keys))
+	for i, key := range keys {
+		respData[i] = newAPIKeyData(key)
+	}
+	response, err := json.Marshal(respData)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not serialize result")
+		return
+	}
 	w.Header().Set("content-type", "application/json")
 	_, err = w.Write(response)
 	if err != nil {
-		http.Error(w, "Something went wrong",
-			http.StatusInternalServerError)
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
 	}
+}
 
+// HandleRevokeAPIKey отзывает ключ пользователя
+func (uh *URLsHandler) HandleRevokeAPIKey(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
+		return
+	}
+
+	userID, err := auth.VerifySession(req)
+	if err != nil {
+		authError(w, req, err)
+		return
+	}
+	keyID, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad key id")
+		return
+	}
+
+	err = uh.urls.RevokeAPIKey(req.Context(), userID, keyID)
+	if err != nil {
+		apierror.Write(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
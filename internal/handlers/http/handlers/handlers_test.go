@@ -15,7 +15,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/wellywell/shorturl/internal/auth"
 	"github.com/wellywell/shorturl/internal/config"
+	"github.com/wellywell/shorturl/internal/ratelimit"
 	"github.com/wellywell/shorturl/internal/storage"
 )
 
@@ -621,3 +623,175 @@ func TestURLsHandler_HandleGetStatsNotEmpty(t *testing.T) {
 	})
 
 }
+
+func TestHandleAPIKeys(t *testing.T) {
+
+	st := storage.NewMemory()
+	auth.SetKeyStore(st)
+	defer auth.SetKeyStore(nil)
+
+	urls := &URLsHandler{urls: st, config: mockConfig}
+
+	// пользователь получает куку при создании первой ссылки
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://something.com"))
+	w := httptest.NewRecorder()
+	urls.HandleCreateShortURL(w, r)
+	require.Equal(t, http.StatusCreated, w.Code)
+	cookies := w.Result().Cookies()
+	require.NotEmpty(t, cookies)
+	defer w.Result().Body.Close()
+
+	createKey := func(body string) (int, string) {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(body))
+		r.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		urls.HandleCreateAPIKey(w, r)
+
+		var result struct {
+			ID  int    `json:"id"`
+			Key string `json:"key"`
+		}
+		if w.Code == http.StatusCreated {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		}
+		return w.Code, result.Key
+	}
+
+	code, _ := createKey(`{"name": "bad", "scopes": ["links:everything"]}`)
+	assert.Equal(t, http.StatusBadRequest, code, "Неизвестная область доступа принята")
+
+	code, readKey := createKey(`{"name": "reader", "scopes": ["links:read"]}`)
+	require.Equal(t, http.StatusCreated, code)
+	assert.True(t, strings.HasPrefix(readKey, "sk_"))
+
+	t.Run("read with key", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		r.Header.Set("Authorization", "Bearer "+readKey)
+		w := httptest.NewRecorder()
+		urls.HandleUserURLS(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("write with read key", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://other.com"))
+		r.Header.Set("Authorization", "Bearer "+readKey)
+		w := httptest.NewRecorder()
+		urls.HandleCreateShortURL(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("manage keys with key", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/keys", nil)
+		r.Header.Set("Authorization", "Bearer "+readKey)
+		w := httptest.NewRecorder()
+		urls.HandleUserAPIKeys(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("list and revoke", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/keys", nil)
+		r.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		urls.HandleUserAPIKeys(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var keys []struct {
+			ID         int        `json:"id"`
+			Key        string     `json:"key"`
+			LastUsedAt *time.Time `json:"last_used_at"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+		require.Len(t, keys, 1)
+		assert.Empty(t, keys[0].Key, "Ключ не должен возвращаться в списке")
+		assert.NotNil(t, keys[0].LastUsedAt)
+
+		r = httptest.NewRequest(http.MethodDelete, "/api/user/keys/"+strconv.Itoa(keys[0].ID), nil)
+		r.SetPathValue("id", strconv.Itoa(keys[0].ID))
+		r.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		urls.HandleRevokeAPIKey(w, r)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		r = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		r.Header.Set("Authorization", "Bearer "+readKey)
+		w = httptest.NewRecorder()
+		urls.HandleUserURLS(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "Отозванный ключ принят")
+	})
+}
+
+func TestHandleRateLimits(t *testing.T) {
+
+	storage := storage.NewMemory()
+	urls := NewURLsHandler(storage, nil, mockConfig)
+	urls.SetRateLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		ratelimit.BucketBatch: {Rate: 1.0 / 60, Burst: 3},
+		ratelimit.BucketUsers: {Rate: 1.0 / 3600, Burst: 1},
+	}))
+
+	userID, err := storage.CreateNewUser(context.Background())
+	require.NoError(t, err)
+	token, err := auth.BuildJWTString(userID)
+	require.NoError(t, err)
+
+	batch := func(size int, token string) *httptest.ResponseRecorder {
+		data := make([]map[string]string, size)
+		for i := range data {
+			data[i] = map[string]string{"correlation_id": strconv.Itoa(i), "original_url": "https://" + randomString()}
+		}
+		body, err := json.Marshal(data)
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(string(body)))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		urls.HandleShortenBatch(w, r)
+		return w
+	}
+
+	// ссылки в пакетах считаются поштучно
+	assert.Equal(t, http.StatusCreated, batch(2, token).Code)
+	w := batch(2, token)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusCreated, batch(1, token).Code)
+
+	// анонимный пользователь создаётся один раз на адрес
+	assert.Equal(t, http.StatusCreated, batch(1, "").Code)
+	w = batch(1, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+}
+
+// existingURLStorage хранилище, в котором любая ссылка уже сокращена, как это делает Database
+type existingURLStorage struct {
+	*storage.Memory
+}
+
+func (s existingURLStorage) Put(ctx context.Context, key string, val string, user int) error {
+	return fmt.Errorf("%w", &storage.ValueExistsError{Value: val, ExistingKey: "existing"})
+}
+
+func (s existingURLStorage) PutLink(ctx context.Context, key string, val string, user int, expiresAt *time.Time) error {
+	return s.Put(ctx, key, val, user)
+}
+
+func TestHandleShortenURLJSONConflict(t *testing.T) {
+	urls := &URLsHandler{urls: existingURLStorage{storage.NewMemory()}, config: mockConfig}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "http://conflict.ru"}`))
+	w := httptest.NewRecorder()
+	urls.HandleShortenURLJSON(w, r)
+
+	// уже сокращённая ссылка - ошибка conflict, существующая короткая ссылка остаётся в поле result
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	var problem struct {
+		Code   string `json:"code"`
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "conflict", problem.Code)
+	assert.Equal(t, "http://localhost:8080/existing", problem.Result)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/handlers"
+)
+
+// IdempotencyKeyHeader заголовок с ключом идемпотентности
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// SetIdempotency включает поддержку заголовка Idempotency-Key
+func (uh *URLsHandler) SetIdempotency(idempotency *handlers.Idempotency) {
+	uh.idempotency = idempotency
+}
+
+// recordingResponseWriter запоминает ответ, чтобы сохранить его для повторных запросов
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recordingResponseWriter) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *recordingResponseWriter) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotent middleware для запросов с заголовком Idempotency-Key: первый ответ сохраняется
+// и отдаётся на повторы с тем же ключом. Ключ учитывается только для авторизованного пользователя,
+// анонимный пользователь при повторе всё равно был бы создан заново
+func (uh *URLsHandler) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if uh.idempotency == nil || key == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		userID, err := auth.VerifyUserWithScope(req, auth.ScopeLinksWrite)
+		if err != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		uh.limitBody(w, req)
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			bodyError(w, req, err, "Could not read body")
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := handlers.RequestHash([]byte(req.Method), []byte(req.URL.Path), body)
+		replay, err := uh.idempotency.Begin(req.Context(), userID, key, hash)
+		switch {
+		case errors.Is(err, handlers.ErrBadIdempotencyKey):
+			apierror.WriteCode(w, req, apierror.CodeBadRequest, "Bad idempotency key")
+			return
+		case errors.Is(err, handlers.ErrIdempotencyKeyReused):
+			apierror.WriteCode(w, req, apierror.CodeUnprocessable, "Idempotency key reused with different request")
+			return
+		case errors.Is(err, handlers.ErrIdempotencyKeyInProgress):
+			apierror.WriteCode(w, req, apierror.CodeConflict, "Request with this idempotency key is in progress")
+			return
+		case err != nil:
+			apierror.WriteCode(w, req, apierror.CodeInternal, "Could not check idempotency key")
+			return
+		}
+
+		if replay != nil {
+			if replay.ContentType != "" {
+				w.Header().Set("content-type", replay.ContentType)
+			}
+			if replay.Location != "" {
+				w.Header().Set("Location", replay.Location)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(replay.Status)
+			_, _ = w.Write(replay.Body)
+			return
+		}
+
+		// если обработчик упал, ключ освобождается, чтобы запрос можно было повторить
+		defer func() {
+			if p := recover(); p != nil {
+				if err := uh.idempotency.Release(req.Context(), userID, key); err != nil {
+					uh.logger.Errorw("could not release idempotency key", "user", userID, "error", err)
+				}
+				panic(p)
+			}
+		}()
+
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, req)
+
+		// ошибки сервера и исчерпанные лимиты не запоминаем, такой запрос можно повторить
+		if rw.status == 0 || rw.status >= http.StatusInternalServerError || rw.status == http.StatusTooManyRequests {
+			if err := uh.idempotency.Release(req.Context(), userID, key); err != nil {
+				uh.logger.Errorw("could not release idempotency key", "user", userID, "error", err)
+			}
+		} else {
+			err := uh.idempotency.Complete(req.Context(), userID, key, rw.status, rw.Header().Get("content-type"), rw.Header().Get("Location"), rw.body.Bytes())
+			if err != nil {
+				uh.logger.Errorw("could not save idempotent response", "user", userID, "error", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/handlers"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestIdempotent(t *testing.T) {
+
+	store := storage.NewMemory()
+	urls := NewURLsHandler(store, nil, mockConfig)
+	urls.SetIdempotency(handlers.NewIdempotency(store, time.Hour))
+	handler := urls.Idempotent(http.HandlerFunc(urls.HandleShortenBatch))
+
+	userID, err := store.CreateNewUser(context.Background())
+	require.NoError(t, err)
+	token, err := auth.BuildJWTString(userID)
+	require.NoError(t, err)
+
+	post := func(key string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	body := `[{"correlation_id": "1", "original_url": "https://example.com/1"}]`
+	first := post("retry-1", body)
+	require.Equal(t, http.StatusCreated, first.Code)
+
+	// повтор получает тот же ответ, а ссылка не создаётся заново
+	retry := post("retry-1", body)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("content-type"))
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+
+	links, err := store.GetUserURLS(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Len(t, links, 1)
+
+	// тот же ключ с другим телом
+	w := post("retry-1", `[{"correlation_id": "1", "original_url": "https://example.com/2"}]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = post(strings.Repeat("k", handlers.MaxIdempotencyKeyLength+1), body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// без ключа запрос выполняется как обычно
+	w = post("", `[{"correlation_id": "1", "original_url": "https://example.com/3"}]`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	// повтор создания ссылки v2 получает и заголовок Location
+	handler = urls.Idempotent(http.HandlerFunc(urls.HandleCreateLink))
+	createLink := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v2/links", strings.NewReader(`{"original_url": "https://example.com/v2"}`))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set(IdempotencyKeyHeader, "retry-v2")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	first = createLink()
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.NotEmpty(t, first.Header().Get("Location"))
+	retry = createLink()
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Header().Get("Location"), retry.Header().Get("Location"))
+}
+
+// ctxStorage хранилище, которое, как база данных, не выполняет запросы с отменённым контекстом
+type ctxStorage struct {
+	*storage.Memory
+}
+
+func (s ctxStorage) CompleteIdempotencyKey(ctx context.Context, record storage.IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Memory.CompleteIdempotencyKey(ctx, record)
+}
+
+func (s ctxStorage) DeleteIdempotencyKey(ctx context.Context, userID int, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Memory.DeleteIdempotencyKey(ctx, userID, key)
+}
+
+func TestIdempotentInterrupted(t *testing.T) {
+	store := storage.NewMemory()
+	urls := NewURLsHandler(store, nil, mockConfig)
+	urls.SetIdempotency(handlers.NewIdempotency(ctxStorage{store}, time.Hour))
+
+	userID, err := store.CreateNewUser(context.Background())
+	require.NoError(t, err)
+	token, err := auth.BuildJWTString(userID)
+	require.NoError(t, err)
+
+	calls := 0
+	post := func(key string, next http.HandlerFunc) *httptest.ResponseRecorder {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://example.com"}`)).WithContext(ctx)
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set(IdempotencyKeyHeader, "retry-1")
+		w := httptest.NewRecorder()
+		urls.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			// клиент отключился, пока запрос выполнялся
+			cancel()
+			next(w, r)
+		})).ServeHTTP(w, r)
+		return w
+	}
+
+	// упавший обработчик освобождает ключ
+	assert.Panics(t, func() {
+		post("retry-1", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	})
+	created := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}
+	w := post("retry-1", created)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 2, calls)
+
+	// ответ сохранён, хотя контекст запроса отменён, и повтор получает его без выполнения запроса
+	w = post("retry-1", created)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 2, calls)
+}
+
+// brokenStorage хранилище, которое не может сохранить ответ
+type brokenStorage struct {
+	*storage.Memory
+}
+
+func (s brokenStorage) CompleteIdempotencyKey(ctx context.Context, record storage.IdempotencyRecord) error {
+	return errors.New("disk full")
+}
+
+func TestIdempotentLogsStorageError(t *testing.T) {
+	store := storage.NewMemory()
+	core, logs := observer.New(zap.ErrorLevel)
+	urls := NewURLsHandler(store, nil, mockConfig)
+	urls.SetIdempotency(handlers.NewIdempotency(brokenStorage{store}, time.Hour))
+	urls.SetLogger(zap.New(core).Sugar())
+
+	userID, err := store.CreateNewUser(context.Background())
+	require.NoError(t, err)
+	token, err := auth.BuildJWTString(userID)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://example.com"}`))
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+	urls.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})).ServeHTTP(w, r)
+
+	// ответ клиенту уже отправлен, ошибка сохранения только логируется
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 1, logs.FilterMessage("could not save idempotent response").Len())
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+)
+
+// tooManyItemsError в JSON-массиве больше элементов, чем разрешено
+type tooManyItemsError struct {
+	Limit int
+}
+
+// Error стандартный метод интерфейса error
+func (e *tooManyItemsError) Error() string {
+	return fmt.Sprintf("too many items, limit is %d", e.Limit)
+}
+
+// limitBody ограничивает размер тела запроса, если в конфигурации задан MaxBodySize
+func (uh *URLsHandler) limitBody(w http.ResponseWriter, req *http.Request) {
+	if uh.config.MaxBodySize > 0 {
+		req.Body = http.MaxBytesReader(w, req.Body, uh.config.MaxBodySize)
+	}
+}
+
+// decodeJSONArray читает JSON-массив поэлементно и прекращает чтение, как только элементов становится больше limit.
+// limit 0 - без ограничения
+func decodeJSONArray[T any](r io.Reader, limit int) ([]T, error) {
+	dec := json.NewDecoder(r)
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("expected JSON array")
+	}
+
+	var items []T
+	for dec.More() {
+		if limit > 0 && len(items) >= limit {
+			return nil, &tooManyItemsError{Limit: limit}
+		}
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// bodyError отвечает на ошибку чтения тела запроса: 413 с указанием лимита, если тело или массив
+// слишком большие, иначе 400 с текстом msg
+func bodyError(w http.ResponseWriter, req *http.Request, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Write(w, req, apierror.Newf(apierror.CodePayloadTooLarge,
+			"Request body too large, limit is %d bytes", tooLarge.Limit).With("limit", tooLarge.Limit))
+		return
+	}
+	var tooMany *tooManyItemsError
+	if errors.As(err, &tooMany) {
+		apierror.Write(w, req, apierror.Newf(apierror.CodePayloadTooLarge,
+			"Too many items in request, limit is %d", tooMany.Limit).With("limit", tooMany.Limit))
+		return
+	}
+	apierror.WriteCode(w, req, apierror.CodeBadRequest, msg)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+func TestRequestLimits(t *testing.T) {
+
+	conf := mockConfig
+	conf.MaxBodySize = 128
+	conf.MaxBatchSize = 2
+	conf.MaxDeleteSize = 1
+
+	store := storage.NewMemory()
+	urls := NewURLsHandler(store, tasks.NewDeleteQueue(store, tasks.DefaultDeleteQueueConfig), conf)
+
+	userID, err := store.CreateNewUser(context.Background())
+	require.NoError(t, err)
+	token, err := auth.BuildJWTString(userID)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		handler http.HandlerFunc
+		want    int
+		message string
+	}{
+		{"plain body too large", http.MethodPost, "https://example.com/" + strings.Repeat("a", 200),
+			urls.HandleCreateShortURL, http.StatusRequestEntityTooLarge, "limit is 128 bytes"},
+		{"json body too large", http.MethodPost, `{"url": "https://example.com/` + strings.Repeat("a", 200) + `"}`,
+			urls.HandleShortenURLJSON, http.StatusRequestEntityTooLarge, "limit is 128 bytes"},
+		{"batch too long", http.MethodPost, `[{"original_url": "a"}, {"original_url": "b"}, {"original_url": "c"}]`,
+			urls.HandleShortenBatch, http.StatusRequestEntityTooLarge, "limit is 2"},
+		{"batch fits", http.MethodPost, `[{"original_url": "a"}, {"original_url": "b"}]`,
+			urls.HandleShortenBatch, http.StatusCreated, ""},
+		{"batch not array", http.MethodPost, `{"original_url": "a"}`,
+			urls.HandleShortenBatch, http.StatusBadRequest, "Could not parse body"},
+		{"delete too long", http.MethodDelete, `["a", "b"]`,
+			urls.HandleDeleteUserURLS, http.StatusRequestEntityTooLarge, "limit is 1"},
+		{"delete fits", http.MethodDelete, `["a"]`,
+			urls.HandleDeleteUserURLS, http.StatusAccepted, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.Contains(t, w.Body.String(), tt.message)
+		})
+	}
+}
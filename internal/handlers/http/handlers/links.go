@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/handlers"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/url"
+)
+
+// LinksPath путь коллекции ссылок API v2
+const LinksPath = "/api/v2/links"
+
+// linkData ресурс Link API v2, одинаковый во всех ответах
+type linkData struct {
+	ID          string     `json:"id"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Owner       int        `json:"owner"`
+	Deleted     bool       `json:"deleted"`
+}
+
+func (uh *URLsHandler) newLinkData(link storage.LinkInfo) linkData {
+	return linkData{
+		ID:          link.ShortURL,
+		ShortURL:    url.FormatShortURL(uh.config.ShortURLsAddress, link.ShortURL),
+		OriginalURL: link.FullURL,
+		CreatedAt:   link.CreatedAt,
+		ExpiresAt:   link.ExpiresAt,
+		Owner:       link.UserID,
+		Deleted:     link.IsDeleted,
+	}
+}
+
+// errExpiresInPast срок действия ссылки уже истёк
+var errExpiresInPast = apierror.New(apierror.CodeValidation, "expires_at must be in the future")
+
+// HandleCreateLink создаёт ссылку. Если ссылка уже сокращена, отвечает ошибкой conflict с id существующей ссылки
+func (uh *URLsHandler) HandleCreateLink(w http.ResponseWriter, req *http.Request) {
+	var data struct {
+		OriginalURL string     `json:"original_url"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+	}
+	uh.limitBody(w, req)
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+		bodyError(w, req, err, "Could not parse body")
+		return
+	}
+	if !url.Validate(data.OriginalURL) {
+		apierror.WriteCode(w, req, apierror.CodeValidation, "original_url must be of length from 1 to 250")
+		return
+	}
+	if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+		apierror.Write(w, req, errExpiresInPast)
+		return
+	}
+
+	userID, err := uh.getOrCreateUser(w, req)
+	if err != nil {
+		userError(w, req, err)
+		return
+	}
+
+	id, isCreated, err := handlers.CreateLink(req.Context(), data.OriginalURL, userID, data.ExpiresAt, uh.urls)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Could not store url")
+		return
+	}
+	if !isCreated {
+		apierror.Write(w, req, apierror.New(apierror.CodeConflict, "URL already shortened").
+			With("id", id).
+			With("short_url", url.FormatShortURL(uh.config.ShortURLsAddress, id)))
+		return
+	}
+
+	link, err := uh.urls.GetLink(req.Context(), id)
+	if err != nil {
+		apierror.Write(w, req, err)
+		return
+	}
+	w.Header().Set("Location", LinksPath+"/"+id)
+	writeJSONStatus(w, req, http.StatusCreated, uh.newLinkData(link))
+}
+
+// HandleLinks возвращает ссылки пользователя, включая удалённые
+func (uh *URLsHandler) HandleLinks(w http.ResponseWriter, req *http.Request) {
+	userID, err := uh.verifyUser(w, req, auth.ScopeLinksRead)
+	if err != nil {
+		authError(w, req, err)
+		return
+	}
+	links, err := uh.urls.GetUserLinks(req.Context(), userID)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Error getting data")
+		return
+	}
+	respData := make([]linkData, len(links))
+	for i, link := range links {
+		respData[i] = uh.newLinkData(link)
+	}
+	writeJSON(w, req, respData)
+}
+
+// HandleLink возвращает ссылку пользователя. Чужая ссылка считается ненайденной
+func (uh *URLsHandler) HandleLink(w http.ResponseWriter, req *http.Request) {
+	userID, err := uh.verifyUser(w, req, auth.ScopeLinksRead)
+	if err != nil {
+		authError(w, req, err)
+		return
+	}
+	link, err := uh.userLink(req, userID)
+	if err != nil {
+		apierror.Write(w, req, err)
+		return
+	}
+	writeJSON(w, req, uh.newLinkData(link))
+}
+
+// HandleUpdateLink изменяет исходную ссылку и срок действия. Поля, которых нет в запросе, не меняются,
+// expires_at null снимает ограничение срока действия
+func (uh *URLsHandler) HandleUpdateLink(w http.ResponseWriter, req *http.Request) {
+	userID, err := uh.verifyUser(w, req, auth.ScopeLinksWrite)
+	if err != nil {
+		authError(w, req, err)
+		return
+	}
+
+	var data struct {
+		OriginalURL *string         `json:"original_url"`
+		ExpiresAt   json.RawMessage `json:"expires_at"`
+	}
+	uh.limitBody(w, req)
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+		bodyError(w, req, err, "Could not parse body")
+		return
+	}
+
+	update := storage.LinkUpdate{FullURL: data.OriginalURL}
+	if update.FullURL != nil && !url.Validate(*update.FullURL) {
+		apierror.WriteCode(w, req, apierror.CodeValidation, "original_url must be of length from 1 to 250")
+		return
+	}
+	switch {
+	case data.ExpiresAt == nil:
+	case string(data.ExpiresAt) == "null":
+		update.ClearExpiresAt = true
+	default:
+		var expiresAt time.Time
+		if err := json.Unmarshal(data.ExpiresAt, &expiresAt); err != nil {
+			apierror.WriteCode(w, req, apierror.CodeValidation, "expires_at must be a date-time")
+			return
+		}
+		if !expiresAt.After(time.Now()) {
+			apierror.Write(w, req, errExpiresInPast)
+			return
+		}
+		update.ExpiresAt = &expiresAt
+	}
+
+	link, err := uh.urls.UpdateLink(req.Context(), req.PathValue("id"), userID, update)
+	if err != nil {
+		apierror.Write(w, req, err)
+		return
+	}
+	writeJSON(w, req, uh.newLinkData(link))
+}
+
+// HandleDeleteLink ставит ссылку пользователя в очередь на удаление
+func (uh *URLsHandler) HandleDeleteLink(w http.ResponseWriter, req *http.Request) {
+	userID, err := uh.verifyUser(w, req, auth.ScopeLinksWrite)
+	if err != nil {
+		authError(w, req, err)
+		return
+	}
+	link, err := uh.userLink(req, userID)
+	if err != nil {
+		apierror.Write(w, req, err)
+		return
+	}
+	job, err := uh.deleteQueue.Enqueue(req.Context(), userID, link.ShortURL)
+	if err != nil {
+		apierror.Write(w, req, err)
+		return
+	}
+	writeDeleteJobAccepted(w, req, job)
+}
+
+// userLink ссылка из пути запроса, если она принадлежит пользователю
+func (uh *URLsHandler) userLink(req *http.Request, userID int) (storage.LinkInfo, error) {
+	id := req.PathValue("id")
+	link, err := uh.urls.GetLink(req.Context(), id)
+	var notFound *storage.KeyNotFoundError
+	if errors.As(err, &notFound) || (err == nil && link.UserID != userID) {
+		return storage.LinkInfo{}, apierror.New(apierror.CodeNotFound, "Not found")
+	}
+	return link, err
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+func TestLinksV2(t *testing.T) {
+	st := storage.NewMemory()
+	ctx := context.Background()
+	owner, _ := st.CreateNewUser(ctx)
+	other, _ := st.CreateNewUser(ctx)
+	uh := NewURLsHandler(st, tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig), mockConfig)
+
+	serve := func(handler http.HandlerFunc, method string, id string, body string, userID int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, LinksPath, strings.NewReader(body))
+		r.SetPathValue("id", id)
+		token, err := auth.BuildJWTString(userID)
+		require.NoError(t, err)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) linkData {
+		var link linkData
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+		return link
+	}
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	w := serve(uh.HandleCreateLink, http.MethodPost, "",
+		`{"original_url": "https://example.com/v2", "expires_at": "`+expiresAt.Format(time.RFC3339)+`"}`, owner)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	created := decode(w)
+	assert.Equal(t, LinksPath+"/"+created.ID, w.Header().Get("Location"))
+	assert.Equal(t, "https://example.com/v2", created.OriginalURL)
+	assert.Equal(t, "http://localhost:8080/"+created.ID, created.ShortURL)
+	assert.Equal(t, owner, created.Owner)
+	require.NotNil(t, created.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*created.ExpiresAt))
+
+	t.Run("expires in past", func(t *testing.T) {
+		w := serve(uh.HandleCreateLink, http.MethodPost, "", `{"original_url": "https://example.com/old", "expires_at": "2000-01-01T00:00:00Z"}`, owner)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		w := serve(uh.HandleLink, http.MethodGet, created.ID, "", owner)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, created, decode(w))
+
+		w = serve(uh.HandleLink, http.MethodGet, created.ID, "", other)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := serve(uh.HandleLinks, http.MethodGet, "", "", owner)
+		require.Equal(t, http.StatusOK, w.Code)
+		var links []linkData
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &links))
+		assert.Equal(t, []linkData{created}, links)
+
+		w = serve(uh.HandleLinks, http.MethodGet, "", "", other)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `[]`, w.Body.String())
+	})
+
+	t.Run("update", func(t *testing.T) {
+		w := serve(uh.HandleUpdateLink, http.MethodPatch, created.ID, `{"original_url": "https://example.com/edited", "expires_at": null}`, owner)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		updated := decode(w)
+		assert.Equal(t, "https://example.com/edited", updated.OriginalURL)
+		assert.Nil(t, updated.ExpiresAt)
+
+		w = serve(uh.HandleUpdateLink, http.MethodPatch, created.ID, `{"original_url": "https://example.com/other"}`, other)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		w := serve(uh.HandleDeleteLink, http.MethodDelete, created.ID, "", other)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = serve(uh.HandleDeleteLink, http.MethodDelete, created.ID, "", owner)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		var job deleteJobData
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+		assert.Equal(t, storage.DeleteJobPending, job.Status)
+		assert.Equal(t, []string{created.ID}, job.ShortURLs)
+		assert.Equal(t, DeletionsPath+"/"+strconv.Itoa(job.ID), w.Header().Get("Location"))
+	})
+}
+
+func TestCreateLinkConflict(t *testing.T) {
+	urls := &URLsHandler{urls: existingURLStorage{storage.NewMemory()}, config: mockConfig}
+
+	r := httptest.NewRequest(http.MethodPost, LinksPath, strings.NewReader(`{"original_url": "http://conflict.ru"}`))
+	w := httptest.NewRecorder()
+	urls.HandleCreateLink(w, r)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var problem struct {
+		Code string `json:"code"`
+		ID   string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "conflict", problem.Code)
+	assert.Equal(t, "existing", problem.ID)
+}
+
+// noUpdateStorage хранилище, в котором изменение ссылки всегда падает
+type noUpdateStorage struct {
+	*storage.Memory
+}
+
+func (s noUpdateStorage) UpdateLink(ctx context.Context, key string, userID int, update storage.LinkUpdate) (storage.LinkInfo, error) {
+	return storage.LinkInfo{}, errors.New("update failed")
+}
+
+func TestCreateLinkWithExpiry(t *testing.T) {
+	st := noUpdateStorage{storage.NewMemory()}
+	urls := NewURLsHandler(st, nil, mockConfig)
+
+	// срок действия сохраняется вместе со ссылкой, без отдельного UpdateLink
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	r := httptest.NewRequest(http.MethodPost, LinksPath,
+		strings.NewReader(`{"original_url": "https://example.com/expiring", "expires_at": "`+expiresAt.Format(time.RFC3339)+`"}`))
+	w := httptest.NewRecorder()
+	urls.HandleCreateLink(w, r)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created linkData
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	link, err := st.GetLink(context.Background(), created.ID)
+	require.NoError(t, err)
+	require.NotNil(t, link.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*link.ExpiresAt))
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/oidc"
+)
+
+// OIDCProvider - интерфейс клиента OpenID Connect провайдера
+type OIDCProvider interface {
+	AuthCodeURL(state string, nonce string, verifier string) string
+	Exchange(ctx context.Context, code string, verifier string, nonce string) (*oidc.Claims, error)
+}
+
+// loginState хранится в куке, пока пользователь проходит вход у провайдера
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"return_to,omitempty"`
+}
+
+// SetOIDCProvider включает вход через OpenID Connect провайдера
+func (uh *URLsHandler) SetOIDCProvider(provider OIDCProvider) {
+	uh.oidc = provider
+}
+
+// HandleOIDCLogin отправляет пользователя на страницу входа провайдера.
+// Параметр return_to задаёт локальный путь, куда вернуть пользователя после входа
+func (uh *URLsHandler) HandleOIDCLogin(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
+		return
+	}
+	if uh.oidc == nil {
+		apierror.WriteCode(w, req, apierror.CodeNotFound, "OIDC login is not configured")
+		return
+	}
+
+	var state loginState
+	var err error
+	for _, v := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		*v, err = oidc.RandomString()
+		if err != nil {
+			apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
+			return
+		}
+	}
+	state.ReturnTo = safeReturnTo(req.URL.Query().Get("return_to"))
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
+		return
+	}
+	auth.SetLoginStateCookie(w, base64.RawURLEncoding.EncodeToString(data))
+	http.Redirect(w, req, uh.oidc.AuthCodeURL(state.State, state.Nonce, state.Verifier), http.StatusFound)
+}
+
+// HandleOIDCCallback принимает пользователя от провайдера, проверяет ID-токен
+// и выдаёт авторизационную куку пользователя, привязанного к учётной записи провайдера
+func (uh *URLsHandler) HandleOIDCCallback(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		apierror.WriteCode(w, req, apierror.CodeMethodNotAllowed, "Wrong method")
+		return
+	}
+	if uh.oidc == nil {
+		apierror.WriteCode(w, req, apierror.CodeNotFound, "OIDC login is not configured")
+		return
+	}
+
+	raw, err := auth.PopLoginStateCookie(w, req)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Login session not found")
+		return
+	}
+	var state loginState
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil || state.State == "" {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Login session not found")
+		return
+	}
+
+	query := req.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		apierror.WriteCode(w, req, apierror.CodeBadRequest, "Login state mismatch")
+		return
+	}
+	if query.Get("error") != "" || query.Get("code") == "" {
+		apierror.WriteCode(w, req, apierror.CodeUnauthorized, "Login failed")
+		return
+	}
+
+	claims, err := uh.oidc.Exchange(req.Context(), query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeUnauthorized, "Login failed")
+		return
+	}
+
+	userID, err := uh.urls.GetOrCreateUserByIdentity(req.Context(), claims.Issuer, claims.Subject)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Error authenticating user")
+		return
+	}
+	err = auth.SetAuthCookie(userID, w)
+	if err != nil {
+		apierror.WriteCode(w, req, apierror.CodeInternal, "Something went wrong")
+		return
+	}
+	http.Redirect(w, req, state.ReturnTo, http.StatusSeeOther)
+}
+
+// safeReturnTo пропускает только локальные пути, чтобы вход нельзя было использовать как открытый редирект.
+// Управляющие символы отклоняются: браузер вырезает их из Location, и "/\t/evil.com" превращается в "//evil.com"
+func safeReturnTo(path string) string {
+	if strings.ContainsFunc(path, func(r rune) bool { return r < 0x20 || r == 0x7f }) || strings.Contains(path, "\\") {
+		return "/"
+	}
+	parsed, err := url.Parse(path)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" ||
+		!strings.HasPrefix(parsed.Path, "/") || strings.HasPrefix(parsed.Path, "//") {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/oidc"
+	"github.com/wellywell/shorturl/internal/oidc/oidctest"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+// oidcLogin проходит весь вход: /auth/login, страницу провайдера и /auth/callback
+func oidcLogin(t *testing.T, urls *URLsHandler, idp *oidctest.Provider, returnTo string) *http.Response {
+	r := httptest.NewRequest(http.MethodGet, "/auth/login?return_to="+url.QueryEscape(returnTo), nil)
+	w := httptest.NewRecorder()
+	urls.HandleOIDCLogin(w, r)
+	login := w.Result()
+	defer login.Body.Close()
+	require.Equal(t, http.StatusFound, login.StatusCode)
+
+	res, err := idp.Client().Get(login.Header.Get("Location"))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	r = httptest.NewRequest(http.MethodGet, res.Header.Get("Location"), nil)
+	for _, c := range login.Cookies() {
+		r.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	urls.HandleOIDCCallback(w, r)
+	return w.Result()
+}
+
+func sessionUser(t *testing.T, res *http.Response) int {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range res.Cookies() {
+		if c.MaxAge >= 0 {
+			r.AddCookie(c)
+		}
+	}
+	userID, err := auth.VerifyUser(r)
+	require.NoError(t, err)
+	return userID
+}
+
+func TestHandleOIDCLogin(t *testing.T) {
+	idp := oidctest.NewProvider("shorturl", "secret")
+	defer idp.Close()
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "shorturl",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/callback",
+	}, idp.Client())
+	require.NoError(t, err)
+
+	st := storage.NewMemory()
+	anonymous, err := st.CreateNewUser(context.Background())
+	require.NoError(t, err)
+
+	urls := &URLsHandler{urls: st, config: mockConfig}
+	urls.SetOIDCProvider(provider)
+
+	idp.SetSubject("alice")
+	res := oidcLogin(t, urls, idp, "/api/user/urls")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusSeeOther, res.StatusCode)
+	assert.Equal(t, "/api/user/urls", res.Header.Get("Location"))
+	alice := sessionUser(t, res)
+	assert.NotEqual(t, anonymous, alice)
+
+	// повторный вход попадает в того же пользователя
+	res = oidcLogin(t, urls, idp, "https://evil.example.com")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusSeeOther, res.StatusCode)
+	assert.Equal(t, "/", res.Header.Get("Location"))
+	assert.Equal(t, alice, sessionUser(t, res))
+
+	idp.SetSubject("bob")
+	res = oidcLogin(t, urls, idp, "")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusSeeOther, res.StatusCode)
+	assert.NotEqual(t, alice, sessionUser(t, res))
+}
+
+func TestHandleOIDCCallbackRejections(t *testing.T) {
+	idp := oidctest.NewProvider("shorturl", "secret")
+	defer idp.Close()
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "shorturl",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/callback",
+	}, idp.Client())
+	require.NoError(t, err)
+
+	urls := &URLsHandler{urls: storage.NewMemory(), config: mockConfig}
+
+	// без настроенного провайдера вход недоступен
+	w := httptest.NewRecorder()
+	urls.HandleOIDCLogin(w, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	urls.SetOIDCProvider(provider)
+
+	// нет куки с состоянием входа
+	w = httptest.NewRecorder()
+	urls.HandleOIDCCallback(w, httptest.NewRequest(http.MethodGet, "/auth/callback?code=x&state=y", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// state не совпадает с сохранённым
+	w = httptest.NewRecorder()
+	urls.HandleOIDCLogin(w, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	login := w.Result()
+	defer login.Body.Close()
+
+	r := httptest.NewRequest(http.MethodGet, "/auth/callback?code=x&state=forged", nil)
+	for _, c := range login.Cookies() {
+		r.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	urls.HandleOIDCCallback(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSafeReturnTo(t *testing.T) {
+	tests := []struct {
+		returnTo string
+		want     string
+	}{
+		{"/api/user/urls", "/api/user/urls"},
+		{"/api/v2/links?limit=10#top", "/api/v2/links?limit=10#top"},
+		{"", "/"},
+		{"https://evil.com", "/"},
+		{"//evil.com", "/"},
+		{"/\\evil.com", "/"},
+		{"/\t/evil.com", "/"},
+		{"/\n/evil.com", "/"},
+		{"javascript:alert(1)", "/"},
+		{"evil.com/path", "/"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, safeReturnTo(tt.returnTo), tt.returnTo)
+	}
+}
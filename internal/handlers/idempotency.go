@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+// MaxIdempotencyKeyLength максимальная длина ключа идемпотентности
+const MaxIdempotencyKeyLength = 255
+
+// Ошибки при работе с ключами идемпотентности
+var (
+	ErrBadIdempotencyKey        = errors.New("bad idempotency key")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key reused with different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+// IdempotencyLockTimeout через сколько незавершённый запрос считается брошенным, а его ключ - свободным.
+// Так ключ освобождается, если процесс упал, не успев вызвать Complete или Release
+const IdempotencyLockTimeout = time.Minute
+
+// IdempotencyStorage - интерфейс хранилища ключей идемпотентности
+type IdempotencyStorage interface {
+	ReserveIdempotencyKey(ctx context.Context, record storage.IdempotencyRecord, expiredBefore time.Time, staleBefore time.Time) (storage.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, record storage.IdempotencyRecord) error
+	DeleteIdempotencyKey(ctx context.Context, userID int, key string) error
+}
+
+// Idempotency запоминает первый ответ на запрос с ключом идемпотентности на время ttl, общая логика для HTTP и gRPC.
+// Ключи действуют в пределах пользователя
+type Idempotency struct {
+	store IdempotencyStorage
+	ttl   time.Duration
+}
+
+// NewIdempotency инициализирует Idempotency
+func NewIdempotency(store IdempotencyStorage, ttl time.Duration) *Idempotency {
+	return &Idempotency{store: store, ttl: ttl}
+}
+
+// Begin резервирует ключ для запроса. Если запрос с этим ключом уже выполнен, возвращает сохранённый ответ.
+// Если вернулись nil и nil, запрос нужно выполнить и вызвать Complete либо Release.
+// Ключ, повторно использованный с другим запросом, вернёт ErrIdempotencyKeyReused
+func (i *Idempotency) Begin(ctx context.Context, userID int, key string, requestHash string) (*storage.IdempotencyRecord, error) {
+	if key == "" || len(key) > MaxIdempotencyKeyLength {
+		return nil, ErrBadIdempotencyKey
+	}
+	now := time.Now()
+	record := storage.IdempotencyRecord{UserID: userID, Key: key, RequestHash: requestHash, CreatedAt: now}
+
+	existing, reserved, err := i.store.ReserveIdempotencyKey(ctx, record, now.Add(-i.ttl), now.Add(-IdempotencyLockTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return &existing, nil
+}
+
+// Complete сохраняет ответ на запрос. Ответ сохраняется, даже если клиент уже отключился и ctx отменён.
+// location - заголовок Location ответа, пустой, если его нет
+func (i *Idempotency) Complete(ctx context.Context, userID int, key string, status int, contentType string, location string, body []byte) error {
+	return i.store.CompleteIdempotencyKey(context.WithoutCancel(ctx), storage.IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		Status:      status,
+		ContentType: contentType,
+		Location:    location,
+		Body:        body,
+	})
+}
+
+// Release освобождает ключ неудавшегося запроса, чтобы его можно было повторить, в том числе после отмены ctx
+func (i *Idempotency) Release(ctx context.Context, userID int, key string) error {
+	return i.store.DeleteIdempotencyKey(context.WithoutCancel(ctx), userID, key)
+}
+
+// RequestHash отпечаток запроса, по которому повторный запрос отличается от другого запроса с тем же ключом
+func RequestHash(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		// длина перед каждой частью, чтобы границы частей не сдвигались
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(part))))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
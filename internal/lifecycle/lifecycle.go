@@ -0,0 +1,172 @@
+// Package lifecycle упорядоченная остановка сервиса: шаги выполняются в заданном порядке,
+// каждый со своим таймаутом, а зависимости между шагами проверяются до запуска
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Stage шаг остановки
+type Stage struct {
+	// Name имя шага в порядке и таймаутах остановки
+	Name string
+	// Timeout сколько ждать шаг, если для него не задан таймаут в SetTimeouts
+	Timeout time.Duration
+	// After шаги, которые должны выполниться раньше этого
+	After []string
+	// Stop останавливает компонент. По истечении таймаута ctx отменяется
+	Stop func(ctx context.Context) error
+}
+
+// Manager выполняет шаги остановки
+type Manager struct {
+	stages   []Stage
+	order    []string
+	timeouts map[string]time.Duration
+	logger   *zap.SugaredLogger
+}
+
+// SetLogger задаёт логгер, в который пишется длительность и результат каждого шага. Без логгера шаги не логируются
+func (m *Manager) SetLogger(logger *zap.SugaredLogger) {
+	m.logger = logger
+}
+
+// Add добавляет шаг. По умолчанию шаги выполняются в порядке добавления
+func (m *Manager) Add(stage Stage) {
+	m.stages = append(m.stages, stage)
+}
+
+// SetOrder задаёт порядок шагов списком имён через запятую. Шаги, которых нет в списке,
+// выполняются после перечисленных в порядке добавления
+func (m *Manager) SetOrder(value string) {
+	m.order = nil
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			m.order = append(m.order, name)
+		}
+	}
+}
+
+// SetTimeouts задаёт таймауты шагов строкой вида "http=10s,delete-queue=30s"
+func (m *Manager) SetTimeouts(value string) error {
+	timeouts := make(map[string]time.Duration)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, duration, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("bad shutdown timeout %q, want name=duration", item)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return fmt.Errorf("bad shutdown timeout %q: %w", item, err)
+		}
+		timeouts[strings.TrimSpace(name)] = timeout
+	}
+	m.timeouts = timeouts
+	return nil
+}
+
+// Plan итоговый порядок шагов. Ошибка, если в порядке или таймаутах есть неизвестный шаг,
+// или шаг стоит раньше того, после которого должен выполняться
+func (m *Manager) Plan() ([]Stage, error) {
+	byName := make(map[string]Stage, len(m.stages))
+	for _, stage := range m.stages {
+		byName[stage.Name] = stage
+	}
+	for name := range m.timeouts {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("unknown shutdown stage %q", name)
+		}
+	}
+
+	var plan []Stage
+	done := make(map[string]bool, len(m.stages))
+	add := func(name string) error {
+		stage, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unknown shutdown stage %q", name)
+		}
+		if done[name] {
+			return fmt.Errorf("shutdown stage %q is listed twice", name)
+		}
+		for _, before := range stage.After {
+			if _, registered := byName[before]; registered && !done[before] {
+				return fmt.Errorf("shutdown stage %q must run after %q", name, before)
+			}
+		}
+		if timeout, ok := m.timeouts[name]; ok {
+			stage.Timeout = timeout
+		}
+		done[name] = true
+		plan = append(plan, stage)
+		return nil
+	}
+
+	for _, name := range m.order {
+		if err := add(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, stage := range m.stages {
+		if !slices.Contains(m.order, stage.Name) {
+			if err := add(stage.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Shutdown выполняет шаги по порядку. Шаг, завершившийся с ошибкой или по таймауту, не останавливает
+// следующие: ошибки всех шагов возвращаются вместе
+func (m *Manager) Shutdown() error {
+	plan, err := m.Plan()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, stage := range plan {
+		started := time.Now()
+		err := run(stage)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", stage.Name, err))
+		}
+		if m.logger != nil {
+			m.logger.Infow("shutdown stage", "stage", stage.Name, "duration", time.Since(started).Round(time.Millisecond), "error", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run выполняет шаг и возвращает ошибку таймаута, если шаг не уложился в Timeout,
+// даже если Stop не следит за контекстом
+func run(stage Stage) error {
+	ctx := context.Background()
+	if stage.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, stage.Timeout)
+		defer cancel()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- stage.Stop(ctx)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
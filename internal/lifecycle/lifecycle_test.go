@@ -0,0 +1,84 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManager(calls *[]string) *Manager {
+	stop := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			*calls = append(*calls, name)
+			return nil
+		}
+	}
+	m := &Manager{}
+	m.Add(Stage{Name: "http", Stop: stop("http")})
+	m.Add(Stage{Name: "grpc", Stop: stop("grpc")})
+	m.Add(Stage{Name: "queue", After: []string{"http", "grpc"}, Stop: stop("queue")})
+	m.Add(Stage{Name: "storage", After: []string{"queue"}, Stop: stop("storage")})
+	return m
+}
+
+func TestManagerOrder(t *testing.T) {
+	var calls []string
+	m := newManager(&calls)
+	require.NoError(t, m.Shutdown())
+	assert.Equal(t, []string{"http", "grpc", "queue", "storage"}, calls)
+
+	// шаги, которых нет в порядке, выполняются после перечисленных
+	calls = nil
+	m.SetOrder("grpc, http")
+	require.NoError(t, m.Shutdown())
+	assert.Equal(t, []string{"grpc", "http", "queue", "storage"}, calls)
+}
+
+func TestManagerPlanErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    string
+		timeouts string
+	}{
+		{"unknown stage", "http,ftp", ""},
+		{"listed twice", "http,http", ""},
+		{"before dependency", "queue,http,grpc", ""},
+		{"storage before queue", "http,grpc,storage", ""},
+		{"unknown timeout", "", "ftp=1s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManager(new([]string))
+			m.SetOrder(tt.order)
+			require.NoError(t, m.SetTimeouts(tt.timeouts))
+			_, err := m.Plan()
+			assert.Error(t, err)
+		})
+	}
+
+	assert.Error(t, (&Manager{}).SetTimeouts("http=soon"))
+	assert.Error(t, (&Manager{}).SetTimeouts("http"))
+}
+
+func TestManagerTimeout(t *testing.T) {
+	var calls []string
+	m := &Manager{}
+	m.Add(Stage{Name: "slow", Timeout: time.Hour, Stop: func(ctx context.Context) error {
+		// Stop не следит за контекстом, шаг всё равно прерывается по таймауту
+		time.Sleep(time.Second)
+		return nil
+	}})
+	m.Add(Stage{Name: "next", Stop: func(ctx context.Context) error {
+		calls = append(calls, "next")
+		return nil
+	}})
+	require.NoError(t, m.SetTimeouts("slow=10ms"))
+
+	err := m.Shutdown()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "slow")
+	assert.Equal(t, []string{"next"}, calls)
+}
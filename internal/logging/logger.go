@@ -0,0 +1,12 @@
+package logging
+
+import "go.uber.org/zap"
+
+// New общий логгер сервиса, который передаётся остальным пакетам
+func New() (*zap.SugaredLogger, error) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		return nil, err
+	}
+	return logger.Sugar(), nil
+}
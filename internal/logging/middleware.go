@@ -6,6 +6,9 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/clientip"
 )
 
 type (
@@ -44,18 +47,16 @@ type Logger struct {
 
 // NewLogger инициализирует логгер
 func NewLogger() (*Logger, error) {
-	logger, err := zap.NewDevelopment()
+	sugar, err := New()
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = logger.Sync()
-	}()
-
-	sugar := logger.Sugar()
-	return &Logger{
-		sugar: sugar,
-	}, nil
+	return NewMiddleware(sugar), nil
+}
+
+// NewMiddleware middleware, которая пишет запросы в переданный логгер
+func NewMiddleware(sugar *zap.SugaredLogger) *Logger {
+	return &Logger{sugar: sugar}
 }
 
 // Handle метод для использования Logger как middleware
@@ -78,6 +79,8 @@ func (l Logger) Handle(h http.Handler) http.Handler {
 		l.sugar.Infoln(
 			"uri", r.RequestURI,
 			"method", r.Method,
+			"ip", clientip.FromRequest(r),
+			"request_id", apierror.CorrelationID(r.Context()),
 			"status", responseData.status,
 			"duration", duration,
 			"size", responseData.size,
@@ -0,0 +1,127 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval не даёт токенам с неизвестным kid заставлять нас постоянно перечитывать ключи
+const minRefreshInterval = time.Minute
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	alg string
+	key any
+}
+
+// keySet кэш публичных ключей провайдера. Ключи перечитываются, когда встречается неизвестный kid
+type keySet struct {
+	client      *http.Client
+	uri         string
+	keys        map[string]publicKey
+	lastRefresh time.Time
+	lock        sync.Mutex
+}
+
+func newKeySet(client *http.Client, uri string) *keySet {
+	return &keySet{client: client, uri: uri}
+}
+
+func (ks *keySet) get(ctx context.Context, kid string, alg string) (any, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	key, ok := ks.keys[kid]
+	if !ok && time.Since(ks.lastRefresh) > minRefreshInterval {
+		if err := ks.refresh(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = ks.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if key.alg != alg {
+		return nil, fmt.Errorf("key %q is not a %s key", kid, alg)
+	}
+	return key.key, nil
+}
+
+func (ks *keySet) refresh(ctx context.Context) error {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, ks.client, ks.uri, &doc); err != nil {
+		return fmt.Errorf("could not load jwks: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	ks.keys = keys
+	ks.lastRefresh = time.Now()
+	return nil
+}
+
+func (jwk jsonWebKey) publicKey() (publicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return publicKey{}, err
+		}
+		return publicKey{alg: "RS256", key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return publicKey{}, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return publicKey{}, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return publicKey{}, err
+		}
+		return publicKey{alg: "ES256", key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	}
+	return publicKey{}, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
@@ -0,0 +1,216 @@
+// Package oidc реализует вход через внешнего OpenID Connect провайдера по authorization code flow с PKCE:
+// discovery, обмен кода на токены и проверку ID-токена по ключам провайдера
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Ошибки проверки ID-токена
+var (
+	ErrTokenInvalid    = errors.New("id token invalid")
+	ErrIssuerMismatch  = errors.New("id token issuer mismatch")
+	ErrAudienceInvalid = errors.New("id token audience invalid")
+	ErrNonceMismatch   = errors.New("id token nonce mismatch")
+)
+
+// Config настройки клиента провайдера
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims данные из проверенного ID-токена
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce,omitempty"`
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// metadata часть документа discovery, которая нужна клиенту
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider клиент OpenID Connect провайдера
+type Provider struct {
+	config   Config
+	client   *http.Client
+	metadata metadata
+	keys     *keySet
+}
+
+// NewProvider загружает документ discovery провайдера. Если client не задан, используется http.DefaultClient
+func NewProvider(ctx context.Context, conf Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid"}
+	}
+
+	wellKnown := strings.TrimSuffix(conf.Issuer, "/") + "/.well-known/openid-configuration"
+	var meta metadata
+	if err := getJSON(ctx, client, wellKnown, &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if meta.Issuer != conf.Issuer {
+		return nil, fmt.Errorf("%w: discovery returned %q, expected %q", ErrIssuerMismatch, meta.Issuer, conf.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery document of %s is incomplete", conf.Issuer)
+	}
+
+	return &Provider{
+		config:   conf,
+		client:   client,
+		metadata: meta,
+		keys:     newKeySet(client, meta.JWKSURI),
+	}, nil
+}
+
+// Issuer идентификатор провайдера
+func (p *Provider) Issuer() string {
+	return p.metadata.Issuer
+}
+
+// AuthCodeURL адрес, на который нужно отправить пользователя для входа
+func (p *Provider) AuthCodeURL(state string, nonce string, verifier string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// Exchange обменивает код авторизации на токены и возвращает проверенные claims ID-токена
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (*Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.config.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("could not decode token response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", res.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrTokenInvalid)
+	}
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken проверяет подпись, срок жизни, издателя, получателя и nonce ID-токена
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*Claims, error) {
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "ES256"}))
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.keys.get(ctx, kid, t.Method.Alg())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenInvalid, err)
+	}
+	if claims.ExpiresAt == nil || claims.Subject == "" {
+		return nil, fmt.Errorf("%w: exp and sub are required", ErrTokenInvalid)
+	}
+	if claims.Issuer != p.metadata.Issuer {
+		return nil, fmt.Errorf("%w: %q", ErrIssuerMismatch, claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, ErrAudienceInvalid
+	}
+	if nonce != "" && claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return claims, nil
+}
+
+// RandomString случайная строка для state, nonce и PKCE verifier
+func RandomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// PKCEChallenge вычисляет code_challenge методом S256
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
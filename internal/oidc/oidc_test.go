@@ -0,0 +1,115 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/auth/callback"
+
+// authorize проходит страницу входа тестового провайдера и возвращает code и state из редиректа
+func authorize(t *testing.T, idp *oidctest.Provider, authURL string) (string, string) {
+	res, err := idp.Client().Get(authURL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func newTestProvider(t *testing.T, idp *oidctest.Provider) *Provider {
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "shorturl",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email"},
+	}, idp.Client())
+	require.NoError(t, err)
+	return p
+}
+
+func TestCodeFlow(t *testing.T) {
+	idp := oidctest.NewProvider("shorturl", "secret")
+	defer idp.Close()
+	idp.SetSubject("alice")
+
+	p := newTestProvider(t, idp)
+	assert.Equal(t, idp.Issuer(), p.Issuer())
+
+	code, state := authorize(t, idp, p.AuthCodeURL("state-1", "nonce-1", "verifier-1"))
+	assert.Equal(t, "state-1", state)
+
+	claims, err := p.Exchange(context.Background(), code, "verifier-1", "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.Subject)
+	assert.Equal(t, idp.Issuer(), claims.Issuer)
+
+	// код одноразовый
+	_, err = p.Exchange(context.Background(), code, "verifier-1", "nonce-1")
+	assert.Error(t, err)
+}
+
+func TestCodeFlowRejections(t *testing.T) {
+	idp := oidctest.NewProvider("shorturl", "secret")
+	defer idp.Close()
+	p := newTestProvider(t, idp)
+
+	testCases := []struct {
+		name     string
+		extra    jwt.MapClaims
+		verifier string
+		nonce    string
+		wantErr  error
+	}{
+		{"wrong verifier", nil, "other-verifier", "nonce", nil},
+		{"wrong nonce", nil, "verifier", "other-nonce", ErrNonceMismatch},
+		{"wrong audience", jwt.MapClaims{"aud": "someone-else"}, "verifier", "nonce", ErrAudienceInvalid},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}, "verifier", "nonce", ErrIssuerMismatch},
+		{"expired", jwt.MapClaims{"exp": 1}, "verifier", "nonce", ErrTokenInvalid},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			idp.SetExtraClaims(tc.extra)
+			defer idp.SetExtraClaims(nil)
+
+			code, _ := authorize(t, idp, p.AuthCodeURL("state", "nonce", "verifier"))
+			_, err := p.Exchange(context.Background(), code, tc.verifier, tc.nonce)
+			require.Error(t, err)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenTampered(t *testing.T) {
+	idp := oidctest.NewProvider("shorturl", "secret")
+	defer idp.Close()
+	p := newTestProvider(t, idp)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": idp.Issuer(), "sub": "mallory", "aud": "shorturl", "exp": 9999999999})
+	raw, err := token.SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	_, err = p.VerifyIDToken(context.Background(), raw, "")
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func TestNewProviderIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewProvider("shorturl", "secret")
+	defer idp.Close()
+
+	_, err := NewProvider(context.Background(), Config{Issuer: idp.Issuer() + "/"}, idp.Client())
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectRefs собирает все ссылки $ref в спецификации
+func collectRefs(value any, refs *[]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" {
+				*refs = append(*refs, ref)
+				continue
+			}
+			collectRefs(item, refs)
+		}
+	case []any:
+		for _, item := range v {
+			collectRefs(item, refs)
+		}
+	}
+}
+
+func TestSpec(t *testing.T) {
+	doc, err := Load()
+	require.NoError(t, err)
+
+	var raw map[string]any
+	require.NoError(t, json.Unmarshal(Spec(), &raw))
+	assert.Equal(t, "3.0.3", raw["openapi"])
+
+	var refs []string
+	collectRefs(raw, &refs)
+	require.NotEmpty(t, refs)
+	for _, ref := range refs {
+		name := refName(ref)
+		switch {
+		case strings.HasPrefix(ref, "#/components/schemas/"):
+			assert.Contains(t, doc.Components.Schemas, name, ref)
+		case strings.HasPrefix(ref, "#/components/parameters/"):
+			assert.Contains(t, doc.Components.Parameters, name, ref)
+		case strings.HasPrefix(ref, "#/components/responses/"):
+			assert.Contains(t, doc.Components.Responses, name, ref)
+		default:
+			t.Errorf("unexpected ref %s", ref)
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, item := range doc.Paths {
+		for _, op := range item {
+			assert.NotEmpty(t, op.OperationID)
+			assert.False(t, ids[op.OperationID], "operationId %s is not unique", op.OperationID)
+			ids[op.OperationID] = true
+		}
+	}
+}
+
+func TestFindOperation(t *testing.T) {
+	doc := MustLoad()
+
+	op, vars, ok := doc.FindOperation(http.MethodGet, "/abc")
+	require.True(t, ok)
+	assert.Equal(t, "getFullURL", op.OperationID)
+	assert.Equal(t, map[string]string{"id": "abc"}, vars)
+
+	// путь без параметров предпочтительнее шаблона /{id}
+	op, _, ok = doc.FindOperation(http.MethodGet, "/ping")
+	require.True(t, ok)
+	assert.Equal(t, "ping", op.OperationID)
+
+	op, vars, ok = doc.FindOperation(http.MethodDelete, "/api/user/keys/12")
+	require.True(t, ok)
+	assert.Equal(t, "revokeAPIKey", op.OperationID)
+	assert.Equal(t, map[string]string{"id": "12"}, vars)
+
+	_, _, ok = doc.FindOperation(http.MethodPut, "/api/shorten")
+	assert.False(t, ok)
+	_, _, ok = doc.FindOperation(http.MethodGet, "/api/unknown/path")
+	assert.False(t, ok)
+}
+
+func TestValidator(t *testing.T) {
+	handler := NewValidator(MustLoad(), 64).Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		header   http.Header
+		wantCode int
+		wantErr  string
+	}{
+		{"valid json", http.MethodPost, "/api/shorten", `{"url": "http://a.ru"}`, nil, http.StatusOK, ""},
+		{"missing field", http.MethodPost, "/api/shorten", `{"link": "http://a.ru"}`, nil, http.StatusBadRequest, "body.url: is required"},
+		{"wrong type", http.MethodPost, "/api/shorten", `{"url": 5}`, nil, http.StatusBadRequest, "body.url: must be a string"},
+		{"invalid json", http.MethodPost, "/api/shorten", `{"url":`, nil, http.StatusBadRequest, "body: must be valid JSON"},
+		{"empty body", http.MethodPost, "/api/shorten", ``, nil, http.StatusBadRequest, "body: is required"},
+		{"batch item", http.MethodPost, "/api/shorten/batch", `[{"correlation_id": "1"}]`, nil, http.StatusBadRequest, "body[0].original_url: is required"},
+		{"text body", http.MethodPost, "/", `http://a.ru`, nil, http.StatusOK, ""},
+		{"unknown scope", http.MethodPost, "/api/user/keys", `{"scopes": ["links:all"]}`, nil, http.StatusBadRequest, "body.scopes[0]: must be one of"},
+		{"bad query", http.MethodGet, "/api/admin/links?limit=ten", ``, nil, http.StatusBadRequest, "query.limit: must be an integer"},
+		{"negative query", http.MethodGet, "/api/admin/links?limit=-1", ``, nil, http.StatusBadRequest, "query.limit: must be at least 0"},
+		{"bool query", http.MethodDelete, "/api/user/urls?sync=true", `["abc"]`, nil, http.StatusOK, ""},
+		{"bad bool query", http.MethodDelete, "/api/user/urls?sync=maybe", `["abc"]`, nil, http.StatusBadRequest, "query.sync: must be a boolean"},
+		{"bad path", http.MethodPost, "/api/admin/users/abc/block", ``, nil, http.StatusBadRequest, "path.id: must be an integer"},
+		{"long idempotency key", http.MethodPost, "/", `http://a.ru`,
+			http.Header{"Idempotency-Key": {strings.Repeat("k", 256)}}, http.StatusBadRequest, "header.Idempotency-Key: must be at most 255 characters"},
+		{"too large", http.MethodPost, "/api/shorten", `{"url": "http://` + strings.Repeat("a", 64) + `.ru"}`, nil, http.StatusRequestEntityTooLarge, ""},
+		{"not in spec", http.MethodPut, "/api/shorten", `nonsense`, nil, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			for key, values := range tt.header {
+				r.Header[key] = values
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantErr == "" {
+				return
+			}
+			var problem struct {
+				Code   string   `json:"code"`
+				Errors []string `json:"errors"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, "validation_failed", problem.Code)
+			require.Len(t, problem.Errors, 1)
+			assert.Contains(t, problem.Errors[0], tt.wantErr)
+		})
+	}
+}
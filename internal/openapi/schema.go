@@ -0,0 +1,118 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema подмножество JSON Schema, которое используется в спецификации
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Properties map[string]*Schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *Schema            `json:"items"`
+	Enum       []any              `json:"enum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	Minimum    *float64           `json:"minimum"`
+	Nullable   bool               `json:"nullable"`
+}
+
+// Validate проверяет значение, разобранное json.Decoder с UseNumber, по схеме.
+// Возвращает все найденные несоответствия, path - путь к значению для сообщений
+func (d *Document) Validate(schema *Schema, value any, path string) []string {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		resolved, ok := d.Components.Schemas[refName(schema.Ref)]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", path, schema.Ref)}
+		}
+		return d.Validate(resolved, value, path)
+	}
+	if value == nil && schema.Nullable {
+		return nil
+	}
+
+	var errs []string
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: must be an object", path)}
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s: is required", path, name))
+			}
+		}
+		for name, propSchema := range schema.Properties {
+			if propValue, ok := obj[name]; ok {
+				errs = append(errs, d.Validate(propSchema, propValue, path+"."+name)...)
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: must be an array", path)}
+		}
+		for i, item := range items {
+			errs = append(errs, d.Validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: must be a string", path)}
+		}
+		errs = append(errs, validateString(schema, s, path)...)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return []string{fmt.Sprintf("%s: must be a %s", path, schema.Type)}
+		}
+		if schema.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return []string{fmt.Sprintf("%s: must be an integer", path)}
+			}
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return []string{fmt.Sprintf("%s: must be a number", path)}
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			errs = append(errs, fmt.Sprintf("%s: must be at least %v", path, *schema.Minimum))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: must be a boolean", path)}
+		}
+	}
+
+	if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, value) {
+		errs = append(errs, fmt.Sprintf("%s: must be one of %v", path, schema.Enum))
+	}
+	return errs
+}
+
+func validateString(schema *Schema, s string, path string) []string {
+	var errs []string
+	length := utf8.RuneCountInString(s)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		errs = append(errs, fmt.Sprintf("%s: must be at least %d characters", path, *schema.MinLength))
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		errs = append(errs, fmt.Sprintf("%s: must be at most %d characters", path, *schema.MaxLength))
+	}
+	if schema.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: must be a date-time", path))
+		}
+	}
+	return errs
+}
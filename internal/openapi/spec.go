@@ -0,0 +1,238 @@
+// Package openapi спецификация OpenAPI 3 для HTTP API: сама спецификация, её отдача клиентам
+// и проверка запросов по ней. Поддерживается подмножество JSON Schema, которое используется в спецификации
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//go:embed openapi.json
+var specJSON []byte
+
+// Document спецификация OpenAPI, только поля, нужные для проверки запросов
+type Document struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Components переиспользуемые части спецификации
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+	Responses  map[string]*Response  `json:"responses"`
+}
+
+// Operation описание метода на пути
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter параметр запроса
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody тело запроса по типам содержимого
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response ответ по типам содержимого
+type Response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]MediaType `json:"content"`
+}
+
+// MediaType схема содержимого одного типа
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Spec спецификация в JSON, как она отдаётся клиентам
+func Spec() []byte {
+	return specJSON
+}
+
+// Load разбирает встроенную спецификацию
+func Load() (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(specJSON, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi spec: %w", err)
+	}
+	return &doc, nil
+}
+
+// MustLoad разбирает встроенную спецификацию и паникует, если она некорректна.
+// Корректность встроенной спецификации проверяется тестами
+func MustLoad() *Document {
+	doc, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// Route метод и путь операции, путь в виде шаблона спецификации, например /api/user/keys/{id}
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Routes все операции спецификации
+func (d *Document) Routes() []Route {
+	var routes []Route
+	for path, item := range d.Paths {
+		for method := range item {
+			routes = append(routes, Route{Method: strings.ToUpper(method), Path: path})
+		}
+	}
+	return routes
+}
+
+// FindOperation ищет операцию по методу и пути запроса. Путь без параметров предпочтительнее шаблона с параметрами,
+// как и в роутере. Возвращает значения параметров пути
+func (d *Document) FindOperation(method string, path string) (*Operation, map[string]string, bool) {
+	var (
+		found      *Operation
+		foundVars  map[string]string
+		foundCount = -1
+	)
+	for template, item := range d.Paths {
+		op, ok := item[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+		vars, ok := matchPath(template, path)
+		if !ok {
+			continue
+		}
+		if found == nil || len(vars) < foundCount {
+			found, foundVars, foundCount = op, vars, len(vars)
+		}
+	}
+	return found, foundVars, found != nil
+}
+
+// matchPath сопоставляет путь запроса шаблону, параметр {name} соответствует одному непустому сегменту
+func matchPath(template string, path string) (map[string]string, bool) {
+	templateParts := strings.Split(strings.Trim(template, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(templateParts) != len(pathParts) {
+		return nil, false
+	}
+	vars := make(map[string]string)
+	for i, part := range templateParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			vars[part[1:len(part)-1]] = pathParts[i]
+			continue
+		}
+		if part != pathParts[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// ValidateResponse проверяет, что ответ на запрос описан в спецификации: статус, если он не покрыт ответом default,
+// тип содержимого и тело по схеме
+func (d *Document) ValidateResponse(method string, path string, status int, contentType string, body []byte) error {
+	op, _, ok := d.FindOperation(method, path)
+	if !ok {
+		return fmt.Errorf("%s %s: operation is not described", method, path)
+	}
+	resp, ok := op.Responses[fmt.Sprint(status)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("%s %s: status %d is not described", method, path, status)
+	}
+	resp = d.response(resp)
+	if len(resp.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s: status %d must have no body", method, path, status)
+		}
+		return nil
+	}
+	media, ok := resp.Content[mediaType(contentType)]
+	if !ok {
+		return fmt.Errorf("%s %s: content type %q is not described for status %d", method, path, contentType, status)
+	}
+
+	var errs []string
+	if mediaType(contentType) == "text/plain" {
+		errs = d.Validate(media.Schema, string(body), "body")
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var value any
+		if err := dec.Decode(&value); err != nil {
+			return fmt.Errorf("%s %s: body is not valid JSON: %w", method, path, err)
+		}
+		errs = d.Validate(media.Schema, value, "body")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s %s: %d: %s", method, path, status, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// parameters параметры операции с раскрытыми ссылками
+func (d *Document) parameters(op *Operation) []*Parameter {
+	params := make([]*Parameter, 0, len(op.Parameters))
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			if resolved, ok := d.Components.Parameters[refName(p.Ref)]; ok {
+				p = resolved
+			}
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+func (d *Document) response(resp *Response) *Response {
+	if resp.Ref != "" {
+		if resolved, ok := d.Components.Responses[refName(resp.Ref)]; ok {
+			return resolved
+		}
+	}
+	return resp
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// mediaType тип содержимого без параметров вроде charset
+func mediaType(contentType string) string {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// Handler отдаёт спецификацию в JSON
+func Handler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	_, err := w.Write(specJSON)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
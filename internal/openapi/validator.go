@@ -0,0 +1,165 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+)
+
+// Validator middleware проверяет параметры и тело запроса по спецификации и отвечает ошибкой validation_failed
+// со списком несоответствий. Запросы к путям и методам, которых нет в спецификации, пропускаются без проверки
+type Validator struct {
+	doc         *Document
+	maxBodySize int64
+}
+
+// NewValidator инициализирует Validator. Тело запроса больше maxBodySize не читается, 0 - без ограничения
+func NewValidator(doc *Document, maxBodySize int64) *Validator {
+	return &Validator{doc: doc, maxBodySize: maxBodySize}
+}
+
+// Handle для использования Validator в качестве Middleware
+func (v *Validator) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		op, pathVars, ok := v.doc.FindOperation(req.Method, req.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		errs := v.validateParameters(op, req, pathVars)
+		if op.RequestBody != nil {
+			body, err := v.readBody(req)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apierror.Write(w, req, apierror.Newf(apierror.CodePayloadTooLarge,
+					"Request body too large, limit is %d bytes", tooLarge.Limit).With("limit", tooLarge.Limit))
+				return
+			}
+			if err != nil {
+				apierror.WriteCode(w, req, apierror.CodeBadRequest, "Could not read body")
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			errs = append(errs, v.validateBody(op.RequestBody, req.Header.Get("Content-Type"), body)...)
+		}
+
+		if len(errs) > 0 {
+			apierror.Write(w, req, apierror.New(apierror.CodeValidation, "Request does not match the API specification").
+				With("errors", errs))
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (v *Validator) readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	if v.maxBodySize <= 0 {
+		return io.ReadAll(req.Body)
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, v.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > v.maxBodySize {
+		return nil, &http.MaxBytesError{Limit: v.maxBodySize}
+	}
+	return body, nil
+}
+
+func (v *Validator) validateParameters(op *Operation, req *http.Request, pathVars map[string]string) []string {
+	var errs []string
+	for _, param := range v.doc.parameters(op) {
+		var (
+			value   string
+			present bool
+		)
+		switch param.In {
+		case "path":
+			value, present = pathVars[param.Name]
+		case "query":
+			present = req.URL.Query().Has(param.Name)
+			value = req.URL.Query().Get(param.Name)
+		case "header":
+			value = req.Header.Get(param.Name)
+			present = value != ""
+		default:
+			continue
+		}
+		name := param.In + "." + param.Name
+		if !present {
+			if param.Required {
+				errs = append(errs, fmt.Sprintf("%s: is required", name))
+			}
+			continue
+		}
+		errs = append(errs, v.doc.Validate(param.Schema, parameterValue(param.Schema, value), name)...)
+	}
+	return errs
+}
+
+// parameterValue приводит строковое значение параметра к типу из схемы, чтобы проверить его как JSON-значение
+func parameterValue(schema *Schema, value string) any {
+	if schema == nil {
+		return value
+	}
+	switch schema.Type {
+	case "integer", "number":
+		return json.Number(value)
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+func (v *Validator) validateBody(body *RequestBody, contentType string, data []byte) []string {
+	if len(data) == 0 {
+		if body.Required {
+			return []string{"body: is required"}
+		}
+		return nil
+	}
+
+	contentType, ok := bodyContentType(body, contentType)
+	if !ok {
+		return []string{fmt.Sprintf("body: unsupported content type %q", contentType)}
+	}
+	schema := body.Content[contentType].Schema
+	if contentType == "text/plain" {
+		return v.doc.Validate(schema, string(data), "body")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return []string{"body: must be valid JSON"}
+	}
+	return v.doc.Validate(schema, value, "body")
+}
+
+// bodyContentType тип содержимого запроса из описанных в спецификации. Клиенты исторически не всегда передают
+// Content-Type, поэтому при единственном описанном типе тело проверяется по нему
+func bodyContentType(body *RequestBody, contentType string) (string, bool) {
+	contentType = mediaType(contentType)
+	if _, ok := body.Content[contentType]; ok {
+		return contentType, true
+	}
+	if len(body.Content) == 1 {
+		for described := range body.Content {
+			return described, true
+		}
+	}
+	return contentType, false
+}
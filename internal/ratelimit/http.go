@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/clientip"
+)
+
+// Middleware ограничивает запросы к маршруту лимитом действия Bucket.
+// Запросы авторизованного пользователя считаются по его id, остальные - по ip-адресу клиента
+type Middleware struct {
+	Limiter *Limiter
+	Bucket  string
+}
+
+// Handle для использования Middleware в цепочке обработчиков
+func (m Middleware) Handle(next http.Handler) http.Handler {
+	if m.Limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := m.Limiter.Allow(r.Context(), m.Bucket, RequestKey(r), 1)
+		if exceeded, ok := IsExceeded(err); ok {
+			WriteExceeded(w, r, exceeded)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestKey ключ ведра для запроса: id пользователя из сессии, хэш API-ключа, иначе ip-адрес.
+// Хранилище не используется, авторизацию полностью проверяет сам обработчик
+func RequestKey(r *http.Request) string {
+	if token, ok := auth.BearerToken(r); ok && auth.IsAPIKey(token) {
+		return APIKeyKey(auth.HashAPIKey(token))
+	}
+	if userID, ok := auth.UnverifiedUserID(r); ok {
+		return UserKey(userID)
+	}
+	return IPKey(clientip.FromRequest(r).String())
+}
+
+// WriteExceeded отвечает 429 с заголовком Retry-After
+func WriteExceeded(w http.ResponseWriter, r *http.Request, exceeded *ExceededError) {
+	w.Header().Set("Retry-After", strconv.Itoa(exceeded.RetryAfterSeconds()))
+	apierror.Write(w, r, apierror.New(apierror.CodeRateLimited, "Too many requests").
+		With("bucket", exceeded.Bucket).
+		With("retry_after", exceeded.RetryAfterSeconds()))
+}
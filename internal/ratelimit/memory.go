@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// idleBucketTTL ведро, к которому так долго не обращались, наверняка полное, и его можно забыть
+const idleBucketTTL = time.Hour
+
+type bucketState struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore хранит вёдра в памяти процесса. Лимиты не общие для реплик
+type MemoryStore struct {
+	lock      sync.Mutex
+	buckets   map[string]bucketState
+	lastSweep time.Time
+}
+
+// NewMemoryStore инициализирует MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]bucketState), lastSweep: time.Now()}
+}
+
+// UpdateBucket обновляет состояние ведра под блокировкой
+func (m *MemoryStore) UpdateBucket(ctx context.Context, key string, fn func(tokens float64, updated time.Time, found bool) (float64, time.Time)) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	state, found := m.buckets[key]
+	tokens, updated := fn(state.tokens, state.updated, found)
+	m.buckets[key] = bucketState{tokens: tokens, updated: updated}
+
+	if now := time.Now(); now.Sub(m.lastSweep) > idleBucketTTL {
+		for k, s := range m.buckets {
+			if now.Sub(s.updated) > idleBucketTTL {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	return nil
+}
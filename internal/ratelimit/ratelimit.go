@@ -0,0 +1,223 @@
+// Package ratelimit ограничивает частоту запросов алгоритмом token bucket.
+// Состояние вёдер хранится в памяти процесса либо в общей для всех реплик БД
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/wellywell/shorturl/internal/config"
+)
+
+// Ограничиваемые действия, для каждого задаётся свой лимит
+const (
+	// BucketShorten запросы на сокращение ссылок
+	BucketShorten = "shorten"
+	// BucketBatch количество ссылок в пакетных запросах
+	BucketBatch = "batch"
+	// BucketUsers создание анонимных пользователей
+	BucketUsers = "users"
+	// BucketRedirect переходы по коротким ссылкам
+	BucketRedirect = "redirect"
+)
+
+// Limit скорость пополнения ведра в токенах в секунду и его ёмкость
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit разбирает лимит вида "60/m" или "10/s:20", где после двоеточия - ёмкость ведра.
+// По умолчанию ёмкость равна количеству за период. Пустая строка означает отсутствие лимита
+func ParseLimit(value string) (Limit, bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Limit{}, false, nil
+	}
+	spec, burstStr, hasBurst := strings.Cut(value, ":")
+	countStr, unit, found := strings.Cut(spec, "/")
+	if !found {
+		return Limit{}, false, fmt.Errorf("bad rate limit %q", value)
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 1 {
+		return Limit{}, false, fmt.Errorf("bad rate limit %q", value)
+	}
+	var period time.Duration
+	switch unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return Limit{}, false, fmt.Errorf("bad rate limit unit in %q", value)
+	}
+	burst := count
+	if hasBurst {
+		burst, err = strconv.Atoi(burstStr)
+		if err != nil || burst < 1 {
+			return Limit{}, false, fmt.Errorf("bad rate limit burst in %q", value)
+		}
+	}
+	return Limit{Rate: float64(count) / period.Seconds(), Burst: burst}, true, nil
+}
+
+// ExceededError лимит исчерпан, повторить запрос можно через RetryAfter
+type ExceededError struct {
+	Bucket     string
+	RetryAfter time.Duration
+}
+
+// Error выводит текст ошибки
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("rate limit %s exceeded, retry after %s", e.Bucket, e.RetryAfter)
+}
+
+// RetryAfterSeconds значение для заголовка Retry-After, не меньше секунды
+func (e *ExceededError) RetryAfterSeconds() int {
+	return max(1, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// IsExceeded проверяет, что ошибка - исчерпанный лимит
+func IsExceeded(err error) (*ExceededError, bool) {
+	var exceeded *ExceededError
+	ok := errors.As(err, &exceeded)
+	return exceeded, ok
+}
+
+// Store хранилище состояния вёдер. UpdateBucket атомарно для данного ключа передаёт fn текущее
+// количество токенов и время последнего обновления (found false, если ведра ещё нет) и сохраняет то, что вернёт fn
+type Store interface {
+	UpdateBucket(ctx context.Context, key string, fn func(tokens float64, updated time.Time, found bool) (float64, time.Time)) error
+}
+
+// Limiter проверяет лимиты. Действия без заданного лимита не ограничиваются, nil Limiter не ограничивает ничего
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+	now    func() time.Time
+	logger *zap.SugaredLogger
+}
+
+// NewLimiter инициализирует Limiter
+func NewLimiter(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits, now: time.Now, logger: zap.NewNop().Sugar()}
+}
+
+// SetLogger задаёт логгер для ошибок хранилища лимитов
+func (l *Limiter) SetLogger(logger *zap.SugaredLogger) {
+	l.logger = logger
+}
+
+// RefillWindow за сколько пустое ведро с самым медленным лимитом наполняется полностью.
+// Ведро, не обновлявшееся дольше, полное и не отличается от отсутствующего
+func (l *Limiter) RefillWindow() time.Duration {
+	if l == nil {
+		return 0
+	}
+	var window time.Duration
+	for _, limit := range l.limits {
+		window = max(window, time.Duration(float64(limit.Burst)/limit.Rate*float64(time.Second)))
+	}
+	return window
+}
+
+// Allow списывает n токенов из ведра действия bucket для ключа key (id пользователя или ip-адреса).
+// Если токенов не хватает, ничего не списывается и возвращается ExceededError.
+// Ошибка хранилища только логируется: недоступность лимитов не должна останавливать сервис
+func (l *Limiter) Allow(ctx context.Context, bucket string, key string, n int) error {
+	if l == nil {
+		return nil
+	}
+	limit, ok := l.limits[bucket]
+	if !ok {
+		return nil
+	}
+	if n > limit.Burst {
+		// столько токенов в ведре не бывает, ждать бессмысленно
+		return &ExceededError{Bucket: bucket, RetryAfter: time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))}
+	}
+
+	now := l.now()
+	var exceeded *ExceededError
+	err := l.store.UpdateBucket(ctx, bucket+":"+key, func(tokens float64, updated time.Time, found bool) (float64, time.Time) {
+		exceeded = nil
+		if !found {
+			tokens = float64(limit.Burst)
+		} else if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+			tokens = math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+		}
+		if tokens < float64(n) {
+			wait := (float64(n) - tokens) / limit.Rate
+			exceeded = &ExceededError{Bucket: bucket, RetryAfter: time.Duration(wait * float64(time.Second))}
+			return tokens, now
+		}
+		return tokens - float64(n), now
+	})
+	if err != nil {
+		l.logger.Errorln("rate limit check failed", err)
+		return nil
+	}
+	if exceeded != nil {
+		return exceeded
+	}
+	return nil
+}
+
+// UserKey ключ ведра для пользователя
+func UserKey(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// APIKeyKey ключ ведра для API-ключа по его хэшу
+func APIKeyKey(hash string) string {
+	return "key:" + hash
+}
+
+// IPKey ключ ведра для ip-адреса
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// ErrNoSharedStore для хранения лимитов в postgres нужна база данных
+var ErrNoSharedStore = errors.New("rate limit store postgres requires database")
+
+// NewFromConfig инициализирует Limiter по конфигурации. shared - хранилище в БД, nil, если БД не используется
+func NewFromConfig(conf config.ServerConfig, shared Store) (*Limiter, error) {
+	limits := make(map[string]Limit)
+	for bucket, value := range map[string]string{
+		BucketShorten:  conf.RateLimitShorten,
+		BucketBatch:    conf.RateLimitBatch,
+		BucketUsers:    conf.RateLimitUsers,
+		BucketRedirect: conf.RateLimitRedirect,
+	} {
+		limit, ok, err := ParseLimit(value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			limits[bucket] = limit
+		}
+	}
+
+	switch conf.RateLimitStore {
+	case "", "memory":
+		return NewLimiter(NewMemoryStore(), limits), nil
+	case "postgres":
+		if shared == nil {
+			return nil, ErrNoSharedStore
+		}
+		return NewLimiter(shared, limits), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", conf.RateLimitStore)
+	}
+}
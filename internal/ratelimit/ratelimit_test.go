@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/auth"
+	"github.com/wellywell/shorturl/internal/config"
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantSet bool
+		wantErr bool
+	}{
+		{"", Limit{}, false, false},
+		{"60/m", Limit{Rate: 1, Burst: 60}, true, false},
+		{"10/s:20", Limit{Rate: 10, Burst: 20}, true, false},
+		{"3600/h", Limit{Rate: 1, Burst: 3600}, true, false},
+		{"10", Limit{}, false, true},
+		{"0/s", Limit{}, false, true},
+		{"10/d", Limit{}, false, true},
+		{"10/s:0", Limit{}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok, err := ParseLimit(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSet, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(NewMemoryStore(), map[string]Limit{BucketShorten: {Rate: 1, Burst: 2}})
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	assert.NoError(t, l.Allow(ctx, BucketShorten, "ip:1", 1))
+	assert.NoError(t, l.Allow(ctx, BucketShorten, "ip:1", 1))
+
+	err := l.Allow(ctx, BucketShorten, "ip:1", 1)
+	exceeded, ok := IsExceeded(err)
+	require.True(t, ok)
+	assert.Equal(t, time.Second, exceeded.RetryAfter)
+	assert.Equal(t, 1, exceeded.RetryAfterSeconds())
+
+	// у другого ключа своё ведро, действия без лимита не ограничиваются
+	assert.NoError(t, l.Allow(ctx, BucketShorten, "ip:2", 2))
+	assert.NoError(t, l.Allow(ctx, BucketRedirect, "ip:1", 100))
+
+	// ведро пополняется со временем, но не больше ёмкости
+	now = now.Add(time.Hour)
+	assert.NoError(t, l.Allow(ctx, BucketShorten, "ip:1", 2))
+	_, ok = IsExceeded(l.Allow(ctx, BucketShorten, "ip:1", 1))
+	assert.True(t, ok)
+
+	// больше ёмкости ведра не пройдёт никогда
+	_, ok = IsExceeded(l.Allow(ctx, BucketShorten, "ip:3", 3))
+	assert.True(t, ok)
+
+	var none *Limiter
+	assert.NoError(t, none.Allow(ctx, BucketShorten, "ip:1", 1))
+}
+
+func TestRefillWindow(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), map[string]Limit{
+		BucketShorten: {Rate: 1, Burst: 10},
+		BucketUsers:   {Rate: 1.0 / 60, Burst: 5},
+	})
+	assert.Equal(t, 5*time.Minute, l.RefillWindow())
+
+	var none *Limiter
+	assert.Zero(t, none.RefillWindow())
+}
+
+func TestMiddleware(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), map[string]Limit{BucketRedirect: {Rate: 1.0 / 60, Burst: 1}})
+	handler := Middleware{Limiter: l, Bucket: BucketRedirect}.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	}))
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusTemporaryRedirect, get("203.0.113.1:5000").Code)
+	w := get("203.0.113.1:5001")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTemporaryRedirect, get("203.0.113.2:5000").Code)
+}
+
+// countingStore считает обращения к хранилищу пользователей и ключей
+type countingStore struct {
+	calls int
+}
+
+func (s *countingStore) GetUser(ctx context.Context, userID int) (storage.User, error) {
+	s.calls++
+	return storage.User{ID: userID, Role: storage.RoleUser}, nil
+}
+
+func (s *countingStore) GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error) {
+	s.calls++
+	return storage.APIKey{UserID: 1}, nil
+}
+
+func (s *countingStore) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	s.calls++
+	return nil
+}
+
+func TestRequestKey(t *testing.T) {
+	st := &countingStore{}
+	auth.SetUserStore(st)
+	auth.SetKeyStore(st)
+	defer auth.SetUserStore(nil)
+	defer auth.SetKeyStore(nil)
+
+	token, err := auth.BuildJWTString(7)
+	require.NoError(t, err)
+	request := func(header string, cookie string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		r.RemoteAddr = "203.0.113.1:5000"
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "_user", Value: cookie})
+		}
+		return r
+	}
+
+	assert.Equal(t, UserKey(7), RequestKey(request("Bearer "+token, "")))
+	assert.Equal(t, UserKey(7), RequestKey(request("", token)))
+	assert.Equal(t, APIKeyKey(auth.HashAPIKey("sk_test")), RequestKey(request("Bearer sk_test", "")))
+	assert.Equal(t, IPKey("203.0.113.1"), RequestKey(request("", "broken")))
+	assert.Equal(t, IPKey("203.0.113.1"), RequestKey(request("", "")))
+
+	// авторизацию полностью проверяет обработчик, ключ ведра хранилище не трогает
+	assert.Zero(t, st.calls)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	l, err := NewFromConfig(config.ServerConfig{RateLimitShorten: "60/m", RateLimitStore: "memory"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Limit{BucketShorten: {Rate: 1, Burst: 60}}, l.limits)
+
+	_, err = NewFromConfig(config.ServerConfig{RateLimitStore: "postgres"}, nil)
+	assert.ErrorIs(t, err, ErrNoSharedStore)
+	_, err = NewFromConfig(config.ServerConfig{RateLimitStore: "redis"}, nil)
+	assert.Error(t, err)
+	_, err = NewFromConfig(config.ServerConfig{RateLimitRedirect: "fast"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/apierror"
+	"github.com/wellywell/shorturl/internal/config"
+	"github.com/wellywell/shorturl/internal/handlers/http/handlers"
+	"github.com/wellywell/shorturl/internal/openapi"
+	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
+)
+
+var contractConfig = config.ServerConfig{
+	BaseAddress:      "localhost:8080",
+	ShortURLsAddress: "http://localhost:8080",
+	MaxBodySize:      1 << 20,
+}
+
+func newContractServer() *Server {
+	st := storage.NewMemory()
+	urls := handlers.NewURLsHandler(st, tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig), contractConfig)
+	return NewServer(contractConfig, urls, handlers.NewAdminHandler(st, contractConfig), nil, apierror.Correlation{})
+}
+
+// TestRoutesMatchSpec каждый маршрут роутера описан в спецификации, и в спецификации нет лишних операций
+func TestRoutesMatchSpec(t *testing.T) {
+	var routes []openapi.Route
+	err := chi.Walk(newContractServer().Handler().(chi.Routes),
+		func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			routes = append(routes, openapi.Route{Method: method, Path: route})
+			return nil
+		})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, openapi.MustLoad().Routes(), routes)
+}
+
+// TestResponsesMatchSpec ответы хендлеров соответствуют схемам спецификации
+func TestResponsesMatchSpec(t *testing.T) {
+	doc := openapi.MustLoad()
+	handler := newContractServer().Handler()
+	var cookies []*http.Cookie
+
+	call := func(method string, target string, body string, wantCode int) []byte {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if strings.HasPrefix(body, "[") || strings.HasPrefix(body, "{") {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if set := w.Result().Cookies(); len(set) > 0 {
+			cookies = set
+		}
+
+		require.Equal(t, wantCode, w.Code, "%s %s: %s", method, target, w.Body.String())
+		assert.NoError(t, doc.ValidateResponse(method, r.URL.Path, w.Code, w.Header().Get("Content-Type"), w.Body.Bytes()))
+		return w.Body.Bytes()
+	}
+
+	call(http.MethodGet, "/api/openapi.json", "", http.StatusOK)
+	shortURL := string(call(http.MethodPost, "/", "http://contract.ru", http.StatusCreated))
+	call(http.MethodPost, "/api/shorten", `{"url": "http://contract.ru/json"}`, http.StatusCreated)
+	call(http.MethodPost, "/api/shorten", `{"link": "http://contract.ru/json"}`, http.StatusBadRequest)
+	call(http.MethodPost, "/api/shorten/batch", `[{"correlation_id": "1", "original_url": "http://contract.ru/batch"}]`, http.StatusCreated)
+	call(http.MethodPost, "/api/shorten/batch", `[]`, http.StatusNoContent)
+	call(http.MethodGet, "/api/user/urls", "", http.StatusOK)
+	call(http.MethodGet, shortURL[strings.LastIndex(shortURL, "/"):], "", http.StatusTemporaryRedirect)
+	call(http.MethodGet, "/missing", "", http.StatusNotFound)
+
+	var key struct {
+		ID int `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(call(http.MethodPost, "/api/user/keys", `{"name": "ci", "scopes": ["links:read"]}`, http.StatusCreated), &key))
+	call(http.MethodGet, "/api/user/keys", "", http.StatusOK)
+	call(http.MethodDelete, "/api/user/keys/"+strconv.Itoa(key.ID), "", http.StatusNoContent)
+	var job struct {
+		ID int `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(call(http.MethodDelete, "/api/user/urls", `["abc"]`, http.StatusAccepted), &job))
+	call(http.MethodGet, "/api/user/urls/deletions/"+strconv.Itoa(job.ID), "", http.StatusOK)
+	call(http.MethodGet, "/api/user/urls/deletions/"+strconv.Itoa(job.ID+1), "", http.StatusNotFound)
+	call(http.MethodDelete, "/api/user/urls?sync=true", `["abc"]`, http.StatusOK)
+
+	var link struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(call(http.MethodPost, "/api/v2/links", `{"original_url": "http://contract.ru/v2"}`, http.StatusCreated), &link))
+	call(http.MethodPost, "/api/v2/links", `{"original_url": ""}`, http.StatusBadRequest)
+	call(http.MethodGet, "/api/v2/links", "", http.StatusOK)
+	call(http.MethodGet, "/api/v2/links/"+link.ID, "", http.StatusOK)
+	call(http.MethodPatch, "/api/v2/links/"+link.ID, `{"expires_at": "2100-01-01T00:00:00Z"}`, http.StatusOK)
+	call(http.MethodPatch, "/api/v2/links/"+link.ID, `{"expires_at": null}`, http.StatusOK)
+	call(http.MethodGet, "/api/v2/links/missing", "", http.StatusNotFound)
+	call(http.MethodDelete, "/api/v2/links/"+link.ID, "", http.StatusAccepted)
+	call(http.MethodGet, "/api/internal/stats", "", http.StatusForbidden)
+	call(http.MethodGet, "/auth/login", "", http.StatusNotFound)
+}
@@ -2,26 +2,31 @@ package router
 
 import (
 	"fmt"
+	"net/http"
 
+	"github.com/wellywell/shorturl/internal/apierror"
 	"github.com/wellywell/shorturl/internal/compress"
 	"github.com/wellywell/shorturl/internal/config"
 	"github.com/wellywell/shorturl/internal/handlers/http/handlers"
 	"github.com/wellywell/shorturl/internal/logging"
 	"github.com/wellywell/shorturl/internal/storage"
+	"github.com/wellywell/shorturl/internal/tasks"
 )
 
 func Example() {
 
 	var mockConfig = config.ServerConfig{BaseAddress: "localhost:8080", ShortURLsAddress: "http://localhost:8080"}
 	st := storage.NewMemory()
-	handler := handlers.NewURLsHandler(st, make(chan storage.ToDelete), mockConfig)
+	handler := handlers.NewURLsHandler(st, tasks.NewDeleteQueue(st, tasks.DefaultDeleteQueueConfig), mockConfig)
 
 	logger, _ := logging.NewLogger()
 
-	r := NewServer(mockConfig, handler, logger, compress.RequestUngzipper{}, compress.ResponseGzipper{})
+	admin := handlers.NewAdminHandler(st, mockConfig)
+
+	r := NewServer(mockConfig, handler, admin, nil, apierror.Correlation{}, logger, compress.RequestUngzipper{}, compress.ResponseGzipper{})
 
 	go func() {
-		err := r.ListenAndServe()
+		err := http.ListenAndServe(mockConfig.BaseAddress, r.Handler())
 		if err != nil {
 			fmt.Println(err)
 		}
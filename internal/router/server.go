@@ -3,13 +3,15 @@
 package router
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/wellywell/shorturl/internal/auth"
 	"github.com/wellywell/shorturl/internal/config"
+	"github.com/wellywell/shorturl/internal/openapi"
+	"github.com/wellywell/shorturl/internal/ratelimit"
+	"github.com/wellywell/shorturl/internal/storage"
 )
 
 // URLsHandlers интерфейс для работы с хендлерами
@@ -21,7 +23,33 @@ type URLsHandlers interface {
 	HandleShortenBatch(w http.ResponseWriter, req *http.Request)
 	HandleUserURLS(w http.ResponseWriter, req *http.Request)
 	HandleDeleteUserURLS(w http.ResponseWriter, req *http.Request)
+	HandleDeleteJob(w http.ResponseWriter, req *http.Request)
 	HandleGetStats(w http.ResponseWriter, req *http.Request)
+	HandleCreateAPIKey(w http.ResponseWriter, req *http.Request)
+	HandleUserAPIKeys(w http.ResponseWriter, req *http.Request)
+	HandleRevokeAPIKey(w http.ResponseWriter, req *http.Request)
+	HandleOIDCLogin(w http.ResponseWriter, req *http.Request)
+	HandleOIDCCallback(w http.ResponseWriter, req *http.Request)
+	HandleCreateLink(w http.ResponseWriter, req *http.Request)
+	HandleLinks(w http.ResponseWriter, req *http.Request)
+	HandleLink(w http.ResponseWriter, req *http.Request)
+	HandleUpdateLink(w http.ResponseWriter, req *http.Request)
+	HandleDeleteLink(w http.ResponseWriter, req *http.Request)
+	Idempotent(next http.Handler) http.Handler
+}
+
+// AdminHandlers интерфейс для работы с хендлерами API администратора
+type AdminHandlers interface {
+	HandleRecentLinks(w http.ResponseWriter, req *http.Request)
+	HandleGetLink(w http.ResponseWriter, req *http.Request)
+	HandleDeleteLink(w http.ResponseWriter, req *http.Request)
+	HandleDisableLink(w http.ResponseWriter, req *http.Request)
+	HandleEnableLink(w http.ResponseWriter, req *http.Request)
+	HandleBlockUser(w http.ResponseWriter, req *http.Request)
+	HandleUnblockUser(w http.ResponseWriter, req *http.Request)
+	HandleEraseUser(w http.ResponseWriter, req *http.Request)
+	HandleAudit(w http.ResponseWriter, req *http.Request)
+	HandleJobRuns(w http.ResponseWriter, req *http.Request)
 }
 
 // Middleware - интерфейс, которому должны соответствовать используемые Middleware
@@ -31,45 +59,69 @@ type Middleware interface {
 
 // Router - объект роутера
 type Server struct {
-	server http.Server
-	config config.ServerConfig
+	handler http.Handler
 }
 
-// NewRouter инициализирует Router, прописывает пути, на которых сервер будет слушать
-func NewServer(config config.ServerConfig, handlers URLsHandlers, middlewares ...Middleware) *Server {
+// NewRouter инициализирует Router, прописывает пути, на которых сервер будет слушать.
+// Запросы проверяются по спецификации OpenAPI, сама спецификация отдаётся на /api/openapi.json.
+// Если admin не nil, подключается API администратора. Если limiter не nil, ограничивается частота сокращений и переходов
+func NewServer(config config.ServerConfig, handlers URLsHandlers, admin AdminHandlers, limiter *ratelimit.Limiter, middlewares ...Middleware) *Server {
 
 	r := chi.NewRouter()
 
 	for _, m := range middlewares {
 		r.Use(m.Handle)
 	}
+	r.Use(openapi.NewValidator(openapi.MustLoad(), config.MaxBodySize).Handle)
 
-	r.Post("/", handlers.HandleCreateShortURL)
-	r.Get("/{id}", handlers.HandleGetFullURL)
-	r.Post("/api/shorten", handlers.HandleShortenURLJSON)
+	csrf := auth.NewCSRFProtector(config).Handle
+	shortenLimit := ratelimit.Middleware{Limiter: limiter, Bucket: ratelimit.BucketShorten}.Handle
+	redirectLimit := ratelimit.Middleware{Limiter: limiter, Bucket: ratelimit.BucketRedirect}.Handle
+
+	r.With(csrf, shortenLimit, handlers.Idempotent).Post("/", handlers.HandleCreateShortURL)
+	r.With(redirectLimit).Get("/{id}", handlers.HandleGetFullURL)
+	r.With(csrf, shortenLimit, handlers.Idempotent).Post("/api/shorten", handlers.HandleShortenURLJSON)
 	r.Get("/ping", handlers.HandlePing)
-	r.Post("/api/shorten/batch", handlers.HandleShortenBatch)
-	r.Get("/api/user/urls", handlers.HandleUserURLS)
-	r.Delete("/api/user/urls", handlers.HandleDeleteUserURLS)
+	r.Get("/api/openapi.json", openapi.Handler)
+	r.With(csrf, shortenLimit, handlers.Idempotent).Post("/api/shorten/batch", handlers.HandleShortenBatch)
+	r.With(csrf).Get("/api/user/urls", handlers.HandleUserURLS)
+	r.With(csrf).Delete("/api/user/urls", handlers.HandleDeleteUserURLS)
+	r.With(csrf).Get("/api/user/urls/deletions/{job}", handlers.HandleDeleteJob)
+	r.With(csrf).Post("/api/user/keys", handlers.HandleCreateAPIKey)
+	r.With(csrf).Get("/api/user/keys", handlers.HandleUserAPIKeys)
+	r.With(csrf).Delete("/api/user/keys/{id}", handlers.HandleRevokeAPIKey)
+	r.Get("/auth/login", handlers.HandleOIDCLogin)
+	r.Get("/auth/callback", handlers.HandleOIDCCallback)
 
-	r.With(auth.SubnetChecker{Trusted: config.Trusted}.Handle).Get("/api/internal/stats", handlers.HandleGetStats)
+	r.With(csrf, shortenLimit, handlers.Idempotent).Post("/api/v2/links", handlers.HandleCreateLink)
+	r.With(csrf).Get("/api/v2/links", handlers.HandleLinks)
+	r.With(csrf).Get("/api/v2/links/{id}", handlers.HandleLink)
+	r.With(csrf).Patch("/api/v2/links/{id}", handlers.HandleUpdateLink)
+	r.With(csrf).Delete("/api/v2/links/{id}", handlers.HandleDeleteLink)
 
-	return &Server{server: http.Server{Addr: config.BaseAddress, Handler: r}, config: config}
-}
+	r.With(auth.SubnetChecker{Trusted: config.Trusted}.Handle).Get("/api/internal/stats", handlers.HandleGetStats)
 
-// ListenAndServe - метод для запуска сервера
-func (s *Server) ListenAndServe() error {
-	var err error
-	if s.config.EnableHTTPS {
-		err = s.server.ListenAndServeTLS("server.rsa.crt", "server.rsa.key")
-	} else {
-		err = s.server.ListenAndServe()
+	if admin != nil {
+		r.Route("/api/admin", func(r chi.Router) {
+			r.Use(auth.SubnetChecker{Trusted: config.Trusted}.Handle, auth.RoleChecker{Role: storage.RoleAdmin}.Handle, csrf)
 
+			r.Get("/links", admin.HandleRecentLinks)
+			r.Get("/links/{id}", admin.HandleGetLink)
+			r.Delete("/links/{id}", admin.HandleDeleteLink)
+			r.Post("/links/{id}/disable", admin.HandleDisableLink)
+			r.Post("/links/{id}/enable", admin.HandleEnableLink)
+			r.Post("/users/{id}/block", admin.HandleBlockUser)
+			r.Post("/users/{id}/unblock", admin.HandleUnblockUser)
+			r.Delete("/users/{id}", admin.HandleEraseUser)
+			r.Get("/audit", admin.HandleAudit)
+			r.Get("/jobs/runs", admin.HandleJobRuns)
+		})
 	}
-	return err
+
+	return &Server{handler: r}
 }
 
-// Shutdown gracefull shutddown
-func (s *Server) Shutdown(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+// Handler обработчик запросов со всеми маршрутами и middleware, для запуска на своём http.Server
+func (s *Server) Handler() http.Handler {
+	return s.handler
 }
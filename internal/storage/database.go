@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
@@ -41,10 +43,132 @@ func NewDatabase(connString string) (*Database, error) {
 	if err != nil {
 		return nil, err
 	}
+	_, err = p.Exec(ctx, "ALTER TABLE link ADD COLUMN IF NOT EXISTS is_disabled bool default false, ADD COLUMN IF NOT EXISTS created_at timestamptz default now()")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "ALTER TABLE link ADD COLUMN IF NOT EXISTS expires_at timestamptz")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS link_created_indx ON link(created_at)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS link_user_short_indx ON link(user_id, short_link)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "ALTER TABLE link ADD COLUMN IF NOT EXISTS deleted_at timestamptz")
+	if err != nil {
+		return nil, err
+	}
+	// у ссылок, удалённых до появления срока хранения, время удаления отсчитывается от миграции
+	_, err = p.Exec(ctx, "UPDATE link SET deleted_at = now() WHERE is_deleted AND deleted_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS link_deleted_indx ON link(deleted_at) WHERE is_deleted")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS link_expires_indx ON link(expires_at) WHERE expires_at IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE TABLE IF NOT EXISTS link_tombstone (short_link text primary key, created_at timestamptz default now())")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE TABLE IF NOT EXISTS erased_user (id bigint primary key, erased_at timestamptz default now())")
+	if err != nil {
+		return nil, err
+	}
 	_, err = p.Exec(ctx, "CREATE TABLE IF NOT EXISTS auth_user (id bigserial)")
 	if err != nil {
 		return nil, err
 	}
+	_, err = p.Exec(ctx, "ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS role text default 'user', ADD COLUMN IF NOT EXISTS is_blocked bool default false")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, `CREATE TABLE IF NOT EXISTS audit_log (
+		id bigserial, created_at timestamptz default now(), actor_id int, action text, target text, details text)`)
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS oidc_issuer text, ADD COLUMN IF NOT EXISTS oidc_subject text")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS auth_user_oidc_indx ON auth_user(oidc_issuer, oidc_subject)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, `CREATE TABLE IF NOT EXISTS api_key (
+		id bigserial, user_id int, name text, prefix text, key_hash text, scopes text[],
+		created_at timestamptz default now(), last_used_at timestamptz, revoked_at timestamptz)`)
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS api_key_hash_indx ON api_key(key_hash)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS api_key_user_indx ON api_key(user_id)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, `CREATE TABLE IF NOT EXISTS idempotency_key (
+		user_id int, key text, request_hash text, completed bool default false, status int default 0,
+		content_type text default '', body bytea, created_at timestamptz, PRIMARY KEY (user_id, key))`)
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS idempotency_key_created_indx ON idempotency_key(created_at)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "ALTER TABLE idempotency_key ADD COLUMN IF NOT EXISTS location text default ''")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE TABLE IF NOT EXISTS rate_limit_bucket (key text primary key, tokens double precision, updated_at timestamptz)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS rate_limit_bucket_updated_indx ON rate_limit_bucket(updated_at)")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, `CREATE TABLE IF NOT EXISTS delete_job (
+		id bigserial primary key, user_id int, short_urls text[], status text default 'pending', attempts int default 0,
+		created_at timestamptz default now(), locked_until timestamptz, done_at timestamptz)`)
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "DROP INDEX IF EXISTS delete_job_active_indx")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS delete_job_claimable_indx ON delete_job(id) WHERE status IN ('pending', 'running')")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "CREATE INDEX IF NOT EXISTS delete_job_finished_indx ON delete_job(done_at) WHERE status IN ('done', 'failed')")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, "ALTER TABLE delete_job ADD COLUMN IF NOT EXISTS results jsonb default '[]'")
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.Exec(ctx, `CREATE TABLE IF NOT EXISTS job_run (
+		id bigserial primary key, job text, replica text, status text, error text default '',
+		started_at timestamptz, finished_at timestamptz)`)
+	if err != nil {
+		return nil, err
+	}
 	return &Database{
 		pool: p,
 	}, nil
@@ -53,11 +177,16 @@ func NewDatabase(connString string) (*Database, error) {
 
 // Put записывает полную ссылку по ключу key в БД
 func (d *Database) Put(ctx context.Context, key string, val string, user int) error {
+	return d.PutLink(ctx, key, val, user, nil)
+}
+
+// PutLink записывает полную ссылку по ключу key в БД сразу со сроком действия, nil - без срока
+func (d *Database) PutLink(ctx context.Context, key string, val string, user int, expiresAt *time.Time) error {
 
 	query := `
 		WITH inserted AS
-			(INSERT INTO link (short_link, full_link, user_id)
-			 VALUES ($1, $2, $3)
+			(INSERT INTO link (short_link, full_link, user_id, expires_at)
+			 SELECT $1, $2, $3, $4 WHERE NOT EXISTS (SELECT 1 FROM link_tombstone WHERE short_link = $1)
 			 ON CONFLICT(full_link) DO NOTHING
 			 RETURNING short_link)
 		SELECT COALESCE (
@@ -65,9 +194,9 @@ func (d *Database) Put(ctx context.Context, key string, val string, user int) er
 			(SELECT short_link FROM link WHERE full_link = $2)
 		)`
 
-	row := d.pool.QueryRow(ctx, query, key, val, user)
+	row := d.pool.QueryRow(ctx, query, key, val, user, expiresAt)
 
-	var shortURL string
+	var shortURL *string
 	if err := row.Scan(&shortURL); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
@@ -75,45 +204,94 @@ func (d *Database) Put(ctx context.Context, key string, val string, user int) er
 		}
 		return err
 	}
+	// ничего не вставлено и полной ссылки нет - ключ занят стёртой ссылкой
+	if shortURL == nil {
+		return fmt.Errorf("%w", &KeyExistsError{Key: key})
+	}
 	// if shortURL returned by DB differes from key, handle dublicate full_link
-	if shortURL != key {
-		return fmt.Errorf("%w", &ValueExistsError{Value: val, ExistingKey: shortURL})
+	if *shortURL != key {
+		return fmt.Errorf("%w", &ValueExistsError{Value: val, ExistingKey: *shortURL})
 	}
 	return nil
 }
 
-// PutBatch записывает в БД несколько записей о ссылках за раз
+// PutBatch записывает в БД несколько записей о ссылках за раз. Если хотя бы один ключ занят,
+// не записывается ни одна
 func (d *Database) PutBatch(ctx context.Context, records ...URLRecord) error {
-	batch := &pgx.Batch{}
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
+	batch := &pgx.Batch{}
 	for _, rec := range records {
-		batch.Queue("INSERT INTO link (short_link, full_link, user_id) VALUES ($1, $2, $3)", rec.ShortURL, rec.FullURL, rec.UserID)
+		batch.Queue(`
+			INSERT INTO link (short_link, full_link, user_id)
+			SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM link_tombstone WHERE short_link = $1)`,
+			rec.ShortURL, rec.FullURL, rec.UserID)
 	}
-	br := d.pool.SendBatch(ctx, batch)
-	return br.Close()
+	br := tx.SendBatch(ctx, batch)
+	for _, rec := range records {
+		tag, err := br.Exec()
+		if err != nil {
+			br.Close()
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			br.Close()
+			return fmt.Errorf("%w", &KeyExistsError{Key: rec.ShortURL})
+		}
+	}
+	if err := br.Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// DeleteBatch помечает как удаленные ссылки
-func (d *Database) DeleteBatch(ctx context.Context, records ...ToDelete) error {
+// DeleteBatch помечает как удаленные ссылки и возвращает результаты в порядке records
+func (d *Database) DeleteBatch(ctx context.Context, records ...ToDelete) ([]DeleteResult, error) {
+	// link видит ссылку такой, какой она была до обновления
+	query := `
+		WITH updated AS
+			(UPDATE link SET is_deleted = true, deleted_at = COALESCE(deleted_at, now())
+			 WHERE short_link = $1 AND user_id = $2 AND NOT is_deleted
+			 RETURNING short_link)
+		SELECT CASE
+			WHEN EXISTS (SELECT 1 FROM updated) THEN 'deleted'
+			WHEN NOT EXISTS (SELECT 1 FROM link WHERE short_link = $1) THEN 'not_found'
+			WHEN EXISTS (SELECT 1 FROM link WHERE short_link = $1 AND user_id = $2) THEN 'already_deleted'
+			ELSE 'not_owner'
+		END`
 	batch := &pgx.Batch{}
-
 	for _, rec := range records {
-		batch.Queue("UPDATE link set is_deleted = true WHERE short_link = $1 AND user_id = $2", rec.ShortURL, rec.UserID)
+		batch.Queue(query, rec.ShortURL, rec.UserID)
 	}
 	br := d.pool.SendBatch(ctx, batch)
-	return br.Close()
+	defer br.Close()
+
+	results := make([]DeleteResult, len(records))
+	for i, rec := range records {
+		results[i].ShortURL = rec.ShortURL
+		if err := br.QueryRow().Scan(&results[i].Status); err != nil {
+			return nil, err
+		}
+	}
+	return results, br.Close()
 }
 
 // Get достаёт из БД ссылку по ключу
 func (d *Database) Get(ctx context.Context, key string) (string, error) {
-	row := d.pool.QueryRow(ctx, "SELECT full_link, is_deleted FROM link WHERE short_link = $1", key)
+	row := d.pool.QueryRow(ctx, "SELECT full_link, is_deleted, is_disabled, expires_at FROM link WHERE short_link = $1", key)
 
 	var URL string
 	var isDeleted bool
+	var isDisabled bool
+	var expiresAt *time.Time
 
-	err := row.Scan(&URL, &isDeleted)
+	err := row.Scan(&URL, &isDeleted, &isDisabled, &expiresAt)
 	if err != nil && errors.Is(err, pgx.ErrNoRows) {
-		return "", fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+		return "", d.missingLinkError(ctx, key)
 	}
 	if err != nil {
 		return "", err
@@ -122,10 +300,29 @@ func (d *Database) Get(ctx context.Context, key string) (string, error) {
 	if isDeleted {
 		return "", fmt.Errorf("%w", &RecordIsDeleted{Key: key})
 	}
+	if isDisabled {
+		return "", fmt.Errorf("%w", &RecordIsDisabled{Key: key})
+	}
+	if (LinkInfo{ExpiresAt: expiresAt}).IsExpired(time.Now()) {
+		return "", fmt.Errorf("%w", &RecordIsExpired{Key: key})
+	}
 
 	return URL, nil
 }
 
+// missingLinkError отличает стёртую ссылку от никогда не существовавшей
+func (d *Database) missingLinkError(ctx context.Context, key string) error {
+	var purged bool
+	row := d.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM link_tombstone WHERE short_link = $1)", key)
+	if err := row.Scan(&purged); err != nil {
+		return err
+	}
+	if purged {
+		return fmt.Errorf("%w", &RecordIsDeleted{Key: key})
+	}
+	return fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+}
+
 // CreateNewUser создаёт нового пользователя и возвращает его id
 func (d *Database) CreateNewUser(ctx context.Context) (int, error) {
 	row := d.pool.QueryRow(ctx, "INSERT INTO auth_user DEFAULT VALUES RETURNING id")
@@ -138,6 +335,34 @@ func (d *Database) CreateNewUser(ctx context.Context) (int, error) {
 	return userID, nil
 }
 
+// GetUserByIdentity ищет пользователя, привязанного к внешней учётной записи
+func (d *Database) GetUserByIdentity(ctx context.Context, issuer string, subject string) (int, error) {
+	row := d.pool.QueryRow(ctx, "SELECT id FROM auth_user WHERE oidc_issuer = $1 AND oidc_subject = $2", issuer, subject)
+
+	var userID int
+	err := row.Scan(&userID)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w", &KeyNotFoundError{Key: subject})
+	}
+	return userID, err
+}
+
+// GetOrCreateUserByIdentity возвращает пользователя, привязанного к внешней учётной записи,
+// и создаёт нового, если привязки ещё нет
+func (d *Database) GetOrCreateUserByIdentity(ctx context.Context, issuer string, subject string) (int, error) {
+	// DO UPDATE нужен, чтобы RETURNING вернул id и для уже существующей строки
+	row := d.pool.QueryRow(ctx, `INSERT INTO auth_user (oidc_issuer, oidc_subject) VALUES ($1, $2)
+		ON CONFLICT (oidc_issuer, oidc_subject) DO UPDATE SET oidc_subject = EXCLUDED.oidc_subject
+		RETURNING id`, issuer, subject)
+
+	var userID int
+	err := row.Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
 // GetUserURLS получает список ссылок, созданных данным польззователем
 func (d *Database) GetUserURLS(ctx context.Context, userID int) ([]URLRecord, error) {
 	rows, err := d.pool.Query(ctx, "SELECT short_link, full_link, user_id, is_deleted FROM link WHERE user_id = $1", userID)
@@ -152,6 +377,23 @@ func (d *Database) GetUserURLS(ctx context.Context, userID int) ([]URLRecord, er
 	return numbers, nil
 }
 
+// GetUserURLSPage получает не более limit ссылок пользователя с ключами больше after, по возрастанию ключа
+func (d *Database) GetUserURLSPage(ctx context.Context, userID int, after string, limit int) ([]URLRecord, error) {
+	rows, err := d.pool.Query(ctx, `
+		SELECT short_link, full_link, user_id, is_deleted FROM link
+		WHERE user_id = $1 AND short_link > $2
+		ORDER BY short_link LIMIT $3`, userID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed collecting rows %w", err)
+	}
+
+	urls, err := pgx.CollectRows(rows, pgx.RowToStructByName[URLRecord])
+	if err != nil {
+		return nil, fmt.Errorf("failed unpacking rows %w", err)
+	}
+	return urls, nil
+}
+
 // CountURLs возвращает количество сохранённых ссылок
 func (d *Database) CountURLs(ctx context.Context) (int, error) {
 	row := d.pool.QueryRow(ctx, "SELECT count(*) FROM auth_user")
@@ -178,6 +420,566 @@ func (d *Database) CountUsers(ctx context.Context) (int, error) {
 	return count, nil
 }
 
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, created_at, last_used_at, revoked_at"
+
+// CreateAPIKey сохраняет новый API-ключ
+func (d *Database) CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error) {
+	row := d.pool.QueryRow(ctx,
+		"INSERT INTO api_key (user_id, name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		key.UserID, key.Name, key.Prefix, key.Hash, key.Scopes)
+
+	if err := row.Scan(&key.ID, &key.CreatedAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
+			return APIKey{}, fmt.Errorf("%w", &KeyExistsError{Key: key.Prefix})
+		}
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// GetAPIKey ищет ключ по хэшу
+func (d *Database) GetAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	rows, err := d.pool.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_key WHERE key_hash = $1", hash)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[APIKey])
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, fmt.Errorf("%w", &KeyNotFoundError{Key: "api key"})
+	}
+	return key, err
+}
+
+// GetUserAPIKeys возвращает все ключи пользователя, включая отозванные
+func (d *Database) GetUserAPIKeys(ctx context.Context, userID int) ([]APIKey, error) {
+	rows, err := d.pool.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_key WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed collecting rows %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowToStructByName[APIKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed unpacking rows %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ пользователя
+func (d *Database) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+	tag, err := d.pool.Exec(ctx,
+		"UPDATE api_key SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1 AND user_id = $2", keyID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(keyID)})
+	}
+	return nil
+}
+
+// TouchAPIKey обновляет время последнего использования ключа
+func (d *Database) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	_, err := d.pool.Exec(ctx, "UPDATE api_key SET last_used_at = $1 WHERE id = $2", usedAt, keyID)
+	return err
+}
+
+// GetUser возвращает пользователя
+func (d *Database) GetUser(ctx context.Context, userID int) (User, error) {
+	rows, err := d.pool.Query(ctx, "SELECT id, COALESCE(role, 'user') AS role, COALESCE(is_blocked, false) AS is_blocked FROM auth_user WHERE id = $1", userID)
+	if err != nil {
+		return User{}, err
+	}
+	user, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[User])
+	if err == nil || !errors.Is(err, pgx.ErrNoRows) {
+		return user, err
+	}
+	var erased bool
+	if err := d.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM erased_user WHERE id = $1)", userID).Scan(&erased); err != nil {
+		return User{}, err
+	}
+	if erased {
+		return User{}, fmt.Errorf("%w", &UserIsErased{Key: strconv.Itoa(userID)})
+	}
+	return User{}, fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(userID)})
+}
+
+// SetUserRole задаёт роль пользователя
+func (d *Database) SetUserRole(ctx context.Context, userID int, role string) error {
+	return d.updateUser(ctx, "UPDATE auth_user SET role = $1 WHERE id = $2", role, userID)
+}
+
+// SetUserBlocked блокирует либо разблокирует пользователя
+func (d *Database) SetUserBlocked(ctx context.Context, userID int, blocked bool) error {
+	return d.updateUser(ctx, "UPDATE auth_user SET is_blocked = $1 WHERE id = $2", blocked, userID)
+}
+
+func (d *Database) updateUser(ctx context.Context, query string, value any, userID int) error {
+	tag, err := d.pool.Exec(ctx, query, value, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(userID)})
+	}
+	return nil
+}
+
+const linkColumns = "short_link, full_link, user_id, is_deleted, is_disabled, created_at, expires_at, deleted_at"
+
+// GetLink возвращает полную информацию о ссылке, в том числе удалённой или отключённой
+func (d *Database) GetLink(ctx context.Context, key string) (LinkInfo, error) {
+	rows, err := d.pool.Query(ctx, "SELECT "+linkColumns+" FROM link WHERE short_link = $1", key)
+	if err != nil {
+		return LinkInfo{}, err
+	}
+	link, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[LinkInfo])
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return LinkInfo{}, fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+	}
+	return link, err
+}
+
+// SetLinkDisabled отключает либо включает ссылку
+func (d *Database) SetLinkDisabled(ctx context.Context, key string, disabled bool) error {
+	return d.updateLink(ctx, "UPDATE link SET is_disabled = $1 WHERE short_link = $2", disabled, key)
+}
+
+// ForceDeleteLink удаляет ссылку независимо от владельца
+func (d *Database) ForceDeleteLink(ctx context.Context, key string) error {
+	return d.updateLink(ctx, "UPDATE link SET is_deleted = $1, deleted_at = COALESCE(deleted_at, now()) WHERE short_link = $2", true, key)
+}
+
+func (d *Database) updateLink(ctx context.Context, query string, value any, key string) error {
+	tag, err := d.pool.Exec(ctx, query, value, key)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+	}
+	return nil
+}
+
+// GetRecentLinks возвращает последние созданные ссылки, от новых к старым
+func (d *Database) GetRecentLinks(ctx context.Context, limit int) ([]LinkInfo, error) {
+	rows, err := d.pool.Query(ctx, "SELECT "+linkColumns+" FROM link ORDER BY created_at DESC, id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed collecting rows %w", err)
+	}
+	links, err := pgx.CollectRows(rows, pgx.RowToStructByName[LinkInfo])
+	if err != nil {
+		return nil, fmt.Errorf("failed unpacking rows %w", err)
+	}
+	return links, nil
+}
+
+// GetUserLinks возвращает ссылки пользователя со всеми атрибутами, от новых к старым
+func (d *Database) GetUserLinks(ctx context.Context, userID int) ([]LinkInfo, error) {
+	rows, err := d.pool.Query(ctx, "SELECT "+linkColumns+" FROM link WHERE user_id = $1 ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed collecting rows %w", err)
+	}
+	links, err := pgx.CollectRows(rows, pgx.RowToStructByName[LinkInfo])
+	if err != nil {
+		return nil, fmt.Errorf("failed unpacking rows %w", err)
+	}
+	return links, nil
+}
+
+// UpdateLink изменяет ссылку пользователя. Чужая ссылка считается ненайденной, удалённую изменить нельзя
+func (d *Database) UpdateLink(ctx context.Context, key string, userID int, update LinkUpdate) (LinkInfo, error) {
+	query := `
+		UPDATE link SET
+			full_link = COALESCE($3::text, full_link),
+			expires_at = CASE WHEN $4 THEN NULL ELSE COALESCE($5::timestamptz, expires_at) END
+		WHERE short_link = $1 AND user_id = $2 AND NOT is_deleted
+		RETURNING ` + linkColumns
+
+	rows, err := d.pool.Query(ctx, query, key, userID, update.FullURL, update.ClearExpiresAt, update.ExpiresAt)
+	if err != nil {
+		return LinkInfo{}, err
+	}
+	link, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[LinkInfo])
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation:
+		return LinkInfo{}, fmt.Errorf("%w", &ValueExistsError{Value: *update.FullURL})
+	case errors.Is(err, pgx.ErrNoRows):
+		existing, getErr := d.GetLink(ctx, key)
+		if getErr == nil && existing.UserID == userID && existing.IsDeleted {
+			return LinkInfo{}, fmt.Errorf("%w", &RecordIsDeleted{Key: key})
+		}
+		return LinkInfo{}, fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+	}
+	return link, err
+}
+
+// AddAuditRecord добавляет запись в журнал аудита
+func (d *Database) AddAuditRecord(ctx context.Context, record AuditRecord) (AuditRecord, error) {
+	row := d.pool.QueryRow(ctx,
+		"INSERT INTO audit_log (actor_id, action, target, details) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		record.ActorID, record.Action, record.Target, record.Details)
+	if err := row.Scan(&record.ID, &record.CreatedAt); err != nil {
+		return AuditRecord{}, err
+	}
+	return record, nil
+}
+
+// GetAuditRecords возвращает последние записи журнала аудита, от новых к старым
+func (d *Database) GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	rows, err := d.pool.Query(ctx,
+		"SELECT id, created_at, actor_id, action, target, details FROM audit_log ORDER BY id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed collecting rows %w", err)
+	}
+	records, err := pgx.CollectRows(rows, pgx.RowToStructByName[AuditRecord])
+	if err != nil {
+		return nil, fmt.Errorf("failed unpacking rows %w", err)
+	}
+	return records, nil
+}
+
+// ReserveIdempotencyKey сохраняет record, если для пользователя ещё нет записи с таким ключом,
+// либо она создана раньше expiredBefore, либо не завершена и создана раньше staleBefore.
+// Иначе возвращает существующую запись и false
+func (d *Database) ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, expiredBefore time.Time, staleBefore time.Time) (IdempotencyRecord, bool, error) {
+	query := `
+		INSERT INTO idempotency_key (user_id, key, request_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+			SET request_hash = EXCLUDED.request_hash, completed = false, status = 0, content_type = '',
+				location = '', body = NULL, created_at = EXCLUDED.created_at
+			WHERE idempotency_key.created_at < $5 OR (NOT idempotency_key.completed AND idempotency_key.created_at < $6)`
+
+	tag, err := d.pool.Exec(ctx, query, record.UserID, record.Key, record.RequestHash, record.CreatedAt, expiredBefore, staleBefore)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	if tag.RowsAffected() > 0 {
+		return record, true, nil
+	}
+
+	query = `
+		SELECT user_id, key, request_hash, completed, status, content_type, location, body, created_at
+		FROM idempotency_key WHERE user_id = $1 AND key = $2`
+	rows, err := d.pool.Query(ctx, query, record.UserID, record.Key)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	existing, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[IdempotencyRecord])
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	return existing, false, nil
+}
+
+// CompleteIdempotencyKey сохраняет в зарезервированной записи ответ: Status, ContentType, Location и Body
+func (d *Database) CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error {
+	query := `
+		UPDATE idempotency_key SET completed = true, status = $1, content_type = $2, location = $3, body = $4
+		WHERE user_id = $5 AND key = $6`
+	tag, err := d.pool.Exec(ctx, query, record.Status, record.ContentType, record.Location, record.Body, record.UserID, record.Key)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: record.Key})
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys удаляет записи, созданные раньше expiredBefore, и возвращает их количество
+func (d *Database) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error) {
+	tag, err := d.pool.Exec(ctx, "DELETE FROM idempotency_key WHERE created_at < $1", expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// DeleteIdempotencyKey удаляет запись, чтобы запрос с этим ключом можно было выполнить заново
+func (d *Database) DeleteIdempotencyKey(ctx context.Context, userID int, key string) error {
+	_, err := d.pool.Exec(ctx, "DELETE FROM idempotency_key WHERE user_id = $1 AND key = $2", userID, key)
+	return err
+}
+
+// PurgeDeletedLinks окончательно стирает ссылки, удалённые раньше deletedBefore, и возвращает их количество.
+// Если tombstones, короткие id стёртых ссылок остаются занятыми
+func (d *Database) PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time, tombstones bool) (int, error) {
+	query := `
+		WITH purged AS
+			(DELETE FROM link WHERE is_deleted AND deleted_at < $1 RETURNING short_link),
+		buried AS
+			(INSERT INTO link_tombstone (short_link) SELECT short_link FROM purged WHERE $2
+			 ON CONFLICT DO NOTHING)
+		SELECT count(*) FROM purged`
+	var purged int
+	if err := d.pool.QueryRow(ctx, query, deletedBefore, tombstones).Scan(&purged); err != nil {
+		return 0, fmt.Errorf("failed purging links %w", err)
+	}
+	return purged, nil
+}
+
+// PurgeExpiredLinks окончательно стирает ссылки, срок действия которых истёк раньше expiredBefore,
+// и возвращает их количество. Если tombstones, короткие id стёртых ссылок остаются занятыми
+func (d *Database) PurgeExpiredLinks(ctx context.Context, expiredBefore time.Time, tombstones bool) (int, error) {
+	query := `
+		WITH purged AS
+			(DELETE FROM link WHERE expires_at < $1 RETURNING short_link),
+		buried AS
+			(INSERT INTO link_tombstone (short_link) SELECT short_link FROM purged WHERE $2
+			 ON CONFLICT DO NOTHING)
+		SELECT count(*) FROM purged`
+	var purged int
+	if err := d.pool.QueryRow(ctx, query, expiredBefore, tombstones).Scan(&purged); err != nil {
+		return 0, fmt.Errorf("failed purging expired links %w", err)
+	}
+	return purged, nil
+}
+
+// EraseUser сразу стирает все данные пользователя: ссылки, ключи, задания на удаление,
+// ключи идемпотентности и сам профиль вместе с привязкой OIDC. Журнал аудита не меняется,
+// id пользователя запоминается как стёртый
+func (d *Database) EraseUser(ctx context.Context, userID int, tombstones bool) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "DELETE FROM auth_user WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(userID)})
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO erased_user (id) VALUES ($1) ON CONFLICT DO NOTHING", userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		WITH purged AS
+			(DELETE FROM link WHERE user_id = $1 RETURNING short_link)
+		INSERT INTO link_tombstone (short_link) SELECT short_link FROM purged WHERE $2
+		ON CONFLICT DO NOTHING`, userID, tombstones)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"api_key", "idempotency_key", "delete_job"} {
+		if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE user_id = $1", userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+const deleteJobColumns = "id, user_id, short_urls, status, attempts, created_at, locked_until, done_at, results"
+
+// AddDeleteJob сохраняет новое задание на удаление в статусе pending
+func (d *Database) AddDeleteJob(ctx context.Context, job DeleteJob) (DeleteJob, error) {
+	row := d.pool.QueryRow(ctx,
+		"INSERT INTO delete_job (user_id, short_urls) VALUES ($1, $2) RETURNING id, status, created_at",
+		job.UserID, job.ShortURLs)
+	if err := row.Scan(&job.ID, &job.Status, &job.CreatedAt); err != nil {
+		return DeleteJob{}, err
+	}
+	return job, nil
+}
+
+// claimableDeleteJobs условие на задания, которые ждут выполнения или не были выполнены до истечения блокировки
+const claimableDeleteJobs = "(status = 'pending' OR (status = 'running' AND (locked_until IS NULL OR locked_until <= now())))"
+
+// ClaimDeleteJobs забирает до limit заданий, которые ждут выполнения или не были выполнены
+// до истечения блокировки, и блокирует их до lockedUntil. Задания, которые в этот момент забирает
+// другая реплика, пропускаются. Задания, которые уже забирались maxAttempts раз, вместо этого
+// переводятся в failed и возвращаются вторым списком. maxAttempts 0 - без ограничения
+func (d *Database) ClaimDeleteJobs(ctx context.Context, limit int, lockedUntil time.Time, maxAttempts int) ([]DeleteJob, []DeleteJob, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var failed []DeleteJob
+	if maxAttempts > 0 {
+		rows, err := tx.Query(ctx, `
+			UPDATE delete_job SET status = 'failed', locked_until = NULL, done_at = now()
+			WHERE id IN (
+				SELECT id FROM delete_job WHERE `+claimableDeleteJobs+` AND attempts >= $1
+				FOR UPDATE SKIP LOCKED)
+			RETURNING `+deleteJobColumns, maxAttempts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed failing delete jobs %w", err)
+		}
+		failed, err = pgx.CollectRows(rows, pgx.RowToStructByName[DeleteJob])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed unpacking rows %w", err)
+		}
+	}
+
+	query := `
+		UPDATE delete_job SET status = 'running', attempts = attempts + 1, locked_until = $2
+		WHERE id IN (
+			SELECT id FROM delete_job
+			WHERE ` + claimableDeleteJobs + ` AND ($3 = 0 OR attempts < $3)
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING ` + deleteJobColumns
+	rows, err := tx.Query(ctx, query, limit, lockedUntil, maxAttempts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed claiming delete jobs %w", err)
+	}
+	jobs, err := pgx.CollectRows(rows, pgx.RowToStructByName[DeleteJob])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed unpacking rows %w", err)
+	}
+	return jobs, failed, tx.Commit(ctx)
+}
+
+// PurgeDeleteJobs удаляет задания, завершённые раньше finishedBefore, и возвращает их количество
+func (d *Database) PurgeDeleteJobs(ctx context.Context, finishedBefore time.Time) (int, error) {
+	tag, err := d.pool.Exec(ctx, "DELETE FROM delete_job WHERE status IN ('done', 'failed') AND done_at < $1", finishedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// CompleteDeleteJobs отмечает задания выполненными и сохраняет их результаты
+func (d *Database) CompleteDeleteJobs(ctx context.Context, jobs ...DeleteJob) error {
+	batch := &pgx.Batch{}
+	for _, job := range jobs {
+		results := job.Results
+		if results == nil {
+			results = []DeleteResult{}
+		}
+		batch.Queue("UPDATE delete_job SET status = 'done', locked_until = NULL, done_at = now(), results = $2 WHERE id = $1",
+			job.ID, results)
+	}
+	return d.pool.SendBatch(ctx, batch).Close()
+}
+
+// GetDeleteJob возвращает задание на удаление, созданное пользователем
+func (d *Database) GetDeleteJob(ctx context.Context, userID int, id int) (DeleteJob, error) {
+	rows, err := d.pool.Query(ctx, `
+		SELECT `+deleteJobColumns+`
+		FROM delete_job WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return DeleteJob{}, err
+	}
+	job, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[DeleteJob])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeleteJob{}, fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(id)})
+	}
+	return job, err
+}
+
+// AddJobRun добавляет запись о запуске фоновой задачи. Хранятся последние MaxJobRuns записей
+func (d *Database) AddJobRun(ctx context.Context, run JobRun) (JobRun, error) {
+	row := d.pool.QueryRow(ctx, `
+		INSERT INTO job_run (job, replica, status, error, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		run.Job, run.Replica, run.Status, run.Error, run.StartedAt, run.FinishedAt)
+	if err := row.Scan(&run.ID); err != nil {
+		return JobRun{}, err
+	}
+	_, err := d.pool.Exec(ctx, "DELETE FROM job_run WHERE id <= $1", run.ID-MaxJobRuns)
+	return run, err
+}
+
+// GetJobRuns возвращает последние запуски фоновых задач, от новых к старым
+func (d *Database) GetJobRuns(ctx context.Context, limit int) ([]JobRun, error) {
+	rows, err := d.pool.Query(ctx,
+		"SELECT id, job, replica, status, error, started_at, finished_at FROM job_run ORDER BY id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed collecting rows %w", err)
+	}
+	runs, err := pgx.CollectRows(rows, pgx.RowToStructByName[JobRun])
+	if err != nil {
+		return nil, fmt.Errorf("failed unpacking rows %w", err)
+	}
+	return runs, nil
+}
+
+// TryLock захватывает advisory lock Postgres с именем name, если его не держит другая реплика.
+// Блокировка живёт в сессии отдельного соединения и снимается вызовом unlock либо при обрыве соединения.
+// Если снять блокировку не удалось, соединение закрывается, и unlock возвращает ошибку
+func (d *Database) TryLock(ctx context.Context, name string) (unlock func() error, ok bool, err error) {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var locked bool
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtextextended($1, 0))", name).Scan(&locked)
+	if err != nil || !locked {
+		conn.Release()
+		return nil, false, err
+	}
+
+	return func() error {
+		_, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtextextended($1, 0))", name)
+		if err != nil {
+			// соединение с неснятой блокировкой нельзя возвращать в пул
+			_ = conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+		return err
+	}, true, nil
+}
+
+// UpdateBucket атомарно обновляет состояние ведра ограничителя частоты запросов, общего для всех реплик.
+// Строка ведра блокируется до конца транзакции
+func (d *Database) UpdateBucket(ctx context.Context, key string, fn func(tokens float64, updated time.Time, found bool) (float64, time.Time)) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// существующая строка блокируется сразу, чтобы PurgeBuckets не удалил её до SELECT FOR UPDATE
+	_, err = tx.Exec(ctx, "INSERT INTO rate_limit_bucket (key) VALUES ($1) ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key", key)
+	if err != nil {
+		return err
+	}
+
+	var tokens *float64
+	var updated *time.Time
+	row := tx.QueryRow(ctx, "SELECT tokens, updated_at FROM rate_limit_bucket WHERE key = $1 FOR UPDATE", key)
+	if err := row.Scan(&tokens, &updated); err != nil {
+		return err
+	}
+
+	var newTokens float64
+	var newUpdated time.Time
+	if tokens == nil || updated == nil {
+		newTokens, newUpdated = fn(0, time.Time{}, false)
+	} else {
+		newTokens, newUpdated = fn(*tokens, *updated, true)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE rate_limit_bucket SET tokens = $1, updated_at = $2 WHERE key = $3", newTokens, newUpdated, key)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// PurgeBuckets удаляет вёдра ограничителя частоты, не обновлявшиеся с updatedBefore, и возвращает их количество
+func (d *Database) PurgeBuckets(ctx context.Context, updatedBefore time.Time) (int, error) {
+	tag, err := d.pool.Exec(ctx, "DELETE FROM rate_limit_bucket WHERE updated_at < $1", updatedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// Ping проверяет соединение с базой данных
+func (d *Database) Ping(ctx context.Context) error {
+	return d.pool.Ping(ctx)
+}
+
 // Close завершает работу базы данных
 func (d *Database) Close() error {
 	d.pool.Close()
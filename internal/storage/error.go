@@ -49,3 +49,33 @@ type RecordIsDeleted struct {
 func (e *RecordIsDeleted) Error() string {
 	return fmt.Sprintf("Record is deleted %s", e.Key)
 }
+
+// UserIsErased ошибка при обращении к стёртому пользователю
+type UserIsErased struct {
+	Key string
+}
+
+// Error стандартный метод интерфейса error
+func (e *UserIsErased) Error() string {
+	return fmt.Sprintf("User is erased %s", e.Key)
+}
+
+// RecordIsDisabled ошибка при попытке достать ссылку, отключённую администратором
+type RecordIsDisabled struct {
+	Key string
+}
+
+// Error стандартный метод интерфейса error
+func (e *RecordIsDisabled) Error() string {
+	return fmt.Sprintf("Record is disabled %s", e.Key)
+}
+
+// RecordIsExpired ошибка при попытке достать ссылку с истёкшим сроком действия
+type RecordIsExpired struct {
+	Key string
+}
+
+// Error стандартный метод интерфейса error
+func (e *RecordIsExpired) Error() string {
+	return fmt.Sprintf("Record is expired %s", e.Key)
+}
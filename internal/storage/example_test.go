@@ -2,7 +2,11 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 func ExampleFileMemory() {
@@ -29,7 +33,7 @@ func ExampleFileMemory() {
 	urls, _ = f.GetUserURLS(ctx, 1)
 	fmt.Println(len(urls))
 
-	_ = f.DeleteBatch(ctx, ToDelete{"key3", 1})
+	_, _ = f.DeleteBatch(ctx, ToDelete{"key3", 1})
 	val, _ = f.Get(ctx, "key3")
 	fmt.Println(val)
 
@@ -72,7 +76,7 @@ func ExampleMemory() {
 	urls, _ = memory.GetUserURLS(ctx, 1)
 	fmt.Println(len(urls))
 
-	_ = memory.DeleteBatch(ctx, ToDelete{"key3", 1})
+	_, _ = memory.DeleteBatch(ctx, ToDelete{"key3", 1})
 	val, _ = memory.Get(ctx, "key3")
 	fmt.Println(val)
 
@@ -90,3 +94,367 @@ func ExampleMemory() {
 	// 3
 
 }
+
+func ExampleFileMemory_CreateAPIKey() {
+	path := fmt.Sprintf("/tmp/keys-%d", time.Now().UnixNano())
+	defer os.Remove(path)
+
+	ctx := context.Background()
+	f, _ := NewFileMemory(path, NewMemory())
+
+	key, _ := f.CreateAPIKey(ctx, APIKey{UserID: 1, Name: "ci", Prefix: "sk_abc", Hash: "hash", Scopes: []string{"links:read"}})
+	_ = f.RevokeAPIKey(ctx, 1, key.ID)
+	_ = f.Close()
+
+	// ключи восстанавливаются из файла вместе с их состоянием
+	f, _ = NewFileMemory(path, NewMemory())
+	restored, _ := f.GetAPIKey(ctx, "hash")
+	fmt.Println(restored.Name, restored.IsRevoked())
+
+	_ = f.Close()
+
+	// Output:
+	// ci true
+}
+
+func ExampleFileMemory_CreateNewUser() {
+	ctx := context.Background()
+
+	// у пользователя нет ссылок, только ключ, задание на удаление или ключ идемпотентности
+	saves := []func(f *FileMemory, userID int){
+		func(f *FileMemory, userID int) {
+			_, _ = f.CreateAPIKey(ctx, APIKey{UserID: userID, Prefix: "sk_abc", Hash: "hash"})
+		},
+		func(f *FileMemory, userID int) {
+			_, _ = f.AddDeleteJob(ctx, DeleteJob{UserID: userID, ShortURLs: []string{"abc"}})
+		},
+		func(f *FileMemory, userID int) {
+			record, _, _ := f.ReserveIdempotencyKey(ctx, IdempotencyRecord{UserID: userID, Key: "k"}, time.Time{}, time.Time{})
+			_ = f.CompleteIdempotencyKey(ctx, record)
+		},
+	}
+	for i, save := range saves {
+		path := fmt.Sprintf("/tmp/users-%d-%d", time.Now().UnixNano(), i)
+		f, _ := NewFileMemory(path, NewMemory())
+		owner, _ := f.CreateNewUser(ctx)
+		save(f, owner)
+		_ = f.Close()
+
+		// после перезапуска id владельца не выдаётся новому пользователю
+		f, _ = NewFileMemory(path, NewMemory())
+		userID, _ := f.CreateNewUser(ctx)
+		fmt.Println(userID != owner)
+		_ = f.Close()
+		os.Remove(path)
+	}
+
+	// Output:
+	// true
+	// true
+	// true
+}
+
+func ExampleFileMemory_GetOrCreateUserByIdentity() {
+	path := fmt.Sprintf("/tmp/identities-%d", time.Now().UnixNano())
+	defer os.Remove(path)
+
+	ctx := context.Background()
+	f, _ := NewFileMemory(path, NewMemory())
+
+	alice, _ := f.GetOrCreateUserByIdentity(ctx, "https://idp.example.com", "alice")
+	again, _ := f.GetOrCreateUserByIdentity(ctx, "https://idp.example.com", "alice")
+	fmt.Println(alice == again)
+	_ = f.Close()
+
+	// привязка восстанавливается из файла, а новые пользователи не получают занятый id
+	f, _ = NewFileMemory(path, NewMemory())
+	restored, _ := f.GetUserByIdentity(ctx, "https://idp.example.com", "alice")
+	fmt.Println(restored == alice)
+
+	userID, _ := f.CreateNewUser(ctx)
+	fmt.Println(userID > alice)
+
+	_ = f.Close()
+
+	// Output:
+	// true
+	// true
+	// true
+}
+
+func ExampleFileMemory_SetLinkDisabled() {
+	path := fmt.Sprintf("/tmp/admin-%d", time.Now().UnixNano())
+	defer os.Remove(path)
+
+	ctx := context.Background()
+	f, _ := NewFileMemory(path, NewMemory())
+
+	userID, _ := f.CreateNewUser(ctx)
+	_ = f.Put(ctx, "key", "long", userID)
+	_ = f.SetLinkDisabled(ctx, "key", true)
+	_ = f.SetUserRole(ctx, userID, RoleAdmin)
+	_, _ = f.AddAuditRecord(ctx, AuditRecord{ActorID: userID, Action: "link.disable", Target: "key"})
+	_ = f.Close()
+
+	// состояние ссылок, роли пользователей и журнал аудита восстанавливаются из файла
+	f, _ = NewFileMemory(path, NewMemory())
+	_, err := f.Get(ctx, "key")
+	var disabled *RecordIsDisabled
+	fmt.Println(errors.As(err, &disabled))
+
+	user, _ := f.GetUser(ctx, userID)
+	fmt.Println(user.Role)
+
+	records, _ := f.GetAuditRecords(ctx, 10)
+	fmt.Println(len(records), records[0].Action)
+
+	_ = f.Close()
+
+	// Output:
+	// true
+	// admin
+	// 1 link.disable
+}
+
+func ExampleFileMemory_ReserveIdempotencyKey() {
+	path := fmt.Sprintf("/tmp/idempotency-%d", time.Now().UnixNano())
+	defer os.Remove(path)
+
+	ctx := context.Background()
+	f, _ := NewFileMemory(path, NewMemory())
+
+	now := time.Now()
+	record := IdempotencyRecord{UserID: 1, Key: "retry-1", RequestHash: "hash", CreatedAt: now}
+	_, reserved, _ := f.ReserveIdempotencyKey(ctx, record, now.Add(-time.Hour), now.Add(-time.Minute))
+	fmt.Println(reserved)
+
+	// пока запрос выполняется, ключ занят
+	_, reserved, _ = f.ReserveIdempotencyKey(ctx, record, now.Add(-time.Hour), now.Add(-time.Minute))
+	fmt.Println(reserved)
+
+	// незавершённую запись, брошенную дольше таймаута, можно занять заново
+	_, reserved, _ = f.ReserveIdempotencyKey(ctx, record, now.Add(-time.Hour), now.Add(time.Second))
+	fmt.Println(reserved)
+
+	record.Status, record.Body = 201, []byte("created")
+	_ = f.CompleteIdempotencyKey(ctx, record)
+	_ = f.Close()
+
+	// сохранённый ответ восстанавливается из файла и возвращается вместо повторного резервирования
+	f, _ = NewFileMemory(path, NewMemory())
+	existing, reserved, _ := f.ReserveIdempotencyKey(ctx, record, now.Add(-time.Hour), now.Add(time.Second))
+	fmt.Println(reserved, existing.Completed, existing.Status, string(existing.Body))
+
+	// просроченный ключ удаляется и его можно занять заново
+	purged, _ := f.PurgeIdempotencyKeys(ctx, now.Add(time.Second))
+	fmt.Println(purged)
+	_, reserved, _ = f.ReserveIdempotencyKey(ctx, record, now.Add(-time.Hour), now.Add(-time.Minute))
+	fmt.Println(reserved)
+
+	_ = f.Close()
+
+	// Output:
+	// true
+	// false
+	// true
+	// false true 201 created
+	// 1
+	// true
+}
+
+func ExampleFileMemory_UpdateLink() {
+	path := fmt.Sprintf("/tmp/links-%d", time.Now().UnixNano())
+	defer os.Remove(path)
+
+	ctx := context.Background()
+	f, _ := NewFileMemory(path, NewMemory())
+
+	userID, _ := f.CreateNewUser(ctx)
+	_ = f.Put(ctx, "key", "long", userID)
+
+	// чужую ссылку изменить нельзя
+	_, err := f.UpdateLink(ctx, "key", userID+1, LinkUpdate{})
+	var notFound *KeyNotFoundError
+	fmt.Println(errors.As(err, &notFound))
+
+	fullURL, expiresAt := "edited", time.Now().Add(-time.Minute)
+	_, _ = f.UpdateLink(ctx, "key", userID, LinkUpdate{FullURL: &fullURL, ExpiresAt: &expiresAt})
+	_ = f.Close()
+
+	// изменения восстанавливаются из файла, ссылка с истёкшим сроком не отдаётся
+	f, _ = NewFileMemory(path, NewMemory())
+	_, err = f.Get(ctx, "key")
+	var expired *RecordIsExpired
+	fmt.Println(errors.As(err, &expired))
+
+	_, _ = f.UpdateLink(ctx, "key", userID, LinkUpdate{ClearExpiresAt: true})
+	val, _ := f.Get(ctx, "key")
+	fmt.Println(val)
+
+	links, _ := f.GetUserLinks(ctx, userID)
+	fmt.Println(len(links), links[0].ExpiresAt == nil)
+
+	_ = f.Close()
+
+	// Output:
+	// true
+	// true
+	// edited
+	// 1 true
+}
+
+func ExampleFileMemory_PurgeDeletedLinks() {
+	path := fmt.Sprintf("/tmp/purge-%d", time.Now().UnixNano())
+	defer os.Remove(path)
+
+	ctx := context.Background()
+	f, _ := NewFileMemory(path, NewMemory())
+
+	userID, _ := f.CreateNewUser(ctx)
+	_ = f.Put(ctx, "old", "https://old.example.com", userID)
+	_ = f.Put(ctx, "fresh", "https://fresh.example.com", userID)
+	_, _ = f.DeleteBatch(ctx, ToDelete{ShortURL: "old", UserID: userID})
+
+	// стираются только ссылки, удалённые раньше срока
+	purged, _ := f.PurgeDeletedLinks(ctx, time.Now().Add(-time.Hour), true)
+	fmt.Println(purged)
+	purged, _ = f.PurgeDeletedLinks(ctx, time.Now().Add(time.Second), true)
+	fmt.Println(purged)
+	_ = f.Close()
+
+	// id стёртой ссылки остаётся занятым и после перезапуска
+	f, _ = NewFileMemory(path, NewMemory())
+	_, err := f.Get(ctx, "old")
+	var deleted *RecordIsDeleted
+	fmt.Println(errors.As(err, &deleted))
+	err = f.Put(ctx, "old", "https://other.example.com", userID+1)
+	var exists *KeyExistsError
+	fmt.Println(errors.As(err, &exists))
+
+	// стирание пользователя удаляет и его действующие ссылки
+	_ = f.EraseUser(ctx, userID, false)
+	_ = f.Close()
+
+	f, _ = NewFileMemory(path, NewMemory())
+	_, err = f.Get(ctx, "fresh")
+	var notFound *KeyNotFoundError
+	fmt.Println(errors.As(err, &notFound))
+
+	// стёртый пользователь остаётся стёртым после перезапуска, а его id не выдаётся заново
+	_, err = f.GetUser(ctx, userID)
+	var erased *UserIsErased
+	fmt.Println(errors.As(err, &erased))
+	newID, _ := f.CreateNewUser(ctx)
+	fmt.Println(newID > userID)
+	_ = f.Close()
+
+	// Output:
+	// 0
+	// 1
+	// true
+	// true
+	// true
+	// true
+	// true
+}
+
+func ExampleFileMemory_PurgeDeleteJobs() {
+	path := fmt.Sprintf("/tmp/delete-jobs-%d", time.Now().UnixNano())
+	defer os.Remove(path)
+
+	ctx := context.Background()
+	f, _ := NewFileMemory(path, NewMemory())
+
+	done, _ := f.AddDeleteJob(ctx, DeleteJob{UserID: 1, ShortURLs: []string{"abc"}})
+	exhausted, _ := f.AddDeleteJob(ctx, DeleteJob{UserID: 1, ShortURLs: []string{"def"}})
+	_, _, _ = f.ClaimDeleteJobs(ctx, 1, time.Now().Add(time.Hour), 1)
+	_ = f.CompleteDeleteJobs(ctx, done)
+
+	// обработчик забрал второе задание и упал. Задание, уже забиравшееся максимальное число раз,
+	// не забирается снова, а отмечается failed
+	_, _, _ = f.ClaimDeleteJobs(ctx, 10, time.Now(), 1)
+	claimed, failed, _ := f.ClaimDeleteJobs(ctx, 10, time.Now(), 1)
+	fmt.Println(len(claimed), len(failed))
+	job, _ := f.GetDeleteJob(ctx, 1, exhausted.ID)
+	fmt.Println(job.Status)
+
+	// завершённые задания стираются и после перезапуска не возвращаются
+	purged, _ := f.PurgeDeleteJobs(ctx, time.Now().Add(time.Second))
+	fmt.Println(purged)
+	_ = f.Close()
+
+	f, _ = NewFileMemory(path, NewMemory())
+	_, err := f.GetDeleteJob(ctx, 1, done.ID)
+	var notFound *KeyNotFoundError
+	fmt.Println(errors.As(err, &notFound))
+	_ = f.Close()
+
+	// Output:
+	// 0 1
+	// failed
+	// 2
+	// true
+}
+
+func ExampleFileMemory_Compact() {
+	dir, _ := os.MkdirTemp("", "compact")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "storage")
+
+	ctx := context.Background()
+	f, _ := NewFileMemory(path, NewMemory())
+
+	userID, _ := f.CreateNewUser(ctx)
+	_ = f.Put(ctx, "abc", "https://example.com", userID)
+	_, _ = f.DeleteBatch(ctx, ToDelete{ShortURL: "abc", UserID: userID})
+
+	// файл заменяется целиком, записи после сжатия попадают уже в новый файл
+	_ = f.Compact(ctx)
+	_ = f.Put(ctx, "def", "https://other.example.com", userID)
+	_ = f.Close()
+
+	// временных файлов не остаётся
+	entries, _ := os.ReadDir(dir)
+	fmt.Println(len(entries))
+
+	f, _ = NewFileMemory(path, NewMemory())
+	_, err := f.Get(ctx, "abc")
+	var deleted *RecordIsDeleted
+	fmt.Println(errors.As(err, &deleted))
+	url, _ := f.Get(ctx, "def")
+	fmt.Println(url)
+	_ = f.Close()
+
+	// Output:
+	// 1
+	// true
+	// https://other.example.com
+}
+
+func ExampleMemory_GetUserURLSPage() {
+	memory := NewMemory()
+	ctx := context.Background()
+	for _, key := range []string{"c", "a", "d", "b"} {
+		_ = memory.Put(ctx, key, "https://example.com/"+key, 1)
+	}
+	_ = memory.Put(ctx, "other", "https://example.com/other", 2)
+
+	// ключ последней ссылки страницы - начало следующей
+	after := ""
+	for {
+		page, _ := memory.GetUserURLSPage(ctx, 1, after, 3)
+		var keys []string
+		for _, rec := range page {
+			keys = append(keys, rec.ShortURL)
+		}
+		fmt.Println(keys)
+		if len(page) < 3 {
+			break
+		}
+		after = page[len(page)-1].ShortURL
+	}
+
+	// Output:
+	// [a b c]
+	// [d]
+}
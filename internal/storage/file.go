@@ -5,33 +5,119 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"sync"
+	"time"
 )
 
 // MemoryStorage - файловое хранилище дублирует записи в InMemory хранилище, поддерживающем данный интерфейс
 type MemoryStorage interface {
 	Put(ctx context.Context, key string, val string, user int) error
+	PutLink(ctx context.Context, key string, val string, user int, expiresAt *time.Time) error
 	Get(ctx context.Context, key string) (string, error)
 	CreateNewUser(ctx context.Context) (int, error)
 	GetUserURLS(ctx context.Context, userID int) ([]URLRecord, error)
+	GetUserURLSPage(ctx context.Context, userID int, after string, limit int) ([]URLRecord, error)
 	GetAllRecords() []URLRecord
-	Delete(key string, user int)
+	Delete(key string, user int) string
 	CountURLs(ctx context.Context) (int, error)
 	CountUsers(ctx context.Context) (int, error)
+	CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error)
+	PutAPIKey(key APIKey)
+	GetAPIKey(ctx context.Context, hash string) (APIKey, error)
+	GetAPIKeyByID(ctx context.Context, id int) (APIKey, error)
+	GetUserAPIKeys(ctx context.Context, userID int) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int, keyID int) error
+	TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error
+	GetAllAPIKeys() []APIKey
+	GetUserByIdentity(ctx context.Context, issuer string, subject string) (int, error)
+	GetOrCreateUserByIdentity(ctx context.Context, issuer string, subject string) (int, error)
+	PutIdentity(identity Identity)
+	GetAllIdentities() []Identity
+	GetUser(ctx context.Context, userID int) (User, error)
+	SetUserRole(ctx context.Context, userID int, role string) error
+	SetUserBlocked(ctx context.Context, userID int, blocked bool) error
+	PutUser(user User)
+	GetAllUsers() []User
+	GetLink(ctx context.Context, key string) (LinkInfo, error)
+	SetLinkDisabled(ctx context.Context, key string, disabled bool) error
+	ForceDeleteLink(ctx context.Context, key string) error
+	GetRecentLinks(ctx context.Context, limit int) ([]LinkInfo, error)
+	GetUserLinks(ctx context.Context, userID int) ([]LinkInfo, error)
+	UpdateLink(ctx context.Context, key string, userID int, update LinkUpdate) (LinkInfo, error)
+	PutLinkInfo(link LinkInfo)
+	GetAllLinks() []LinkInfo
+	AddAuditRecord(ctx context.Context, record AuditRecord) (AuditRecord, error)
+	PutAuditRecord(record AuditRecord)
+	GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error)
+	GetAllAuditRecords() []AuditRecord
+	ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, expiredBefore time.Time, staleBefore time.Time) (IdempotencyRecord, bool, error)
+	PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error)
+	CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error
+	GetIdempotencyRecord(ctx context.Context, userID int, key string) (IdempotencyRecord, error)
+	DeleteIdempotencyKey(ctx context.Context, userID int, key string) error
+	PutIdempotencyRecord(record IdempotencyRecord)
+	GetAllIdempotencyRecords() []IdempotencyRecord
+	AddDeleteJob(ctx context.Context, job DeleteJob) (DeleteJob, error)
+	ClaimDeleteJobs(ctx context.Context, limit int, lockedUntil time.Time, maxAttempts int) ([]DeleteJob, []DeleteJob, error)
+	PurgeDeleteJobs(ctx context.Context, finishedBefore time.Time) (int, error)
+	CompleteDeleteJobs(ctx context.Context, jobs ...DeleteJob) error
+	GetDeleteJob(ctx context.Context, userID int, id int) (DeleteJob, error)
+	PutDeleteJob(job DeleteJob)
+	GetAllDeleteJobs() []DeleteJob
+	AddJobRun(ctx context.Context, run JobRun) (JobRun, error)
+	GetJobRuns(ctx context.Context, limit int) ([]JobRun, error)
+	PutJobRun(run JobRun)
+	GetAllJobRuns() []JobRun
+	PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time, tombstones bool) (int, error)
+	PurgeExpiredLinks(ctx context.Context, expiredBefore time.Time, tombstones bool) (int, error)
+	EraseUser(ctx context.Context, userID int, tombstones bool) error
+	PutTombstone(tombstone Tombstone)
+	GetAllTombstones() []Tombstone
+	PutErasedUser(user ErasedUser)
+	GetAllErasedUsers() []ErasedUser
 }
 
+// Типы записей в файле. Записи без типа - ссылки, для совместимости со старым форматом
+const (
+	recordKindLink        = ""
+	recordKindAPIKey      = "api_key"
+	recordKindIdentity    = "identity"
+	recordKindUser        = "user"
+	recordKindAudit       = "audit"
+	recordKindIdempotency = "idempotency"
+	recordKindDeleteJob   = "delete_job"
+	recordKindJobRun      = "job_run"
+	recordKindTombstone   = "tombstone"
+	recordKindErasedUser  = "erased_user"
+)
+
 // FileRecord структура, задающая формат хранения записи в файле
 type FileRecord struct {
-	UUID        string `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
-	UserID      int    `json:"user_id"`
-	IsDeleted   bool   `json:"is_deleted"`
+	UUID        string             `json:"uuid"`
+	Kind        string             `json:"kind,omitempty"`
+	ShortURL    string             `json:"short_url"`
+	OriginalURL string             `json:"original_url"`
+	UserID      int                `json:"user_id"`
+	IsDeleted   bool               `json:"is_deleted"`
+	IsDisabled  bool               `json:"is_disabled,omitempty"`
+	CreatedAt   *time.Time         `json:"created_at,omitempty"`
+	ExpiresAt   *time.Time         `json:"expires_at,omitempty"`
+	DeletedAt   *time.Time         `json:"deleted_at,omitempty"`
+	APIKey      *APIKey            `json:"api_key,omitempty"`
+	Identity    *Identity          `json:"identity,omitempty"`
+	User        *User              `json:"user,omitempty"`
+	Audit       *AuditRecord       `json:"audit,omitempty"`
+	Idempotency *IdempotencyRecord `json:"idempotency,omitempty"`
+	DeleteJob   *DeleteJob         `json:"delete_job,omitempty"`
+	JobRun      *JobRun            `json:"job_run,omitempty"`
 }
 
 // FileMemory структура, использующая как хранилище память + запись в файл
 type FileMemory struct {
+	path     string
 	file     *os.File
 	writer   *bufio.Writer
 	memory   MemoryStorage
@@ -42,6 +128,7 @@ type FileMemory struct {
 // NewFileMemory инициализирует FileMemory
 func NewFileMemory(path string, memory MemoryStorage) (*FileMemory, error) {
 	storage := FileMemory{
+		path:   path,
 		memory: memory,
 	}
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
@@ -60,16 +147,18 @@ func NewFileMemory(path string, memory MemoryStorage) (*FileMemory, error) {
 
 // Put - сохранение записи о ссылке по ключу
 func (f *FileMemory) Put(ctx context.Context, key string, val string, user int) error {
+	return f.PutLink(ctx, key, val, user, nil)
+}
+
+// PutLink - сохранение записи о ссылке вместе со сроком действия одной записью в файл
+func (f *FileMemory) PutLink(ctx context.Context, key string, val string, user int, expiresAt *time.Time) error {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	if err := f.memory.Put(ctx, key, val, user); err != nil {
+	if err := f.memory.PutLink(ctx, key, val, user, expiresAt); err != nil {
 		return err
 	}
-	if err := f.writeToFile(key, val, user, false); err != nil {
-		return err
-	}
-	return nil
+	return f.writeCurrentLink(ctx, key)
 }
 
 // PutBatch - сохранение нескольких записей в хранилище
@@ -83,18 +172,19 @@ func (f *FileMemory) PutBatch(ctx context.Context, records ...URLRecord) error {
 	return nil
 }
 
-// DeleteBatch - удаление нескольких записей из хранилища
-func (f *FileMemory) DeleteBatch(ctx context.Context, records ...ToDelete) error {
+// DeleteBatch - удаление нескольких записей из хранилища. Результаты идут в порядке records
+func (f *FileMemory) DeleteBatch(ctx context.Context, records ...ToDelete) ([]DeleteResult, error) {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	for _, rec := range records {
-		f.memory.Delete(rec.ShortURL, rec.UserID)
+	results := make([]DeleteResult, len(records))
+	for i, rec := range records {
+		results[i] = DeleteResult{ShortURL: rec.ShortURL, Status: f.memory.Delete(rec.ShortURL, rec.UserID)}
 	}
 	// переписать файл
 	err := f.dumpToFile()
 
-	return err
+	return results, err
 }
 
 // Get получение записи из хранилища
@@ -118,6 +208,13 @@ func (f *FileMemory) GetUserURLS(ctx context.Context, userID int) ([]URLRecord,
 	return f.memory.GetUserURLS(ctx, userID)
 }
 
+// GetUserURLSPage получение не более limit ссылок пользователя с ключами больше after, по возрастанию ключа
+func (f *FileMemory) GetUserURLSPage(ctx context.Context, userID int, after string, limit int) ([]URLRecord, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetUserURLSPage(ctx, userID, after, limit)
+}
+
 // CountURLs возвращает количество сохранённых ссылок
 func (f *FileMemory) CountURLs(ctx context.Context) (int, error) {
 	return f.memory.CountURLs(ctx)
@@ -128,16 +225,412 @@ func (f *FileMemory) CountUsers(ctx context.Context) (int, error) {
 	return f.memory.CountUsers(ctx)
 }
 
-func (f *FileMemory) writeToFile(key string, val string, user int, isDeleted bool) error {
-	nextUUID := f.lastUUID + 1
+// CreateAPIKey сохранение нового API-ключа
+func (f *FileMemory) CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	key, err := f.memory.CreateAPIKey(ctx, key)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, f.writeAPIKey(key)
+}
+
+// GetAPIKey получение ключа по хэшу
+func (f *FileMemory) GetAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetAPIKey(ctx, hash)
+}
+
+// GetUserAPIKeys получение списка ключей пользователя
+func (f *FileMemory) GetUserAPIKeys(ctx context.Context, userID int) ([]APIKey, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetUserAPIKeys(ctx, userID)
+}
+
+// RevokeAPIKey отзыв ключа пользователя
+func (f *FileMemory) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.memory.RevokeAPIKey(ctx, userID, keyID); err != nil {
+		return err
+	}
+	key, err := f.memory.GetAPIKeyByID(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	return f.writeAPIKey(key)
+}
+
+// TouchAPIKey обновление времени последнего использования ключа
+func (f *FileMemory) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.memory.TouchAPIKey(ctx, keyID, usedAt); err != nil {
+		return err
+	}
+	key, err := f.memory.GetAPIKeyByID(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	return f.writeAPIKey(key)
+}
+
+// GetUserByIdentity ищет пользователя, привязанного к внешней учётной записи
+func (f *FileMemory) GetUserByIdentity(ctx context.Context, issuer string, subject string) (int, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetUserByIdentity(ctx, issuer, subject)
+}
+
+// GetOrCreateUserByIdentity возвращает пользователя, привязанного к внешней учётной записи,
+// новая привязка записывается в файл
+func (f *FileMemory) GetOrCreateUserByIdentity(ctx context.Context, issuer string, subject string) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if userID, err := f.memory.GetUserByIdentity(ctx, issuer, subject); err == nil {
+		return userID, nil
+	}
+	userID, err := f.memory.GetOrCreateUserByIdentity(ctx, issuer, subject)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.writeIdentity(Identity{Issuer: issuer, Subject: subject, UserID: userID}); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// GetUser возвращает пользователя
+func (f *FileMemory) GetUser(ctx context.Context, userID int) (User, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetUser(ctx, userID)
+}
+
+// SetUserRole задаёт роль пользователя
+func (f *FileMemory) SetUserRole(ctx context.Context, userID int, role string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.memory.SetUserRole(ctx, userID, role); err != nil {
+		return err
+	}
+	return f.writeCurrentUser(ctx, userID)
+}
 
+// SetUserBlocked блокирует либо разблокирует пользователя
+func (f *FileMemory) SetUserBlocked(ctx context.Context, userID int, blocked bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.memory.SetUserBlocked(ctx, userID, blocked); err != nil {
+		return err
+	}
+	return f.writeCurrentUser(ctx, userID)
+}
+
+// GetLink возвращает полную информацию о ссылке
+func (f *FileMemory) GetLink(ctx context.Context, key string) (LinkInfo, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetLink(ctx, key)
+}
+
+// SetLinkDisabled отключает либо включает ссылку
+func (f *FileMemory) SetLinkDisabled(ctx context.Context, key string, disabled bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.memory.SetLinkDisabled(ctx, key, disabled); err != nil {
+		return err
+	}
+	return f.writeCurrentLink(ctx, key)
+}
+
+// ForceDeleteLink удаляет ссылку независимо от владельца
+func (f *FileMemory) ForceDeleteLink(ctx context.Context, key string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.memory.ForceDeleteLink(ctx, key); err != nil {
+		return err
+	}
+	return f.writeCurrentLink(ctx, key)
+}
+
+// GetUserLinks возвращает ссылки пользователя со всеми атрибутами
+func (f *FileMemory) GetUserLinks(ctx context.Context, userID int) ([]LinkInfo, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetUserLinks(ctx, userID)
+}
+
+// UpdateLink изменяет ссылку пользователя
+func (f *FileMemory) UpdateLink(ctx context.Context, key string, userID int, update LinkUpdate) (LinkInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	link, err := f.memory.UpdateLink(ctx, key, userID, update)
+	if err != nil {
+		return LinkInfo{}, err
+	}
+	return link, f.writeLink(link)
+}
+
+// GetRecentLinks возвращает последние созданные ссылки
+func (f *FileMemory) GetRecentLinks(ctx context.Context, limit int) ([]LinkInfo, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetRecentLinks(ctx, limit)
+}
+
+// AddAuditRecord добавляет запись в журнал аудита
+func (f *FileMemory) AddAuditRecord(ctx context.Context, record AuditRecord) (AuditRecord, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	record, err := f.memory.AddAuditRecord(ctx, record)
+	if err != nil {
+		return AuditRecord{}, err
+	}
+	return record, f.writeAuditRecord(record)
+}
+
+// GetAuditRecords возвращает последние записи журнала аудита
+func (f *FileMemory) GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetAuditRecords(ctx, limit)
+}
+
+// ReserveIdempotencyKey резервирует ключ идемпотентности. Незавершённые записи в файл не пишутся
+func (f *FileMemory) ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, expiredBefore time.Time, staleBefore time.Time) (IdempotencyRecord, bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.memory.ReserveIdempotencyKey(ctx, record, expiredBefore, staleBefore)
+}
+
+// PurgeIdempotencyKeys удаляет просроченные записи из памяти. Из файла они пропадут при следующем сжатии
+func (f *FileMemory) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.memory.PurgeIdempotencyKeys(ctx, expiredBefore)
+}
+
+// CompleteIdempotencyKey сохраняет в зарезервированной записи ответ: Status, ContentType, Location и Body
+func (f *FileMemory) CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.memory.CompleteIdempotencyKey(ctx, record); err != nil {
+		return err
+	}
+	record, err := f.memory.GetIdempotencyRecord(ctx, record.UserID, record.Key)
+	if err != nil {
+		return err
+	}
+	return f.writeRecord(FileRecord{Kind: recordKindIdempotency, Idempotency: &record})
+}
+
+// DeleteIdempotencyKey удаляет запись о ключе идемпотентности. Удаляются только незавершённые записи,
+// которых нет в файле, поэтому файл не переписывается
+func (f *FileMemory) DeleteIdempotencyKey(ctx context.Context, userID int, key string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.memory.DeleteIdempotencyKey(ctx, userID, key)
+}
+
+// AddDeleteJob сохраняет задание на удаление. Задание попадает в файл до ответа клиенту
+// и переживает перезапуск сервиса
+func (f *FileMemory) AddDeleteJob(ctx context.Context, job DeleteJob) (DeleteJob, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	job, err := f.memory.AddDeleteJob(ctx, job)
+	if err != nil {
+		return DeleteJob{}, err
+	}
+	return job, f.writeDeleteJob(job)
+}
+
+// ClaimDeleteJobs забирает до limit заданий на удаление и блокирует их до lockedUntil.
+// Задания, исчерпавшие maxAttempts попыток, переводятся в failed
+func (f *FileMemory) ClaimDeleteJobs(ctx context.Context, limit int, lockedUntil time.Time, maxAttempts int) ([]DeleteJob, []DeleteJob, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	jobs, failed, err := f.memory.ClaimDeleteJobs(ctx, limit, lockedUntil, maxAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, job := range append(slices.Clone(jobs), failed...) {
+		if err := f.writeDeleteJob(job); err != nil {
+			return nil, nil, err
+		}
+	}
+	return jobs, failed, nil
+}
+
+// PurgeDeleteJobs удаляет задания, завершённые раньше finishedBefore, и переписывает файл без них
+func (f *FileMemory) PurgeDeleteJobs(ctx context.Context, finishedBefore time.Time) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	purged, err := f.memory.PurgeDeleteJobs(ctx, finishedBefore)
+	if err != nil || purged == 0 {
+		return purged, err
+	}
+	return purged, f.dumpToFile()
+}
+
+// CompleteDeleteJobs отмечает задания выполненными и сохраняет их результаты
+func (f *FileMemory) CompleteDeleteJobs(ctx context.Context, jobs ...DeleteJob) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.memory.CompleteDeleteJobs(ctx, jobs...); err != nil {
+		return err
+	}
+	for _, job := range f.memory.GetAllDeleteJobs() {
+		if !slices.ContainsFunc(jobs, func(done DeleteJob) bool { return done.ID == job.ID }) {
+			continue
+		}
+		if err := f.writeDeleteJob(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDeleteJob возвращает задание на удаление, созданное пользователем
+func (f *FileMemory) GetDeleteJob(ctx context.Context, userID int, id int) (DeleteJob, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetDeleteJob(ctx, userID, id)
+}
+
+// AddJobRun добавляет запись о запуске фоновой задачи
+func (f *FileMemory) AddJobRun(ctx context.Context, run JobRun) (JobRun, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	run, err := f.memory.AddJobRun(ctx, run)
+	if err != nil {
+		return JobRun{}, err
+	}
+	return run, f.writeRecord(FileRecord{Kind: recordKindJobRun, JobRun: &run})
+}
+
+// GetJobRuns возвращает последние запуски фоновых задач
+func (f *FileMemory) GetJobRuns(ctx context.Context, limit int) ([]JobRun, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.memory.GetJobRuns(ctx, limit)
+}
+
+// PurgeDeletedLinks окончательно стирает ссылки, удалённые раньше deletedBefore.
+// Файл переписывается, чтобы стёртые ссылки не остались в старых записях
+func (f *FileMemory) PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time, tombstones bool) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	purged, err := f.memory.PurgeDeletedLinks(ctx, deletedBefore, tombstones)
+	if err != nil || purged == 0 {
+		return purged, err
+	}
+	return purged, f.dumpToFile()
+}
+
+// PurgeExpiredLinks окончательно стирает ссылки, срок действия которых истёк раньше expiredBefore.
+// Файл переписывается, чтобы стёртые ссылки не остались в старых записях
+func (f *FileMemory) PurgeExpiredLinks(ctx context.Context, expiredBefore time.Time, tombstones bool) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	purged, err := f.memory.PurgeExpiredLinks(ctx, expiredBefore, tombstones)
+	if err != nil || purged == 0 {
+		return purged, err
+	}
+	return purged, f.dumpToFile()
+}
+
+// EraseUser стирает все данные пользователя и переписывает файл без них
+func (f *FileMemory) EraseUser(ctx context.Context, userID int, tombstones bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.memory.EraseUser(ctx, userID, tombstones); err != nil {
+		return err
+	}
+	return f.dumpToFile()
+}
+
+// Compact переписывает файл, оставляя только текущее состояние записей
+func (f *FileMemory) Compact(ctx context.Context) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.dumpToFile()
+}
+
+// writeCurrentLink дописывает в файл текущее состояние ссылки, при загрузке побеждает последняя запись
+func (f *FileMemory) writeCurrentLink(ctx context.Context, key string) error {
+	link, err := f.memory.GetLink(ctx, key)
+	if err != nil {
+		return err
+	}
+	return f.writeLink(link)
+}
+
+func (f *FileMemory) writeLink(link LinkInfo) error {
 	record := FileRecord{
-		UUID:        strconv.Itoa(nextUUID),
-		ShortURL:    key,
-		OriginalURL: val,
-		UserID:      user,
-		IsDeleted:   isDeleted,
+		Kind:        recordKindLink,
+		ShortURL:    link.ShortURL,
+		OriginalURL: link.FullURL,
+		UserID:      link.UserID,
+		IsDeleted:   link.IsDeleted,
+		IsDisabled:  link.IsDisabled,
+		ExpiresAt:   link.ExpiresAt,
+		DeletedAt:   link.DeletedAt,
+	}
+	if !link.CreatedAt.IsZero() {
+		record.CreatedAt = &link.CreatedAt
+	}
+	return f.writeRecord(record)
+}
+
+func (f *FileMemory) writeCurrentUser(ctx context.Context, userID int) error {
+	user, err := f.memory.GetUser(ctx, userID)
+	if err != nil {
+		return err
 	}
+	return f.writeRecord(FileRecord{Kind: recordKindUser, User: &user})
+}
+
+func (f *FileMemory) writeAuditRecord(record AuditRecord) error {
+	return f.writeRecord(FileRecord{Kind: recordKindAudit, Audit: &record})
+}
+
+// writeAPIKey дописывает в файл текущее состояние ключа, при загрузке побеждает последняя запись
+func (f *FileMemory) writeAPIKey(key APIKey) error {
+	return f.writeRecord(FileRecord{Kind: recordKindAPIKey, APIKey: &key})
+}
+
+func (f *FileMemory) writeDeleteJob(job DeleteJob) error {
+	return f.writeRecord(FileRecord{Kind: recordKindDeleteJob, DeleteJob: &job})
+}
+
+func (f *FileMemory) writeIdentity(identity Identity) error {
+	return f.writeRecord(FileRecord{Kind: recordKindIdentity, Identity: &identity})
+}
+
+func (f *FileMemory) writeRecord(record FileRecord) error {
+	nextUUID := f.lastUUID + 1
+
+	record.UUID = strconv.Itoa(nextUUID)
 	data, err := json.Marshal(record)
 
 	if err != nil {
@@ -161,8 +654,6 @@ func (f *FileMemory) loadFromFile(file *os.File) error {
 	defer f.lock.Unlock()
 	scanner := bufio.NewScanner(file)
 
-	ctx := context.Background()
-
 	for {
 		if !scanner.Scan() {
 			return scanner.Err()
@@ -173,8 +664,70 @@ func (f *FileMemory) loadFromFile(file *os.File) error {
 		if err := json.Unmarshal(data, &record); err != nil {
 			return err
 		}
-		if err := f.memory.Put(ctx, record.ShortURL, record.OriginalURL, record.UserID); err != nil {
-			return err
+		switch record.Kind {
+		case recordKindLink:
+			if record.ShortURL != "" {
+				link := LinkInfo{
+					ShortURL:   record.ShortURL,
+					FullURL:    record.OriginalURL,
+					UserID:     record.UserID,
+					IsDeleted:  record.IsDeleted,
+					IsDisabled: record.IsDisabled,
+					ExpiresAt:  record.ExpiresAt,
+					DeletedAt:  record.DeletedAt,
+				}
+				if record.CreatedAt != nil {
+					link.CreatedAt = *record.CreatedAt
+				}
+				// у ссылок, удалённых до появления срока хранения, время удаления отсчитывается от загрузки
+				if link.IsDeleted && link.DeletedAt == nil {
+					now := time.Now()
+					link.DeletedAt = &now
+				}
+				f.memory.PutLinkInfo(link)
+			}
+		case recordKindAPIKey:
+			if record.APIKey != nil {
+				f.memory.PutAPIKey(*record.APIKey)
+			}
+		case recordKindIdentity:
+			if record.Identity != nil {
+				f.memory.PutIdentity(*record.Identity)
+			}
+		case recordKindUser:
+			if record.User != nil {
+				f.memory.PutUser(*record.User)
+			}
+		case recordKindAudit:
+			if record.Audit != nil {
+				f.memory.PutAuditRecord(*record.Audit)
+			}
+		case recordKindIdempotency:
+			if record.Idempotency != nil {
+				f.memory.PutIdempotencyRecord(*record.Idempotency)
+			}
+		case recordKindDeleteJob:
+			if record.DeleteJob != nil {
+				job := *record.DeleteJob
+				// файл принадлежит одному процессу: задания, которые он не успел выполнить, снова ждут обработчика
+				if job.Status == DeleteJobRunning {
+					job.Status = DeleteJobPending
+					job.LockedUntil = nil
+				}
+				f.memory.PutDeleteJob(job)
+			}
+		case recordKindJobRun:
+			if record.JobRun != nil {
+				f.memory.PutJobRun(*record.JobRun)
+			}
+		case recordKindTombstone:
+			if record.ShortURL != "" && record.CreatedAt != nil {
+				f.memory.PutTombstone(Tombstone{ShortURL: record.ShortURL, CreatedAt: *record.CreatedAt})
+			}
+		case recordKindErasedUser:
+			if record.UserID != 0 && record.CreatedAt != nil {
+				f.memory.PutErasedUser(ErasedUser{UserID: record.UserID, ErasedAt: *record.CreatedAt})
+			}
 		}
 
 		var err error
@@ -185,22 +738,109 @@ func (f *FileMemory) loadFromFile(file *os.File) error {
 	}
 }
 
+// dumpToFile переписывает файл текущим состоянием памяти. Запись идёт во временный файл,
+// который после fsync атомарно заменяет исходный, так что сбой не оставляет файл обрезанным
 func (f *FileMemory) dumpToFile() error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	writer, lastUUID := f.writer, f.lastUUID
+	f.writer, f.lastUUID = bufio.NewWriter(tmp), 0
 
-	err := f.file.Truncate(0)
+	err = tmp.Chmod(0644)
+	if err == nil {
+		err = f.writeSnapshot()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
 	if err != nil {
+		os.Remove(tmp.Name())
+		f.writer, f.lastUUID = writer, lastUUID
 		return err
 	}
 
-	for _, rec := range f.memory.GetAllRecords() {
-		err := f.writeToFile(rec.ShortURL, rec.FullURL, rec.UserID, rec.IsDeleted)
-		if err != nil {
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	f.file.Close()
+	f.file = file
+	f.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (f *FileMemory) writeSnapshot() error {
+	for _, link := range f.memory.GetAllLinks() {
+		if err := f.writeLink(link); err != nil {
+			return err
+		}
+	}
+	for _, key := range f.memory.GetAllAPIKeys() {
+		if err := f.writeAPIKey(key); err != nil {
+			return err
+		}
+	}
+	for _, identity := range f.memory.GetAllIdentities() {
+		if err := f.writeIdentity(identity); err != nil {
+			return err
+		}
+	}
+	for _, user := range f.memory.GetAllUsers() {
+		if err := f.writeRecord(FileRecord{Kind: recordKindUser, User: &user}); err != nil {
+			return err
+		}
+	}
+	for _, record := range f.memory.GetAllAuditRecords() {
+		if err := f.writeAuditRecord(record); err != nil {
+			return err
+		}
+	}
+	for _, record := range f.memory.GetAllIdempotencyRecords() {
+		if err := f.writeRecord(FileRecord{Kind: recordKindIdempotency, Idempotency: &record}); err != nil {
+			return err
+		}
+	}
+	for _, job := range f.memory.GetAllDeleteJobs() {
+		if err := f.writeDeleteJob(job); err != nil {
+			return err
+		}
+	}
+	for _, run := range f.memory.GetAllJobRuns() {
+		if err := f.writeRecord(FileRecord{Kind: recordKindJobRun, JobRun: &run}); err != nil {
+			return err
+		}
+	}
+	for _, tombstone := range f.memory.GetAllTombstones() {
+		record := FileRecord{Kind: recordKindTombstone, ShortURL: tombstone.ShortURL, CreatedAt: &tombstone.CreatedAt}
+		if err := f.writeRecord(record); err != nil {
+			return err
+		}
+	}
+	for _, user := range f.memory.GetAllErasedUsers() {
+		record := FileRecord{Kind: recordKindErasedUser, UserID: user.UserID, CreatedAt: &user.ErasedAt}
+		if err := f.writeRecord(record); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Ping проверяет, что файл хранилища открыт и доступен
+func (f *FileMemory) Ping(ctx context.Context) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	_, err := f.file.Stat()
+	return err
+}
+
 // Close завершение работы хранилища
 func (f *FileMemory) Close() error {
 	return f.file.Close()
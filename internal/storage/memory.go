@@ -3,28 +3,58 @@ package storage
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // FullURLData структура для хранения записи в памяти
 type FullURLData struct {
-	FullURL   string
-	IsDeleted bool
-	UserID    int
+	FullURL    string
+	IsDeleted  bool
+	IsDisabled bool
+	UserID     int
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	DeletedAt  *time.Time
 }
 
 // Memory - imMemory хранилище для ссылок
 type Memory struct {
-	urls      map[string]FullURLData
-	maxUserID int
-	lock      sync.RWMutex
+	urls        map[string]FullURLData
+	apiKeys     map[int]APIKey
+	keyHashes   map[string]int
+	identity    map[identityKey]int
+	users       map[int]User
+	audit       []AuditRecord
+	idempotency map[idempotencyKey]IdempotencyRecord
+	deleteJobs  map[int]DeleteJob
+	tombstones  map[string]time.Time
+	erased      map[int]time.Time
+	jobRuns     []JobRun
+	maxRunID    int
+	maxUserID   int
+	maxKeyID    int
+	maxJobID    int
+	lock        sync.RWMutex
 }
 
 // NewMemory инициализация хранилища
 func NewMemory() *Memory {
 	return &Memory{
-		urls:      make(map[string]FullURLData),
-		maxUserID: 0,
+		urls:        make(map[string]FullURLData),
+		apiKeys:     make(map[int]APIKey),
+		keyHashes:   make(map[string]int),
+		identity:    make(map[identityKey]int),
+		users:       make(map[int]User),
+		idempotency: make(map[idempotencyKey]IdempotencyRecord),
+		deleteJobs:  make(map[int]DeleteJob),
+		tombstones:  make(map[string]time.Time),
+		erased:      make(map[int]time.Time),
+		maxUserID:   0,
 	}
 }
 
@@ -33,40 +63,60 @@ func (m *Memory) Get(ctx context.Context, key string) (string, error) {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 	v, ok := m.urls[key]
+	if _, tombstone := m.tombstones[key]; !ok && tombstone {
+		return "", fmt.Errorf("%w", &RecordIsDeleted{Key: key})
+	}
 	if !ok {
 		return "", fmt.Errorf("%w", &KeyNotFoundError{Key: key})
 	}
 	if v.IsDeleted {
 		return "", fmt.Errorf("%w", &RecordIsDeleted{Key: key})
 	}
+	if v.IsDisabled {
+		return "", fmt.Errorf("%w", &RecordIsDisabled{Key: key})
+	}
+	if newLinkInfo(key, v).IsExpired(time.Now()) {
+		return "", fmt.Errorf("%w", &RecordIsExpired{Key: key})
+	}
 	return v.FullURL, nil
 }
 
 // Put - сохранение записи о ссылке по ключу
 func (m *Memory) Put(ctx context.Context, key string, val string, user int) error {
+	return m.PutLink(ctx, key, val, user, nil)
+}
+
+// PutLink - сохранение записи о ссылке по ключу вместе со сроком действия, nil - без срока
+func (m *Memory) PutLink(ctx context.Context, key string, val string, user int, expiresAt *time.Time) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	v, exists := m.urls[key]
-	if exists && v.FullURL != val {
+	if _, tombstone := m.tombstones[key]; tombstone || exists && v.FullURL != val {
 		return fmt.Errorf("%w", &KeyExistsError{Key: key})
 	}
-	m.urls[key] = FullURLData{FullURL: val, UserID: user, IsDeleted: false}
+	m.urls[key] = FullURLData{FullURL: val, UserID: user, IsDeleted: false, CreatedAt: time.Now(), ExpiresAt: expiresAt}
 	if user > m.maxUserID {
 		m.maxUserID = user
 	}
 	return nil
 }
 
-// Delete - удаление записи по ключу
-func (m *Memory) Delete(key string, user int) {
+// Delete - удаление записи по ключу. Возвращает результат удаления, чужие ссылки не удаляются
+func (m *Memory) Delete(key string, user int) string {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
 	v, ok := m.urls[key]
-	if !ok || v.UserID != user {
-		return
+	switch {
+	case !ok:
+		return DeleteNotFound
+	case v.UserID != user:
+		return DeleteNotOwner
+	case v.IsDeleted:
+		return DeleteAlreadyDeleted
 	}
-	m.urls[key] = FullURLData{FullURL: v.FullURL, UserID: v.UserID, IsDeleted: true}
+	m.urls[key] = markDeleted(v)
+	return DeleteDeleted
 }
 
 // CountURLs возвращает количество сохранённых ссылок
@@ -98,12 +148,13 @@ func (m *Memory) PutBatch(ctx context.Context, records ...URLRecord) error {
 	return nil
 }
 
-// DeleteBatch - удаление нескольких записей из хранилища
-func (m *Memory) DeleteBatch(ctx context.Context, records ...ToDelete) error {
-	for _, rec := range records {
-		m.Delete(rec.ShortURL, rec.UserID)
+// DeleteBatch - удаление нескольких записей из хранилища. Результаты идут в порядке records
+func (m *Memory) DeleteBatch(ctx context.Context, records ...ToDelete) ([]DeleteResult, error) {
+	results := make([]DeleteResult, len(records))
+	for i, rec := range records {
+		results[i] = DeleteResult{ShortURL: rec.ShortURL, Status: m.Delete(rec.ShortURL, rec.UserID)}
 	}
-	return nil
+	return results, nil
 }
 
 // GetUserURLS получение списка ссылок, принадлежащих пользователю
@@ -122,6 +173,27 @@ func (m *Memory) GetUserURLS(ctx context.Context, userID int) ([]URLRecord, erro
 	return urls, nil
 }
 
+// GetUserURLSPage получение не более limit ссылок пользователя с ключами больше after, по возрастанию ключа
+func (m *Memory) GetUserURLSPage(ctx context.Context, userID int, after string, limit int) ([]URLRecord, error) {
+	var urls []URLRecord
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for short, record := range m.urls {
+		if record.UserID == userID && short > after {
+			urls = append(urls, URLRecord{UserID: userID, ShortURL: short, FullURL: record.FullURL})
+		}
+	}
+	slices.SortFunc(urls, func(a, b URLRecord) int {
+		return strings.Compare(a.ShortURL, b.ShortURL)
+	})
+	if len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls, nil
+}
+
 // GetAllRecords получение списка всех записей
 func (m *Memory) GetAllRecords() []URLRecord {
 	urls := make([]URLRecord, len(m.urls))
@@ -135,6 +207,817 @@ func (m *Memory) GetAllRecords() []URLRecord {
 	return urls
 }
 
+// CreateAPIKey сохраняет новый API-ключ и возвращает его с присвоенным id
+func (m *Memory) CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, exists := m.keyHashes[key.Hash]; exists {
+		return APIKey{}, fmt.Errorf("%w", &KeyExistsError{Key: key.Prefix})
+	}
+	m.maxKeyID = m.maxKeyID + 1
+	key.ID = m.maxKeyID
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	m.putAPIKey(key)
+	return key, nil
+}
+
+// PutAPIKey сохраняет ключ как есть, вместе с id. Используется при восстановлении из файла
+func (m *Memory) PutAPIKey(key APIKey) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if key.ID > m.maxKeyID {
+		m.maxKeyID = key.ID
+	}
+	if key.UserID > m.maxUserID {
+		m.maxUserID = key.UserID
+	}
+	m.putAPIKey(key)
+}
+
+func (m *Memory) putAPIKey(key APIKey) {
+	m.apiKeys[key.ID] = key
+	m.keyHashes[key.Hash] = key.ID
+}
+
+// GetAPIKey ищет ключ по хэшу
+func (m *Memory) GetAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	id, ok := m.keyHashes[hash]
+	if !ok {
+		return APIKey{}, fmt.Errorf("%w", &KeyNotFoundError{Key: "api key"})
+	}
+	return m.apiKeys[id], nil
+}
+
+// GetAPIKeyByID ищет ключ по id
+func (m *Memory) GetAPIKeyByID(ctx context.Context, id int) (APIKey, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return APIKey{}, fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(id)})
+	}
+	return key, nil
+}
+
+// GetUserAPIKeys возвращает все ключи пользователя, включая отозванные
+func (m *Memory) GetUserAPIKeys(ctx context.Context, userID int) ([]APIKey, error) {
+	var keys []APIKey
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for id := 1; id <= m.maxKeyID; id++ {
+		key, ok := m.apiKeys[id]
+		if ok && key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ пользователя
+func (m *Memory) RevokeAPIKey(ctx context.Context, userID int, keyID int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key, ok := m.apiKeys[keyID]
+	if !ok || key.UserID != userID {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(keyID)})
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		m.apiKeys[keyID] = key
+	}
+	return nil
+}
+
+// TouchAPIKey обновляет время последнего использования ключа
+func (m *Memory) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key, ok := m.apiKeys[keyID]
+	if !ok {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(keyID)})
+	}
+	key.LastUsedAt = &usedAt
+	m.apiKeys[keyID] = key
+	return nil
+}
+
+// GetAllAPIKeys получение списка всех ключей
+func (m *Memory) GetAllAPIKeys() []APIKey {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	keys := make([]APIKey, 0, len(m.apiKeys))
+	for id := 1; id <= m.maxKeyID; id++ {
+		if key, ok := m.apiKeys[id]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// GetUser возвращает пользователя. Пользователи без явно заданных роли и блокировки - обычные пользователи
+func (m *Memory) GetUser(ctx context.Context, userID int) (User, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if _, ok := m.erased[userID]; ok {
+		return User{}, fmt.Errorf("%w", &UserIsErased{Key: strconv.Itoa(userID)})
+	}
+	if user, ok := m.users[userID]; ok {
+		return user, nil
+	}
+	return User{ID: userID, Role: RoleUser}, nil
+}
+
+// SetUserRole задаёт роль пользователя
+func (m *Memory) SetUserRole(ctx context.Context, userID int, role string) error {
+	return m.updateUser(userID, func(user *User) { user.Role = role })
+}
+
+// SetUserBlocked блокирует либо разблокирует пользователя
+func (m *Memory) SetUserBlocked(ctx context.Context, userID int, blocked bool) error {
+	return m.updateUser(userID, func(user *User) { user.IsBlocked = blocked })
+}
+
+func (m *Memory) updateUser(userID int, update func(user *User)) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, erased := m.erased[userID]; erased || userID < 1 || userID > m.maxUserID {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(userID)})
+	}
+	user, ok := m.users[userID]
+	if !ok {
+		user = User{ID: userID, Role: RoleUser}
+	}
+	update(&user)
+	m.users[userID] = user
+	return nil
+}
+
+// PutUser сохраняет пользователя как есть. Используется при восстановлении из файла
+func (m *Memory) PutUser(user User) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.users[user.ID] = user
+	if user.ID > m.maxUserID {
+		m.maxUserID = user.ID
+	}
+}
+
+// GetAllUsers получение списка пользователей с явно заданными ролью или блокировкой
+func (m *Memory) GetAllUsers() []User {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	users := make([]User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	return users
+}
+
+// GetLink возвращает полную информацию о ссылке, в том числе удалённой или отключённой
+func (m *Memory) GetLink(ctx context.Context, key string) (LinkInfo, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	v, ok := m.urls[key]
+	if !ok {
+		return LinkInfo{}, fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+	}
+	return newLinkInfo(key, v), nil
+}
+
+// SetLinkDisabled отключает либо включает ссылку
+func (m *Memory) SetLinkDisabled(ctx context.Context, key string, disabled bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	v, ok := m.urls[key]
+	if !ok {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+	}
+	v.IsDisabled = disabled
+	m.urls[key] = v
+	return nil
+}
+
+// ForceDeleteLink удаляет ссылку независимо от владельца
+func (m *Memory) ForceDeleteLink(ctx context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	v, ok := m.urls[key]
+	if !ok {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+	}
+	m.urls[key] = markDeleted(v)
+	return nil
+}
+
+// markDeleted помечает ссылку удалённой. Время первого удаления не меняется
+func markDeleted(v FullURLData) FullURLData {
+	if !v.IsDeleted || v.DeletedAt == nil {
+		now := time.Now()
+		v.DeletedAt = &now
+	}
+	v.IsDeleted = true
+	return v
+}
+
+// GetRecentLinks возвращает последние созданные ссылки, от новых к старым
+func (m *Memory) GetRecentLinks(ctx context.Context, limit int) ([]LinkInfo, error) {
+	links := m.GetAllLinks()
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].CreatedAt.After(links[j].CreatedAt)
+	})
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+// GetUserLinks возвращает ссылки пользователя со всеми атрибутами, от новых к старым
+func (m *Memory) GetUserLinks(ctx context.Context, userID int) ([]LinkInfo, error) {
+	m.lock.RLock()
+	var links []LinkInfo
+	for key, v := range m.urls {
+		if v.UserID == userID {
+			links = append(links, newLinkInfo(key, v))
+		}
+	}
+	m.lock.RUnlock()
+
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].CreatedAt.After(links[j].CreatedAt)
+	})
+	return links, nil
+}
+
+// UpdateLink изменяет ссылку пользователя. Чужая ссылка считается ненайденной, удалённую изменить нельзя
+func (m *Memory) UpdateLink(ctx context.Context, key string, userID int, update LinkUpdate) (LinkInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	v, ok := m.urls[key]
+	if !ok || v.UserID != userID {
+		return LinkInfo{}, fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+	}
+	if v.IsDeleted {
+		return LinkInfo{}, fmt.Errorf("%w", &RecordIsDeleted{Key: key})
+	}
+	if update.FullURL != nil {
+		v.FullURL = *update.FullURL
+	}
+	if update.ClearExpiresAt {
+		v.ExpiresAt = nil
+	} else if update.ExpiresAt != nil {
+		v.ExpiresAt = update.ExpiresAt
+	}
+	m.urls[key] = v
+	return newLinkInfo(key, v), nil
+}
+
+// PutLinkInfo сохраняет ссылку со всеми атрибутами. Используется при восстановлении из файла
+func (m *Memory) PutLinkInfo(link LinkInfo) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.urls[link.ShortURL] = FullURLData{
+		FullURL:    link.FullURL,
+		UserID:     link.UserID,
+		IsDeleted:  link.IsDeleted,
+		IsDisabled: link.IsDisabled,
+		CreatedAt:  link.CreatedAt,
+		ExpiresAt:  link.ExpiresAt,
+		DeletedAt:  link.DeletedAt,
+	}
+	if link.UserID > m.maxUserID {
+		m.maxUserID = link.UserID
+	}
+}
+
+// GetAllLinks получение списка всех ссылок со всеми атрибутами
+func (m *Memory) GetAllLinks() []LinkInfo {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	links := make([]LinkInfo, 0, len(m.urls))
+	for key, v := range m.urls {
+		links = append(links, newLinkInfo(key, v))
+	}
+	return links
+}
+
+func newLinkInfo(key string, v FullURLData) LinkInfo {
+	return LinkInfo{
+		ShortURL:   key,
+		FullURL:    v.FullURL,
+		UserID:     v.UserID,
+		IsDeleted:  v.IsDeleted,
+		IsDisabled: v.IsDisabled,
+		CreatedAt:  v.CreatedAt,
+		ExpiresAt:  v.ExpiresAt,
+		DeletedAt:  v.DeletedAt,
+	}
+}
+
+// AddAuditRecord добавляет запись в журнал аудита
+func (m *Memory) AddAuditRecord(ctx context.Context, record AuditRecord) (AuditRecord, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	record.ID = len(m.audit) + 1
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	m.audit = append(m.audit, record)
+	return record, nil
+}
+
+// PutAuditRecord сохраняет запись журнала как есть. Используется при восстановлении из файла
+func (m *Memory) PutAuditRecord(record AuditRecord) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.audit = append(m.audit, record)
+}
+
+// GetAuditRecords возвращает последние записи журнала аудита, от новых к старым
+func (m *Memory) GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	records := make([]AuditRecord, 0, min(limit, len(m.audit)))
+	for i := len(m.audit) - 1; i >= 0 && len(records) < limit; i-- {
+		records = append(records, m.audit[i])
+	}
+	return records, nil
+}
+
+// GetAllAuditRecords получение всего журнала аудита
+func (m *Memory) GetAllAuditRecords() []AuditRecord {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return slices.Clone(m.audit)
+}
+
+type identityKey struct {
+	issuer  string
+	subject string
+}
+
+// GetUserByIdentity ищет пользователя, привязанного к внешней учётной записи
+func (m *Memory) GetUserByIdentity(ctx context.Context, issuer string, subject string) (int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	userID, ok := m.identity[identityKey{issuer, subject}]
+	if !ok {
+		return 0, fmt.Errorf("%w", &KeyNotFoundError{Key: subject})
+	}
+	return userID, nil
+}
+
+// GetOrCreateUserByIdentity возвращает пользователя, привязанного к внешней учётной записи,
+// и создаёт нового, если привязки ещё нет
+func (m *Memory) GetOrCreateUserByIdentity(ctx context.Context, issuer string, subject string) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := identityKey{issuer, subject}
+	if userID, ok := m.identity[key]; ok {
+		return userID, nil
+	}
+	m.maxUserID = m.maxUserID + 1
+	m.identity[key] = m.maxUserID
+	return m.maxUserID, nil
+}
+
+// PutIdentity сохраняет привязку как есть. Используется при восстановлении из файла
+func (m *Memory) PutIdentity(identity Identity) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.identity[identityKey{identity.Issuer, identity.Subject}] = identity.UserID
+	if identity.UserID > m.maxUserID {
+		m.maxUserID = identity.UserID
+	}
+}
+
+// GetAllIdentities получение списка всех привязок внешних учётных записей
+func (m *Memory) GetAllIdentities() []Identity {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	identities := make([]Identity, 0, len(m.identity))
+	for key, userID := range m.identity {
+		identities = append(identities, Identity{Issuer: key.issuer, Subject: key.subject, UserID: userID})
+	}
+	return identities
+}
+
+type idempotencyKey struct {
+	userID int
+	key    string
+}
+
+// ReserveIdempotencyKey сохраняет record, если для пользователя ещё нет записи с таким ключом,
+// либо она создана раньше expiredBefore, либо не завершена и создана раньше staleBefore.
+// Иначе возвращает существующую запись и false
+func (m *Memory) ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, expiredBefore time.Time, staleBefore time.Time) (IdempotencyRecord, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := idempotencyKey{record.UserID, record.Key}
+	if existing, ok := m.idempotency[key]; ok && !existing.expired(expiredBefore, staleBefore) {
+		return existing, false, nil
+	}
+	m.idempotency[key] = record
+	return record, true, nil
+}
+
+// PurgeIdempotencyKeys удаляет записи, созданные раньше expiredBefore, и возвращает их количество
+func (m *Memory) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	purged := 0
+	for k, r := range m.idempotency {
+		if r.CreatedAt.Before(expiredBefore) {
+			delete(m.idempotency, k)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// CompleteIdempotencyKey сохраняет в зарезервированной записи ответ: Status, ContentType, Location и Body
+func (m *Memory) CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := idempotencyKey{record.UserID, record.Key}
+	existing, ok := m.idempotency[key]
+	if !ok {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: record.Key})
+	}
+	existing.Completed = true
+	existing.Status = record.Status
+	existing.ContentType = record.ContentType
+	existing.Location = record.Location
+	existing.Body = record.Body
+	m.idempotency[key] = existing
+	return nil
+}
+
+// DeleteIdempotencyKey удаляет запись, чтобы запрос с этим ключом можно было выполнить заново
+func (m *Memory) DeleteIdempotencyKey(ctx context.Context, userID int, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.idempotency, idempotencyKey{userID, key})
+	return nil
+}
+
+// GetIdempotencyRecord возвращает запись по ключу
+func (m *Memory) GetIdempotencyRecord(ctx context.Context, userID int, key string) (IdempotencyRecord, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	record, ok := m.idempotency[idempotencyKey{userID, key}]
+	if !ok {
+		return IdempotencyRecord{}, fmt.Errorf("%w", &KeyNotFoundError{Key: key})
+	}
+	return record, nil
+}
+
+// PutIdempotencyRecord сохраняет запись как есть. Используется при восстановлении из файла
+func (m *Memory) PutIdempotencyRecord(record IdempotencyRecord) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.idempotency[idempotencyKey{record.UserID, record.Key}] = record
+	if record.UserID > m.maxUserID {
+		m.maxUserID = record.UserID
+	}
+}
+
+// GetAllIdempotencyRecords получение всех завершённых записей идемпотентности
+func (m *Memory) GetAllIdempotencyRecords() []IdempotencyRecord {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	records := make([]IdempotencyRecord, 0, len(m.idempotency))
+	for _, record := range m.idempotency {
+		if record.Completed {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// AddDeleteJob сохраняет новое задание на удаление в статусе pending
+func (m *Memory) AddDeleteJob(ctx context.Context, job DeleteJob) (DeleteJob, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.maxJobID++
+	job.ID = m.maxJobID
+	job.Status = DeleteJobPending
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now()
+	}
+	job.ShortURLs = slices.Clone(job.ShortURLs)
+	m.deleteJobs[job.ID] = job
+	return job, nil
+}
+
+// ClaimDeleteJobs забирает до limit заданий, которые ждут выполнения или не были выполнены
+// до истечения блокировки, и блокирует их до lockedUntil. Задания, которые уже забирались maxAttempts раз,
+// вместо этого переводятся в failed и возвращаются вторым списком. maxAttempts 0 - без ограничения
+func (m *Memory) ClaimDeleteJobs(ctx context.Context, limit int, lockedUntil time.Time, maxAttempts int) ([]DeleteJob, []DeleteJob, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+	jobs := make([]DeleteJob, 0)
+	var failed []DeleteJob
+	for id := 1; id <= m.maxJobID && len(jobs) < limit; id++ {
+		job, ok := m.deleteJobs[id]
+		if !ok || !job.IsClaimable(now) {
+			continue
+		}
+		if maxAttempts > 0 && job.Attempts >= maxAttempts {
+			job.Status = DeleteJobFailed
+			job.LockedUntil = nil
+			job.DoneAt = &now
+			m.deleteJobs[id] = job
+			failed = append(failed, job)
+			continue
+		}
+		job.Status = DeleteJobRunning
+		job.Attempts++
+		job.LockedUntil = &lockedUntil
+		m.deleteJobs[id] = job
+		jobs = append(jobs, job)
+	}
+	return jobs, failed, nil
+}
+
+// PurgeDeleteJobs удаляет задания, завершённые раньше finishedBefore, и возвращает их количество
+func (m *Memory) PurgeDeleteJobs(ctx context.Context, finishedBefore time.Time) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	purged := 0
+	for id, job := range m.deleteJobs {
+		if job.IsFinished() && job.DoneAt != nil && job.DoneAt.Before(finishedBefore) {
+			delete(m.deleteJobs, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// CompleteDeleteJobs отмечает задания выполненными и сохраняет их результаты
+func (m *Memory) CompleteDeleteJobs(ctx context.Context, jobs ...DeleteJob) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+	for _, done := range jobs {
+		job, ok := m.deleteJobs[done.ID]
+		if !ok {
+			continue
+		}
+		job.Status = DeleteJobDone
+		job.LockedUntil = nil
+		job.DoneAt = &now
+		job.Results = done.Results
+		m.deleteJobs[done.ID] = job
+	}
+	return nil
+}
+
+// GetDeleteJob возвращает задание на удаление, созданное пользователем
+func (m *Memory) GetDeleteJob(ctx context.Context, userID int, id int) (DeleteJob, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	job, ok := m.deleteJobs[id]
+	if !ok || job.UserID != userID {
+		return DeleteJob{}, fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(id)})
+	}
+	return job, nil
+}
+
+// PutDeleteJob сохраняет задание как есть. Используется при восстановлении из файла
+func (m *Memory) PutDeleteJob(job DeleteJob) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.deleteJobs[job.ID] = job
+	m.maxJobID = max(m.maxJobID, job.ID)
+	if job.UserID > m.maxUserID {
+		m.maxUserID = job.UserID
+	}
+}
+
+// GetAllDeleteJobs получение всех заданий на удаление
+func (m *Memory) GetAllDeleteJobs() []DeleteJob {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	jobs := make([]DeleteJob, 0, len(m.deleteJobs))
+	for _, job := range m.deleteJobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// AddJobRun добавляет запись о запуске фоновой задачи. Хранятся последние MaxJobRuns записей
+func (m *Memory) AddJobRun(ctx context.Context, run JobRun) (JobRun, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.maxRunID++
+	run.ID = m.maxRunID
+	m.putJobRun(run)
+	return run, nil
+}
+
+// PutJobRun сохраняет запись о запуске как есть. Используется при восстановлении из файла
+func (m *Memory) PutJobRun(run JobRun) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.maxRunID = max(m.maxRunID, run.ID)
+	m.putJobRun(run)
+}
+
+func (m *Memory) putJobRun(run JobRun) {
+	m.jobRuns = append(m.jobRuns, run)
+	if len(m.jobRuns) > MaxJobRuns {
+		m.jobRuns = slices.Clone(m.jobRuns[len(m.jobRuns)-MaxJobRuns:])
+	}
+}
+
+// GetJobRuns возвращает последние запуски фоновых задач, от новых к старым
+func (m *Memory) GetJobRuns(ctx context.Context, limit int) ([]JobRun, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	runs := make([]JobRun, 0, min(limit, len(m.jobRuns)))
+	for i := len(m.jobRuns) - 1; i >= 0 && len(runs) < limit; i-- {
+		runs = append(runs, m.jobRuns[i])
+	}
+	return runs, nil
+}
+
+// GetAllJobRuns получение всех хранящихся запусков фоновых задач
+func (m *Memory) GetAllJobRuns() []JobRun {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return slices.Clone(m.jobRuns)
+}
+
+// PurgeDeletedLinks окончательно стирает ссылки, удалённые раньше deletedBefore, и возвращает их количество.
+// Если tombstones, короткие id стёртых ссылок остаются занятыми
+func (m *Memory) PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time, tombstones bool) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	purged := 0
+	for key, v := range m.urls {
+		if v.IsDeleted && v.DeletedAt != nil && v.DeletedAt.Before(deletedBefore) {
+			m.purgeLink(key, tombstones)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// PurgeExpiredLinks окончательно стирает ссылки, срок действия которых истёк раньше expiredBefore,
+// и возвращает их количество. Если tombstones, короткие id стёртых ссылок остаются занятыми
+func (m *Memory) PurgeExpiredLinks(ctx context.Context, expiredBefore time.Time, tombstones bool) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	purged := 0
+	for key, v := range m.urls {
+		if v.ExpiresAt != nil && v.ExpiresAt.Before(expiredBefore) {
+			m.purgeLink(key, tombstones)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// EraseUser сразу стирает все данные пользователя: ссылки, ключи, привязки OIDC, задания на удаление,
+// ключи идемпотентности и сам профиль. Журнал аудита не меняется, id пользователя запоминается как стёртый
+func (m *Memory) EraseUser(ctx context.Context, userID int, tombstones bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, erased := m.erased[userID]; erased || userID < 1 || userID > m.maxUserID {
+		return fmt.Errorf("%w", &KeyNotFoundError{Key: strconv.Itoa(userID)})
+	}
+	for key, v := range m.urls {
+		if v.UserID == userID {
+			m.purgeLink(key, tombstones)
+		}
+	}
+	for id, key := range m.apiKeys {
+		if key.UserID == userID {
+			delete(m.keyHashes, key.Hash)
+			delete(m.apiKeys, id)
+		}
+	}
+	for key, id := range m.identity {
+		if id == userID {
+			delete(m.identity, key)
+		}
+	}
+	for key, record := range m.idempotency {
+		if record.UserID == userID {
+			delete(m.idempotency, key)
+		}
+	}
+	for id, job := range m.deleteJobs {
+		if job.UserID == userID {
+			delete(m.deleteJobs, id)
+		}
+	}
+	delete(m.users, userID)
+	m.erased[userID] = time.Now()
+	return nil
+}
+
+func (m *Memory) purgeLink(key string, tombstone bool) {
+	delete(m.urls, key)
+	if tombstone {
+		m.tombstones[key] = time.Now()
+	}
+}
+
+// PutTombstone сохраняет короткий id стёртой ссылки. Используется при восстановлении из файла
+func (m *Memory) PutTombstone(tombstone Tombstone) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.tombstones[tombstone.ShortURL] = tombstone.CreatedAt
+}
+
+// GetAllTombstones получение всех занятых id стёртых ссылок
+func (m *Memory) GetAllTombstones() []Tombstone {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	tombstones := make([]Tombstone, 0, len(m.tombstones))
+	for key, createdAt := range m.tombstones {
+		tombstones = append(tombstones, Tombstone{ShortURL: key, CreatedAt: createdAt})
+	}
+	return tombstones
+}
+
+// PutErasedUser сохраняет id стёртого пользователя. Используется при восстановлении из файла
+func (m *Memory) PutErasedUser(user ErasedUser) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.erased[user.UserID] = user.ErasedAt
+	if user.UserID > m.maxUserID {
+		m.maxUserID = user.UserID
+	}
+}
+
+// GetAllErasedUsers получение всех стёртых пользователей
+func (m *Memory) GetAllErasedUsers() []ErasedUser {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	users := make([]ErasedUser, 0, len(m.erased))
+	for userID, erasedAt := range m.erased {
+		users = append(users, ErasedUser{UserID: userID, ErasedAt: erasedAt})
+	}
+	return users
+}
+
+// Ping хранилище в памяти доступно всегда
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
 // Close метод нужен для соответствия интерфейсу Storage
 func (m *Memory) Close() error {
 	return nil
@@ -1,5 +1,7 @@
 package storage
 
+import "time"
+
 // URLRecord информация о ссылке
 type URLRecord struct {
 	ShortURL  string `db:"short_link"`
@@ -13,3 +15,183 @@ type ToDelete struct {
 	ShortURL string
 	UserID   int
 }
+
+// Результаты удаления одной ссылки
+const (
+	DeleteDeleted        = "deleted"
+	DeleteNotFound       = "not_found"
+	DeleteNotOwner       = "not_owner"
+	DeleteAlreadyDeleted = "already_deleted"
+)
+
+// DeleteResult чем закончилось удаление ссылки ShortURL
+type DeleteResult struct {
+	ShortURL string `json:"short_url"`
+	Status   string `json:"status"`
+}
+
+// APIKey персональный ключ пользователя для программного доступа.
+// Сам ключ не хранится, только его хэш и префикс для отображения
+type APIKey struct {
+	ID         int        `db:"id" json:"id"`
+	UserID     int        `db:"user_id" json:"user_id"`
+	Name       string     `db:"name" json:"name"`
+	Prefix     string     `db:"prefix" json:"prefix"`
+	Hash       string     `db:"key_hash" json:"hash"`
+	Scopes     []string   `db:"scopes" json:"scopes"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+// IsRevoked возвращает true, если ключ отозван
+func (k APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Identity привязка внешней учётной записи (issuer + subject из OIDC) к пользователю сервиса
+type Identity struct {
+	Issuer  string `db:"oidc_issuer" json:"issuer"`
+	Subject string `db:"oidc_subject" json:"subject"`
+	UserID  int    `db:"id" json:"user_id"`
+}
+
+// Роли пользователей
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User пользователь сервиса
+type User struct {
+	ID        int    `db:"id" json:"id"`
+	Role      string `db:"role" json:"role"`
+	IsBlocked bool   `db:"is_blocked" json:"is_blocked"`
+}
+
+// LinkInfo полная информация о ссылке
+type LinkInfo struct {
+	ShortURL   string    `db:"short_link" json:"short_url"`
+	FullURL    string    `db:"full_link" json:"original_url"`
+	UserID     int       `db:"user_id" json:"user_id"`
+	IsDeleted  bool      `db:"is_deleted" json:"is_deleted"`
+	IsDisabled bool      `db:"is_disabled" json:"is_disabled"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	// ExpiresAt после этого момента ссылка перестаёт открываться, nil - без срока действия
+	ExpiresAt *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	// DeletedAt когда ссылка удалена. Через срок хранения удалённая ссылка стирается окончательно
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// IsExpired истёк ли срок действия ссылки к моменту now
+func (l LinkInfo) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// LinkUpdate изменения ссылки её владельцем, nil-поля не меняются
+type LinkUpdate struct {
+	FullURL   *string
+	ExpiresAt *time.Time
+	// ClearExpiresAt снимает ограничение срока действия
+	ClearExpiresAt bool
+}
+
+// AuditRecord запись журнала действий администраторов
+type AuditRecord struct {
+	ID        int       `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ActorID   int       `db:"actor_id" json:"actor_id"`
+	Action    string    `db:"action" json:"action"`
+	Target    string    `db:"target" json:"target"`
+	Details   string    `db:"details" json:"details,omitempty"`
+}
+
+// IdempotencyRecord первый ответ на запрос с ключом идемпотентности, повторяется при повторных запросах.
+// Пока запрос выполняется, Completed false
+type IdempotencyRecord struct {
+	UserID      int       `db:"user_id" json:"user_id"`
+	Key         string    `db:"key" json:"key"`
+	RequestHash string    `db:"request_hash" json:"request_hash"`
+	Completed   bool      `db:"completed" json:"completed"`
+	Status      int       `db:"status" json:"status"`
+	ContentType string    `db:"content_type" json:"content_type,omitempty"`
+	Location    string    `db:"location" json:"location,omitempty"`
+	Body        []byte    `db:"body" json:"body,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// expired запись можно занять заново: она создана раньше expiredBefore, либо брошена незавершённой
+// и создана раньше staleBefore
+func (r IdempotencyRecord) expired(expiredBefore time.Time, staleBefore time.Time) bool {
+	return r.CreatedAt.Before(expiredBefore) || (!r.Completed && r.CreatedAt.Before(staleBefore))
+}
+
+// Статусы задания на удаление ссылок
+const (
+	DeleteJobPending = "pending"
+	DeleteJobRunning = "running"
+	DeleteJobDone    = "done"
+	// DeleteJobFailed задание не выполнено за допустимое число попыток и больше не повторяется
+	DeleteJobFailed = "failed"
+)
+
+// DeleteJob задание на удаление ссылок пользователя. Задание в статусе running забрано обработчиком
+// до LockedUntil, после этого срока его снова может забрать любой обработчик.
+// DoneAt - время перехода в done или failed
+type DeleteJob struct {
+	ID          int        `db:"id" json:"id"`
+	UserID      int        `db:"user_id" json:"user_id"`
+	ShortURLs   []string   `db:"short_urls" json:"short_urls"`
+	Status      string     `db:"status" json:"status"`
+	Attempts    int        `db:"attempts" json:"attempts"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	LockedUntil *time.Time `db:"locked_until" json:"locked_until,omitempty"`
+	DoneAt      *time.Time `db:"done_at" json:"done_at,omitempty"`
+	// Results результаты по каждой ссылке, заполняются при выполнении задания
+	Results []DeleteResult `db:"results" json:"results,omitempty"`
+}
+
+// IsClaimable может ли обработчик забрать задание в момент now
+func (j DeleteJob) IsClaimable(now time.Time) bool {
+	return j.Status == DeleteJobPending ||
+		j.Status == DeleteJobRunning && (j.LockedUntil == nil || !now.Before(*j.LockedUntil))
+}
+
+// IsFinished задание выполнено или окончательно не удалось
+func (j DeleteJob) IsFinished() bool {
+	return j.Status == DeleteJobDone || j.Status == DeleteJobFailed
+}
+
+// Результаты запуска фоновой задачи
+const (
+	JobRunOK     = "ok"
+	JobRunFailed = "failed"
+)
+
+// JobRun запуск фоновой задачи планировщика
+type JobRun struct {
+	ID  int    `db:"id" json:"id"`
+	Job string `db:"job" json:"job"`
+	// Replica экземпляр сервиса, выполнивший задачу
+	Replica    string    `db:"replica" json:"replica"`
+	Status     string    `db:"status" json:"status"`
+	Error      string    `db:"error" json:"error,omitempty"`
+	StartedAt  time.Time `db:"started_at" json:"started_at"`
+	FinishedAt time.Time `db:"finished_at" json:"finished_at"`
+}
+
+// MaxJobRuns сколько последних запусков задач хранится
+const MaxJobRuns = 1000
+
+// Tombstone короткий id окончательно стёртой ссылки. Пока он хранится, id не выдаётся заново,
+// чтобы по старой ссылке нельзя было открыть чужую
+type Tombstone struct {
+	ShortURL  string    `db:"short_link" json:"short_url"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// ErasedUser id стёртого пользователя. Сессии с этим id больше не принимаются
+type ErasedUser struct {
+	UserID   int       `db:"id" json:"user_id"`
+	ErasedAt time.Time `db:"erased_at" json:"erased_at"`
+}
@@ -0,0 +1,195 @@
+package tasks
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BatchConfig параметры BatchWorker
+type BatchConfig struct {
+	// BatchSize сколько задач накапливается до сброса
+	BatchSize int
+	// MaxLatency как часто сбрасывается неполный пакет
+	MaxLatency time.Duration
+	// Workers количество обработчиков, у каждого свой пакет
+	Workers int
+	// Retries сколько раз повторить неудачный сброс
+	Retries int
+	// RetryBackoff пауза перед первым повтором, перед каждым следующим удваивается
+	RetryBackoff time.Duration
+}
+
+// DefaultBatchConfig параметры по умолчанию
+var DefaultBatchConfig = BatchConfig{
+	BatchSize:    100,
+	MaxLatency:   100 * time.Millisecond,
+	Workers:      1,
+	Retries:      3,
+	RetryBackoff: 100 * time.Millisecond,
+}
+
+// Metrics метрики BatchWorker
+type Metrics struct {
+	// QueueDepth задачи в канале и в пакетах, ещё не сброшенные
+	QueueDepth expvar.Int
+	// Flushed задачи, успешно сброшенные, Dropped - не сброшенные после всех повторов или при отмене контекста
+	Flushed expvar.Int
+	Dropped expvar.Int
+	// Flushes количество сбросов, Retries - повторов после ошибок
+	Flushes expvar.Int
+	Retries expvar.Int
+	// LastFlushLatency и TotalFlushLatency длительность последнего сброса и всех сбросов с повторами, в микросекундах
+	LastFlushLatency  expvar.Int
+	TotalFlushLatency expvar.Int
+}
+
+// Map метрики в виде expvar.Map для публикации
+func (m *Metrics) Map() *expvar.Map {
+	result := new(expvar.Map).Init()
+	result.Set("queue_depth", &m.QueueDepth)
+	result.Set("flushed", &m.Flushed)
+	result.Set("dropped", &m.Dropped)
+	result.Set("flushes", &m.Flushes)
+	result.Set("retries", &m.Retries)
+	result.Set("last_flush_latency_us", &m.LastFlushLatency)
+	result.Set("total_flush_latency_us", &m.TotalFlushLatency)
+	return result
+}
+
+// published метрики всех опубликованных обработчиков, доступны на /debug/vars под ключом tasks
+var published = expvar.NewMap("tasks")
+
+// BatchWorker собирает задачи из канала в пакеты и передаёт их в flush: когда пакет заполнен,
+// по тикеру раз в MaxLatency и при закрытии канала
+type BatchWorker[T any] struct {
+	config  BatchConfig
+	flush   func(ctx context.Context, batch []T) error
+	metrics Metrics
+	pending atomic.Int64
+	logger  *zap.SugaredLogger
+}
+
+// NewBatchWorker создаёт BatchWorker. Нулевые параметры config заменяются значениями из DefaultBatchConfig
+func NewBatchWorker[T any](config BatchConfig, flush func(ctx context.Context, batch []T) error) *BatchWorker[T] {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchConfig.BatchSize
+	}
+	if config.MaxLatency <= 0 {
+		config.MaxLatency = DefaultBatchConfig.MaxLatency
+	}
+	if config.Workers <= 0 {
+		config.Workers = DefaultBatchConfig.Workers
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = DefaultBatchConfig.RetryBackoff
+	}
+
+	return &BatchWorker[T]{config: config, flush: flush, logger: zap.NewNop().Sugar()}
+}
+
+// SetLogger задаёт логгер для неудачных сбросов пакетов
+func (w *BatchWorker[T]) SetLogger(logger *zap.SugaredLogger) {
+	w.logger = logger
+}
+
+// Metrics метрики обработчика
+func (w *BatchWorker[T]) Metrics() *Metrics {
+	return &w.metrics
+}
+
+// Publish публикует метрики через expvar под ключом tasks.name
+func (w *BatchWorker[T]) Publish(name string) {
+	published.Set(name, w.metrics.Map())
+}
+
+// Run обрабатывает задачи из in, пока канал не закрыт, и сбрасывает оставшиеся пакеты.
+// При отмене ctx завершается сразу, несброшенные задачи теряются
+func (w *BatchWorker[T]) Run(ctx context.Context, in <-chan T) {
+	var wg sync.WaitGroup
+	for i := 0; i < w.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work(ctx, in)
+		}()
+	}
+	wg.Wait()
+	_ = w.logger.Sync()
+}
+
+func (w *BatchWorker[T]) work(ctx context.Context, in <-chan T) {
+	ticker := time.NewTicker(w.config.MaxLatency)
+	defer ticker.Stop()
+
+	var batch []T
+	flush := func() {
+		if len(batch) > 0 {
+			w.flushBatch(ctx, batch, len(in))
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.drop(batch, len(in))
+			return
+		case item, ok := <-in:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, item)
+			w.metrics.QueueDepth.Set(w.pending.Add(1) + int64(len(in)))
+			if len(batch) >= w.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flushBatch сбрасывает пакет, повторяя при ошибках с растущей паузой
+func (w *BatchWorker[T]) flushBatch(ctx context.Context, batch []T, queued int) {
+	started := time.Now()
+	backoff := w.config.RetryBackoff
+	err := w.flush(ctx, batch)
+	for attempt := 0; err != nil && attempt < w.config.Retries; attempt++ {
+		w.logger.Warnf("Flush of %d tasks failed, retrying in %v: %v", len(batch), backoff, err)
+		select {
+		case <-ctx.Done():
+			w.drop(batch, queued)
+			return
+		case <-time.After(backoff):
+		}
+		w.metrics.Retries.Add(1)
+		backoff *= 2
+		err = w.flush(ctx, batch)
+	}
+
+	latency := time.Since(started).Microseconds()
+	w.metrics.Flushes.Add(1)
+	w.metrics.LastFlushLatency.Set(latency)
+	w.metrics.TotalFlushLatency.Add(latency)
+	if err != nil {
+		w.logger.Errorf("Dropped %d tasks: %v", len(batch), err)
+		w.drop(batch, queued)
+		return
+	}
+	w.metrics.Flushed.Add(int64(len(batch)))
+	w.metrics.QueueDepth.Set(w.pending.Add(-int64(len(batch))) + int64(queued))
+}
+
+func (w *BatchWorker[T]) drop(batch []T, queued int) {
+	if len(batch) == 0 {
+		return
+	}
+	w.metrics.Dropped.Add(int64(len(batch)))
+	w.metrics.QueueDepth.Set(w.pending.Add(-int64(len(batch))) + int64(queued))
+}
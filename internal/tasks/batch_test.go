@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]int
+	fails   int
+}
+
+func (r *recorder) flush(_ context.Context, batch []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fails > 0 {
+		r.fails--
+		return errors.New("storage unavailable")
+	}
+	r.batches = append(r.batches, append([]int(nil), batch...))
+	return nil
+}
+
+func (r *recorder) items() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []int
+	for _, batch := range r.batches {
+		result = append(result, batch...)
+	}
+	return result
+}
+
+func TestBatchWorkerFlushesFullBatch(t *testing.T) {
+	r := &recorder{}
+	w := NewBatchWorker(BatchConfig{BatchSize: 2, MaxLatency: time.Hour}, r.flush)
+	in := make(chan int)
+	done := make(chan struct{})
+	go func() {
+		w.Run(context.Background(), in)
+		close(done)
+	}()
+
+	in <- 1
+	in <- 2
+	in <- 3
+	assert.Eventually(t, func() bool { return len(r.items()) == 2 }, time.Second, 10*time.Millisecond)
+
+	close(in)
+	<-done
+	assert.Equal(t, [][]int{{1, 2}, {3}}, r.batches)
+	assert.Equal(t, int64(3), w.Metrics().Flushed.Value())
+	assert.Equal(t, int64(2), w.Metrics().Flushes.Value())
+	assert.Equal(t, int64(0), w.Metrics().QueueDepth.Value())
+}
+
+func TestBatchWorkerFlushesByTicker(t *testing.T) {
+	r := &recorder{}
+	w := NewBatchWorker(BatchConfig{BatchSize: 100, MaxLatency: 10 * time.Millisecond}, r.flush)
+	in := make(chan int)
+	go w.Run(context.Background(), in)
+	defer close(in)
+
+	in <- 1
+	assert.Eventually(t, func() bool { return len(r.items()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestBatchWorkerRetries(t *testing.T) {
+	r := &recorder{fails: 2}
+	w := NewBatchWorker(BatchConfig{BatchSize: 1, Retries: 2, RetryBackoff: time.Millisecond}, r.flush)
+	in := make(chan int, 1)
+	in <- 1
+	close(in)
+	w.Run(context.Background(), in)
+
+	assert.Equal(t, []int{1}, r.items())
+	assert.Equal(t, int64(2), w.Metrics().Retries.Value())
+	assert.Equal(t, int64(0), w.Metrics().Dropped.Value())
+
+	r = &recorder{fails: 3}
+	w = NewBatchWorker(BatchConfig{BatchSize: 1, Retries: 2, RetryBackoff: time.Millisecond}, r.flush)
+	in = make(chan int, 1)
+	in <- 1
+	close(in)
+	w.Run(context.Background(), in)
+
+	assert.Empty(t, r.items())
+	assert.Equal(t, int64(1), w.Metrics().Dropped.Value())
+}
+
+func TestBatchWorkerCancel(t *testing.T) {
+	r := &recorder{}
+	w := NewBatchWorker(BatchConfig{BatchSize: 100, MaxLatency: time.Hour, Workers: 3}, r.flush)
+	in := make(chan int)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, in)
+		close(done)
+	}()
+
+	in <- 1
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "worker did not stop")
+	}
+	assert.Empty(t, r.items())
+	assert.Equal(t, int64(1), w.Metrics().Dropped.Value())
+}
+
+func TestBatchWorkerPublish(t *testing.T) {
+	w := NewBatchWorker(BatchConfig{}, (&recorder{}).flush)
+	w.Publish("test")
+	w.Metrics().Flushed.Add(5)
+	assert.Contains(t, published.Get("test").String(), `"flushed": 5`)
+}
@@ -1,63 +1,199 @@
-// Package tasks - отложенная таска для удаления ссылок
+// Package tasks - фоновые задачи: очередь удаления ссылок и планировщик периодических задач
 package tasks
 
 import (
 	"context"
-	"fmt"
+	"sync"
+	"time"
 
-	"github.com/wellywell/shorturl/internal/storage"
 	"go.uber.org/zap"
+
+	"github.com/wellywell/shorturl/internal/storage"
 )
 
-// Storage - интерфейс хранилища, требуемый здесь
+// Storage - интерфейс хранилища, требуемый здесь. Задания на удаление хранятся в нём же
+// и переживают перезапуск сервиса
 type Storage interface {
-	DeleteBatch(ctx context.Context, records ...storage.ToDelete) error
+	DeleteBatch(ctx context.Context, records ...storage.ToDelete) ([]storage.DeleteResult, error)
+	AddDeleteJob(ctx context.Context, job storage.DeleteJob) (storage.DeleteJob, error)
+	ClaimDeleteJobs(ctx context.Context, limit int, lockedUntil time.Time, maxAttempts int) ([]storage.DeleteJob, []storage.DeleteJob, error)
+	CompleteDeleteJobs(ctx context.Context, jobs ...storage.DeleteJob) error
+	GetDeleteJob(ctx context.Context, userID int, id int) (storage.DeleteJob, error)
+}
+
+// DeleteQueueConfig параметры DeleteQueue. BatchSize считается в заданиях, а не в ссылках
+type DeleteQueueConfig struct {
+	BatchConfig
+	// PollInterval как часто хранилище проверяется на новые задания, кроме созданных этим процессом
+	PollInterval time.Duration
+	// Lease на сколько задание блокируется обработчиком. Если за это время оно не выполнено,
+	// например процесс упал, задание заберёт другой обработчик
+	Lease time.Duration
+	// MaxAttempts сколько раз задание забирается обработчиком, прежде чем оно будет отмечено failed
+	MaxAttempts int
+}
+
+// DefaultDeleteQueueConfig параметры по умолчанию
+var DefaultDeleteQueueConfig = DeleteQueueConfig{
+	BatchConfig:  DefaultBatchConfig,
+	PollInterval: time.Second,
+	Lease:        5 * time.Minute,
+	MaxAttempts:  10,
 }
 
-// DeleteWorker - функция, читающая задания на удаление ссылок и удаляющая их
-func DeleteWorker(tasks <-chan storage.ToDelete, store Storage) {
+// DeleteQueue очередь заданий на удаление ссылок в хранилище. Задание выполняется хотя бы один раз:
+// удаление ссылки идемпотентно, поэтому повтор после сбоя безопасен
+type DeleteQueue struct {
+	store  Storage
+	config DeleteQueueConfig
+	worker *BatchWorker[storage.DeleteJob]
 
-	logger, err := zap.NewDevelopment()
+	wake      chan struct{}
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDeleteQueue создаёт DeleteQueue. Нулевые параметры config заменяются значениями по умолчанию
+func NewDeleteQueue(store Storage, config DeleteQueueConfig) *DeleteQueue {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultDeleteQueueConfig.PollInterval
+	}
+	if config.Lease <= 0 {
+		config.Lease = DefaultDeleteQueueConfig.Lease
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultDeleteQueueConfig.MaxAttempts
+	}
+	q := &DeleteQueue{
+		store:  store,
+		config: config,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	q.worker = NewBatchWorker(config.BatchConfig, q.delete)
+	q.config.BatchConfig = q.worker.config
+	return q
+}
+
+// SetLogger задаёт логгер обработчика очереди
+func (q *DeleteQueue) SetLogger(logger *zap.SugaredLogger) {
+	q.worker.SetLogger(logger)
+}
+
+// Enqueue сохраняет задание на удаление ссылок пользователя и будит обработчик
+func (q *DeleteQueue) Enqueue(ctx context.Context, userID int, shortURLs ...string) (storage.DeleteJob, error) {
+	job, err := q.store.AddDeleteJob(ctx, storage.DeleteJob{UserID: userID, ShortURLs: shortURLs})
 	if err != nil {
-		return
+		return storage.DeleteJob{}, err
 	}
-	defer func() {
-		err := logger.Sync()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
 
-	sugar := logger.Sugar()
+// Delete сразу удаляет ссылки пользователя, минуя очередь, и возвращает результат по каждой
+func (q *DeleteQueue) Delete(ctx context.Context, userID int, shortURLs ...string) ([]storage.DeleteResult, error) {
+	records := make([]storage.ToDelete, len(shortURLs))
+	for i, shortURL := range shortURLs {
+		records[i] = storage.ToDelete{UserID: userID, ShortURL: shortURL}
+	}
+	return q.store.DeleteBatch(ctx, records...)
+}
 
-	sugar.Infoln("Started delete worker...")
+// Job возвращает задание на удаление, созданное пользователем
+func (q *DeleteQueue) Job(ctx context.Context, userID int, id int) (storage.DeleteJob, error) {
+	return q.store.GetDeleteJob(ctx, userID, id)
+}
 
-	flushSize := 100
+// Worker обработчик очереди, для публикации метрик
+func (q *DeleteQueue) Worker() *BatchWorker[storage.DeleteJob] {
+	return q.worker
+}
+
+// Run забирает задания из хранилища и выполняет их, пока не вызван Close, затем дожидается
+// выполнения уже забранных заданий. При отмене ctx завершается сразу, забранные задания
+// выполнит другой обработчик после истечения Lease
+func (q *DeleteQueue) Run(ctx context.Context) {
+	jobs := make(chan storage.DeleteJob)
+	done := make(chan struct{})
+	go func() {
+		q.worker.Run(ctx, jobs)
+		close(done)
+	}()
+
+	q.poll(ctx, jobs)
+	close(jobs)
+	<-done
+}
+
+// Close прекращает забирать новые задания. Оставшиеся задания сохранены в хранилище
+func (q *DeleteQueue) Close() {
+	q.closeOnce.Do(func() {
+		close(q.stop)
+	})
+}
 
-	var buffer []storage.ToDelete
+func (q *DeleteQueue) poll(ctx context.Context, jobs chan<- storage.DeleteJob) {
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
 
+	limit := q.config.BatchSize * q.config.Workers
 	for {
 		select {
-		case task := <-tasks:
-			sugar.Infof("Got record to delete %v", task)
-			buffer = append(buffer, task)
-
-			if len(buffer) == flushSize {
-				err := store.DeleteBatch(context.Background(), buffer...)
-				if err != nil {
-					sugar.Error(err.Error())
-				}
-				buffer = nil
-			}
+		case <-q.stop:
+			return
 		default:
-			// новых задач нет, выполним текущие
-			if len(buffer) > 0 {
-				err := store.DeleteBatch(context.Background(), buffer...)
-				if err != nil {
-					sugar.Error(err.Error())
-				}
-				buffer = nil
+		}
+
+		claimed, failed, err := q.store.ClaimDeleteJobs(ctx, limit, time.Now().Add(q.config.Lease), q.config.MaxAttempts)
+		if err != nil {
+			q.worker.logger.Errorln("could not claim delete jobs", err)
+		}
+		for _, job := range failed {
+			q.worker.logger.Errorw("delete job failed", "job", job.ID, "attempts", job.Attempts)
+		}
+		for _, job := range claimed {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
 			}
 		}
+		// забрали полную пачку - возможно, в хранилище есть ещё
+		if len(claimed) == limit {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// delete удаляет ссылки из пачки заданий и отмечает задания выполненными вместе с результатами.
+// При повторном выполнении после сбоя ссылки, удалённые в первый раз, получат результат already_deleted
+func (q *DeleteQueue) delete(ctx context.Context, jobs []storage.DeleteJob) error {
+	var records []storage.ToDelete
+	for _, job := range jobs {
+		for _, shortURL := range job.ShortURLs {
+			records = append(records, storage.ToDelete{UserID: job.UserID, ShortURL: shortURL})
+		}
+	}
+	results, err := q.store.DeleteBatch(ctx, records...)
+	if err != nil {
+		return err
+	}
+	done := make([]storage.DeleteJob, len(jobs))
+	for i, job := range jobs {
+		job.Results, results = results[:len(job.ShortURLs)], results[len(job.ShortURLs):]
+		done[i] = job
 	}
+	return q.store.CompleteDeleteJobs(ctx, done...)
 }
@@ -0,0 +1,144 @@
+package tasks
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestDeleteQueueRetriesExpiredLease(t *testing.T) {
+	st := storage.NewMemory()
+	ctx := context.Background()
+	require.NoError(t, st.Put(ctx, "abc", "http://example.com", 1))
+
+	queue := NewDeleteQueue(st, DeleteQueueConfig{PollInterval: 10 * time.Millisecond, Lease: time.Minute})
+	job, err := queue.Enqueue(ctx, 1, "abc")
+	require.NoError(t, err)
+
+	// другой обработчик забрал задание и упал, не выполнив его
+	claimed, _, err := st.ClaimDeleteJobs(ctx, 10, time.Now().Add(50*time.Millisecond), 0)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	go queue.Run(ctx)
+	defer queue.Close()
+
+	assert.Eventually(t, func() bool {
+		job, err = queue.Job(ctx, 1, job.ID)
+		return err == nil && job.Status == storage.DeleteJobDone
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, job.Attempts)
+
+	_, err = st.Get(ctx, "abc")
+	var deleted *storage.RecordIsDeleted
+	assert.ErrorAs(t, err, &deleted)
+}
+
+func TestDeleteQueueMaxAttempts(t *testing.T) {
+	st := storage.NewMemory()
+	ctx := context.Background()
+	require.NoError(t, st.Put(ctx, "abc", "http://example.com", 1))
+
+	queue := NewDeleteQueue(st, DeleteQueueConfig{PollInterval: 10 * time.Millisecond, Lease: time.Minute, MaxAttempts: 2})
+	job, err := queue.Enqueue(ctx, 1, "abc")
+	require.NoError(t, err)
+
+	// задание дважды забирали обработчики, которые упали, не выполнив его
+	for i := 0; i < 2; i++ {
+		claimed, _, err := st.ClaimDeleteJobs(ctx, 10, time.Now(), 2)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+	}
+
+	go queue.Run(ctx)
+	defer queue.Close()
+
+	assert.Eventually(t, func() bool {
+		job, err = queue.Job(ctx, 1, job.ID)
+		return err == nil && job.Status == storage.DeleteJobFailed
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, job.Attempts)
+	require.NotNil(t, job.DoneAt)
+
+	// ссылка не удалена, а задание больше не забирается
+	_, err = st.Get(ctx, "abc")
+	assert.NoError(t, err)
+	claimed, failed, err := st.ClaimDeleteJobs(ctx, 10, time.Now(), 2)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+	assert.Empty(t, failed)
+
+	// завершённые задания удаляются после срока хранения
+	purged, err := st.PurgeDeleteJobs(ctx, job.DoneAt.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = queue.Job(ctx, 1, job.ID)
+	var notFound *storage.KeyNotFoundError
+	assert.ErrorAs(t, err, &notFound)
+}
+
+func TestDeleteQueueFileJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	ctx := context.Background()
+
+	st, err := storage.NewFileMemory(path, storage.NewMemory())
+	require.NoError(t, err)
+	queue := NewDeleteQueue(st, DefaultDeleteQueueConfig)
+	running, err := queue.Enqueue(ctx, 1, "abc")
+	require.NoError(t, err)
+	pending, err := queue.Enqueue(ctx, 1, "def")
+	require.NoError(t, err)
+	_, _, err = st.ClaimDeleteJobs(ctx, 1, time.Now().Add(time.Hour), 0)
+	require.NoError(t, err)
+	require.NoError(t, st.Close())
+
+	// после перезапуска незавершённые задания снова ждут обработчика, даже если блокировка не истекла
+	st, err = storage.NewFileMemory(path, storage.NewMemory())
+	require.NoError(t, err)
+	defer st.Close()
+	claimed, _, err := st.ClaimDeleteJobs(ctx, 10, time.Now().Add(time.Hour), 0)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, running.ID, claimed[0].ID)
+	assert.Equal(t, pending.ID, claimed[1].ID)
+	assert.Equal(t, []string{"def"}, claimed[1].ShortURLs)
+}
+
+func TestDeleteQueueJobResults(t *testing.T) {
+	st := storage.NewMemory()
+	ctx := context.Background()
+	require.NoError(t, st.Put(ctx, "abc", "http://example.com/abc", 1))
+	require.NoError(t, st.Put(ctx, "def", "http://example.com/def", 2))
+
+	queue := NewDeleteQueue(st, DeleteQueueConfig{PollInterval: 10 * time.Millisecond})
+	first, err := queue.Enqueue(ctx, 1, "abc", "def")
+	require.NoError(t, err)
+	second, err := queue.Enqueue(ctx, 2, "def", "missing")
+	require.NoError(t, err)
+
+	go queue.Run(ctx)
+	defer queue.Close()
+
+	// результаты пачки раскладываются по заданиям, в которых были ссылки
+	for _, job := range []*storage.DeleteJob{&first, &second} {
+		userID := job.UserID
+		assert.Eventually(t, func() bool {
+			*job, err = queue.Job(ctx, userID, job.ID)
+			return err == nil && job.Status == storage.DeleteJobDone
+		}, time.Second, 10*time.Millisecond)
+	}
+	assert.Equal(t, []storage.DeleteResult{
+		{ShortURL: "abc", Status: storage.DeleteDeleted},
+		{ShortURL: "def", Status: storage.DeleteNotOwner},
+	}, first.Results)
+	assert.Equal(t, []storage.DeleteResult{
+		{ShortURL: "def", Status: storage.DeleteDeleted},
+		{ShortURL: "missing", Status: storage.DeleteNotFound},
+	}, second.Results)
+}
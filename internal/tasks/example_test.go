@@ -1,13 +1,41 @@
 package tasks
 
-import "github.com/wellywell/shorturl/internal/storage"
+import (
+	"context"
+	"fmt"
 
-func Example() {
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func ExampleDeleteQueue() {
 	st := storage.NewMemory()
+	_ = st.Put(context.Background(), "abc", "http://example.com", 1)
+
+	queue := NewDeleteQueue(st, DefaultDeleteQueueConfig)
+	done := make(chan struct{})
+	go func() {
+		queue.Run(context.Background())
+		close(done)
+	}()
+
+	job, err := queue.Enqueue(context.Background(), 1, "abc")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(job.Status)
 
-	ch := make(chan storage.ToDelete)
+	// очередь закрывается после того, как задание забрано
+	for job.Status == storage.DeleteJobPending {
+		job, _ = queue.Job(context.Background(), 1, job.ID)
+	}
+	queue.Close()
+	<-done
 
-	go DeleteWorker(ch, st)
+	job, _ = queue.Job(context.Background(), 1, job.ID)
+	fmt.Println(job.Status)
 
 	// Output:
+	// pending
+	// done
 }
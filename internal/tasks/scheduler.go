@@ -0,0 +1,207 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+// ScheduledJob фоновая задача планировщика
+type ScheduledJob struct {
+	// Name имя задачи в конфигурации, журнале запусков и блокировке
+	Name string
+	// Interval период запуска, первый запуск через Interval после старта. Ноль - разовая задача,
+	// которая выполняется один раз сразу после старта
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Locker выбирает реплику, которая выполняет задачу: задача запускается, только если блокировка
+// с её именем получена. unlock снимает блокировку
+type Locker interface {
+	TryLock(ctx context.Context, name string) (unlock func() error, ok bool, err error)
+}
+
+// RunStorage журнал запусков задач
+type RunStorage interface {
+	AddJobRun(ctx context.Context, run storage.JobRun) (storage.JobRun, error)
+}
+
+// LocalLocker блокировки внутри одного процесса, для хранилищ, которые не разделяются между репликами.
+// Не даёт запустить задачу, пока не завершился её предыдущий запуск
+type LocalLocker struct {
+	locked map[string]bool
+	lock   sync.Mutex
+}
+
+// NewLocalLocker инициализирует LocalLocker
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{locked: make(map[string]bool)}
+}
+
+// TryLock захватывает блокировку name, если она свободна
+func (l *LocalLocker) TryLock(ctx context.Context, name string) (func() error, bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.locked[name] {
+		return nil, false, nil
+	}
+	l.locked[name] = true
+	return func() error {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		delete(l.locked, name)
+		return nil
+	}, true, nil
+}
+
+// lockPrefix отделяет блокировки планировщика от других advisory lock в той же базе
+const lockPrefix = "shorturl.scheduler."
+
+// Scheduler запускает фоновые задачи по расписанию. Каждый запуск записывается в журнал
+type Scheduler struct {
+	jobs    []ScheduledJob
+	locker  Locker
+	runs    RunStorage
+	replica string
+	logger  *zap.SugaredLogger
+}
+
+// NewScheduler инициализирует Scheduler
+func NewScheduler(locker Locker, runs RunStorage) *Scheduler {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &Scheduler{
+		locker:  locker,
+		runs:    runs,
+		replica: fmt.Sprintf("%s:%d", host, os.Getpid()),
+		logger:  zap.NewNop().Sugar(),
+	}
+}
+
+// SetLogger задаёт логгер для ошибок задач и журнала запусков
+func (s *Scheduler) SetLogger(logger *zap.SugaredLogger) {
+	s.logger = logger
+}
+
+// Add добавляет задачу
+func (s *Scheduler) Add(job ScheduledJob) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Jobs задачи планировщика
+func (s *Scheduler) Jobs() []ScheduledJob {
+	return s.jobs
+}
+
+// SetIntervals задаёт периоды задач строкой вида "compact=1h,purge=24h". Значение off выключает задачу
+func (s *Scheduler) SetIntervals(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, interval, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("bad job interval %q, want name=duration", item)
+		}
+		name, interval = strings.TrimSpace(name), strings.TrimSpace(interval)
+
+		i := s.indexOf(name)
+		if i < 0 {
+			return fmt.Errorf("unknown job %q", name)
+		}
+		if interval == "off" {
+			s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+			continue
+		}
+		duration, err := time.ParseDuration(interval)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("bad job interval %q, want positive duration or off", item)
+		}
+		s.jobs[i].Interval = duration
+	}
+	return nil
+}
+
+func (s *Scheduler) indexOf(name string) int {
+	for i, job := range s.jobs {
+		if job.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Run запускает задачи и ждёт отмены ctx и завершения начатых запусков
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.schedule(ctx, job)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) schedule(ctx context.Context, job ScheduledJob) {
+	if job.Interval == 0 {
+		s.RunJob(ctx, job)
+		return
+	}
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunJob(ctx, job)
+		}
+	}
+}
+
+// RunJob выполняет задачу, если удалось получить её блокировку, и записывает запуск в журнал.
+// Возвращает false, если задачу выполняет другая реплика
+func (s *Scheduler) RunJob(ctx context.Context, job ScheduledJob) bool {
+	unlock, ok, err := s.locker.TryLock(ctx, lockPrefix+job.Name)
+	if err != nil {
+		s.logger.Errorw("job lock failed", "job", job.Name, "error", err)
+	}
+	if !ok {
+		return false
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			s.logger.Errorw("job unlock failed", "job", job.Name, "error", err)
+		}
+	}()
+
+	run := storage.JobRun{Job: job.Name, Replica: s.replica, Status: storage.JobRunOK, StartedAt: time.Now()}
+	err = job.Run(ctx)
+	run.FinishedAt = time.Now()
+	if err != nil {
+		run.Status = storage.JobRunFailed
+		run.Error = err.Error()
+		s.logger.Errorw("job failed", "job", job.Name, "error", err)
+	}
+
+	// запуск записывается, даже если задачу прервала остановка сервиса
+	if _, err := s.runs.AddJobRun(context.WithoutCancel(ctx), run); err != nil {
+		s.logger.Errorw("could not save job run", "job", job.Name, "error", err)
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/wellywell/shorturl/internal/storage"
+)
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	st := storage.NewMemory()
+	s := NewScheduler(NewLocalLocker(), st)
+
+	var periodic, once atomic.Int32
+	s.Add(ScheduledJob{Name: "periodic", Interval: time.Hour, Run: func(ctx context.Context) error {
+		periodic.Add(1)
+		return nil
+	}})
+	s.Add(ScheduledJob{Name: "once", Run: func(ctx context.Context) error {
+		once.Add(1)
+		return errors.New("boom")
+	}})
+	require.NoError(t, s.SetIntervals("periodic=10ms"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return periodic.Load() >= 2 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, int32(1), once.Load())
+
+	runs, err := st.GetJobRuns(context.Background(), storage.MaxJobRuns)
+	require.NoError(t, err)
+	var failed []storage.JobRun
+	for _, run := range runs {
+		assert.NotEmpty(t, run.Replica)
+		assert.False(t, run.FinishedAt.Before(run.StartedAt))
+		if run.Status == storage.JobRunFailed {
+			failed = append(failed, run)
+		}
+	}
+	require.Len(t, failed, 1)
+	assert.Equal(t, "once", failed[0].Job)
+	assert.Equal(t, "boom", failed[0].Error)
+}
+
+func TestSchedulerSkipsLockedJob(t *testing.T) {
+	st := storage.NewMemory()
+	locker := NewLocalLocker()
+	s := NewScheduler(locker, st)
+	job := ScheduledJob{Name: "purge", Run: func(ctx context.Context) error { return nil }}
+
+	// задачу уже выполняет другой запуск
+	unlock, ok, err := locker.TryLock(context.Background(), lockPrefix+job.Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.False(t, s.RunJob(context.Background(), job))
+
+	require.NoError(t, unlock())
+	assert.True(t, s.RunJob(context.Background(), job))
+	runs, err := st.GetJobRuns(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
+
+func TestSchedulerSetIntervals(t *testing.T) {
+	s := NewScheduler(NewLocalLocker(), storage.NewMemory())
+	s.Add(ScheduledJob{Name: "compact", Interval: time.Hour})
+	s.Add(ScheduledJob{Name: "purge", Interval: time.Hour})
+
+	require.NoError(t, s.SetIntervals("compact=off, purge=30m"))
+	require.Len(t, s.Jobs(), 1)
+	assert.Equal(t, 30*time.Minute, s.Jobs()[0].Interval)
+
+	assert.Error(t, s.SetIntervals("unknown=1h"))
+	assert.Error(t, s.SetIntervals("purge"))
+	assert.Error(t, s.SetIntervals("purge=-1h"))
+}
+
+// failingLocker выдаёт блокировку, которую не удаётся снять
+type failingLocker struct{}
+
+func (failingLocker) TryLock(ctx context.Context, name string) (func() error, bool, error) {
+	return func() error { return errors.New("connection lost") }, true, nil
+}
+
+func TestSchedulerLogsUnlockError(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	s := NewScheduler(failingLocker{}, storage.NewMemory())
+	s.SetLogger(zap.New(core).Sugar())
+
+	assert.True(t, s.RunJob(context.Background(), ScheduledJob{Name: "purge", Run: func(ctx context.Context) error { return nil }}))
+	entries := logs.FilterMessage("job unlock failed").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "purge", entries[0].ContextMap()["job"])
+}